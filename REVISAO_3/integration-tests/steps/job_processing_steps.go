@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -39,6 +40,7 @@ type TestContext struct {
 	sqsClient     *sqs.Client
 	httpClient    *http.Client
 	baseURL       string
+	apiKey        string
 }
 
 func NewTestContext() *TestContext {
@@ -61,9 +63,40 @@ func NewTestContext() *TestContext {
 		sqsClient:    sqs.NewFromConfig(cfg),
 		httpClient:   &http.Client{Timeout: 30 * time.Second},
 		baseURL:      "http://localhost",
+		apiKey:       apiKeyFromEnv(),
 	}
 }
 
+// apiKeyFromEnv is the X-API-Key sent to the services, JMI_API_KEY or the
+// local-dev-key of docker-compose
+func apiKeyFromEnv() string {
+	if key := os.Getenv("JMI_API_KEY"); key != "" {
+		return key
+	}
+	return "local-dev-key"
+}
+
+// get calls a service endpoint with the test's API key
+func (tc *TestContext) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-Key", tc.apiKey)
+	return tc.httpClient.Do(req)
+}
+
+// post sends a JSON body to a service endpoint with the test's API key
+func (tc *TestContext) post(url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", tc.apiKey)
+	return tc.httpClient.Do(req)
+}
+
 func (tc *TestContext) allServicesAreRunning() error {
 	services := map[string]string{
 		"control-m":         "8081",
@@ -77,7 +110,7 @@ func (tc *TestContext) allServicesAreRunning() error {
 
 	for service, port := range services {
 		url := fmt.Sprintf("%s:%s/health", tc.baseURL, port)
-		resp, err := tc.httpClient.Get(url)
+		resp, err := tc.get(url)
 		if err != nil {
 			return fmt.Errorf("service %s is not running: %v", service, err)
 		}
@@ -152,7 +185,7 @@ func (tc *TestContext) iSubmitTheJobToControlM() error {
 	}
 
 	url := fmt.Sprintf("%s:8081/jobs", tc.baseURL)
-	resp, err := tc.httpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	resp, err := tc.post(url, jsonData)
 	if err != nil {
 		return err
 	}
@@ -235,7 +268,7 @@ func (tc *TestContext) theJobShouldAppearInJMIWithStatus(expectedStatus string)
 
 	// Also check the API for backward compatibility
 	url := fmt.Sprintf("%s:8082/jobs", tc.baseURL)
-	resp, err := tc.httpClient.Get(url)
+	resp, err := tc.get(url)
 	if err != nil {
 		return err
 	}
@@ -299,7 +332,7 @@ func (tc *TestContext) theJobShouldBeProcessedByJMWWithStatus(expectedStatus str
 
 	// Also check JMW stats
 	url := fmt.Sprintf("%s:8083/stats", tc.baseURL)
-	resp, err := tc.httpClient.Get(url)
+	resp, err := tc.get(url)
 	if err != nil {
 		return err
 	}
@@ -367,7 +400,7 @@ func (tc *TestContext) theJobShouldBeExecutedByJMRWithStatus(expectedStatus stri
 
 	// Also check JMR stats
 	url := fmt.Sprintf("%s:8084/stats", tc.baseURL)
-	resp, err := tc.httpClient.Get(url)
+	resp, err := tc.get(url)
 	if err != nil {
 		return err
 	}
@@ -445,7 +478,7 @@ func (tc *TestContext) anAdapterShouldBeConfiguredBySPA() error {
 	
 	// Also check the API
 	url := fmt.Sprintf("%s:8086/adapters", tc.baseURL)
-	resp, err := tc.httpClient.Get(url)
+	resp, err := tc.get(url)
 	if err != nil {
 		return err
 	}
@@ -456,12 +489,14 @@ func (tc *TestContext) anAdapterShouldBeConfiguredBySPA() error {
 		return err
 	}
 
-	var adapters []interface{}
-	if err := json.Unmarshal(body, &adapters); err != nil {
+	var page struct {
+		Items []interface{} `json:"adapters"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
 		return err
 	}
 
-	if len(adapters) == 0 {
+	if len(page.Items) == 0 {
 		return fmt.Errorf("no adapters configured")
 	}
 
@@ -487,7 +522,7 @@ func (tc *TestContext) aQueueMessageShouldBeCreatedBySPAQ() error {
 	
 	// Also check the API
 	url := fmt.Sprintf("%s:8087/messages", tc.baseURL)
-	resp, err := tc.httpClient.Get(url)
+	resp, err := tc.get(url)
 	if err != nil {
 		return err
 	}
@@ -498,12 +533,14 @@ func (tc *TestContext) aQueueMessageShouldBeCreatedBySPAQ() error {
 		return err
 	}
 
-	var messages []interface{}
-	if err := json.Unmarshal(body, &messages); err != nil {
+	var page struct {
+		Items []interface{} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
 		return err
 	}
 
-	if len(messages) == 0 {
+	if len(page.Items) == 0 {
 		return fmt.Errorf("no queue messages created")
 	}
 
@@ -545,7 +582,7 @@ func (tc *TestContext) iSubmitAllJobsToControlM() error {
 		}
 
 		url := fmt.Sprintf("%s:8081/jobs", tc.baseURL)
-		resp, err := tc.httpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
+		resp, err := tc.post(url, jsonData)
 		if err != nil {
 			return err
 		}
@@ -310,7 +310,7 @@ func (tc *TestContext) iCallTheHealthEndpointOf(service string) error {
 	}
 
 	url := fmt.Sprintf("%s:%s/health", tc.baseURL, port)
-	resp, err := tc.httpClient.Get(url)
+	resp, err := tc.get(url)
 	if err != nil {
 		return err
 	}
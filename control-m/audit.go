@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	auditActionKey = "auditAction"
+	auditTargetKey = "auditTarget"
+)
+
+// AuditEntry is one append-only record of a mutating call
+type AuditEntry struct {
+	AuditId       string `json:"auditId" dynamodbav:"auditId"`
+	AccountId     string `json:"accountId" dynamodbav:"accountId"`
+	Actor         string `json:"actor" dynamodbav:"actor"`
+	Action        string `json:"action" dynamodbav:"action"`
+	Target        string `json:"target" dynamodbav:"target"`
+	RequestDigest string `json:"requestDigest" dynamodbav:"requestDigest"`
+	Result        string `json:"result" dynamodbav:"result"`
+	StatusCode    int    `json:"statusCode" dynamodbav:"statusCode"`
+	Service       string `json:"service" dynamodbav:"service"`
+	Timestamp     int64  `json:"timestamp" dynamodbav:"timestamp"` // Unix milliseconds, sort key of the GSIs
+	Time          string `json:"time" dynamodbav:"time"`
+}
+
+func (c *ControlMService) auditTableName() string {
+	if c.auditTable == "" {
+		return "audit_log"
+	}
+	return c.auditTable
+}
+
+// newAuditor returns a middleware factory that records every call of the wrapped
+// route once the handler has answered. Handlers name what they acted on with
+// setAuditTarget and may refine the action with setAuditAction.
+func newAuditor(client *dynamodb.Client, tableName, service string) func(action string) gin.HandlerFunc {
+	return func(action string) gin.HandlerFunc {
+		return func(ctx *gin.Context) {
+			body, _ := io.ReadAll(ctx.Request.Body)
+			ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+			digest := sha256.Sum256(body)
+
+			ctx.Next()
+
+			identity := identityFrom(ctx)
+			now := time.Now()
+			entry := AuditEntry{
+				AuditId:       uuid.New().String(),
+				AccountId:     identity.AccountId,
+				Actor:         identity.Subject,
+				Action:        action,
+				Target:        ctx.GetString(auditTargetKey),
+				RequestDigest: "sha256:" + hex.EncodeToString(digest[:]),
+				Result:        "success",
+				StatusCode:    ctx.Writer.Status(),
+				Service:       service,
+				Timestamp:     now.UnixMilli(),
+				Time:          now.Format(time.RFC3339),
+			}
+			if override := ctx.GetString(auditActionKey); override != "" {
+				entry.Action = override
+			}
+			// target and actor are GSI keys, which DynamoDB refuses empty; calls
+			// rejected before the handler named a target are still recorded
+			if entry.Target == "" {
+				entry.Target = ctx.FullPath()
+			}
+			if entry.Actor == "" {
+				entry.Actor = "anonymous"
+			}
+			if entry.StatusCode >= http.StatusBadRequest {
+				entry.Result = "failure"
+			}
+
+			writeAuditEntry(client, tableName, entry)
+		}
+	}
+}
+
+// writeAuditEntry appends the entry; the condition guarantees it never overwrites one
+func writeAuditEntry(client *dynamodb.Client, tableName string, entry AuditEntry) {
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal audit entry: %v", err)
+		return
+	}
+
+	_, err = client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String(tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(auditId)"),
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to write audit entry %s %s: %v", entry.Action, entry.Target, err)
+	}
+}
+
+func setAuditTarget(ctx *gin.Context, target string) {
+	ctx.Set(auditTargetKey, target)
+}
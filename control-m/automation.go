@@ -0,0 +1,807 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// The Automation API facade accepts the subset of the BMC Control-M Automation
+// API used by our upstream tooling and maps it onto JMI: each job of a deployed
+// folder runs the JMI routine of the same name, with the job's variables as
+// execution parameters.
+
+// Control-M job statuses reported by run/status
+const (
+	CtmStatusWaitCondition = "Wait Condition"
+	CtmStatusExecuting     = "Executing"
+	CtmStatusEndedOK       = "Ended OK"
+	CtmStatusEndedNotOK    = "Ended Not OK"
+)
+
+const (
+	defaultCtmServer = "workbench"
+	ctmTimeLayout    = "20060102150405"
+)
+
+// Run states: a run is stored as starting before its first job is ordered in
+// JMI and turns ordered once every job was tried, so every execution an order
+// makes is on record even when the order stops midway
+const (
+	runStateStarting = "starting"
+	runStateOrdered  = "ordered"
+)
+
+// orderInterruptedAfter is how long a run may stay starting; run/status then
+// ends the jobs its order never reached
+const orderInterruptedAfter = 5 * time.Minute
+
+var (
+	errFolderNotFound = errors.New("folder not found")
+	errRunNotFound    = errors.New("run not found")
+)
+
+// AutomationJob is one job of a deployed folder
+type AutomationJob struct {
+	Name        string                 `json:"name" dynamodbav:"name"`
+	Type        string                 `json:"type" dynamodbav:"type"`
+	Description string                 `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	Host        string                 `json:"host,omitempty" dynamodbav:"host,omitempty"`
+	Application string                 `json:"application,omitempty" dynamodbav:"application,omitempty"`
+	Variables   map[string]interface{} `json:"variables,omitempty" dynamodbav:"variables,omitempty"`
+}
+
+// AutomationFolder is a deployed folder with its original definition
+type AutomationFolder struct {
+	AccountId      string          `json:"account_id" dynamodbav:"account_id"`
+	Folder         string          `json:"folder" dynamodbav:"folder"`
+	ControlmServer string          `json:"controlm_server,omitempty" dynamodbav:"controlm_server,omitempty"`
+	Jobs           []AutomationJob `json:"jobs" dynamodbav:"jobs"`
+	Definition     string          `json:"definition" dynamodbav:"definition"`
+	DeployedBy     string          `json:"deployed_by" dynamodbav:"deployed_by"`
+	DeployedAt     time.Time       `json:"deployed_at" dynamodbav:"deployed_at"`
+}
+
+// AutomationRunJob is an ordered job and the JMI execution of its latest run
+type AutomationRunJob struct {
+	JobId          string                 `json:"job_id" dynamodbav:"job_id"`
+	Name           string                 `json:"name" dynamodbav:"name"`
+	Type           string                 `json:"type" dynamodbav:"type"`
+	Description    string                 `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	Host           string                 `json:"host,omitempty" dynamodbav:"host,omitempty"`
+	Application    string                 `json:"application,omitempty" dynamodbav:"application,omitempty"`
+	Parameters     map[string]interface{} `json:"parameters,omitempty" dynamodbav:"parameters,omitempty"`
+	NumberOfRuns   int                    `json:"number_of_runs" dynamodbav:"number_of_runs"`
+	ExecutionUuid  string                 `json:"execution_uuid,omitempty" dynamodbav:"execution_uuid,omitempty"`
+	RoutineVersion int                    `json:"routine_version,omitempty" dynamodbav:"routine_version,omitempty"`
+	Status         string                 `json:"status" dynamodbav:"status"`
+	Error          string                 `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	StartTime      string                 `json:"start_time,omitempty" dynamodbav:"start_time,omitempty"`
+	EndTime        string                 `json:"end_time,omitempty" dynamodbav:"end_time,omitempty"`
+}
+
+// ended reports whether the job's latest run is over
+func (j *AutomationRunJob) ended() bool {
+	return j.Status == CtmStatusEndedOK || j.Status == CtmStatusEndedNotOK
+}
+
+// AutomationRun is one run/order of a folder
+type AutomationRun struct {
+	RunId     string             `json:"run_id" dynamodbav:"run_id"`
+	AccountId string             `json:"account_id" dynamodbav:"account_id"`
+	Ctm       string             `json:"ctm" dynamodbav:"ctm"`
+	Folder    string             `json:"folder" dynamodbav:"folder"`
+	OrderDate string             `json:"order_date" dynamodbav:"order_date"`
+	OrderedBy string             `json:"ordered_by" dynamodbav:"ordered_by"`
+	CreatedAt time.Time          `json:"created_at" dynamodbav:"created_at"`
+	State     string             `json:"state,omitempty" dynamodbav:"state,omitempty"` // Empty on runs stored before states
+	Jobs      []AutomationRunJob `json:"jobs" dynamodbav:"jobs"`
+}
+
+// OrderRequest is the body of POST /automation-api/run/order. Jobs is a
+// comma-separated list of job names or wildcard patterns; empty orders them all.
+type OrderRequest struct {
+	Ctm       string                   `json:"ctm"`
+	Folder    string                   `json:"folder"`
+	Jobs      string                   `json:"jobs,omitempty"`
+	Variables []map[string]interface{} `json:"variables,omitempty"`
+}
+
+// jobDefinition is the part of a Control-M job definition the facade reads
+type jobDefinition struct {
+	Type        string                   `json:"Type"`
+	Description string                   `json:"Description"`
+	Host        string                   `json:"Host"`
+	Application string                   `json:"Application"`
+	Variables   []map[string]interface{} `json:"Variables"`
+}
+
+// automationError answers in the Automation API error format
+func automationError(ctx *gin.Context, status int, message string) {
+	ctx.JSON(status, gin.H{"errors": []gin.H{{"message": message}}})
+}
+
+func (c *ControlMService) folderTableName() string {
+	if c.folderTable == "" {
+		return "controlm_folders"
+	}
+	return c.folderTable
+}
+
+func (c *ControlMService) runTableName() string {
+	if c.runTable == "" {
+		return "controlm_runs"
+	}
+	return c.runTable
+}
+
+// mergeVariables flattens Control-M's list of single-entry variable objects
+// into parameters, dropping the %% prefix of variable names
+func mergeVariables(parameters map[string]interface{}, variables []map[string]interface{}) map[string]interface{} {
+	if parameters == nil {
+		parameters = make(map[string]interface{})
+	}
+	for _, variable := range variables {
+		for name, value := range variable {
+			parameters[strings.TrimPrefix(name, "%%")] = value
+		}
+	}
+	return parameters
+}
+
+// parseDefinitions reads a Control-M definitions file into folders. Top-level
+// objects of Type Folder or SimpleFolder are folders; their members whose Type
+// starts with "Job:" are jobs.
+func parseDefinitions(data []byte) ([]AutomationFolder, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return nil, fmt.Errorf("definitions must be a JSON object: %v", err)
+	}
+
+	names := make([]string, 0, len(top))
+	for name := range top {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var folders []AutomationFolder
+	for _, name := range names {
+		if name == "Defaults" {
+			continue
+		}
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(top[name], &members); err != nil {
+			return nil, fmt.Errorf("%s must be an object", name)
+		}
+		var folderType, server string
+		json.Unmarshal(members["Type"], &folderType)
+		json.Unmarshal(members["ControlmServer"], &server)
+		if folderType != "Folder" && folderType != "SimpleFolder" {
+			return nil, fmt.Errorf("%s: only Folder and SimpleFolder objects are supported, got %q", name, folderType)
+		}
+
+		folder := AutomationFolder{Folder: name, ControlmServer: server, Definition: string(top[name])}
+		for member, raw := range members {
+			var job jobDefinition
+			if json.Unmarshal(raw, &job) != nil || !strings.HasPrefix(job.Type, "Job:") {
+				continue
+			}
+			folder.Jobs = append(folder.Jobs, AutomationJob{
+				Name:        member,
+				Type:        strings.TrimPrefix(job.Type, "Job:"),
+				Description: job.Description,
+				Host:        job.Host,
+				Application: job.Application,
+				Variables:   mergeVariables(nil, job.Variables),
+			})
+		}
+		if len(folder.Jobs) == 0 {
+			return nil, fmt.Errorf("folder %s has no jobs", name)
+		}
+		sort.Slice(folder.Jobs, func(a, b int) bool {
+			return folder.Jobs[a].Name < folder.Jobs[b].Name
+		})
+		folders = append(folders, folder)
+	}
+	if len(folders) == 0 {
+		return nil, errors.New("definitions contain no folders")
+	}
+	return folders, nil
+}
+
+// getFolder loads one of the account's deployed folders
+func (c *ControlMService) getFolder(accountId, name string) (*AutomationFolder, error) {
+	result, err := c.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(c.folderTableName()),
+		Key: map[string]types.AttributeValue{
+			"account_id": &types.AttributeValueMemberS{Value: accountId},
+			"folder":     &types.AttributeValueMemberS{Value: name},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errFolderNotFound
+	}
+
+	var folder AutomationFolder
+	if err := attributevalue.UnmarshalMap(result.Item, &folder); err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// getRun loads one of the account's runs
+func (c *ControlMService) getRun(accountId, runId string) (*AutomationRun, error) {
+	result, err := c.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(c.runTableName()),
+		Key: map[string]types.AttributeValue{
+			"run_id": &types.AttributeValueMemberS{Value: runId},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errRunNotFound
+	}
+
+	var run AutomationRun
+	if err := attributevalue.UnmarshalMap(result.Item, &run); err != nil {
+		return nil, err
+	}
+	if run.AccountId != accountId {
+		return nil, errRunNotFound
+	}
+	return &run, nil
+}
+
+func (c *ControlMService) putRun(run *AutomationRun) error {
+	item, err := attributevalue.MarshalMap(run)
+	if err != nil {
+		return err
+	}
+	_, err = c.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(c.runTableName()),
+		Item:      item,
+	})
+	return err
+}
+
+// jobIdFor builds the Control-M job id of the nth job of a run, "<ctm>:<runId>.<n>"
+func jobIdFor(ctm, runId string, n int) string {
+	return fmt.Sprintf("%s:%s.%d", ctm, runId, n)
+}
+
+// runIdOf extracts the run id from a job id
+func runIdOf(jobId string) (string, bool) {
+	_, rest, found := strings.Cut(jobId, ":")
+	if !found {
+		return "", false
+	}
+	dot := strings.LastIndex(rest, ".")
+	if dot <= 0 {
+		return "", false
+	}
+	return rest[:dot], true
+}
+
+// loadRunOfJob resolves a job id to its run and job, answering the error itself
+func (c *ControlMService) loadRunOfJob(ctx *gin.Context) (*AutomationRun, *AutomationRunJob) {
+	jobId := ctx.Param("jobId")
+	runId, ok := runIdOf(jobId)
+	if ok {
+		run, err := c.getRun(identityFrom(ctx).AccountId, runId)
+		if err != nil && !errors.Is(err, errRunNotFound) {
+			log.Printf("Error loading run %s: %v", runId, err)
+			automationError(ctx, http.StatusInternalServerError, "Failed to load job "+jobId)
+			return nil, nil
+		}
+		if run != nil {
+			for i := range run.Jobs {
+				if run.Jobs[i].JobId == jobId {
+					return run, &run.Jobs[i]
+				}
+			}
+		}
+	}
+	automationError(ctx, http.StatusNotFound, "Job "+jobId+" not found")
+	return nil, nil
+}
+
+// startRunJob starts the job's next run in JMI, retaking it when retake is set
+func (c *ControlMService) startRunJob(ctx *gin.Context, job *AutomationRunJob, retake map[string]interface{}) error {
+	request := gin.H{"executionName": job.Name}
+	if len(job.Parameters) > 0 {
+		request["parameters"] = job.Parameters
+	}
+	if retake != nil {
+		request["retake"] = retake
+		if job.RoutineVersion > 0 {
+			request["version"] = job.RoutineVersion
+		}
+	}
+
+	body, err := c.jmi.do(ctx.Request.Context(), http.MethodPost, "/startExecution", request, identityFrom(ctx), ctx.Request.Header, "")
+	if err != nil {
+		return err
+	}
+	var started struct {
+		ExecutionUuid  string `json:"executionUuid"`
+		RoutineVersion int    `json:"routineVersion"`
+	}
+	if err := json.Unmarshal(body, &started); err != nil || started.ExecutionUuid == "" {
+		return errors.New("JMI returned no executionUuid")
+	}
+
+	job.NumberOfRuns++
+	job.ExecutionUuid = started.ExecutionUuid
+	job.RoutineVersion = started.RoutineVersion
+	job.Status = CtmStatusWaitCondition
+	job.Error = ""
+	job.StartTime = time.Now().UTC().Format(ctmTimeLayout)
+	job.EndTime = ""
+	return nil
+}
+
+// jmiExecution is the part of JMI's execution detail the facade reads
+type jmiExecution struct {
+	Status    string `json:"status"`
+	StartedAt string `json:"startedAt"`
+	UpdatedAt string `json:"updatedAt"`
+	Tasks     []struct {
+		StepId string `json:"stepId"`
+		Status string `json:"status"`
+	} `json:"tasks"`
+}
+
+func (c *ControlMService) getExecution(ctx *gin.Context, executionUuid string) (*jmiExecution, error) {
+	body, err := c.jmi.do(ctx.Request.Context(), http.MethodGet, "/executions/"+executionUuid, nil, identityFrom(ctx), ctx.Request.Header, "")
+	if err != nil {
+		return nil, err
+	}
+	var execution jmiExecution
+	if err := json.Unmarshal(body, &execution); err != nil {
+		return nil, fmt.Errorf("failed to decode JMI response: %v", err)
+	}
+	return &execution, nil
+}
+
+// ctmTime converts a JMI RFC3339 timestamp to Control-M's YYYYMMDDhhmmss
+func ctmTime(value string) string {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return ""
+	}
+	return parsed.UTC().Format(ctmTimeLayout)
+}
+
+// refreshRunJob reads the job's execution from JMI and reports whether it changed
+func (c *ControlMService) refreshRunJob(ctx *gin.Context, job *AutomationRunJob) bool {
+	if job.ExecutionUuid == "" || job.ended() {
+		return false
+	}
+	execution, err := c.getExecution(ctx, job.ExecutionUuid)
+	if err != nil {
+		log.Printf("Error reading execution %s of job %s: %v", job.ExecutionUuid, job.JobId, err)
+		return false
+	}
+
+	status := CtmStatusWaitCondition
+	switch execution.Status {
+	case "running":
+		status = CtmStatusExecuting
+	case "succeeded":
+		status = CtmStatusEndedOK
+	case "failed", "stopped":
+		status = CtmStatusEndedNotOK
+	}
+	if status == job.Status {
+		return false
+	}
+	job.Status = status
+	if startTime := ctmTime(execution.StartedAt); startTime != "" {
+		job.StartTime = startTime
+	}
+	if job.ended() {
+		job.EndTime = ctmTime(execution.UpdatedAt)
+	}
+	return true
+}
+
+// Deploy stores the folders of a Control-M definitions file, sent as the JSON
+// body or as the definitionsFile part of a multipart form
+func (c *ControlMService) Deploy(ctx *gin.Context) {
+	fileName := "definitions.json"
+	var data []byte
+	var err error
+	if strings.HasPrefix(ctx.ContentType(), "multipart/") {
+		file, header, formErr := ctx.Request.FormFile("definitionsFile")
+		if formErr != nil {
+			automationError(ctx, http.StatusBadRequest, "definitionsFile is required")
+			return
+		}
+		defer file.Close()
+		fileName = header.Filename
+		data, err = io.ReadAll(file)
+	} else {
+		data, err = io.ReadAll(ctx.Request.Body)
+	}
+	if err != nil {
+		automationError(ctx, http.StatusBadRequest, "Failed to read definitions file")
+		return
+	}
+
+	folders, err := parseDefinitions(data)
+	if err != nil {
+		automationError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	identity := identityFrom(ctx)
+	deployed := make([]string, 0, len(folders))
+	jobCount := 0
+	for i := range folders {
+		folder := &folders[i]
+		folder.AccountId = identity.AccountId
+		folder.DeployedBy = identity.Subject
+		folder.DeployedAt = time.Now()
+
+		item, err := attributevalue.MarshalMap(folder)
+		if err == nil {
+			_, err = c.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+				TableName: aws.String(c.folderTableName()),
+				Item:      item,
+			})
+		}
+		if err != nil {
+			log.Printf("Error storing folder %s: %v", folder.Folder, err)
+			automationError(ctx, http.StatusInternalServerError, "Failed to deploy folder "+folder.Folder)
+			return
+		}
+		deployed = append(deployed, folder.Folder)
+		jobCount += len(folder.Jobs)
+	}
+	setAuditTarget(ctx, "folder/"+strings.Join(deployed, ","))
+
+	log.Printf("Control-M deployed folders %v", deployed)
+	ctx.JSON(http.StatusOK, []gin.H{{
+		"deploymentFile":                    fileName,
+		"deploymentState":                   "DEPLOYED_FOLDERS",
+		"deploymentStatus":                  "ENDED_OK",
+		"successfulFoldersCount":            len(deployed),
+		"successfulSmartFoldersCount":       0,
+		"successfulSubFoldersCount":         0,
+		"successfulJobsCount":               jobCount,
+		"successfulConnectionProfilesCount": 0,
+		"successfulDriversCount":            0,
+		"isDeployDescriptorValid":           false,
+		"deployedFolders":                   deployed,
+	}})
+}
+
+// OrderFolder runs the selected jobs of a deployed folder, one JMI execution per job
+func (c *ControlMService) OrderFolder(ctx *gin.Context) {
+	var req OrderRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		automationError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Folder == "" {
+		automationError(ctx, http.StatusBadRequest, "folder is required")
+		return
+	}
+	setAuditTarget(ctx, "folder/"+req.Folder)
+
+	identity := identityFrom(ctx)
+	folder, err := c.getFolder(identity.AccountId, req.Folder)
+	if errors.Is(err, errFolderNotFound) {
+		automationError(ctx, http.StatusNotFound, "Folder "+req.Folder+" is not deployed")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading folder %s: %v", req.Folder, err)
+		automationError(ctx, http.StatusInternalServerError, "Failed to load folder "+req.Folder)
+		return
+	}
+
+	ctm := req.Ctm
+	if ctm == "" {
+		ctm = folder.ControlmServer
+	}
+	if ctm == "" {
+		ctm = defaultCtmServer
+	}
+
+	now := time.Now()
+	run := &AutomationRun{
+		RunId:     uuid.New().String(),
+		AccountId: identity.AccountId,
+		Ctm:       ctm,
+		Folder:    folder.Folder,
+		OrderDate: now.UTC().Format("060102"),
+		OrderedBy: identity.Subject,
+		CreatedAt: now,
+	}
+	for _, job := range folder.Jobs {
+		if !jobSelected(job.Name, req.Jobs) {
+			continue
+		}
+		parameters := make(map[string]interface{}, len(job.Variables))
+		for name, value := range job.Variables {
+			parameters[name] = value
+		}
+		run.Jobs = append(run.Jobs, AutomationRunJob{
+			JobId:       jobIdFor(ctm, run.RunId, len(run.Jobs)+1),
+			Name:        job.Name,
+			Type:        job.Type,
+			Description: job.Description,
+			Host:        job.Host,
+			Application: job.Application,
+			Parameters:  mergeVariables(parameters, req.Variables),
+		})
+	}
+	if len(run.Jobs) == 0 {
+		automationError(ctx, http.StatusBadRequest, "No job of folder "+req.Folder+" matches "+req.Jobs)
+		return
+	}
+
+	// Store the run before anything starts and again after each job, so no
+	// execution is left running without a run that tracks it
+	run.State = runStateStarting
+	if err := c.putRun(run); err != nil {
+		log.Printf("Error storing run %s: %v", run.RunId, err)
+		automationError(ctx, http.StatusInternalServerError, "Failed to store run")
+		return
+	}
+
+	started := 0
+	for i := range run.Jobs {
+		job := &run.Jobs[i]
+		if err := c.startRunJob(ctx, job, nil); err != nil {
+			log.Printf("Error ordering job %s: %v", job.Name, err)
+			job.Status = CtmStatusEndedNotOK
+			job.Error = err.Error()
+		} else {
+			started++
+		}
+
+		if i == len(run.Jobs)-1 {
+			run.State = runStateOrdered
+		}
+		if err := c.putRun(run); err != nil {
+			log.Printf("Error storing run %s: %v", run.RunId, err)
+			c.stopRunJobs(ctx, run)
+			automationError(ctx, http.StatusInternalServerError, "Failed to store run")
+			return
+		}
+	}
+	if started == 0 {
+		automationError(ctx, http.StatusBadGateway, "Failed to order folder "+req.Folder+": "+run.Jobs[0].Error)
+		return
+	}
+
+	log.Printf("Control-M ordered folder %s as run %s with %d jobs", folder.Folder, run.RunId, len(run.Jobs))
+	ctx.JSON(http.StatusOK, gin.H{
+		"runId":     run.RunId,
+		"statusURI": statusURI(ctx, run.RunId),
+	})
+}
+
+// stopRunJobs stops the executions an order started before it failed to record them
+func (c *ControlMService) stopRunJobs(ctx *gin.Context, run *AutomationRun) {
+	for _, job := range run.Jobs {
+		if job.ExecutionUuid == "" || job.ended() {
+			continue
+		}
+		_, err := c.jmi.do(ctx.Request.Context(), http.MethodPost, "/stopExecution", gin.H{
+			"executionName": job.Name,
+			"executionUuid": job.ExecutionUuid,
+		}, identityFrom(ctx), ctx.Request.Header, "")
+		if err != nil {
+			log.Printf("ERROR: Failed to stop execution %s of unrecorded job %s: %v", job.ExecutionUuid, job.JobId, err)
+			continue
+		}
+		log.Printf("Control-M stopped execution %s of unrecorded job %s", job.ExecutionUuid, job.JobId)
+	}
+}
+
+// endInterruptedOrder ends the jobs a run's order never reached once the order
+// has been starting for too long, and reports whether it changed the run
+func endInterruptedOrder(run *AutomationRun, now time.Time) bool {
+	if run.State != runStateStarting || now.Sub(run.CreatedAt) < orderInterruptedAfter {
+		return false
+	}
+	for i := range run.Jobs {
+		if run.Jobs[i].Status == "" {
+			run.Jobs[i].Status = CtmStatusEndedNotOK
+			run.Jobs[i].Error = "order interrupted"
+		}
+	}
+	run.State = runStateOrdered
+	return true
+}
+
+// jobSelected reports whether name matches the comma-separated names or wildcard patterns
+func jobSelected(name, selection string) bool {
+	if strings.TrimSpace(selection) == "" {
+		return true
+	}
+	for _, pattern := range strings.Split(selection, ",") {
+		if matched, _ := path.Match(strings.TrimSpace(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// statusURI is the absolute run/status URL of a run, as Control-M returns it
+func statusURI(ctx *gin.Context, runId string) string {
+	scheme := ctx.GetHeader("X-Forwarded-Proto")
+	if scheme == "" {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/automation-api/run/status/%s", scheme, ctx.Request.Host, runId)
+}
+
+// RunStatus reports the Control-M status of every job of a run
+func (c *ControlMService) RunStatus(ctx *gin.Context) {
+	runId := ctx.Param("runId")
+	run, err := c.getRun(identityFrom(ctx).AccountId, runId)
+	if errors.Is(err, errRunNotFound) {
+		automationError(ctx, http.StatusNotFound, "Run "+runId+" not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading run %s: %v", runId, err)
+		automationError(ctx, http.StatusInternalServerError, "Failed to load run "+runId)
+		return
+	}
+
+	changed := endInterruptedOrder(run, time.Now())
+	for i := range run.Jobs {
+		changed = c.refreshRunJob(ctx, &run.Jobs[i]) || changed
+	}
+	if changed {
+		if err := c.putRun(run); err != nil {
+			log.Printf("Error storing run %s: %v", runId, err)
+		}
+	}
+
+	completion := "Completed"
+	statuses := make([]gin.H, 0, len(run.Jobs))
+	for _, job := range run.Jobs {
+		if !job.ended() {
+			completion = "Executing"
+		}
+		// A job the order has not reached yet waits like a job before its start
+		if job.Status == "" {
+			job.Status = CtmStatusWaitCondition
+		}
+		statuses = append(statuses, gin.H{
+			"jobId":              job.JobId,
+			"folderId":           run.Ctm + ":",
+			"numberOfRuns":       job.NumberOfRuns,
+			"name":               job.Name,
+			"folder":             run.Folder,
+			"type":               job.Type,
+			"status":             job.Status,
+			"held":               false,
+			"deleted":            false,
+			"cyclic":             false,
+			"startTime":          job.StartTime,
+			"endTime":            job.EndTime,
+			"estimatedStartTime": []string{},
+			"estimatedEndTime":   []string{},
+			"orderDate":          run.OrderDate,
+			"ctm":                run.Ctm,
+			"description":        job.Description,
+			"host":               job.Host,
+			"application":        job.Application,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"completion":   completion,
+		"statuses":     statuses,
+		"startIndex":   0,
+		"itemsPerPage": len(statuses),
+		"total":        len(statuses),
+	})
+}
+
+// RerunJob runs an ended job again. A failed run is retaken in JMI from its
+// first failed step on the same routine version; otherwise the routine restarts.
+func (c *ControlMService) RerunJob(ctx *gin.Context) {
+	setAuditTarget(ctx, "job/"+ctx.Param("jobId"))
+	run, job := c.loadRunOfJob(ctx)
+	if job == nil {
+		return
+	}
+	c.refreshRunJob(ctx, job)
+	if !job.ended() {
+		automationError(ctx, http.StatusConflict, "Job "+job.JobId+" is still running; kill it before rerunning")
+		return
+	}
+
+	var retake map[string]interface{}
+	if job.Status == CtmStatusEndedNotOK && job.ExecutionUuid != "" {
+		execution, err := c.getExecution(ctx, job.ExecutionUuid)
+		if err != nil {
+			log.Printf("Error reading execution %s of job %s: %v", job.ExecutionUuid, job.JobId, err)
+		} else {
+			for _, task := range execution.Tasks {
+				if task.Status == "failed" {
+					retake = map[string]interface{}{"fromStepId": task.StepId}
+					break
+				}
+			}
+		}
+	}
+
+	if err := c.startRunJob(ctx, job, retake); err != nil {
+		log.Printf("Error rerunning job %s: %v", job.JobId, err)
+		automationError(ctx, http.StatusBadGateway, "Failed to rerun job "+job.JobId+": "+err.Error())
+		return
+	}
+	if err := c.putRun(run); err != nil {
+		log.Printf("Error storing run %s: %v", run.RunId, err)
+		automationError(ctx, http.StatusInternalServerError, "Failed to store run")
+		return
+	}
+
+	log.Printf("Control-M reran job %s as execution %s", job.JobId, job.ExecutionUuid)
+	ctx.JSON(http.StatusOK, gin.H{"message": "Job '" + job.JobId + "' was rerun"})
+}
+
+// KillJob stops the JMI execution of a running job
+func (c *ControlMService) KillJob(ctx *gin.Context) {
+	setAuditTarget(ctx, "job/"+ctx.Param("jobId"))
+	run, job := c.loadRunOfJob(ctx)
+	if job == nil {
+		return
+	}
+	c.refreshRunJob(ctx, job)
+	if job.ended() || job.ExecutionUuid == "" {
+		automationError(ctx, http.StatusConflict, "Job "+job.JobId+" is not running")
+		return
+	}
+
+	_, err := c.jmi.do(ctx.Request.Context(), http.MethodPost, "/stopExecution", gin.H{
+		"executionName": job.Name,
+		"executionUuid": job.ExecutionUuid,
+	}, identityFrom(ctx), ctx.Request.Header, "")
+	if err != nil {
+		log.Printf("Error killing job %s: %v", job.JobId, err)
+		automationError(ctx, http.StatusBadGateway, "Failed to kill job "+job.JobId+": "+err.Error())
+		return
+	}
+
+	job.Status = CtmStatusEndedNotOK
+	job.Error = "killed"
+	job.EndTime = time.Now().UTC().Format(ctmTimeLayout)
+	if err := c.putRun(run); err != nil {
+		log.Printf("Error storing run %s: %v", run.RunId, err)
+		automationError(ctx, http.StatusInternalServerError, "Failed to store run")
+		return
+	}
+
+	log.Printf("Control-M killed job %s", job.JobId)
+	ctx.JSON(http.StatusOK, gin.H{"message": "Job '" + job.JobId + "' was killed"})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOrderFolderRecordsRunFirst(t *testing.T) {
+	folder := AutomationFolder{
+		AccountId: "acc-a",
+		Folder:    "nightly",
+		Jobs:      []AutomationJob{{Name: "extract", Type: "Job:Command"}, {Name: "load", Type: "Job:Command"}},
+	}
+
+	tests := []struct {
+		name        string
+		failPut     int // 1-based PutItem of the run that fails, 0 for none
+		jmiStatus   int
+		wantStatus  int
+		wantStarts  int
+		wantStops   []string
+		wantPuts    int
+		wantOrdered bool
+	}{
+		{"every job starts", 0, http.StatusOK, http.StatusOK, 2, nil, 3, true},
+		{"run cannot be stored", 1, http.StatusOK, http.StatusInternalServerError, 0, nil, 1, false},
+		{"storage fails after the first job", 2, http.StatusOK, http.StatusInternalServerError, 1, []string{"exec-1"}, 2, false},
+		{"every job fails", 0, http.StatusBadRequest, http.StatusBadGateway, 2, nil, 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var starts int
+			var stops []string
+			jmi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				var body map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&body)
+				switch r.URL.Path {
+				case "/startExecution":
+					starts++
+					w.WriteHeader(tt.jmiStatus)
+					if tt.jmiStatus == http.StatusOK {
+						fmt.Fprintf(w, `{"executionUuid": "exec-%d", "routineVersion": 1}`, starts)
+					} else {
+						fmt.Fprint(w, `{"error": "routine not found"}`)
+					}
+				case "/stopExecution":
+					stops = append(stops, body["executionUuid"].(string))
+					fmt.Fprint(w, `{"status": "stopped"}`)
+				}
+			}))
+			defer jmi.Close()
+
+			puts := 0
+			fake, client := newFakeDynamo(t, func(call dynamoCall) (interface{}, *dynamoError) {
+				switch {
+				case call.Operation == "GetItem" && call.table() == "controlm_folders":
+					return map[string]interface{}{"Item": wireItem(t, folder)}, nil
+				case call.Operation == "PutItem" && call.table() == "controlm_runs":
+					puts++
+					if puts == tt.failPut {
+						return nil, &dynamoError{Type: "InternalServerError"}
+					}
+				}
+				return nil, nil
+			})
+			service := &ControlMService{dynamoClient: client, jmi: testJMIClient(jmi, 1, 100)}
+
+			recorder := requestAs(Identity{Subject: "alice", AccountId: "acc-a", Roles: []string{"operator"}}, func(r *gin.Engine) {
+				r.POST("/automation-api/run/order", service.OrderFolder)
+			}, http.MethodPost, "/automation-api/run/order", `{"ctm": "workbench", "folder": "nightly"}`)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("POST /run/order = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if starts != tt.wantStarts {
+				t.Errorf("started %d executions, want %d", starts, tt.wantStarts)
+			}
+			if fmt.Sprint(stops) != fmt.Sprint(tt.wantStops) {
+				t.Errorf("stopped %v, want %v", stops, tt.wantStops)
+			}
+
+			runs := fake.recorded("PutItem", "controlm_runs")
+			if len(runs) != tt.wantPuts {
+				t.Fatalf("stored the run %d times, want %d", len(runs), tt.wantPuts)
+			}
+			if state := runs[0].value("Item", "state"); state != runStateStarting {
+				t.Errorf("first stored state = %q, want %s before any job starts", state, runStateStarting)
+			}
+			if ordered := runs[len(runs)-1].value("Item", "state") == runStateOrdered; ordered != tt.wantOrdered {
+				t.Errorf("last stored state = %q, want ordered %v", runs[len(runs)-1].value("Item", "state"), tt.wantOrdered)
+			}
+		})
+	}
+}
+
+func TestEndInterruptedOrder(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		state       string
+		age         time.Duration
+		wantChanged bool
+		wantStatus  string // status of the job the order never reached
+	}{
+		{"order still in progress", runStateStarting, time.Minute, false, ""},
+		{"order interrupted", runStateStarting, time.Hour, true, CtmStatusEndedNotOK},
+		{"order finished", runStateOrdered, time.Hour, false, ""},
+		{"run stored before states", "", time.Hour, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := &AutomationRun{
+				State:     tt.state,
+				CreatedAt: now.Add(-tt.age),
+				Jobs: []AutomationRunJob{
+					{JobId: "workbench:r.1", Status: CtmStatusExecuting, ExecutionUuid: "exec-1"},
+					{JobId: "workbench:r.2"},
+				},
+			}
+			if changed := endInterruptedOrder(run, now); changed != tt.wantChanged {
+				t.Errorf("endInterruptedOrder() = %v, want %v", changed, tt.wantChanged)
+			}
+			if run.Jobs[0].Status != CtmStatusExecuting {
+				t.Errorf("started job became %q", run.Jobs[0].Status)
+			}
+			if run.Jobs[1].Status != tt.wantStatus {
+				t.Errorf("unreached job = %q, want %q", run.Jobs[1].Status, tt.wantStatus)
+			}
+		})
+	}
+}
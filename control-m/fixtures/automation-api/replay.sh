@@ -0,0 +1,58 @@
+#!/bin/bash
+# Replays the recorded Automation API calls against the Control-M facade and
+# checks that every answer has the shape of the recorded response (same fields
+# and types; ids, times and statuses naturally differ between runs).
+#
+#   ./replay.sh [http://localhost:8081]
+
+BASE_URL="${1:-${CONTROL_M_URL:-http://localhost:8081}}/automation-api"
+DIR="$(cd "$(dirname "$0")" && pwd)"
+API_KEY="${JMI_API_KEY:-local-dev-key}"
+FAILURES=0
+
+# shape prints the sorted paths and value types of a JSON document
+shape() {
+    jq -c '[paths(scalars) as $p | {path: ($p | map(if type == "number" then 0 else . end) | join(".")), type: (getpath($p) | type)}] | unique'
+}
+
+check() {
+    local name="$1" fixture="$2" answer="$3"
+    if [ "$(echo "$answer" | shape)" == "$(shape < "$DIR/$fixture")" ]; then
+        echo "✓ $name"
+    else
+        echo "✗ $name: answer does not match $fixture"
+        echo "$answer" | jq .
+        FAILURES=$((FAILURES + 1))
+    fi
+}
+
+echo "=== Replaying Automation API fixtures against $BASE_URL ==="
+
+ANSWER=$(curl -s -H "X-API-Key: $API_KEY" -X POST "$BASE_URL/deploy" -F "definitionsFile=@$DIR/definitions.json")
+check "deploy" deploy.response.json "$ANSWER"
+
+ANSWER=$(curl -s -H "X-API-Key: $API_KEY" -X POST "$BASE_URL/run/order" -H "Content-Type: application/json" -d @"$DIR/run-order.request.json")
+check "run/order" run-order.response.json "$ANSWER"
+RUN_ID=$(echo "$ANSWER" | jq -r '.runId // empty')
+
+sleep 5
+ANSWER=$(curl -s -H "X-API-Key: $API_KEY" "$BASE_URL/run/status/$RUN_ID")
+check "run/status" run-status.response.json "$ANSWER"
+JOB_ID=$(echo "$ANSWER" | jq -r '.statuses[] | select(.status != "Ended OK" and .status != "Ended Not OK") | .jobId' | head -1)
+
+if [ -n "$JOB_ID" ]; then
+    ANSWER=$(curl -s -H "X-API-Key: $API_KEY" -X POST "$BASE_URL/run/job/$JOB_ID/kill")
+    check "run/job:kill" kill.response.json "$ANSWER"
+else
+    echo "- run/job:kill skipped: every job already ended"
+    JOB_ID=$(echo "$ANSWER" | jq -r '.statuses[0].jobId')
+fi
+
+ANSWER=$(curl -s -H "X-API-Key: $API_KEY" -X POST "$BASE_URL/run/job/$JOB_ID/rerun")
+check "run/job:rerun" rerun.response.json "$ANSWER"
+
+ANSWER=$(curl -s -H "X-API-Key: $API_KEY" "$BASE_URL/run/status/00000000-0000-0000-0000-000000000000")
+check "errors" error.response.json "$ANSWER"
+
+echo "=== $FAILURES failure(s) ==="
+[ "$FAILURES" -eq 0 ]
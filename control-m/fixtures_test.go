@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordedRunId is the run id in the recorded Automation API responses
+const recordedRunId = "6b0f3c2e-5d1a-4b7e-9f3c-2a8d4e6f1b90"
+
+// fakeTables keeps the items put into the fake DynamoDB, so a later GetItem finds them
+type fakeTables struct {
+	mu    sync.Mutex
+	items map[string][]map[string]interface{}
+}
+
+func (f *fakeTables) handle(call dynamoCall) (interface{}, *dynamoError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch call.Operation {
+	case "PutItem":
+		item, _ := call.Input["Item"].(map[string]interface{})
+		f.items[call.table()] = append(f.items[call.table()], item)
+	case "GetItem":
+		key, _ := call.Input["Key"].(map[string]interface{})
+		// The latest put of an item wins
+		items := f.items[call.table()]
+		for i := len(items) - 1; i >= 0; i-- {
+			matches := true
+			for name, value := range key {
+				if !reflect.DeepEqual(items[i][name], value) {
+					matches = false
+				}
+			}
+			if matches {
+				return map[string]interface{}{"Item": items[i]}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// TestAutomationAPIFixtures replays the recorded calls of fixtures/automation-api
+// through the facade, against a JMI that answers as in the recording, and
+// compares every answer with its recorded response
+func TestAutomationAPIFixtures(t *testing.T) {
+	dir := filepath.Join("fixtures", "automation-api")
+	read := func(name string) []byte {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("ReadFile(%s): %v", name, err)
+		}
+		return data
+	}
+
+	// FIN_EXTRACT ran to the end and FIN_LOAD is still executing when run/status is asked
+	var mu sync.Mutex
+	started := 0
+	jmi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/startExecution":
+			started++
+			fmt.Fprintf(w, `{"executionUuid": "exec-%d", "routineVersion": 1}`, started)
+		case r.URL.Path == "/executions/exec-1":
+			fmt.Fprint(w, `{"status": "succeeded", "startedAt": "2026-10-16T06:00:12Z", "updatedAt": "2026-10-16T06:00:19Z"}`)
+		case strings.HasPrefix(r.URL.Path, "/executions/"):
+			fmt.Fprint(w, `{"status": "running", "startedAt": "2026-10-16T06:00:12Z", "updatedAt": "2026-10-16T06:00:14Z"}`)
+		case r.URL.Path == "/stopExecution":
+			fmt.Fprint(w, `{"status": "stopped"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer jmi.Close()
+
+	tables := &fakeTables{items: make(map[string][]map[string]interface{})}
+	_, client := newFakeDynamo(t, tables.handle)
+	service := &ControlMService{dynamoClient: client, jmi: testJMIClient(jmi, 1, 100)}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set(identityContextKey, Identity{Subject: "alice", AccountId: "acc-a", Roles: []string{"operator"}})
+	})
+	automation := router.Group("/automation-api")
+	automation.POST("/deploy", service.Deploy)
+	automation.POST("/run/order", service.OrderFolder)
+	automation.GET("/run/status/:runId", service.RunStatus)
+	automation.POST("/run/job/:jobId/rerun", service.RerunJob)
+	automation.POST("/run/job/:jobId/kill", service.KillJob)
+
+	var deployForm bytes.Buffer
+	form := multipart.NewWriter(&deployForm)
+	part, _ := form.CreateFormFile("definitionsFile", "definitions.json")
+	part.Write(read("definitions.json"))
+	form.Close()
+
+	runId := ""
+	steps := []struct {
+		name        string
+		method      string
+		path        func() string
+		contentType string
+		body        func() io.Reader
+		fixture     string
+		wantStatus  int
+	}{
+		{"deploy", http.MethodPost, func() string { return "/automation-api/deploy" }, form.FormDataContentType(),
+			func() io.Reader { return &deployForm }, "deploy.response.json", http.StatusOK},
+		{"run/order", http.MethodPost, func() string { return "/automation-api/run/order" }, "application/json",
+			func() io.Reader { return bytes.NewReader(read("run-order.request.json")) }, "run-order.response.json", http.StatusOK},
+		{"run/status", http.MethodGet, func() string { return "/automation-api/run/status/" + runId }, "",
+			nil, "run-status.response.json", http.StatusOK},
+		{"run/job:kill", http.MethodPost, func() string { return "/automation-api/run/job/workbench:" + runId + ".2/kill" }, "",
+			nil, "kill.response.json", http.StatusOK},
+		{"run/job:rerun", http.MethodPost, func() string { return "/automation-api/run/job/workbench:" + runId + ".2/rerun" }, "",
+			nil, "rerun.response.json", http.StatusOK},
+		{"errors", http.MethodGet, func() string { return "/automation-api/run/status/00000000-0000-0000-0000-000000000000" }, "",
+			nil, "error.response.json", http.StatusNotFound},
+	}
+
+	for _, step := range steps {
+		var body io.Reader
+		if step.body != nil {
+			body = step.body()
+		}
+		request := httptest.NewRequest(step.method, step.path(), body)
+		request.Host = "localhost:8081"
+		if step.contentType != "" {
+			request.Header.Set("Content-Type", step.contentType)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		if recorder.Code != step.wantStatus {
+			t.Fatalf("%s answered %d, want %d: %s", step.name, recorder.Code, step.wantStatus, recorder.Body)
+		}
+
+		var answer interface{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &answer); err != nil {
+			t.Fatalf("%s answered invalid JSON: %v", step.name, err)
+		}
+		if object, ok := answer.(map[string]interface{}); ok {
+			if step.name == "run/order" {
+				runId, _ = object["runId"].(string)
+			}
+			// The order date is the day the test runs; the recording was made on 2026-10-16
+			statuses, _ := object["statuses"].([]interface{})
+			for _, status := range statuses {
+				status.(map[string]interface{})["orderDate"] = "261016"
+			}
+		}
+
+		var recorded interface{}
+		if err := json.Unmarshal(bytes.ReplaceAll(read(step.fixture), []byte(recordedRunId), []byte(runId)), &recorded); err != nil {
+			t.Fatalf("%s: invalid fixture: %v", step.fixture, err)
+		}
+		if !reflect.DeepEqual(answer, recorded) {
+			got, _ := json.MarshalIndent(answer, "", "  ")
+			t.Errorf("%s answered\n%s\nwant %s as recorded", step.name, got, step.fixture)
+		}
+	}
+}
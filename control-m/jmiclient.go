@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// errJMIUnavailable is returned without calling JMI while the breaker is open
+var errJMIUnavailable = errors.New("JMI is unavailable, circuit breaker is open")
+
+// JMIError is a non-2xx answer from JMI, kept whole so it can be passed on to the caller
+type JMIError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *JMIError) Error() string {
+	var answer struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(e.Body, &answer) == nil && answer.Error != "" {
+		return fmt.Sprintf("JMI returned status %d: %s", e.StatusCode, answer.Error)
+	}
+	return fmt.Sprintf("JMI returned status %d", e.StatusCode)
+}
+
+// retryable reports whether JMI may answer differently if asked again
+func retryable(status int) bool {
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// inProgress reports whether an answer is JMI's 409 for an Idempotency-Key
+// whose first request is still running, and how long JMI asks to wait. Asked
+// again later, JMI answers with the outcome of that request.
+func inProgress(status int, header http.Header) (time.Duration, bool) {
+	if status != http.StatusConflict || header.Get("Retry-After") == "" {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, true
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// circuitBreaker stops calls to JMI after threshold consecutive failures. Once
+// cooldown has passed a single probe call is let through; its outcome closes
+// the circuit or opens it again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+// allow reports whether a call may go to JMI now
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		log.Printf("JMI circuit breaker half-open, probing JMI")
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// record takes the outcome of a call let through by allow
+func (b *circuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		if b.state != BreakerClosed {
+			log.Printf("JMI circuit breaker closed")
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		if b.state != BreakerOpen {
+			log.Printf("JMI circuit breaker open after %d consecutive failures", b.failures)
+		}
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// abandon releases a call let through by allow without judging JMI by it
+func (b *circuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// retryAfter is how long until the open breaker lets a probe through
+func (b *circuitBreaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != BreakerOpen {
+		return 0
+	}
+	if wait := b.cooldown - time.Since(b.openedAt); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// snapshot describes the breaker for the health check
+func (b *circuitBreaker) snapshot() map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snapshot := map[string]interface{}{
+		"state":               b.state,
+		"consecutiveFailures": b.failures,
+		"threshold":           b.threshold,
+		"cooldownSeconds":     b.cooldown.Seconds(),
+	}
+	if b.state != BreakerClosed {
+		snapshot["openedAt"] = b.openedAt
+	}
+	return snapshot
+}
+
+// jmiClient calls JMI with a deadline per attempt, retries transport errors,
+// 5xx answers and idempotency keys still in progress with jittered exponential
+// backoff, and fails fast while the circuit breaker is open
+type jmiClient struct {
+	baseURL     string
+	http        *http.Client
+	timeout     time.Duration
+	maxAttempts int
+	backoff     time.Duration
+	breaker     *circuitBreaker
+}
+
+// newJMIClient reads the client settings:
+// JMI_TIMEOUT seconds per attempt (default 10), JMI_MAX_ATTEMPTS (default 3),
+// JMI_RETRY_BACKOFF_MS before the first retry, doubled on each one (default 200),
+// JMI_BREAKER_THRESHOLD consecutive failures (default 5) and
+// JMI_BREAKER_COOLDOWN seconds open before probing (default 30)
+func newJMIClient(baseURL string) *jmiClient {
+	number := func(name string, fallback int) int {
+		if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+			return value
+		}
+		return fallback
+	}
+
+	return &jmiClient{
+		baseURL:     baseURL,
+		http:        &http.Client{},
+		timeout:     time.Duration(number("JMI_TIMEOUT", 10)) * time.Second,
+		maxAttempts: number("JMI_MAX_ATTEMPTS", 3),
+		backoff:     time.Duration(number("JMI_RETRY_BACKOFF_MS", 200)) * time.Millisecond,
+		breaker: &circuitBreaker{
+			threshold: number("JMI_BREAKER_THRESHOLD", 5),
+			cooldown:  time.Duration(number("JMI_BREAKER_COOLDOWN", 30)) * time.Second,
+			state:     BreakerClosed,
+		},
+	}
+}
+
+// do sends a request to JMI as the caller and returns the body of a 2xx
+// answer. Other answers are returned as *JMIError. POSTs carry an
+// Idempotency-Key, idempotencyKey or a new one, shared by all attempts so a
+// retry never starts a second execution.
+func (c *jmiClient) do(ctx context.Context, method, path string, payload interface{}, identity Identity, callerHeaders http.Header, idempotencyKey string) ([]byte, error) {
+	var reqBody []byte
+	if payload != nil {
+		var err error
+		if reqBody, err = json.Marshal(payload); err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %v", err)
+		}
+	}
+	if method == http.MethodPost && idempotencyKey == "" {
+		idempotencyKey = uuid.New().String()
+	}
+
+	var lastErr error
+	var retryAfter time.Duration
+	for attempt := 1; attempt <= c.maxAttempts; attempt++ {
+		if attempt > 1 {
+			wait := c.backoff << (attempt - 2)
+			wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+			if wait < retryAfter {
+				wait = retryAfter
+			}
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+
+		if !c.breaker.allow() {
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, errJMIUnavailable
+		}
+
+		status, header, body, err := c.attempt(ctx, method, path, reqBody, identity, callerHeaders, idempotencyKey)
+		if err != nil && ctx.Err() != nil {
+			// The caller gave up, which says nothing about JMI
+			c.breaker.abandon()
+			return nil, err
+		}
+		c.breaker.record(err == nil && status < http.StatusInternalServerError)
+		if err == nil && status < 300 {
+			return body, nil
+		}
+		if err == nil {
+			lastErr = &JMIError{StatusCode: status, Body: body}
+			var pending bool
+			retryAfter, pending = inProgress(status, header)
+			if !retryable(status) && !pending {
+				return nil, lastErr
+			}
+		} else {
+			lastErr = err
+			retryAfter = 0
+		}
+		log.Printf("Control-M: JMI %s %s attempt %d/%d failed: %v", method, path, attempt, c.maxAttempts, lastErr)
+	}
+	return nil, lastErr
+}
+
+// attempt makes one call to JMI within the per-attempt deadline
+func (c *jmiClient) attempt(parent context.Context, method, path string, reqBody []byte, identity Identity, callerHeaders http.Header, idempotencyKey string) (int, http.Header, []byte, error) {
+	ctx, cancel := context.WithTimeout(parent, c.timeout)
+	defer cancel()
+
+	jmiEndpoint := c.baseURL + path
+	log.Printf("Control-M: Calling JMI at %s", jmiEndpoint)
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, jmiEndpoint, bytes.NewReader(reqBody))
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to build JMI request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		httpReq.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	// Forward the caller's credentials so JMI authenticates the same identity,
+	// plus the tenant headers a service key acts for
+	for _, header := range []string{"Authorization", "X-API-Key"} {
+		if value := callerHeaders.Get(header); value != "" {
+			httpReq.Header.Set(header, value)
+		}
+	}
+	httpReq.Header.Set("X-Account-Id", identity.AccountId)
+	httpReq.Header.Set("X-Subject", identity.Subject)
+	if len(identity.Acronyms) > 0 {
+		httpReq.Header.Set("X-Acronyms", strings.Join(identity.Acronyms, ","))
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to call JMI: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to read JMI response: %w", err)
+	}
+	return resp.StatusCode, resp.Header, body, nil
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testJMIClient returns a client for server with short delays
+func testJMIClient(server *httptest.Server, maxAttempts, threshold int) *jmiClient {
+	return &jmiClient{
+		baseURL:     server.URL,
+		http:        server.Client(),
+		timeout:     time.Second,
+		maxAttempts: maxAttempts,
+		backoff:     time.Millisecond,
+		breaker:     &circuitBreaker{threshold: threshold, cooldown: time.Hour, state: BreakerClosed},
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusBadRequest, false},
+		{http.StatusConflict, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, true},
+		{http.StatusNotImplemented, false},
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusGatewayTimeout, true},
+	}
+
+	for _, tt := range tests {
+		if got := retryable(tt.status); got != tt.want {
+			t.Errorf("retryable(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	type step struct {
+		action    string // allow, success, failure, abandon, expire
+		wantAllow bool
+		wantState string
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"closed below the threshold", []step{
+			{"failure", false, BreakerClosed},
+			{"failure", false, BreakerClosed},
+			{"allow", true, BreakerClosed},
+		}},
+		{"success resets the failure count", []step{
+			{"failure", false, BreakerClosed},
+			{"failure", false, BreakerClosed},
+			{"success", false, BreakerClosed},
+			{"failure", false, BreakerClosed},
+			{"failure", false, BreakerClosed},
+			{"allow", true, BreakerClosed},
+		}},
+		{"opens at the threshold", []step{
+			{"failure", false, BreakerClosed},
+			{"failure", false, BreakerClosed},
+			{"failure", false, BreakerOpen},
+			{"allow", false, BreakerOpen},
+		}},
+		{"one probe after the cooldown", []step{
+			{"failure", false, BreakerClosed},
+			{"failure", false, BreakerClosed},
+			{"failure", false, BreakerOpen},
+			{"expire", false, BreakerOpen},
+			{"allow", true, BreakerHalfOpen},
+			{"allow", false, BreakerHalfOpen},
+		}},
+		{"successful probe closes", []step{
+			{"failure", false, BreakerClosed},
+			{"failure", false, BreakerClosed},
+			{"failure", false, BreakerOpen},
+			{"expire", false, BreakerOpen},
+			{"allow", true, BreakerHalfOpen},
+			{"success", false, BreakerClosed},
+			{"allow", true, BreakerClosed},
+		}},
+		{"failed probe opens again", []step{
+			{"failure", false, BreakerClosed},
+			{"failure", false, BreakerClosed},
+			{"failure", false, BreakerOpen},
+			{"expire", false, BreakerOpen},
+			{"allow", true, BreakerHalfOpen},
+			{"failure", false, BreakerOpen},
+			{"allow", false, BreakerOpen},
+		}},
+		{"abandoned probe lets another through", []step{
+			{"failure", false, BreakerClosed},
+			{"failure", false, BreakerClosed},
+			{"failure", false, BreakerOpen},
+			{"expire", false, BreakerOpen},
+			{"allow", true, BreakerHalfOpen},
+			{"abandon", false, BreakerHalfOpen},
+			{"allow", true, BreakerHalfOpen},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := &circuitBreaker{threshold: 3, cooldown: time.Hour, state: BreakerClosed}
+			for i, s := range tt.steps {
+				switch s.action {
+				case "allow":
+					if got := breaker.allow(); got != s.wantAllow {
+						t.Fatalf("step %d: allow() = %v, want %v", i, got, s.wantAllow)
+					}
+				case "success":
+					breaker.record(true)
+				case "failure":
+					breaker.record(false)
+				case "abandon":
+					breaker.abandon()
+				case "expire":
+					breaker.openedAt = breaker.openedAt.Add(-breaker.cooldown)
+				}
+				if breaker.state != s.wantState {
+					t.Fatalf("step %d (%s): state = %s, want %s", i, s.action, breaker.state, s.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerRetryAfter(t *testing.T) {
+	breaker := &circuitBreaker{threshold: 1, cooldown: time.Minute, state: BreakerClosed}
+	if wait := breaker.retryAfter(); wait != 0 {
+		t.Errorf("retryAfter() while closed = %s, want 0", wait)
+	}
+	breaker.record(false)
+	if wait := breaker.retryAfter(); wait <= 0 || wait > time.Minute {
+		t.Errorf("retryAfter() while open = %s, want within the cooldown", wait)
+	}
+	if snapshot := breaker.snapshot(); snapshot["state"] != BreakerOpen || snapshot["openedAt"] == nil {
+		t.Errorf("snapshot() = %v, want open with openedAt", snapshot)
+	}
+}
+
+func TestJMIClientDo(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		statuses     []int // answered in turn; the last one repeats
+		maxAttempts  int
+		threshold    int
+		wantCalls    int
+		wantStatus   int // of the returned *JMIError, 0 on success
+		wantState    string
+		wantFailures int
+	}{
+		{"success", http.MethodPost, []int{200}, 3, 5, 1, 0, BreakerClosed, 0},
+		{"created", http.MethodPost, []int{201}, 3, 5, 1, 0, BreakerClosed, 0},
+		{"retried until success", http.MethodPost, []int{503, 502, 200}, 3, 5, 3, 0, BreakerClosed, 0},
+		{"retries exhausted", http.MethodGet, []int{500}, 3, 5, 3, 500, BreakerClosed, 3},
+		{"client error not retried", http.MethodPost, []int{400}, 3, 5, 1, 400, BreakerClosed, 0},
+		{"conflict not retried", http.MethodPost, []int{409}, 3, 5, 1, 409, BreakerClosed, 0},
+		{"breaker opens mid-call", http.MethodGet, []int{503}, 5, 2, 2, 503, BreakerOpen, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			calls := 0
+			keys := make(map[string]bool)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				status := tt.statuses[len(tt.statuses)-1]
+				if calls < len(tt.statuses) {
+					status = tt.statuses[calls]
+				}
+				calls++
+				keys[r.Header.Get("Idempotency-Key")] = true
+				mu.Unlock()
+				w.WriteHeader(status)
+				w.Write([]byte(`{"error":"from JMI"}`))
+			}))
+			defer server.Close()
+
+			client := testJMIClient(server, tt.maxAttempts, tt.threshold)
+			_, err := client.do(context.Background(), tt.method, "/executions", map[string]string{"executionName": "daily-load"}, Identity{AccountId: "acc-1"}, http.Header{}, "")
+
+			var jmiErr *JMIError
+			switch {
+			case tt.wantStatus == 0 && err != nil:
+				t.Fatalf("do() error = %v, want success", err)
+			case tt.wantStatus != 0 && (!errors.As(err, &jmiErr) || jmiErr.StatusCode != tt.wantStatus):
+				t.Fatalf("do() error = %v, want JMI status %d", err, tt.wantStatus)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("JMI called %d times, want %d", calls, tt.wantCalls)
+			}
+			if client.breaker.state != tt.wantState || client.breaker.failures != tt.wantFailures {
+				t.Errorf("breaker = %s with %d failures, want %s with %d", client.breaker.state, client.breaker.failures, tt.wantState, tt.wantFailures)
+			}
+			// Every attempt of a POST carries the same key
+			if tt.method == http.MethodPost && (len(keys) != 1 || keys[""]) {
+				t.Errorf("Idempotency-Key across attempts = %v, want one key", keys)
+			}
+		})
+	}
+}
+
+func TestInProgress(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		wantWait   time.Duration
+		wantOK     bool
+	}{
+		{"key still in progress", http.StatusConflict, "1", time.Second, true},
+		{"unreadable Retry-After", http.StatusConflict, "soon", 0, true},
+		{"conflict without Retry-After", http.StatusConflict, "", 0, false},
+		{"other status with Retry-After", http.StatusTooManyRequests, "1", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.retryAfter != "" {
+				header.Set("Retry-After", tt.retryAfter)
+			}
+			wait, ok := inProgress(tt.status, header)
+			if wait != tt.wantWait || ok != tt.wantOK {
+				t.Errorf("inProgress() = %v, %v, want %v, %v", wait, ok, tt.wantWait, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestJMIClientWaitsForKeyInProgress(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"error":"A request with this Idempotency-Key is still being processed"}`))
+			return
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"executionUuid":"exec-1"}`))
+	}))
+	defer server.Close()
+
+	client := testJMIClient(server, 3, 5)
+	body, err := client.do(context.Background(), http.MethodPost, "/startExecution", map[string]string{"executionName": "daily-load"}, Identity{AccountId: "acc-1"}, http.Header{}, "key-1")
+	if err != nil {
+		t.Fatalf("do() error = %v, want the first request's answer", err)
+	}
+	if string(body) != `{"executionUuid":"exec-1"}` {
+		t.Errorf("do() = %s, want the replayed answer", body)
+	}
+	if calls != 3 {
+		t.Errorf("JMI called %d times, want 3", calls)
+	}
+	if client.breaker.failures != 0 {
+		t.Errorf("breaker counted %d failures, want none for a key in progress", client.breaker.failures)
+	}
+}
+
+func TestJMIClientOpenBreaker(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer server.Close()
+
+	client := testJMIClient(server, 3, 1)
+	client.breaker.record(false)
+
+	_, err := client.do(context.Background(), http.MethodGet, "/health", nil, Identity{}, http.Header{}, "")
+	if !errors.Is(err, errJMIUnavailable) {
+		t.Errorf("do() error = %v, want errJMIUnavailable", err)
+	}
+	if calls != 0 {
+		t.Errorf("JMI called %d times while the breaker is open", calls)
+	}
+}
+
+func TestJMIClientForwardsHeaders(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	caller := http.Header{}
+	caller.Set("Authorization", "Bearer token")
+	caller.Set("X-Forwarded-For", "10.0.0.1")
+	identity := Identity{Subject: "ops", AccountId: "acc-1", Acronyms: []string{"FIN", "HR"}}
+
+	client := testJMIClient(server, 1, 5)
+	if _, err := client.do(context.Background(), http.MethodPost, "/executions", nil, identity, caller, "key-1"); err != nil {
+		t.Fatalf("do(): %v", err)
+	}
+
+	want := map[string]string{
+		"Authorization":   "Bearer token",
+		"X-Account-Id":    "acc-1",
+		"X-Subject":       "ops",
+		"X-Acronyms":      "FIN,HR",
+		"Idempotency-Key": "key-1",
+		"X-Forwarded-For": "",
+	}
+	for header, value := range want {
+		if got.Get(header) != value {
+			t.Errorf("%s = %q, want %q", header, got.Get(header), value)
+		}
+	}
+}
+
+func TestJMIErrorMessage(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"error":"Routine not found"}`, "JMI returned status 404: Routine not found"},
+		{`not json`, "JMI returned status 404"},
+		{``, "JMI returned status 404"},
+	}
+
+	for _, tt := range tests {
+		err := &JMIError{StatusCode: http.StatusNotFound, Body: []byte(tt.body)}
+		if got := err.Error(); got != tt.want {
+			t.Errorf("Error() for %q = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
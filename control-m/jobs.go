@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// Job states, in pipeline order. A job moves forward as the downstream
+// services pick it up: JMI integrates it, Scheduler Plugin schedules it, SPA
+// adapts the schedule and SPAQ queues and processes the adapter's message.
+const (
+	JobStatusSubmitted  = "submitted"
+	JobStatusFailed     = "failed" // never reached the job queue
+	JobStatusIntegrated = "integrated"
+	JobStatusScheduled  = "scheduled"
+	JobStatusAdapted    = "adapted"
+	JobStatusQueued     = "queued"
+	JobStatusHeld       = "held" // SPAQ holds the message of a paused schedule or disabled adapter
+	JobStatusCompleted  = "completed"
+)
+
+// jobStatusRank orders the states; held and queued share a rank, since a held
+// message is queued once released
+var jobStatusRank = map[string]int{
+	JobStatusSubmitted:  1,
+	JobStatusIntegrated: 2,
+	JobStatusScheduled:  3,
+	JobStatusAdapted:    4,
+	JobStatusQueued:     5,
+	JobStatusHeld:       5,
+	JobStatusCompleted:  6,
+}
+
+var errJobNotFound = errors.New("job not found")
+
+// JobTransition records when a job reached a state
+type JobTransition struct {
+	Status string    `json:"status" dynamodbav:"status"`
+	At     time.Time `json:"at" dynamodbav:"at"`
+}
+
+// terminal reports whether the job can no longer change state
+func (j *JobRequest) terminal() bool {
+	return j.Status == JobStatusCompleted || j.Status == JobStatusFailed
+}
+
+// advance moves the job to status unless it is already further along, and
+// reports whether anything changed
+func (j *JobRequest) advance(status, reason string, now time.Time) bool {
+	if jobStatusRank[status] < jobStatusRank[j.Status] {
+		return false
+	}
+	if status == j.Status && reason == j.StatusReason {
+		return false
+	}
+	if status != j.Status {
+		j.History = append(j.History, JobTransition{Status: status, At: now})
+	}
+	j.Status = status
+	j.StatusReason = reason
+	j.UpdatedAt = now
+	return true
+}
+
+func (c *ControlMService) jobTableName() string {
+	if c.jobTable == "" {
+		return "controlm_jobs"
+	}
+	return c.jobTable
+}
+
+// putJob stores the job
+func (c *ControlMService) putJob(job *JobRequest) error {
+	item, err := attributevalue.MarshalMap(job)
+	if err != nil {
+		return err
+	}
+	_, err = c.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(c.jobTableName()),
+		Item:      item,
+	})
+	return err
+}
+
+// getJob loads one of the account's jobs
+func (c *ControlMService) getJob(accountId, id string) (*JobRequest, error) {
+	result, err := c.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(c.jobTableName()),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errJobNotFound
+	}
+
+	var job JobRequest
+	if err := attributevalue.UnmarshalMap(result.Item, &job); err != nil {
+		return nil, err
+	}
+	if job.AccountId != accountId {
+		return nil, errJobNotFound
+	}
+	return &job, nil
+}
+
+// firstByIndex returns the first item of a downstream table whose index key
+// attribute equals value, or nil
+func (c *ControlMService) firstByIndex(table, index, attribute, value string) (map[string]types.AttributeValue, error) {
+	result, err := c.dynamoClient.Query(context.TODO(), &dynamodb.QueryInput{
+		TableName:              aws.String(table),
+		IndexName:              aws.String(index),
+		KeyConditionExpression: aws.String("#key = :value"),
+		ExpressionAttributeNames: map[string]string{
+			"#key": attribute,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":value": &types.AttributeValueMemberS{Value: value},
+		},
+	})
+	if err != nil || len(result.Items) == 0 {
+		return nil, err
+	}
+	return result.Items[0], nil
+}
+
+// stringAttribute reads a string attribute of a raw item
+func stringAttribute(item map[string]types.AttributeValue, name string) string {
+	if value, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return value.Value
+	}
+	return ""
+}
+
+// trackJob follows the job down the pipeline (JMI job, schedule, adapter,
+// queue message) and advances its status to the furthest stage reached.
+// It reports whether the job changed.
+func (c *ControlMService) trackJob(job *JobRequest) (bool, error) {
+	if job.terminal() {
+		return false, nil
+	}
+	now := time.Now()
+	changed := false
+
+	integrated, err := c.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(envOrDefault("JMI_JOB_TABLE", "jobs")),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: job.ID},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	if integrated.Item != nil {
+		changed = job.advance(JobStatusIntegrated, "", now) || changed
+	}
+
+	schedule, err := c.firstByIndex(envOrDefault("SCHEDULE_TABLE", "schedules"), "job_id-index", "job_id", job.ID)
+	if err != nil || schedule == nil {
+		return changed, err
+	}
+	if job.ScheduleID == "" {
+		job.ScheduleID = stringAttribute(schedule, "id")
+		changed = true
+	}
+	changed = job.advance(JobStatusScheduled, "", now) || changed
+
+	adapter, err := c.firstByIndex(envOrDefault("ADAPTER_TABLE", "adapters"), "schedule_id-index", "schedule_id", job.ScheduleID)
+	if err != nil || adapter == nil {
+		return changed, err
+	}
+	if job.AdapterID == "" {
+		job.AdapterID = stringAttribute(adapter, "id")
+		changed = true
+	}
+	changed = job.advance(JobStatusAdapted, "", now) || changed
+
+	message, err := c.firstByIndex(envOrDefault("QUEUE_MESSAGE_TABLE", "queue_messages"), "adapter_id-index", "adapter_id", job.AdapterID)
+	if err != nil || message == nil {
+		return changed, err
+	}
+	if job.QueueMessageID == "" {
+		job.QueueMessageID = stringAttribute(message, "id")
+		changed = true
+	}
+	switch stringAttribute(message, "status") {
+	case "processed":
+		changed = job.advance(JobStatusCompleted, "", now) || changed
+	case "held":
+		changed = job.advance(JobStatusHeld, stringAttribute(message, "hold_reason"), now) || changed
+	default:
+		changed = job.advance(JobStatusQueued, "", now) || changed
+	}
+	return changed, nil
+}
+
+// refreshJob tracks the job and stores it when it moved
+func (c *ControlMService) refreshJob(job *JobRequest) {
+	changed, err := c.trackJob(job)
+	if err != nil {
+		log.Printf("Error tracking job %s: %v", job.ID, err)
+	}
+	if !changed {
+		return
+	}
+	if err := c.putJob(job); err != nil {
+		log.Printf("Error storing job %s: %v", job.ID, err)
+		return
+	}
+	log.Printf("Control-M job %s is now %s", job.ID, job.Status)
+}
+
+// GetJob returns one of the caller's jobs with its current pipeline status
+func (c *ControlMService) GetJob(ctx *gin.Context) {
+	id := ctx.Param("id")
+	job, err := c.getJob(identityFrom(ctx).AccountId, id)
+	if errors.Is(err, errJobNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading job %s: %v", id, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load job"})
+		return
+	}
+
+	c.refreshJob(job)
+	ctx.JSON(http.StatusOK, job)
+}
+
+// startJobTracker advances submitted jobs as the pipeline processes them,
+// every JOB_TRACK_INTERVAL seconds (default 15)
+func (c *ControlMService) startJobTracker() {
+	interval := 15 * time.Second
+	if value, err := strconv.Atoi(os.Getenv("JOB_TRACK_INTERVAL")); err == nil && value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.receiveCtx.Done():
+			log.Println("Job tracker stopped")
+			return
+		case <-ticker.C:
+			c.trackOpenJobs()
+		}
+	}
+}
+
+func (c *ControlMService) trackOpenJobs() {
+	paginator := dynamodb.NewScanPaginator(c.dynamoClient, &dynamodb.ScanInput{
+		TableName:        aws.String(c.jobTableName()),
+		FilterExpression: aws.String("#status <> :completed AND #status <> :failed"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":completed": &types.AttributeValueMemberS{Value: JobStatusCompleted},
+			":failed":    &types.AttributeValueMemberS{Value: JobStatusFailed},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error scanning open jobs: %v", err)
+			return
+		}
+		var jobs []JobRequest
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &jobs); err != nil {
+			log.Printf("Error unmarshaling open jobs: %v", err)
+			return
+		}
+		for i := range jobs {
+			c.refreshJob(&jobs[i])
+		}
+	}
+}
@@ -1,32 +1,47 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type JobRequest struct {
-	ID          string                 `json:"id"`
-	JobName     string                 `json:"job_name"`
-	JobType     string                 `json:"job_type"`
-	Parameters  map[string]interface{} `json:"parameters"`
-	Priority    int                    `json:"priority"`
-	ScheduledAt time.Time              `json:"scheduled_at"`
-	CreatedAt   time.Time              `json:"created_at"`
-	Status      string                 `json:"status"`
+	ID          string                 `json:"id" dynamodbav:"id"`
+	AccountId   string                 `json:"account_id" dynamodbav:"account_id"`
+	JobName     string                 `json:"job_name" dynamodbav:"job_name"`
+	JobType     string                 `json:"job_type" dynamodbav:"job_type"`
+	Parameters  map[string]interface{} `json:"parameters" dynamodbav:"parameters"`
+	Priority    int                    `json:"priority" dynamodbav:"priority"`
+	ScheduledAt time.Time              `json:"scheduled_at" dynamodbav:"scheduled_at"`
+	CreatedAt   time.Time              `json:"created_at" dynamodbav:"created_at"`
+	Status      string                 `json:"status" dynamodbav:"status"`
+
+	// Pipeline tracking; see jobs.go
+	StatusReason   string          `json:"status_reason,omitempty" dynamodbav:"status_reason,omitempty"`
+	UpdatedAt      time.Time       `json:"updated_at" dynamodbav:"updated_at"`
+	ScheduleID     string          `json:"schedule_id,omitempty" dynamodbav:"schedule_id,omitempty"`
+	AdapterID      string          `json:"adapter_id,omitempty" dynamodbav:"adapter_id,omitempty"`
+	QueueMessageID string          `json:"queue_message_id,omitempty" dynamodbav:"queue_message_id,omitempty"`
+	History        []JobTransition `json:"history,omitempty" dynamodbav:"history,omitempty"`
 }
 
 // StartExecutionRequest represents the request to start an execution
@@ -43,10 +58,21 @@ type StartExecutionResponse struct {
 }
 
 type ControlMService struct {
-	jobs      []JobRequest
-	sqsClient *sqs.Client
-	queueURL  string
-	jmiURL    string
+	dynamoClient   *dynamodb.Client
+	sqsClient      *sqs.Client
+	queueURL       string
+	jmiURL         string
+	jmi            *jmiClient
+	auditTable     string
+	jobTable       string
+	folderTable    string
+	runTable       string
+	operationTable string
+	operations     chan operationTask
+	instanceId     string   // owner recorded on the operations this instance runs
+	ownedOps       sync.Map // ids of this instance's pending operations
+	receiveCtx     context.Context
+	receiveCancel  context.CancelFunc
 }
 
 func NewControlMService() *ControlMService {
@@ -83,12 +109,34 @@ func NewControlMService() *ControlMService {
 		jmiURL = "http://jmi:8080"
 	}
 
-	return &ControlMService{
-		jobs:      make([]JobRequest, 0),
-		sqsClient: sqs.NewFromConfig(cfg),
-		queueURL:  os.Getenv("SQS_QUEUE_URL"),
-		jmiURL:    jmiURL,
+	ctx, cancel := context.WithCancel(context.Background())
+
+	service := &ControlMService{
+		dynamoClient:   dynamodb.NewFromConfig(cfg),
+		sqsClient:      sqs.NewFromConfig(cfg),
+		queueURL:       os.Getenv("SQS_QUEUE_URL"),
+		jmiURL:         jmiURL,
+		jmi:            newJMIClient(jmiURL),
+		auditTable:     os.Getenv("AUDIT_TABLE"),
+		jobTable:       os.Getenv("JOB_TABLE"),
+		folderTable:    os.Getenv("FOLDER_TABLE"),
+		runTable:       os.Getenv("RUN_TABLE"),
+		operationTable: os.Getenv("OPERATION_TABLE"),
+		operations:     make(chan operationTask, asyncQueueSize()),
+		instanceId:     uuid.New().String(),
+		receiveCtx:     ctx,
+		receiveCancel:  cancel,
 	}
+
+	// Follow submitted jobs through the pipeline
+	go service.startJobTracker()
+
+	// Async execution starts: settle the ones a stopped instance left behind, then serve new ones
+	service.failInterruptedOperations(time.Now())
+	service.startOperationWorkers()
+	go service.startOperationHeartbeat()
+
+	return service
 }
 
 func (c *ControlMService) StartExecution(ctx *gin.Context) {
@@ -98,13 +146,40 @@ func (c *ControlMService) StartExecution(ctx *gin.Context) {
 		return
 	}
 
+	setAuditTarget(ctx, "execution/"+req.ExecutionName)
+
+	// Async mode answers 202 right away and leaves the JMI call to a worker
+	if wantsAsync(ctx) {
+		c.startExecutionAsync(ctx, req)
+		return
+	}
 	log.Printf("Control-M: Starting execution %s", req.ExecutionName)
 
-	// Call JMI to start the execution
-	jmiResponse, err := c.callJMI(req)
-	if err != nil {
+	// Call JMI to start the execution. The caller's Idempotency-Key, if any,
+	// is passed on so a client retrying Control-M is deduplicated by JMI too
+	jmiResponse, err := c.callJMI(ctx.Request.Context(), req, identityFrom(ctx), ctx.Request.Header, ctx.GetHeader("Idempotency-Key"))
+	var jmiErr *JMIError
+	switch {
+	case errors.As(err, &jmiErr):
+		// Pass JMI's own answer on (quota, unknown version, invalid retake...)
+		log.Printf("JMI rejected execution %s: %v", req.ExecutionName, err)
+		ctx.Data(jmiErr.StatusCode, "application/json; charset=utf-8", jmiErr.Body)
+		return
+	case errors.Is(err, errJMIUnavailable):
+		retryAfter := int(math.Ceil(c.jmi.breaker.retryAfter().Seconds()))
+		ctx.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "JMI is unavailable, try again later",
+			"details": err.Error(),
+		})
+		return
+	case err != nil:
 		log.Printf("Error calling JMI: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{
+		status := http.StatusBadGateway
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		ctx.JSON(status, gin.H{
 			"error":   "Failed to start execution via JMI",
 			"details": err.Error(),
 		})
@@ -117,30 +192,15 @@ func (c *ControlMService) StartExecution(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, jmiResponse)
 }
 
-func (c *ControlMService) callJMI(req StartExecutionRequest) (*StartExecutionResponse, error) {
-	// Prepare the request to JMI
-	reqBody, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %v", err)
-	}
-
-	// Make HTTP request to JMI
-	jmiEndpoint := fmt.Sprintf("%s/startExecution", c.jmiURL)
-	log.Printf("Control-M: Calling JMI at %s", jmiEndpoint)
-
-	resp, err := http.Post(jmiEndpoint, "application/json", bytes.NewBuffer(reqBody))
+func (c *ControlMService) callJMI(ctx context.Context, req StartExecutionRequest, identity Identity, callerHeaders http.Header, idempotencyKey string) (*StartExecutionResponse, error) {
+	body, err := c.jmi.do(ctx, http.MethodPost, "/startExecution", req, identity, callerHeaders, idempotencyKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to call JMI: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("JMI returned status %d", resp.StatusCode)
+		return nil, err
 	}
 
 	// Parse JMI response
 	var jmiResponse StartExecutionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&jmiResponse); err != nil {
+	if err := json.Unmarshal(body, &jmiResponse); err != nil {
 		return nil, fmt.Errorf("failed to decode JMI response: %v", err)
 	}
 
@@ -158,12 +218,20 @@ func (c *ControlMService) SubmitJob(ctx *gin.Context) {
 	if req.ID == "" {
 		req.ID = uuid.New().String()
 	}
+	setAuditTarget(ctx, "job/"+req.ID)
 
+	req.AccountId = identityFrom(ctx).AccountId
 	req.CreatedAt = time.Now()
-	req.Status = "submitted"
-
-	// Store job locally
-	c.jobs = append(c.jobs, req)
+	req.Status = ""
+	req.History = nil
+	req.advance(JobStatusSubmitted, "", req.CreatedAt)
+
+	// Persist the job before it is queued, so it is on record even if queuing fails
+	if err := c.putJob(&req); err != nil {
+		log.Printf("Error storing job %s: %v", req.ID, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store job"})
+		return
+	}
 
 	// Send job to SQS queue
 	jobJSON, err := json.Marshal(req)
@@ -180,6 +248,10 @@ func (c *ControlMService) SubmitJob(ctx *gin.Context) {
 
 	if err != nil {
 		log.Printf("Error sending message to SQS: %v", err)
+		req.advance(JobStatusFailed, "Failed to submit job to queue", time.Now())
+		if err := c.putJob(&req); err != nil {
+			log.Printf("Error storing job %s: %v", req.ID, err)
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit job to queue"})
 		return
 	}
@@ -194,15 +266,56 @@ func (c *ControlMService) SubmitJob(ctx *gin.Context) {
 }
 
 func (c *ControlMService) GetJobs(ctx *gin.Context) {
-	ctx.JSON(http.StatusOK, c.jobs)
+	// Query the caller's jobs through the account_id GSI, newest first
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(c.jobTableName()),
+		IndexName:              aws.String("account_id-created_at-index"),
+		KeyConditionExpression: aws.String("account_id = :accountId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: identityFrom(ctx).AccountId},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+	if status := ctx.Query("status"); status != "" {
+		input.FilterExpression = aws.String("#status = :status")
+		input.ExpressionAttributeNames = map[string]string{"#status": "status"}
+		input.ExpressionAttributeValues[":status"] = &types.AttributeValueMemberS{Value: status}
+	}
+
+	jobs := make([]JobRequest, 0)
+	paginator := dynamodb.NewQueryPaginator(c.dynamoClient, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error querying jobs: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve jobs"})
+			return
+		}
+		var pageJobs []JobRequest
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageJobs); err != nil {
+			log.Printf("Error unmarshaling jobs: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process jobs data"})
+			return
+		}
+		jobs = append(jobs, pageJobs...)
+	}
+
+	ctx.JSON(http.StatusOK, jobs)
 }
 
 func (c *ControlMService) GetHealth(ctx *gin.Context) {
+	// Control-M itself is up, but starting executions fails fast while JMI's breaker is open
+	breaker := c.jmi.breaker.snapshot()
+	status := "healthy"
+	if breaker["state"] != BreakerClosed {
+		status = "degraded"
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
-		"service":    "control-m",
-		"status":     "healthy",
-		"timestamp":  time.Now(),
-		"jobs_count": len(c.jobs),
+		"service":   "control-m",
+		"status":    status,
+		"jmi":       breaker,
+		"timestamp": time.Now(),
 	})
 }
 
@@ -214,12 +327,26 @@ func main() {
 	// Health check
 	r.GET("/health", service.GetHealth)
 
+	// Authenticated, tenant-scoped endpoints
+	tenant := r.Group("/", authMiddleware(loadAuthenticators()))
+	audit := newAuditor(service.dynamoClient, service.auditTableName(), "control-m")
+
 	// Job management endpoints
-	r.POST("/jobs", service.SubmitJob)
-	r.GET("/jobs", service.GetJobs)
+	tenant.POST("/jobs", audit("job.submit"), requireRole(RoleSubmitter), service.SubmitJob)
+	tenant.GET("/jobs", requireRole(RoleViewer), service.GetJobs)
+	tenant.GET("/jobs/:id", requireRole(RoleViewer), service.GetJob)
 
 	// Execution management endpoints (NEW - calls JMI)
-	r.POST("/startExecution", service.StartExecution)
+	tenant.POST("/startExecution", audit("execution.start"), requireRole(RoleSubmitter), service.StartExecution)
+	tenant.GET("/operations/:id", requireRole(RoleViewer), service.GetOperation)
+
+	// Control-M Automation API facade
+	automation := tenant.Group("/automation-api")
+	automation.POST("/deploy", audit("automation.deploy"), requireRole(RoleSubmitter), service.Deploy)
+	automation.POST("/run/order", audit("automation.order"), requireRole(RoleSubmitter), service.OrderFolder)
+	automation.GET("/run/status/:runId", requireRole(RoleViewer), service.RunStatus)
+	automation.POST("/run/job/:jobId/rerun", audit("automation.rerun"), requireRole(RoleSubmitter), service.RerunJob)
+	automation.POST("/run/job/:jobId/kill", audit("automation.kill"), requireRole(RoleOperator), service.KillJob)
 
 	port := os.Getenv("SERVICE_PORT")
 	if port == "" {
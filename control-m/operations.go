@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Operation states
+const (
+	OperationPending   = "pending"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+)
+
+// The instance running an operation refreshes its heartbeatAt every
+// operationHeartbeat while it is pending; one not refreshed for
+// operationStaleAfter was left behind by an instance that stopped
+const (
+	operationHeartbeat  = 10 * time.Second
+	operationStaleAfter = time.Minute
+)
+
+var errOperationNotFound = errors.New("operation not found")
+
+// OperationError is why an operation failed, with JMI's status code when JMI answered
+type OperationError struct {
+	StatusCode int    `json:"statusCode" dynamodbav:"statusCode"`
+	Message    string `json:"message" dynamodbav:"message"`
+}
+
+// Operation is an execution start accepted in async mode. The JMI call is
+// made by a background worker and the outcome recorded here.
+type Operation struct {
+	ID             string          `json:"id" dynamodbav:"id"`
+	AccountId      string          `json:"accountId" dynamodbav:"accountId"`
+	Type           string          `json:"type" dynamodbav:"type"`
+	ExecutionName  string          `json:"executionName" dynamodbav:"executionName"`
+	IdempotencyKey string          `json:"idempotencyKey" dynamodbav:"idempotencyKey"`
+	Status         string          `json:"status" dynamodbav:"status"`
+	ExecutionUuid  string          `json:"executionUuid,omitempty" dynamodbav:"executionUuid,omitempty"`
+	Error          *OperationError `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	CreatedBy      string          `json:"createdBy" dynamodbav:"createdBy"`
+	CreatedAt      time.Time       `json:"createdAt" dynamodbav:"createdAt"`
+	UpdatedAt      time.Time       `json:"updatedAt" dynamodbav:"updatedAt"`
+	ExpiresAt      int64           `json:"-" dynamodbav:"expiresAt"`   // Unix seconds, the table's TTL attribute
+	Owner          string          `json:"-" dynamodbav:"owner"`       // instanceId of the Control-M running it
+	HeartbeatAt    int64           `json:"-" dynamodbav:"heartbeatAt"` // Unix milliseconds, refreshed by the owner while pending
+}
+
+// stale reports whether a pending operation's owner stopped refreshing it
+func (o *Operation) stale(now time.Time) bool {
+	return o.Status == OperationPending && o.HeartbeatAt < now.Add(-operationStaleAfter).UnixMilli()
+}
+
+// operationTask is a queued operation with what the worker needs to call JMI
+// as the caller; credentials stay in memory and are never stored
+type operationTask struct {
+	operation *Operation
+	request   StartExecutionRequest
+	identity  Identity
+	headers   http.Header
+}
+
+func (c *ControlMService) operationTableName() string {
+	if c.operationTable == "" {
+		return "controlm_operations"
+	}
+	return c.operationTable
+}
+
+// wantsAsync reports whether the caller asked for async mode, with
+// "Prefer: respond-async" or ?async=true
+func wantsAsync(ctx *gin.Context) bool {
+	if async, err := strconv.ParseBool(ctx.Query("async")); err == nil {
+		return async
+	}
+	for _, preference := range strings.Split(ctx.GetHeader("Prefer"), ",") {
+		if strings.EqualFold(strings.TrimSpace(preference), "respond-async") {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ControlMService) putOperation(operation *Operation) error {
+	item, err := attributevalue.MarshalMap(operation)
+	if err != nil {
+		return err
+	}
+	_, err = c.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(c.operationTableName()),
+		Item:      item,
+	})
+	return err
+}
+
+// getOperation loads one of the account's operations
+func (c *ControlMService) getOperation(accountId, id string) (*Operation, error) {
+	result, err := c.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(c.operationTableName()),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errOperationNotFound
+	}
+
+	var operation Operation
+	if err := attributevalue.UnmarshalMap(result.Item, &operation); err != nil {
+		return nil, err
+	}
+	if operation.AccountId != accountId {
+		return nil, errOperationNotFound
+	}
+	return &operation, nil
+}
+
+// startExecutionAsync records a pending operation, queues it for the workers
+// and answers 202 with its location
+func (c *ControlMService) startExecutionAsync(ctx *gin.Context, req StartExecutionRequest) {
+	identity := identityFrom(ctx)
+	now := time.Now()
+	operation := &Operation{
+		ID:            uuid.New().String(),
+		AccountId:     identity.AccountId,
+		Type:          "execution.start",
+		ExecutionName: req.ExecutionName,
+		Status:        OperationPending,
+		CreatedBy:     identity.Subject,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		ExpiresAt:     now.Add(operationTTL()).Unix(),
+		Owner:         c.instanceId,
+		HeartbeatAt:   now.UnixMilli(),
+	}
+	// JMI deduplicates on this key, so the start can be retried safely
+	operation.IdempotencyKey = ctx.GetHeader("Idempotency-Key")
+	if operation.IdempotencyKey == "" {
+		operation.IdempotencyKey = operation.ID
+	}
+
+	if err := c.putOperation(operation); err != nil {
+		log.Printf("Error storing operation %s: %v", operation.ID, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store operation"})
+		return
+	}
+	c.ownedOps.Store(operation.ID, true)
+
+	task := operationTask{
+		operation: operation,
+		request:   req,
+		identity:  identity,
+		headers:   ctx.Request.Header.Clone(),
+	}
+	select {
+	case c.operations <- task:
+	default:
+		c.finishOperation(operation, "", &OperationError{
+			StatusCode: http.StatusServiceUnavailable,
+			Message:    "Too many pending operations",
+		})
+		ctx.Header("Retry-After", "1")
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "Too many pending operations, try again later"})
+		return
+	}
+
+	log.Printf("Control-M: Accepted execution %s as operation %s", req.ExecutionName, operation.ID)
+	ctx.Header("Location", "/operations/"+operation.ID)
+	ctx.Header("Preference-Applied", "respond-async")
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"operationId":   operation.ID,
+		"executionName": operation.ExecutionName,
+		"status":        operation.Status,
+	})
+}
+
+// operationTTL is how long operations are kept, OPERATION_TTL hours (default 24)
+func operationTTL() time.Duration {
+	if value, err := strconv.Atoi(os.Getenv("OPERATION_TTL")); err == nil && value > 0 {
+		return time.Duration(value) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// asyncQueueSize is how many operations may wait for a worker, ASYNC_QUEUE_SIZE (default 100)
+func asyncQueueSize() int {
+	if value, err := strconv.Atoi(os.Getenv("ASYNC_QUEUE_SIZE")); err == nil && value > 0 {
+		return value
+	}
+	return 100
+}
+
+// startOperationWorkers runs ASYNC_WORKERS workers (default 4) that make the
+// JMI calls of queued operations
+func (c *ControlMService) startOperationWorkers() {
+	workers := 4
+	if value, err := strconv.Atoi(os.Getenv("ASYNC_WORKERS")); err == nil && value > 0 {
+		workers = value
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-c.receiveCtx.Done():
+					return
+				case task := <-c.operations:
+					c.runOperation(task)
+				}
+			}
+		}()
+	}
+	log.Printf("Started %d operation workers", workers)
+}
+
+// runOperation starts the execution in JMI and records the outcome
+func (c *ControlMService) runOperation(task operationTask) {
+	operation := task.operation
+	response, err := c.callJMI(c.receiveCtx, task.request, task.identity, task.headers, operation.IdempotencyKey)
+	if err != nil {
+		log.Printf("Error starting execution %s of operation %s: %v", operation.ExecutionName, operation.ID, err)
+		failure := &OperationError{StatusCode: http.StatusBadGateway, Message: err.Error()}
+		var jmiErr *JMIError
+		switch {
+		case errors.As(err, &jmiErr):
+			failure.StatusCode = jmiErr.StatusCode
+		case errors.Is(err, errJMIUnavailable):
+			failure.StatusCode = http.StatusServiceUnavailable
+		case errors.Is(err, context.DeadlineExceeded):
+			failure.StatusCode = http.StatusGatewayTimeout
+		}
+		c.finishOperation(operation, "", failure)
+		return
+	}
+
+	log.Printf("Control-M: Operation %s started execution %s as %s", operation.ID, operation.ExecutionName, response.ExecutionUuid)
+	c.finishOperation(operation, response.ExecutionUuid, nil)
+}
+
+// finishOperation records the operation's outcome
+func (c *ControlMService) finishOperation(operation *Operation, executionUuid string, failure *OperationError) {
+	operation.Status = OperationSucceeded
+	operation.ExecutionUuid = executionUuid
+	operation.Error = failure
+	if failure != nil {
+		operation.Status = OperationFailed
+	}
+	operation.UpdatedAt = time.Now()
+	if err := c.putOperation(operation); err != nil {
+		log.Printf("Error storing operation %s: %v", operation.ID, err)
+	}
+	c.ownedOps.Delete(operation.ID)
+}
+
+// startOperationHeartbeat keeps this instance's pending operations alive and,
+// every operationStaleAfter, fails those another instance left behind
+func (c *ControlMService) startOperationHeartbeat() {
+	heartbeat := time.NewTicker(operationHeartbeat)
+	defer heartbeat.Stop()
+	reaper := time.NewTicker(operationStaleAfter)
+	defer reaper.Stop()
+
+	for {
+		select {
+		case <-c.receiveCtx.Done():
+			return
+		case now := <-heartbeat.C:
+			c.ownedOps.Range(func(id, _ interface{}) bool {
+				c.heartbeatOperation(id.(string), now)
+				return true
+			})
+		case now := <-reaper.C:
+			c.failInterruptedOperations(now)
+		}
+	}
+}
+
+// heartbeatOperation refreshes the heartbeatAt of a pending operation this
+// instance owns. Once it is no longer pending or ours, it is not refreshed again.
+func (c *ControlMService) heartbeatOperation(id string, now time.Time) {
+	_, err := c.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.operationTableName()),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("SET heartbeatAt = :now"),
+		ConditionExpression: aws.String("#status = :pending AND #owner = :owner"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+			"#owner":  "owner",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now":     &types.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixMilli(), 10)},
+			":pending": &types.AttributeValueMemberS{Value: OperationPending},
+			":owner":   &types.AttributeValueMemberS{Value: c.instanceId},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		c.ownedOps.Delete(id)
+		return
+	}
+	if err != nil {
+		log.Printf("Error refreshing heartbeat of operation %s: %v", id, err)
+	}
+}
+
+// failInterruptedOperations fails the pending operations whose owner stopped
+// refreshing their heartbeat: the instance is gone with the callers'
+// credentials, so they cannot be resumed. Operations another running instance
+// still owns are left alone. Starting again with the same Idempotency-Key is
+// safe either way.
+func (c *ControlMService) failInterruptedOperations(now time.Time) {
+	stale := map[string]types.AttributeValue{
+		":pending": &types.AttributeValueMemberS{Value: OperationPending},
+		":stale":   &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(-operationStaleAfter).UnixMilli(), 10)},
+	}
+	condition := "#status = :pending AND (attribute_not_exists(heartbeatAt) OR heartbeatAt < :stale)"
+	paginator := dynamodb.NewScanPaginator(c.dynamoClient, &dynamodb.ScanInput{
+		TableName:        aws.String(c.operationTableName()),
+		FilterExpression: aws.String(condition),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: stale,
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error scanning pending operations: %v", err)
+			return
+		}
+		var operations []Operation
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &operations); err != nil {
+			log.Printf("Error unmarshaling pending operations: %v", err)
+			return
+		}
+		for i := range operations {
+			operation := &operations[i]
+			if !operation.stale(now) {
+				continue
+			}
+			operation.Status = OperationFailed
+			operation.Error = &OperationError{
+				StatusCode: http.StatusServiceUnavailable,
+				Message:    "Control-M stopped before JMI answered; start again with Idempotency-Key " + operation.IdempotencyKey + " to avoid a duplicate execution",
+			}
+			operation.UpdatedAt = now
+
+			// Conditional, so an operation whose owner came back in the meantime is kept
+			item, err := attributevalue.MarshalMap(operation)
+			if err == nil {
+				_, err = c.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+					TableName:                 aws.String(c.operationTableName()),
+					Item:                      item,
+					ConditionExpression:       aws.String(condition),
+					ExpressionAttributeNames:  map[string]string{"#status": "status"},
+					ExpressionAttributeValues: stale,
+				})
+			}
+			var conditionErr *types.ConditionalCheckFailedException
+			switch {
+			case errors.As(err, &conditionErr):
+				// Refreshed or finished since the scan
+			case err != nil:
+				log.Printf("Error failing interrupted operation %s: %v", operation.ID, err)
+			default:
+				log.Printf("Control-M: Failed operation %s left pending by instance %s", operation.ID, operation.Owner)
+			}
+		}
+	}
+}
+
+// GetOperation reports an async operation and, once it succeeded, its executionUuid
+func (c *ControlMService) GetOperation(ctx *gin.Context) {
+	id := ctx.Param("id")
+	operation, err := c.getOperation(identityFrom(ctx).AccountId, id)
+	if errors.Is(err, errOperationNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Operation not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading operation %s: %v", id, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load operation"})
+		return
+	}
+
+	if operation.Status == OperationPending {
+		ctx.Header("Retry-After", "1")
+	}
+	ctx.JSON(http.StatusOK, operation)
+}
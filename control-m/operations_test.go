@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFailInterruptedOperations(t *testing.T) {
+	now := time.Now()
+	operation := func(id, owner string, heartbeat time.Time) Operation {
+		return Operation{
+			ID:             id,
+			AccountId:      "acc-a",
+			ExecutionName:  "daily-load",
+			IdempotencyKey: "key-" + id,
+			Status:         OperationPending,
+			Owner:          owner,
+			HeartbeatAt:    heartbeat.UnixMilli(),
+		}
+	}
+	stale := operation("stale", "stopped-instance", now.Add(-operationStaleAfter-time.Second))
+	fresh := operation("fresh", "running-instance", now.Add(-operationHeartbeat))
+	legacy := operation("legacy", "", time.Time{})
+	legacy.HeartbeatAt = 0
+
+	fake, client := newFakeDynamo(t, func(call dynamoCall) (interface{}, *dynamoError) {
+		if call.Operation == "Scan" {
+			return map[string]interface{}{"Items": []interface{}{wireItem(t, stale), wireItem(t, fresh), wireItem(t, legacy)}}, nil
+		}
+		return nil, nil
+	})
+	service := &ControlMService{dynamoClient: client}
+
+	service.failInterruptedOperations(now)
+
+	scans := fake.recorded("Scan", "controlm_operations")
+	if len(scans) != 1 {
+		t.Fatalf("Scan calls = %d, want 1", len(scans))
+	}
+	if got, want := scans[0].value("ExpressionAttributeValues", ":stale"), strconv.FormatInt(now.Add(-operationStaleAfter).UnixMilli(), 10); got != want {
+		t.Errorf("scanned for heartbeats before %s, want %s", got, want)
+	}
+
+	failed := make(map[string]bool)
+	for _, put := range fake.recorded("PutItem", "controlm_operations") {
+		if status := put.value("Item", "status"); status != OperationFailed {
+			t.Errorf("operation %s stored as %s, want %s", put.value("Item", "id"), status, OperationFailed)
+		}
+		if condition, _ := put.Input["ConditionExpression"].(string); condition == "" {
+			t.Errorf("operation %s failed without a condition", put.value("Item", "id"))
+		}
+		failed[put.value("Item", "id")] = true
+	}
+	if !failed["stale"] || !failed["legacy"] || failed["fresh"] || len(failed) != 2 {
+		t.Errorf("failed operations = %v, want stale and legacy only", failed)
+	}
+}
+
+func TestHeartbeatOperation(t *testing.T) {
+	tests := []struct {
+		name      string
+		failure   *dynamoError
+		wantOwned bool
+	}{
+		{"still pending and ours", nil, true},
+		{"finished or failed by another instance", &dynamoError{Type: "ConditionalCheckFailedException"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, client := newFakeDynamo(t, func(call dynamoCall) (interface{}, *dynamoError) {
+				return nil, tt.failure
+			})
+			service := &ControlMService{dynamoClient: client, instanceId: "instance-1"}
+			service.ownedOps.Store("op-1", true)
+
+			now := time.Now()
+			service.heartbeatOperation("op-1", now)
+
+			updates := fake.recorded("UpdateItem", "controlm_operations")
+			if len(updates) != 1 {
+				t.Fatalf("UpdateItem calls = %d, want 1", len(updates))
+			}
+			if got := updates[0].value("ExpressionAttributeValues", ":owner"); got != "instance-1" {
+				t.Errorf("heartbeat conditioned on owner %q, want instance-1", got)
+			}
+			if got, want := updates[0].value("ExpressionAttributeValues", ":now"), strconv.FormatInt(now.UnixMilli(), 10); got != want {
+				t.Errorf("heartbeatAt = %s, want %s", got, want)
+			}
+			if _, owned := service.ownedOps.Load("op-1"); owned != tt.wantOwned {
+				t.Errorf("still refreshing op-1 = %v, want %v", owned, tt.wantOwned)
+			}
+		})
+	}
+}
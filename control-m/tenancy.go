@@ -0,0 +1,31 @@
+package main
+
+import "github.com/gin-gonic/gin"
+
+const identityContextKey = "identity"
+
+// Identity is the authenticated caller a request is scoped to. Every
+// tenant-scoped read and write uses AccountId; Acronyms, when set, further
+// restricts which acronyms the caller may act on.
+type Identity struct {
+	Subject   string   `json:"subject"`
+	AccountId string   `json:"accountId"`
+	Acronyms  []string `json:"acronyms,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// HasRole reports whether any of the identity's roles grants the given one
+func (i Identity) HasRole(role string) bool {
+	for _, granted := range i.Roles {
+		if roleRank[granted] >= roleRank[role] {
+			return true
+		}
+	}
+	return false
+}
+
+// identityFrom returns the identity resolved by authMiddleware
+func identityFrom(ctx *gin.Context) Identity {
+	identity, _ := ctx.MustGet(identityContextKey).(Identity)
+	return identity
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/gin-gonic/gin"
+)
+
+// StepApproval is the step type that pauses an execution until someone signs it off
+const StepApproval = "approval"
+
+// Approval states; a stopped execution cancels its pending approval
+const (
+	ApprovalPending   = "pending"
+	ApprovalApproved  = "approved"
+	ApprovalRejected  = "rejected"
+	ApprovalCancelled = "cancelled"
+)
+
+var (
+	errApprovalNotFound = errors.New("approval not found")
+	errApprovalDecided  = errors.New("approval already decided")
+)
+
+// ApprovalGate configures an approval step
+type ApprovalGate struct {
+	Description    string `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	TimeoutSeconds int    `json:"timeoutSeconds,omitempty" dynamodbav:"timeoutSeconds,omitempty"` // Auto-rejects when it runs out
+}
+
+// Approval is an execution paused by JMR at an approval step. Message is the
+// execution as JMR received it, sent back through JMW once it is decided.
+type Approval struct {
+	AccountId     string `json:"-" dynamodbav:"accountId"`
+	ApprovalId    string `json:"-" dynamodbav:"approvalId"` // executionUuid#stepId
+	ExecutionName string `json:"executionName" dynamodbav:"executionName"`
+	ExecutionUuid string `json:"executionUuid" dynamodbav:"executionUuid"`
+	StepId        string `json:"stepId" dynamodbav:"stepId"`
+	Description   string `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	Status        string `json:"status" dynamodbav:"status"`
+	RequestedAt   string `json:"requestedAt" dynamodbav:"requestedAt"`
+	ExpiresAt     int64  `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"`
+	DecidedBy     string `json:"decidedBy,omitempty" dynamodbav:"decidedBy,omitempty"`
+	Comment       string `json:"comment,omitempty" dynamodbav:"comment,omitempty"`
+	DecidedAt     string `json:"decidedAt,omitempty" dynamodbav:"decidedAt,omitempty"`
+	Message       string `json:"-" dynamodbav:"message"`
+}
+
+// ApprovalDecisionRequest is the payload of the approve and reject endpoints
+type ApprovalDecisionRequest struct {
+	StepId  string `json:"stepId"` // Only needed to pick one of several pending approvals
+	Comment string `json:"comment"`
+}
+
+func (j *JMIService) approvalTableName() string {
+	if j.approvalTable == "" {
+		return "approvals"
+	}
+	return j.approvalTable
+}
+
+// executionApprovals returns the approvals requested by an execution
+func (j *JMIService) executionApprovals(accountId, executionUuid string) ([]Approval, error) {
+	result, err := j.dynamoClient.Query(context.TODO(), &dynamodb.QueryInput{
+		TableName:              aws.String(j.approvalTableName()),
+		KeyConditionExpression: aws.String("accountId = :accountId AND begins_with(approvalId, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: accountId},
+			":prefix":    &types.AttributeValueMemberS{Value: executionUuid + "#"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var approvals []Approval
+	err = attributevalue.UnmarshalListOfMaps(result.Items, &approvals)
+	return approvals, err
+}
+
+// pendingApproval finds the approval an execution waits for, or the one of stepId
+func (j *JMIService) pendingApproval(accountId, executionUuid, stepId string) (*Approval, error) {
+	approvals, err := j.executionApprovals(accountId, executionUuid)
+	if err != nil {
+		return nil, err
+	}
+	var decided *Approval
+	for i := range approvals {
+		if stepId != "" && approvals[i].StepId != stepId {
+			continue
+		}
+		if approvals[i].Status == ApprovalPending {
+			return &approvals[i], nil
+		}
+		decided = &approvals[i]
+	}
+	if decided != nil {
+		return decided, errApprovalDecided
+	}
+	return nil, errApprovalNotFound
+}
+
+// decideApproval records the decision and sends the execution back through
+// JMW, so JMR resumes it after the approval step or fails it there
+func (j *JMIService) decideApproval(approval *Approval, status, decidedBy, comment string) error {
+	now := time.Now().Format(time.RFC3339)
+	_, err := j.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName: aws.String(j.approvalTableName()),
+		Key: map[string]types.AttributeValue{
+			"accountId":  &types.AttributeValueMemberS{Value: approval.AccountId},
+			"approvalId": &types.AttributeValueMemberS{Value: approval.ApprovalId},
+		},
+		UpdateExpression:         aws.String("SET #status = :status, decidedBy = :decidedBy, #comment = :comment, decidedAt = :now"),
+		ConditionExpression:      aws.String("#status = :pending"),
+		ExpressionAttributeNames: map[string]string{"#status": "status", "#comment": "comment"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status":    &types.AttributeValueMemberS{Value: status},
+			":decidedBy": &types.AttributeValueMemberS{Value: decidedBy},
+			":comment":   &types.AttributeValueMemberS{Value: comment},
+			":now":       &types.AttributeValueMemberS{Value: now},
+			":pending":   &types.AttributeValueMemberS{Value: ApprovalPending},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return errApprovalDecided
+	}
+	if err != nil {
+		return err
+	}
+	approval.Status, approval.DecidedBy, approval.Comment, approval.DecidedAt = status, decidedBy, comment, now
+	if status == ApprovalCancelled {
+		return nil
+	}
+
+	var execution map[string]interface{}
+	if err := json.Unmarshal([]byte(approval.Message), &execution); err != nil {
+		return err
+	}
+	execution["approval"] = gin.H{
+		"stepId":    approval.StepId,
+		"status":    status,
+		"decidedBy": decidedBy,
+		"comment":   comment,
+	}
+	executionJSON, err := json.Marshal(execution)
+	if err != nil {
+		return err
+	}
+	_, err = j.sqsClient.SendMessage(context.TODO(), &sqs.SendMessageInput{
+		QueueUrl:    aws.String(j.outQueueURL),
+		MessageBody: aws.String(string(executionJSON)),
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("JMI %s step %s of %s (%s)", status, approval.StepId, approval.ExecutionUuid, decidedBy)
+	return nil
+}
+
+// cancelApprovals drops the pending approvals of a stopped execution
+func (j *JMIService) cancelApprovals(accountId, executionUuid, stoppedBy string) {
+	approvals, err := j.executionApprovals(accountId, executionUuid)
+	if err != nil {
+		log.Printf("ERROR: Failed to query approvals of %s: %v", executionUuid, err)
+		return
+	}
+	for i := range approvals {
+		if approvals[i].Status != ApprovalPending {
+			continue
+		}
+		if err := j.decideApproval(&approvals[i], ApprovalCancelled, stoppedBy, "Execution stopped"); err != nil && !errors.Is(err, errApprovalDecided) {
+			log.Printf("ERROR: Failed to cancel approval %s: %v", approvals[i].ApprovalId, err)
+		}
+	}
+}
+
+// GetApprovals lists the tenant's approvals, by default the pending ones;
+// ?status= picks another state
+func (j *JMIService) GetApprovals(ctx *gin.Context) {
+	status := ctx.DefaultQuery("status", ApprovalPending)
+	switch status {
+	case ApprovalPending, ApprovalApproved, ApprovalRejected, ApprovalCancelled:
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, approved, rejected or cancelled"})
+		return
+	}
+
+	approvals := make([]Approval, 0)
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:                aws.String(j.approvalTableName()),
+		KeyConditionExpression:   aws.String("accountId = :accountId"),
+		FilterExpression:         aws.String("#status = :status"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: identityFrom(ctx).AccountId},
+			":status":    &types.AttributeValueMemberS{Value: status},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error querying approvals: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve approvals"})
+			return
+		}
+		var pageApprovals []Approval
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageApprovals); err != nil {
+			log.Printf("Error unmarshaling approvals: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process approvals"})
+			return
+		}
+		approvals = append(approvals, pageApprovals...)
+	}
+
+	sort.Slice(approvals, func(a, b int) bool {
+		return approvals[a].RequestedAt < approvals[b].RequestedAt
+	})
+	ctx.JSON(http.StatusOK, gin.H{"approvals": approvals, "count": len(approvals)})
+}
+
+// ApproveExecution signs off the approval step an execution waits at
+func (j *JMIService) ApproveExecution(ctx *gin.Context) {
+	j.decideExecution(ctx, ApprovalApproved)
+}
+
+// RejectExecution rejects the approval step, which fails the execution
+func (j *JMIService) RejectExecution(ctx *gin.Context) {
+	j.decideExecution(ctx, ApprovalRejected)
+}
+
+func (j *JMIService) decideExecution(ctx *gin.Context, status string) {
+	identity := identityFrom(ctx)
+	executionUuid := ctx.Param("executionUuid")
+	setAuditTarget(ctx, "execution/"+executionUuid)
+
+	var req ApprovalDecisionRequest
+	if !bindAndValidate(ctx, "approval-decision", &req, nil) {
+		return
+	}
+
+	approval, err := j.pendingApproval(identity.AccountId, executionUuid, req.StepId)
+	if err == nil {
+		err = j.decideApproval(approval, status, identity.Subject, req.Comment)
+	}
+	switch {
+	case errors.Is(err, errApprovalNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "No approval requested by this execution"})
+	case errors.Is(err, errApprovalDecided):
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Approval already decided", "status": approval.Status, "decidedBy": approval.DecidedBy})
+	case err != nil:
+		log.Printf("Error deciding approval of %s: %v", executionUuid, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record approval decision"})
+	default:
+		ctx.JSON(http.StatusOK, approval)
+	}
+}
+
+// startApprovalTimeouts rejects approvals whose timeout ran out, checking
+// every APPROVAL_CHECK_INTERVAL seconds (default 30)
+func (j *JMIService) startApprovalTimeouts() {
+	interval := 30 * time.Second
+	if value, err := strconv.Atoi(os.Getenv("APPROVAL_CHECK_INTERVAL")); err == nil && value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.receiveCtx.Done():
+			log.Println("Approval timeouts stopped")
+			return
+		case <-ticker.C:
+			j.expireApprovals()
+		}
+	}
+}
+
+func (j *JMIService) expireApprovals() {
+	paginator := dynamodb.NewScanPaginator(j.dynamoClient, &dynamodb.ScanInput{
+		TableName:                aws.String(j.approvalTableName()),
+		FilterExpression:         aws.String("#status = :pending AND expiresAt <= :now"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: ApprovalPending},
+			":now":     &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("ERROR: Failed to scan approvals: %v", err)
+			return
+		}
+		var expired []Approval
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &expired); err != nil {
+			log.Printf("ERROR: Failed to unmarshal approvals: %v", err)
+			return
+		}
+		for i := range expired {
+			err := j.decideApproval(&expired[i], ApprovalRejected, "system:timeout", "Approval timed out")
+			if err != nil && !errors.Is(err, errApprovalDecided) {
+				log.Printf("ERROR: Failed to reject expired approval %s: %v", expired[i].ApprovalId, err)
+			}
+		}
+	}
+}
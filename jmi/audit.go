@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	auditActionKey = "auditAction"
+	auditTargetKey = "auditTarget"
+)
+
+// AuditEntry is one append-only record of a mutating call
+type AuditEntry struct {
+	AuditId       string `json:"auditId" dynamodbav:"auditId"`
+	AccountId     string `json:"accountId" dynamodbav:"accountId"`
+	Actor         string `json:"actor" dynamodbav:"actor"`
+	Action        string `json:"action" dynamodbav:"action"`
+	Target        string `json:"target" dynamodbav:"target"`
+	RequestDigest string `json:"requestDigest" dynamodbav:"requestDigest"`
+	Result        string `json:"result" dynamodbav:"result"`
+	StatusCode    int    `json:"statusCode" dynamodbav:"statusCode"`
+	Service       string `json:"service" dynamodbav:"service"`
+	Timestamp     int64  `json:"timestamp" dynamodbav:"timestamp"` // Unix milliseconds, sort key of the GSIs
+	Time          string `json:"time" dynamodbav:"time"`
+}
+
+func (j *JMIService) auditTableName() string {
+	if j.auditTable == "" {
+		return "audit_log"
+	}
+	return j.auditTable
+}
+
+// newAuditor returns a middleware factory that records every call of the wrapped
+// route once the handler has answered. Handlers name what they acted on with
+// setAuditTarget and may refine the action with setAuditAction.
+func newAuditor(client *dynamodb.Client, tableName, service string) func(action string) gin.HandlerFunc {
+	return func(action string) gin.HandlerFunc {
+		return func(ctx *gin.Context) {
+			body, _ := io.ReadAll(ctx.Request.Body)
+			ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+			digest := sha256.Sum256(body)
+
+			ctx.Next()
+
+			identity := identityFrom(ctx)
+			now := time.Now()
+			entry := AuditEntry{
+				AuditId:       uuid.New().String(),
+				AccountId:     identity.AccountId,
+				Actor:         identity.Subject,
+				Action:        action,
+				Target:        ctx.GetString(auditTargetKey),
+				RequestDigest: "sha256:" + hex.EncodeToString(digest[:]),
+				Result:        "success",
+				StatusCode:    ctx.Writer.Status(),
+				Service:       service,
+				Timestamp:     now.UnixMilli(),
+				Time:          now.Format(time.RFC3339),
+			}
+			if override := ctx.GetString(auditActionKey); override != "" {
+				entry.Action = override
+			}
+			// target and actor are GSI keys, which DynamoDB refuses empty; calls
+			// rejected before the handler named a target are still recorded
+			if entry.Target == "" {
+				entry.Target = ctx.FullPath()
+			}
+			if entry.Actor == "" {
+				entry.Actor = "anonymous"
+			}
+			if entry.StatusCode >= http.StatusBadRequest {
+				entry.Result = "failure"
+			}
+
+			writeAuditEntry(client, tableName, entry)
+		}
+	}
+}
+
+// writeAuditEntry appends the entry; the condition guarantees it never overwrites one
+func writeAuditEntry(client *dynamodb.Client, tableName string, entry AuditEntry) {
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal audit entry: %v", err)
+		return
+	}
+
+	_, err = client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String(tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(auditId)"),
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to write audit entry %s %s: %v", entry.Action, entry.Target, err)
+	}
+}
+
+func setAuditTarget(ctx *gin.Context, target string) {
+	ctx.Set(auditTargetKey, target)
+}
+
+func setAuditAction(ctx *gin.Context, action string) {
+	ctx.Set(auditActionKey, action)
+}
+
+// GetAuditLog lists the caller's audit entries, newest first. It filters by
+// actor, target and an RFC3339 from/to range, and returns JSON Lines when
+// format=jsonl.
+func (j *JMIService) GetAuditLog(ctx *gin.Context) {
+	identity := identityFrom(ctx)
+
+	from, to, err := parseTimeRange(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	values := map[string]types.AttributeValue{
+		":accountId": &types.AttributeValueMemberS{Value: identity.AccountId},
+		":from":      &types.AttributeValueMemberN{Value: strconv.FormatInt(from.UnixMilli(), 10)},
+		":to":        &types.AttributeValueMemberN{Value: strconv.FormatInt(to.UnixMilli(), 10)},
+	}
+
+	// Use the most selective index; the account is always enforced
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(j.auditTableName()),
+		ScanIndexForward:          aws.Bool(false),
+		ExpressionAttributeValues: values,
+		ExpressionAttributeNames:  map[string]string{"#ts": "timestamp"},
+	}
+	var filters []string
+	switch {
+	case ctx.Query("target") != "":
+		input.IndexName = aws.String("target-timestamp-index")
+		input.KeyConditionExpression = aws.String("target = :target AND #ts BETWEEN :from AND :to")
+		values[":target"] = &types.AttributeValueMemberS{Value: ctx.Query("target")}
+		filters = append(filters, "accountId = :accountId")
+		if actor := ctx.Query("actor"); actor != "" {
+			values[":actor"] = &types.AttributeValueMemberS{Value: actor}
+			filters = append(filters, "actor = :actor")
+		}
+	case ctx.Query("actor") != "":
+		input.IndexName = aws.String("actor-timestamp-index")
+		input.KeyConditionExpression = aws.String("actor = :actor AND #ts BETWEEN :from AND :to")
+		values[":actor"] = &types.AttributeValueMemberS{Value: ctx.Query("actor")}
+		filters = append(filters, "accountId = :accountId")
+	default:
+		input.IndexName = aws.String("accountId-timestamp-index")
+		input.KeyConditionExpression = aws.String("accountId = :accountId AND #ts BETWEEN :from AND :to")
+	}
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+	}
+
+	var entries []AuditEntry
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error querying audit log: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit log"})
+			return
+		}
+
+		var pageEntries []AuditEntry
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageEntries); err != nil {
+			log.Printf("Error unmarshaling audit entries: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process audit log"})
+			return
+		}
+		entries = append(entries, pageEntries...)
+	}
+
+	if ctx.Query("format") == "jsonl" {
+		ctx.Header("Content-Type", "application/x-ndjson")
+		ctx.Header("Content-Disposition", `attachment; filename="audit.jsonl"`)
+		ctx.Status(http.StatusOK)
+		encoder := json.NewEncoder(ctx.Writer)
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				log.Printf("Error writing audit export: %v", err)
+				return
+			}
+		}
+		return
+	}
+
+	if entries == nil {
+		entries = []AuditEntry{}
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// Bulk actions
+const (
+	BulkStart  = "start"
+	BulkStop   = "stop"
+	BulkRetake = "retake"
+)
+
+// Per-item results of a bulk operation
+const (
+	BulkResultSelected  = "selected" // dry run
+	BulkResultSucceeded = "succeeded"
+	BulkResultFailed    = "failed"
+	BulkResultSkipped   = "skipped"
+)
+
+// BulkSelector picks targets by acronym (the routine's commonProperties.acronym),
+// by status and by name prefix. For start and retake, status is the status of
+// each routine's latest execution; stop only considers pending and running
+// executions and retake failed and stopped ones. Executions are looked up
+// since Since (default 24 hours ago).
+type BulkSelector struct {
+	Acronym    string `json:"acronym,omitempty"`
+	Status     string `json:"status,omitempty"`
+	NamePrefix string `json:"namePrefix,omitempty"`
+	Since      string `json:"since,omitempty"`
+}
+
+func (s *BulkSelector) empty() bool {
+	return s == nil || (s.Acronym == "" && s.Status == "" && s.NamePrefix == "")
+}
+
+// BulkRequest is the body of POST /bulk/start, /bulk/stop and /bulk/retake.
+// Targets are the routines of ExecutionNames (start) or the executions of
+// ExecutionUuids (stop, retake), narrowed by Selector; without a list the
+// selector alone picks them.
+type BulkRequest struct {
+	ExecutionNames []string               `json:"executionNames,omitempty"`
+	ExecutionUuids []string               `json:"executionUuids,omitempty"`
+	Selector       *BulkSelector          `json:"selector,omitempty"`
+	Parameters     map[string]interface{} `json:"parameters,omitempty"` // start; laid over the execution's on retake
+	Retake         *RetakeInfo            `json:"retake,omitempty"`     // retake; default is the first failed step
+	DryRun         bool                   `json:"dryRun,omitempty"`
+	Concurrency    int                    `json:"concurrency,omitempty"`
+}
+
+// BulkItem is one target of a bulk operation and what happened to it
+type BulkItem struct {
+	ExecutionName string `json:"executionName"`
+	ExecutionUuid string `json:"executionUuid,omitempty"`
+	Acronym       string `json:"acronym,omitempty"`
+	Status        string `json:"status,omitempty"` // of the execution acted on, before the operation
+	Result        string `json:"result"`
+	StatusCode    int    `json:"statusCode,omitempty"`
+	Error         string `json:"error,omitempty"`
+	Response      gin.H  `json:"response,omitempty"`
+
+	retake     *RetakeInfo
+	version    int
+	parameters map[string]interface{}
+}
+
+// executionSummary folds the stage records of one execution
+type executionSummary struct {
+	ExecutionName  string
+	ExecutionUuid  string
+	AccountId      string
+	Acronym        string
+	Status         string
+	RoutineVersion int
+	Parameters     map[string]interface{}
+	Tasks          []TaskResult
+	StartedAt      int64
+}
+
+// routineAcronym is the acronym a routine is filed under, if any
+func routineAcronym(definition *RoutineDefinition) string {
+	if definition == nil {
+		return ""
+	}
+	acronym, _ := definition.CommonProperties["acronym"].(string)
+	return acronym
+}
+
+// bulkMaxItems caps the targets of one bulk operation, BULK_MAX_ITEMS (default 100)
+func bulkMaxItems() int {
+	if value, err := strconv.Atoi(os.Getenv("BULK_MAX_ITEMS")); err == nil && value > 0 {
+		return value
+	}
+	return 100
+}
+
+// summarizeExecutions folds stage records into one summary per execution,
+// newest first. Executions whose jmi-start record is missing are left out.
+func summarizeExecutions(stages []StageRecord) []executionSummary {
+	byUuid := make(map[string][]StageRecord)
+	for _, stage := range stages {
+		byUuid[stage.ExecutionUuid] = append(byUuid[stage.ExecutionUuid], stage)
+	}
+
+	summaries := make([]executionSummary, 0, len(byUuid))
+	for uuid, records := range byUuid {
+		sort.SliceStable(records, func(a, b int) bool {
+			return records[a].Version < records[b].Version
+		})
+		start := records[0]
+		if start.Stage != "jmi-start" {
+			continue
+		}
+		summary := executionSummary{
+			ExecutionName:  start.OriginalName,
+			ExecutionUuid:  uuid,
+			AccountId:      start.AccountId,
+			Acronym:        routineAcronym(start.Definition),
+			Status:         currentStatus(records),
+			RoutineVersion: start.RoutineVersion,
+			Parameters:     start.Parameters,
+			StartedAt:      start.Timestamp,
+		}
+		for _, record := range records {
+			if record.Tasks != nil {
+				summary.Tasks = record.Tasks
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(a, b int) bool {
+		return summaries[a].StartedAt > summaries[b].StartedAt
+	})
+	return summaries
+}
+
+// accountExecutions returns the summaries of the account's executions started since
+func (j *JMIService) accountExecutions(accountId string, since time.Time) ([]executionSummary, error) {
+	var stages []StageRecord
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:                aws.String(j.executionTableName()),
+		IndexName:                aws.String("accountId-timestamp-index"),
+		KeyConditionExpression:   aws.String("accountId = :accountId AND #ts >= :from"),
+		ExpressionAttributeNames: map[string]string{"#ts": "timestamp"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: accountId},
+			":from":      &types.AttributeValueMemberN{Value: strconv.FormatInt(since.Unix(), 10)},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		var pageStages []StageRecord
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageStages); err != nil {
+			return nil, err
+		}
+		stages = append(stages, pageStages...)
+	}
+	return summarizeExecutions(stages), nil
+}
+
+// executionsByUuid returns the summaries of the given executions of the account,
+// in the order asked; unknown ones are reported with an empty name
+func (j *JMIService) executionsByUuid(accountId string, uuids []string) ([]executionSummary, error) {
+	summaries := make([]executionSummary, 0, len(uuids))
+	for _, uuid := range uuids {
+		items, err := j.queryIndex(j.executionTableName(), "executionUuid-timestamp-index", "executionUuid", uuid)
+		if err != nil {
+			return nil, err
+		}
+		var stages []StageRecord
+		if err := attributevalue.UnmarshalListOfMaps(items, &stages); err != nil {
+			return nil, err
+		}
+		found := summarizeExecutions(stages)
+		// Other tenants' executions are reported as missing
+		if len(found) == 0 || found[0].AccountId != accountId {
+			summaries = append(summaries, executionSummary{ExecutionUuid: uuid})
+			continue
+		}
+		summaries = append(summaries, found[0])
+	}
+	return summaries, nil
+}
+
+// latestPerRoutine keeps the newest execution of each routine
+func latestPerRoutine(summaries []executionSummary) map[string]executionSummary {
+	latest := make(map[string]executionSummary)
+	for _, summary := range summaries {
+		if _, ok := latest[summary.ExecutionName]; !ok {
+			latest[summary.ExecutionName] = summary
+		}
+	}
+	return latest
+}
+
+// matches reports whether a target passes the selector
+func (s *BulkSelector) matches(name, acronym, status string) bool {
+	if s == nil {
+		return true
+	}
+	if s.Acronym != "" && s.Acronym != acronym {
+		return false
+	}
+	if s.NamePrefix != "" && !strings.HasPrefix(name, s.NamePrefix) {
+		return false
+	}
+	return s.Status == "" || s.Status == status
+}
+
+// mergeBulkParameters lays the request's parameters over the execution's own
+func mergeBulkParameters(execution, request map[string]interface{}) map[string]interface{} {
+	if len(request) == 0 {
+		return execution
+	}
+	merged := make(map[string]interface{}, len(execution)+len(request))
+	for name, value := range execution {
+		merged[name] = value
+	}
+	for name, value := range request {
+		merged[name] = value
+	}
+	return merged
+}
+
+// firstFailedStep is the step of the first failed task of an execution
+func firstFailedStep(tasks []TaskResult) string {
+	for _, task := range tasks {
+		if task.Status == "failed" {
+			return task.StepId
+		}
+	}
+	return ""
+}
+
+// selectBulkTargets resolves the request into the items to act on
+func (j *JMIService) selectBulkTargets(identity Identity, action string, req BulkRequest) ([]BulkItem, error) {
+	since := time.Now().Add(-24 * time.Hour)
+	if req.Selector != nil && req.Selector.Since != "" {
+		since, _ = time.Parse(time.RFC3339, req.Selector.Since) // checked by the schema
+	}
+
+	var items []BulkItem
+	switch action {
+	case BulkStart:
+		routines, err := j.latestRoutines(identity.AccountId)
+		if err != nil {
+			return nil, err
+		}
+		acronyms := make(map[string]string)
+		names := req.ExecutionNames
+		for _, routine := range routines {
+			routine := routine
+			acronyms[routine.RoutineName] = routineAcronym(&routine)
+			if len(req.ExecutionNames) == 0 {
+				names = append(names, routine.RoutineName)
+			}
+		}
+		executions, err := j.accountExecutions(identity.AccountId, since)
+		if err != nil {
+			return nil, err
+		}
+		latest := latestPerRoutine(executions)
+
+		seen := make(map[string]bool)
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			last := latest[name]
+			if !req.Selector.matches(name, acronyms[name], last.Status) {
+				continue
+			}
+			items = append(items, BulkItem{
+				ExecutionName: name,
+				ExecutionUuid: last.ExecutionUuid,
+				Acronym:       acronyms[name],
+				Status:        last.Status,
+				parameters:    req.Parameters,
+			})
+		}
+
+	case BulkStop, BulkRetake:
+		var executions []executionSummary
+		var err error
+		if len(req.ExecutionUuids) > 0 {
+			executions, err = j.executionsByUuid(identity.AccountId, req.ExecutionUuids)
+		} else {
+			executions, err = j.accountExecutions(identity.AccountId, since)
+			if err == nil && action == BulkRetake {
+				// Only a routine's latest execution is worth retaking
+				latest := latestPerRoutine(executions)
+				executions = executions[:0]
+				for _, execution := range latest {
+					executions = append(executions, execution)
+				}
+				sort.Slice(executions, func(a, b int) bool {
+					return executions[a].StartedAt > executions[b].StartedAt
+				})
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, execution := range executions {
+			if execution.ExecutionName == "" {
+				items = append(items, BulkItem{
+					ExecutionUuid: execution.ExecutionUuid,
+					Result:        BulkResultSkipped,
+					StatusCode:    http.StatusNotFound,
+					Error:         "Execution not found",
+				})
+				continue
+			}
+			if !req.Selector.matches(execution.ExecutionName, execution.Acronym, execution.Status) {
+				continue
+			}
+			item := BulkItem{
+				ExecutionName: execution.ExecutionName,
+				ExecutionUuid: execution.ExecutionUuid,
+				Acronym:       execution.Acronym,
+				Status:        execution.Status,
+			}
+			if action == BulkStop {
+				if !inProgress(execution.Status) {
+					if len(req.ExecutionUuids) == 0 {
+						continue
+					}
+					item.Result = BulkResultSkipped
+					item.StatusCode = http.StatusConflict
+					item.Error = "Execution is already " + execution.Status
+				}
+			} else {
+				item.version = execution.RoutineVersion
+				item.parameters = mergeBulkParameters(execution.Parameters, req.Parameters)
+				item.retake = req.Retake
+				if item.retake == nil {
+					item.retake = &RetakeInfo{FromStepId: firstFailedStep(execution.Tasks), ExcludingTasks: []string{}}
+				}
+				switch {
+				case execution.Status != "failed" && execution.Status != "stopped":
+					if len(req.ExecutionUuids) == 0 {
+						continue
+					}
+					item.Result = BulkResultSkipped
+					item.StatusCode = http.StatusConflict
+					item.Error = "Only failed or stopped executions can be retaken, execution is " + execution.Status
+				case item.retake.FromStepId == "":
+					item.Result = BulkResultSkipped
+					item.StatusCode = http.StatusUnprocessableEntity
+					item.Error = "No failed step to retake from; pass retake.fromStepId"
+				}
+			}
+			items = append(items, item)
+		}
+	}
+
+	// Acronym restrictions of the caller apply to each target
+	for i := range items {
+		if items[i].Result == "" && items[i].Acronym != "" && !identity.CanAccessAcronym(items[i].Acronym) {
+			items[i].Result = BulkResultSkipped
+			items[i].StatusCode = http.StatusForbidden
+			items[i].Error = "Access to acronym " + items[i].Acronym + " is not allowed"
+		}
+	}
+	return items, nil
+}
+
+// runBulkItem performs the action on one target
+func (j *JMIService) runBulkItem(identity Identity, action string, item *BulkItem) {
+	var status int
+	var response gin.H
+	switch action {
+	case BulkStop:
+		status, response = j.stopExecution(identity, StopExecutionRequest{
+			ExecutionName: item.ExecutionName,
+			ExecutionUuid: item.ExecutionUuid,
+		})
+	default:
+		request := StartExecutionRequest{
+			ExecutionName: item.ExecutionName,
+			Parameters:    item.parameters,
+		}
+		if action == BulkRetake {
+			request.Version = item.version
+			request.Retake = item.retake
+		}
+		status, response = j.startExecution(identity, request)
+	}
+
+	item.StatusCode = status
+	item.Response = response
+	// Starts queued by the routine's overlap policy are accepted with 202
+	if status < http.StatusMultipleChoices {
+		item.Result = BulkResultSucceeded
+		return
+	}
+	item.Result = BulkResultFailed
+	if message, ok := response["error"].(string); ok {
+		item.Error = message
+	}
+}
+
+// bulkHandler answers POST /bulk/{action}: it selects the targets, and unless
+// dryRun is set acts on them with bounded concurrency, reporting every item
+func (j *JMIService) bulkHandler(action string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req BulkRequest
+		if !bindAndValidate(ctx, "bulk-operation", &req, nil) {
+			return
+		}
+		setAuditTarget(ctx, "bulk/"+action)
+
+		listed := len(req.ExecutionNames) > 0
+		if action != BulkStart {
+			listed = len(req.ExecutionUuids) > 0
+		}
+		if !listed && req.Selector.empty() {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Give the targets to " + action + " or a selector (acronym, status or namePrefix)"})
+			return
+		}
+
+		identity := identityFrom(ctx)
+		if req.Selector != nil && req.Selector.Acronym != "" && !identity.CanAccessAcronym(req.Selector.Acronym) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Access to acronym " + req.Selector.Acronym + " is not allowed"})
+			return
+		}
+
+		items, err := j.selectBulkTargets(identity, action, req)
+		if err != nil {
+			log.Printf("ERROR: Failed to select bulk %s targets: %v", action, err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to select targets"})
+			return
+		}
+		if maxItems := bulkMaxItems(); len(items) > maxItems {
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":    fmt.Sprintf("%d targets selected, at most %d per request; narrow the selector", len(items), maxItems),
+				"count":    len(items),
+				"maxItems": maxItems,
+			})
+			return
+		}
+
+		concurrency := req.Concurrency
+		if concurrency == 0 {
+			concurrency = 5
+		}
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, concurrency)
+		for i := range items {
+			if items[i].Result != "" {
+				continue
+			}
+			if req.DryRun {
+				items[i].Result = BulkResultSelected
+				continue
+			}
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(item *BulkItem) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				j.runBulkItem(identity, action, item)
+			}(&items[i])
+		}
+		wg.Wait()
+
+		counts := map[string]int{}
+		for _, item := range items {
+			counts[item.Result]++
+		}
+		log.Printf("JMI bulk %s for account %s: %d targets, %v (dryRun=%t)", action, identity.AccountId, len(items), counts, req.DryRun)
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"action":    action,
+			"dryRun":    req.DryRun,
+			"count":     len(items),
+			"selected":  counts[BulkResultSelected],
+			"succeeded": counts[BulkResultSucceeded],
+			"failed":    counts[BulkResultFailed],
+			"skipped":   counts[BulkResultSkipped],
+			"items":     items,
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBulkSelectorMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector *BulkSelector
+		target   [3]string // name, acronym, status
+		want     bool
+	}{
+		{"no selector", nil, [3]string{"daily-load", "", ""}, true},
+		{"empty selector", &BulkSelector{}, [3]string{"daily-load", "FIN", "failed"}, true},
+		{"acronym matches", &BulkSelector{Acronym: "FIN"}, [3]string{"daily-load", "FIN", "failed"}, true},
+		{"acronym differs", &BulkSelector{Acronym: "FIN"}, [3]string{"daily-load", "HR", "failed"}, false},
+		{"acronym is case sensitive", &BulkSelector{Acronym: "FIN"}, [3]string{"daily-load", "fin", "failed"}, false},
+		{"routine without acronym", &BulkSelector{Acronym: "FIN"}, [3]string{"daily-load", "", "failed"}, false},
+		{"name prefix matches", &BulkSelector{NamePrefix: "daily-"}, [3]string{"daily-load", "", ""}, true},
+		{"name prefix differs", &BulkSelector{NamePrefix: "weekly-"}, [3]string{"daily-load", "", ""}, false},
+		{"status matches", &BulkSelector{Status: "failed"}, [3]string{"daily-load", "", "failed"}, true},
+		{"status differs", &BulkSelector{Status: "failed"}, [3]string{"daily-load", "", "succeeded"}, false},
+		{"never executed", &BulkSelector{Status: "failed"}, [3]string{"daily-load", "", ""}, false},
+		{"all criteria match", &BulkSelector{Acronym: "FIN", Status: "stopped", NamePrefix: "daily"}, [3]string{"daily-load", "FIN", "stopped"}, true},
+		{"one criterion differs", &BulkSelector{Acronym: "FIN", Status: "stopped", NamePrefix: "daily"}, [3]string{"daily-load", "FIN", "failed"}, false},
+		{"since alone selects everything", &BulkSelector{Since: "2025-06-01T00:00:00Z"}, [3]string{"daily-load", "FIN", "failed"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.selector.matches(tt.target[0], tt.target[1], tt.target[2]); got != tt.want {
+				t.Errorf("matches(%q, %q, %q) = %v, want %v", tt.target[0], tt.target[1], tt.target[2], got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBulkSelectorEmpty(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector *BulkSelector
+		want     bool
+	}{
+		{"nil", nil, true},
+		{"no criteria", &BulkSelector{}, true},
+		{"since only", &BulkSelector{Since: "2025-06-01T00:00:00Z"}, true},
+		{"acronym", &BulkSelector{Acronym: "FIN"}, false},
+		{"status", &BulkSelector{Status: "failed"}, false},
+		{"name prefix", &BulkSelector{NamePrefix: "daily-"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.selector.empty(); got != tt.want {
+			t.Errorf("%s: empty() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSummarizeExecutions(t *testing.T) {
+	definition := &RoutineDefinition{CommonProperties: map[string]interface{}{"acronym": "FIN"}}
+	stages := []StageRecord{
+		{ExecutionUuid: "u-1", Stage: "jmr-run", Version: 3, Status: "failed", Tasks: []TaskResult{{StepId: "load", Status: "failed"}}},
+		{ExecutionUuid: "u-1", Stage: "jmi-start", Version: 1, OriginalName: "daily-load", AccountId: "acc-1", Timestamp: 100, RoutineVersion: 2, Definition: definition},
+		{ExecutionUuid: "u-1", Stage: "jmw-process", Version: 2},
+		{ExecutionUuid: "u-2", Stage: "jmi-start", Version: 1, OriginalName: "daily-load", AccountId: "acc-1", Timestamp: 200},
+		{ExecutionUuid: "u-2", Stage: "jmi-stop", Version: 2},
+		{ExecutionUuid: "u-3", Stage: "jmw-wait", Version: 1}, // jmi-start outside the window
+	}
+
+	got := summarizeExecutions(stages)
+	if len(got) != 2 {
+		t.Fatalf("summarizeExecutions() returned %d summaries, want 2", len(got))
+	}
+	if got[0].ExecutionUuid != "u-2" || got[1].ExecutionUuid != "u-1" {
+		t.Errorf("summarizeExecutions() order = %s, %s; want newest first", got[0].ExecutionUuid, got[1].ExecutionUuid)
+	}
+	if got[0].Status != "stopped" {
+		t.Errorf("u-2 status = %s, want stopped", got[0].Status)
+	}
+	failed := got[1]
+	if failed.Status != "failed" || failed.Acronym != "FIN" || failed.RoutineVersion != 2 || failed.ExecutionName != "daily-load" {
+		t.Errorf("u-1 summary = %+v", failed)
+	}
+	if firstFailedStep(failed.Tasks) != "load" {
+		t.Errorf("firstFailedStep() = %q, want load", firstFailedStep(failed.Tasks))
+	}
+
+	latest := latestPerRoutine(got)
+	if len(latest) != 1 || latest["daily-load"].ExecutionUuid != "u-2" {
+		t.Errorf("latestPerRoutine() = %+v, want u-2 for daily-load", latest)
+	}
+}
+
+func TestMergeBulkParameters(t *testing.T) {
+	tests := []struct {
+		name      string
+		execution map[string]interface{}
+		request   map[string]interface{}
+		want      map[string]interface{}
+	}{
+		{"no request parameters", map[string]interface{}{"env": "prod"}, nil, map[string]interface{}{"env": "prod"}},
+		{"request adds", map[string]interface{}{"env": "prod"}, map[string]interface{}{"date": "2025-06-01"}, map[string]interface{}{"env": "prod", "date": "2025-06-01"}},
+		{"request overrides", map[string]interface{}{"env": "prod"}, map[string]interface{}{"env": "dev"}, map[string]interface{}{"env": "dev"}},
+		{"execution without parameters", nil, map[string]interface{}{"env": "dev"}, map[string]interface{}{"env": "dev"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeBulkParameters(tt.execution, tt.request); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeBulkParameters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The execution's parameters are left untouched
+	execution := map[string]interface{}{"env": "prod"}
+	mergeBulkParameters(execution, map[string]interface{}{"env": "dev"})
+	if execution["env"] != "prod" {
+		t.Errorf("mergeBulkParameters() changed the execution's parameters to %v", execution)
+	}
+}
@@ -0,0 +1,762 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// Overlap policies: what a start does when the routine already runs
+// maxConcurrentRuns executions
+const (
+	OverlapSkip           = "skip"            // reject the start with 409
+	OverlapQueue          = "queue"           // accept it with 202 and start it when a run ends
+	OverlapCancelPrevious = "cancel-previous" // stop the oldest running execution and start
+	OverlapAllow          = "allow"           // no limit
+)
+
+var (
+	errRoutineBusy         = errors.New("routine concurrency limit reached")
+	errQueuedNotFound      = errors.New("queued start not found")
+	errConcurrencyNotFound = errors.New("routine concurrency not configured")
+)
+
+// RoutineConcurrency is the concurrency policy of a routine together with its
+// running-executions counter. Both live on one item so acquireExecutionSlot
+// can check the limit in the same conditional write that counts the run. Items
+// are keyed by account too: unregistered routines of different tenants may
+// share a name and must not share a counter.
+type RoutineConcurrency struct {
+	RoutineName       string `json:"routineName" dynamodbav:"routineName"`
+	AccountId         string `json:"accountId" dynamodbav:"accountId"`
+	MaxConcurrentRuns int    `json:"maxConcurrentRuns,omitempty" dynamodbav:"maxConcurrentRuns,omitempty"`
+	OverlapPolicy     string `json:"overlapPolicy,omitempty" dynamodbav:"overlapPolicy,omitempty"`
+	RunningExecutions int    `json:"runningExecutions" dynamodbav:"runningExecutions"`
+	UpdatedBy         string `json:"updatedBy,omitempty" dynamodbav:"updatedBy,omitempty"`
+	UpdatedAt         string `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+}
+
+// RoutineConcurrencyRequest is the payload of PUT /routines/:name/concurrency
+type RoutineConcurrencyRequest struct {
+	MaxConcurrentRuns int    `json:"maxConcurrentRuns"`
+	OverlapPolicy     string `json:"overlapPolicy"`
+}
+
+// QueuedStart is a start accepted under the queue policy, waiting for a run
+// of its routine to end. QueueKey (routineName#queuedAt#uuid) orders the queue
+// of each routine within the account. The dispatcher marks the entry while it
+// starts it, so a stop in between finds it, and keeps an entry JMI refused to
+// start as failed until it expires, so the caller can still see why.
+type QueuedStart struct {
+	AccountId     string                 `json:"accountId" dynamodbav:"accountId"`
+	QueueKey      string                 `json:"-" dynamodbav:"queueKey"`
+	RoutineName   string                 `json:"executionName" dynamodbav:"routineName"`
+	ExecutionUuid string                 `json:"executionUuid" dynamodbav:"executionUuid"`
+	QueuedBy      string                 `json:"queuedBy" dynamodbav:"queuedBy"`
+	Acronyms      []string               `json:"-" dynamodbav:"acronyms,omitempty"`
+	Version       int                    `json:"version,omitempty" dynamodbav:"version,omitempty"`
+	Parameters    map[string]interface{} `json:"parameters,omitempty" dynamodbav:"parameters,omitempty"`
+	Retake        *RetakeInfo            `json:"retake,omitempty" dynamodbav:"retake,omitempty"`
+	Parent        *ParentExecution       `json:"parent,omitempty" dynamodbav:"parent,omitempty"`
+	QueuedAt      string                 `json:"queuedAt" dynamodbav:"queuedAt"`
+	DispatchingAt string                 `json:"-" dynamodbav:"dispatchingAt,omitempty"`
+	FailedAt      string                 `json:"failedAt,omitempty" dynamodbav:"failedAt,omitempty"`
+	Error         string                 `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	ExpiresAt     int64                  `json:"-" dynamodbav:"expiresAt,omitempty"`
+}
+
+// dispatchClaimTimeout is how long a dispatcher's mark holds a queued start;
+// past it, the entry of a replica that died while starting is taken again
+const dispatchClaimTimeout = 5 * time.Minute
+
+// failedStartRetention is how long a queued start JMI refused stays readable
+const failedStartRetention = 7 * 24 * time.Hour
+
+// queueKeyTimeLayout keeps every digit of the nanoseconds, so queue keys sort
+// by the time they were queued; RFC3339Nano drops trailing zeros
+const queueKeyTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// What the dispatcher does with a queued start after asking JMI to start it
+const (
+	dispatchStarted = "started" // remove it from the queue
+	dispatchBlocked = "blocked" // leave it in its place with the rest of the routine's queue
+	dispatchRefused = "refused" // keep it as failed
+)
+
+func (j *JMIService) routineConcurrencyTableName() string {
+	if j.routineConcurrencyTable == "" {
+		return "routine_concurrency"
+	}
+	return j.routineConcurrencyTable
+}
+
+func (j *JMIService) queuedStartTableName() string {
+	if j.queuedStartTable == "" {
+		return "queued_starts"
+	}
+	return j.queuedStartTable
+}
+
+func routineConcurrencyKey(accountId, routineName string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"accountId":   &types.AttributeValueMemberS{Value: accountId},
+		"routineName": &types.AttributeValueMemberS{Value: routineName},
+	}
+}
+
+// getRoutineConcurrency loads the policy and counter of an account's routine
+func (j *JMIService) getRoutineConcurrency(accountId, routineName string) (*RoutineConcurrency, error) {
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName:      aws.String(j.routineConcurrencyTableName()),
+		Key:            routineConcurrencyKey(accountId, routineName),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	concurrency := &RoutineConcurrency{RoutineName: routineName, AccountId: accountId}
+	if result.Item != nil {
+		if err := attributevalue.UnmarshalMap(result.Item, concurrency); err != nil {
+			return nil, err
+		}
+	}
+	return concurrency, nil
+}
+
+// routineBusy is the answer to a start rejected by the routine's limit
+func routineBusy(concurrency *RoutineConcurrency) (int, gin.H) {
+	return http.StatusConflict, gin.H{
+		"error": fmt.Sprintf("Routine %s already runs %d of %d allowed concurrent executions",
+			concurrency.RoutineName, concurrency.RunningExecutions, concurrency.MaxConcurrentRuns),
+		"executionName":     concurrency.RoutineName,
+		"overlapPolicy":     concurrency.OverlapPolicy,
+		"maxConcurrentRuns": concurrency.MaxConcurrentRuns,
+		"runningExecutions": concurrency.RunningExecutions,
+	}
+}
+
+// resolveOverlap applies the routine's overlap policy to a start that found
+// the routine at its limit. It answers for skip and queue; for cancel-previous
+// it stops the oldest running executions and returns their UUIDs with a nil
+// answer, so the caller can take the freed slot.
+func (j *JMIService) resolveOverlap(identity Identity, req StartExecutionRequest, executionUuid string) ([]string, int, gin.H) {
+	concurrency, err := j.getRoutineConcurrency(identity.AccountId, req.ExecutionName)
+	if err != nil {
+		log.Printf("ERROR: Failed to load concurrency of routine %s: %v", req.ExecutionName, err)
+		return nil, http.StatusInternalServerError, gin.H{"error": "Failed to check routine concurrency"}
+	}
+
+	switch concurrency.OverlapPolicy {
+	case OverlapQueue:
+		// The dispatcher retries queued starts itself; they are not queued twice
+		if req.fromQueue {
+			status, response := routineBusy(concurrency)
+			return nil, status, response
+		}
+		status, response := j.queueStart(identity, req, executionUuid, concurrency)
+		return nil, status, response
+
+	case OverlapCancelPrevious:
+		cancelled, err := j.cancelOldestExecutions(identity, req.ExecutionName, concurrency.RunningExecutions-concurrency.MaxConcurrentRuns+1)
+		if err != nil {
+			log.Printf("ERROR: Failed to cancel previous executions of %s: %v", req.ExecutionName, err)
+			return nil, http.StatusInternalServerError, gin.H{"error": "Failed to cancel previous executions"}
+		}
+		return cancelled, 0, nil
+	}
+
+	status, response := routineBusy(concurrency)
+	return nil, status, response
+}
+
+// cancelOldestExecutions stops up to count of the routine's running
+// executions, oldest first, and returns their UUIDs
+func (j *JMIService) cancelOldestExecutions(identity Identity, routineName string, count int) ([]string, error) {
+	if count < 1 {
+		count = 1
+	}
+
+	// Long runs may have started well before today
+	since := time.Now().AddDate(0, 0, -7)
+	var stages []StageRecord
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:                aws.String(j.executionTableName()),
+		IndexName:                aws.String("originalName-timestamp-index"),
+		KeyConditionExpression:   aws.String("originalName = :name AND #ts >= :from"),
+		FilterExpression:         aws.String("accountId = :accountId"),
+		ExpressionAttributeNames: map[string]string{"#ts": "timestamp"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":name":      &types.AttributeValueMemberS{Value: routineName},
+			":from":      &types.AttributeValueMemberN{Value: strconv.FormatInt(since.Unix(), 10)},
+			":accountId": &types.AttributeValueMemberS{Value: identity.AccountId},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		var pageStages []StageRecord
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageStages); err != nil {
+			return nil, err
+		}
+		stages = append(stages, pageStages...)
+	}
+
+	executions := summarizeExecutions(stages)
+	var cancelled []string
+	for i := len(executions) - 1; i >= 0 && len(cancelled) < count; i-- {
+		execution := executions[i]
+		if !inProgress(execution.Status) {
+			continue
+		}
+		status, response := j.stopExecution(identity, StopExecutionRequest{
+			ExecutionName: execution.ExecutionName,
+			ExecutionUuid: execution.ExecutionUuid,
+		})
+		if status != http.StatusOK && status != http.StatusConflict {
+			return cancelled, fmt.Errorf("stopping %s: %v", execution.ExecutionUuid, response["error"])
+		}
+		log.Printf("JMI cancelled execution %s of %s to start a new one", execution.ExecutionUuid, routineName)
+		cancelled = append(cancelled, execution.ExecutionUuid)
+	}
+	return cancelled, nil
+}
+
+// queueStart records a start to be made when a run of the routine ends
+func (j *JMIService) queueStart(identity Identity, req StartExecutionRequest, executionUuid string, concurrency *RoutineConcurrency) (int, gin.H) {
+	queued := newQueuedStart(identity, req, executionUuid, time.Now())
+	if err := j.putQueuedStart(queued); err != nil {
+		log.Printf("ERROR: Failed to queue start of %s: %v", req.ExecutionName, err)
+		return http.StatusInternalServerError, gin.H{"error": "Failed to queue execution"}
+	}
+
+	queue, err := j.routineQueue(identity.AccountId, req.ExecutionName)
+	if err != nil {
+		log.Printf("ERROR: Failed to read queue of %s: %v", req.ExecutionName, err)
+	}
+	position := len(queue)
+	for i, entry := range queue {
+		if entry.ExecutionUuid == executionUuid {
+			position = i + 1
+		}
+	}
+
+	log.Printf("JMI queued execution %s of %s at position %d", executionUuid, req.ExecutionName, position)
+	return http.StatusAccepted, gin.H{
+		"message":           "Execution queued until a running execution of the routine ends",
+		"executionName":     req.ExecutionName,
+		"executionUuid":     executionUuid,
+		"status":            "queued",
+		"position":          position,
+		"overlapPolicy":     concurrency.OverlapPolicy,
+		"maxConcurrentRuns": concurrency.MaxConcurrentRuns,
+		"runningExecutions": concurrency.RunningExecutions,
+	}
+}
+
+// newQueuedStart is the queue entry of a start made by identity at now
+func newQueuedStart(identity Identity, req StartExecutionRequest, executionUuid string, now time.Time) QueuedStart {
+	now = now.UTC()
+	return QueuedStart{
+		AccountId:     identity.AccountId,
+		QueueKey:      req.ExecutionName + "#" + now.Format(queueKeyTimeLayout) + "#" + executionUuid,
+		RoutineName:   req.ExecutionName,
+		ExecutionUuid: executionUuid,
+		QueuedBy:      identity.Subject,
+		Acronyms:      identity.Acronyms,
+		Version:       req.Version,
+		Parameters:    req.Parameters,
+		Retake:        req.Retake,
+		Parent:        req.Parent,
+		QueuedAt:      now.Format(time.RFC3339),
+	}
+}
+
+func (j *JMIService) putQueuedStart(queued QueuedStart) error {
+	item, err := attributevalue.MarshalMap(queued)
+	if err != nil {
+		return err
+	}
+	_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(j.queuedStartTableName()),
+		Item:      item,
+	})
+	return err
+}
+
+// routineQueue returns the starts still queued for an account's routine, in
+// queue order
+func (j *JMIService) routineQueue(accountId, routineName string) ([]QueuedStart, error) {
+	var queue []QueuedStart
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.queuedStartTableName()),
+		KeyConditionExpression: aws.String("accountId = :accountId AND begins_with(queueKey, :prefix)"),
+		FilterExpression:       aws.String("routineName = :name AND attribute_not_exists(failedAt)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: accountId},
+			":prefix":    &types.AttributeValueMemberS{Value: routineName + "#"},
+			":name":      &types.AttributeValueMemberS{Value: routineName},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		var pageQueue []QueuedStart
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageQueue); err != nil {
+			return nil, err
+		}
+		queue = append(queue, pageQueue...)
+	}
+	return queue, nil
+}
+
+// findQueuedStart looks a queued start up by the UUID it was given
+func (j *JMIService) findQueuedStart(accountId, executionUuid string) (*QueuedStart, error) {
+	items, err := j.queryIndex(j.queuedStartTableName(), "executionUuid-index", "executionUuid", executionUuid)
+	if err != nil {
+		return nil, err
+	}
+	var found []QueuedStart
+	if err := attributevalue.UnmarshalListOfMaps(items, &found); err != nil {
+		return nil, err
+	}
+	// Other tenants' starts are reported as missing
+	if len(found) == 0 || found[0].AccountId != accountId {
+		return nil, errQueuedNotFound
+	}
+	return &found[0], nil
+}
+
+// removeQueuedStart drops a queued start nobody is starting, reporting false
+// when the dispatcher or another stop got to it first
+func (j *JMIService) removeQueuedStart(queued QueuedStart) (bool, error) {
+	_, err := j.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName:           aws.String(j.queuedStartTableName()),
+		Key:                 queuedStartKey(queued),
+		ConditionExpression: aws.String("attribute_exists(queueKey) AND attribute_not_exists(dispatchingAt) AND attribute_not_exists(failedAt)"),
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func queuedStartKey(queued QueuedStart) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"accountId": &types.AttributeValueMemberS{Value: queued.AccountId},
+		"queueKey":  &types.AttributeValueMemberS{Value: queued.QueueKey},
+	}
+}
+
+// claimQueuedStart marks a queued start as being started by this replica,
+// reporting false when a stop removed it or another replica holds it. The
+// entry stays in place until the start is made, so a stop meanwhile is told
+// to retry instead of finding nothing.
+func (j *JMIService) claimQueuedStart(queued QueuedStart) (bool, error) {
+	now := time.Now().UTC()
+	_, err := j.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:        aws.String(j.queuedStartTableName()),
+		Key:              queuedStartKey(queued),
+		UpdateExpression: aws.String("SET dispatchingAt = :now"),
+		ConditionExpression: aws.String("attribute_exists(queueKey) AND attribute_not_exists(failedAt) AND " +
+			"(attribute_not_exists(dispatchingAt) OR dispatchingAt < :stale)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now":   &types.AttributeValueMemberS{Value: now.Format(time.RFC3339Nano)},
+			":stale": &types.AttributeValueMemberS{Value: now.Add(-dispatchClaimTimeout).Format(time.RFC3339Nano)},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// releaseQueuedStart gives a claimed start back to the queue, in its place
+func (j *JMIService) releaseQueuedStart(queued QueuedStart) error {
+	_, err := j.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:        aws.String(j.queuedStartTableName()),
+		Key:              queuedStartKey(queued),
+		UpdateExpression: aws.String("REMOVE dispatchingAt"),
+	})
+	return err
+}
+
+// deleteQueuedStart drops a claimed start once it has been made
+func (j *JMIService) deleteQueuedStart(queued QueuedStart) error {
+	_, err := j.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(j.queuedStartTableName()),
+		Key:       queuedStartKey(queued),
+	})
+	return err
+}
+
+// failQueuedStart keeps a start JMI refused as failed, so GET /executions
+// shows why, and tells the account's webhooks and a parent parked on it
+func (j *JMIService) failQueuedStart(queued QueuedStart, status int, reason string) {
+	now := time.Now().UTC()
+	_, err := j.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:        aws.String(j.queuedStartTableName()),
+		Key:              queuedStartKey(queued),
+		UpdateExpression: aws.String("SET failedAt = :now, #error = :error, expiresAt = :expiresAt REMOVE dispatchingAt"),
+		ExpressionAttributeNames: map[string]string{
+			"#error": "error",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now":       &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+			":error":     &types.AttributeValueMemberS{Value: fmt.Sprintf("%d: %s", status, reason)},
+			":expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(failedStartRetention).Unix(), 10)},
+		},
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to record failed start %s of %s: %v", queued.ExecutionUuid, queued.RoutineName, err)
+	}
+
+	log.Printf("ERROR: Queued start %s of %s failed: %d %s", queued.ExecutionUuid, queued.RoutineName, status, reason)
+	j.dispatchWebhookEvent(WebhookEvent{
+		EventId:       "queued#" + queued.ExecutionUuid,
+		Type:          "execution.completed",
+		Status:        WebhookStatusFailed,
+		AccountId:     queued.AccountId,
+		RoutineName:   queued.RoutineName,
+		ExecutionUuid: queued.ExecutionUuid,
+		Stage:         "jmi-queue",
+		Timestamp:     now.Unix(),
+		Details:       map[string]interface{}{"error": reason, "statusCode": status},
+	})
+	j.wakeWaiters(queued.AccountId, "execution#"+queued.ExecutionUuid+"#")
+}
+
+// startedAlready reports whether the start of a queued entry was made by a
+// replica that died before dropping the entry
+func (j *JMIService) startedAlready(queued QueuedStart) (bool, error) {
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(j.executionTableName()),
+		Key: map[string]types.AttributeValue{
+			"executionName": &types.AttributeValueMemberS{Value: executionKey(queued.RoutineName, queued.ExecutionUuid, 1, "jmi-start")},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.Item != nil, nil
+}
+
+// startQueueDispatcher starts queued executions as runs of their routines end,
+// checking every QUEUE_DISPATCH_INTERVAL seconds (default 5)
+func (j *JMIService) startQueueDispatcher() {
+	interval := 5 * time.Second
+	if value, err := strconv.Atoi(os.Getenv("QUEUE_DISPATCH_INTERVAL")); err == nil && value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.receiveCtx.Done():
+			log.Println("Queue dispatcher stopped")
+			return
+		case <-ticker.C:
+			j.dispatchQueuedStarts()
+		}
+	}
+}
+
+func (j *JMIService) dispatchQueuedStarts() {
+	var queued []QueuedStart
+	paginator := dynamodb.NewScanPaginator(j.dynamoClient, &dynamodb.ScanInput{
+		TableName:        aws.String(j.queuedStartTableName()),
+		FilterExpression: aws.String("attribute_not_exists(failedAt)"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("ERROR: Failed to scan queued starts: %v", err)
+			return
+		}
+		var pageQueued []QueuedStart
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageQueued); err != nil {
+			log.Printf("ERROR: Failed to unmarshal queued starts: %v", err)
+			return
+		}
+		queued = append(queued, pageQueued...)
+	}
+
+	sortQueuedStarts(queued)
+
+	// Start each routine's queue in order until the routine is full again
+	blocked := make(map[string]bool)
+	for _, entry := range queued {
+		routineKey := entry.AccountId + "#" + entry.RoutineName
+		if blocked[routineKey] {
+			continue
+		}
+		claimed, err := j.claimQueuedStart(entry)
+		if err != nil {
+			log.Printf("ERROR: Failed to claim queued start %s: %v", entry.ExecutionUuid, err)
+			blocked[routineKey] = true
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		// A mark left by a replica that died may hide a start it already made
+		if entry.DispatchingAt != "" {
+			started, err := j.startedAlready(entry)
+			if err != nil {
+				log.Printf("ERROR: Failed to check queued start %s: %v", entry.ExecutionUuid, err)
+				blocked[routineKey] = true
+				if err := j.releaseQueuedStart(entry); err != nil {
+					log.Printf("ERROR: Failed to requeue start %s of %s: %v", entry.ExecutionUuid, entry.RoutineName, err)
+				}
+				continue
+			}
+			if started {
+				if err := j.deleteQueuedStart(entry); err != nil {
+					log.Printf("ERROR: Failed to remove started queued start %s: %v", entry.ExecutionUuid, err)
+				}
+				continue
+			}
+		}
+
+		status, response := j.startExecution(Identity{
+			Subject:   entry.QueuedBy,
+			AccountId: entry.AccountId,
+			Acronyms:  entry.Acronyms,
+		}, StartExecutionRequest{
+			ExecutionName: entry.RoutineName,
+			Version:       entry.Version,
+			Retake:        entry.Retake,
+			Parameters:    entry.Parameters,
+			Parent:        entry.Parent,
+			executionUuid: entry.ExecutionUuid,
+			fromQueue:     true,
+		})
+		switch dispatchOutcome(status) {
+		case dispatchStarted:
+			log.Printf("JMI started queued execution %s of %s", entry.ExecutionUuid, entry.RoutineName)
+			if err := j.deleteQueuedStart(entry); err != nil {
+				log.Printf("ERROR: Failed to remove started queued start %s: %v", entry.ExecutionUuid, err)
+			}
+		case dispatchBlocked:
+			blocked[routineKey] = true
+			if err := j.releaseQueuedStart(entry); err != nil {
+				log.Printf("ERROR: Failed to requeue start %s of %s: %v", entry.ExecutionUuid, entry.RoutineName, err)
+			}
+		case dispatchRefused:
+			reason, _ := response["error"].(string)
+			j.failQueuedStart(entry, status, reason)
+		}
+	}
+}
+
+// sortQueuedStarts puts the queued starts in dispatch order: by account, then
+// by routine and the time each start was queued
+func sortQueuedStarts(queued []QueuedStart) {
+	sort.Slice(queued, func(a, b int) bool {
+		if queued[a].AccountId != queued[b].AccountId {
+			return queued[a].AccountId < queued[b].AccountId
+		}
+		return queued[a].QueueKey < queued[b].QueueKey
+	})
+}
+
+// dispatchOutcome classifies JMI's answer to a queued start. A conflict (the
+// routine is still full), throttling or a server error leave it queued;
+// any other refusal will not change by retrying.
+func dispatchOutcome(status int) string {
+	switch {
+	case status == http.StatusOK:
+		return dispatchStarted
+	case status == http.StatusConflict || status == http.StatusTooManyRequests || status >= http.StatusInternalServerError:
+		return dispatchBlocked
+	}
+	return dispatchRefused
+}
+
+// GetRoutineConcurrency reports a routine's policy, running count and queue
+func (j *JMIService) GetRoutineConcurrency(ctx *gin.Context) {
+	routineName := ctx.Param("name")
+	concurrency, ok := j.loadOwnConcurrency(ctx, routineName)
+	if !ok {
+		return
+	}
+
+	queue, err := j.routineQueue(concurrency.AccountId, routineName)
+	if err != nil {
+		log.Printf("Error reading queue of %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read routine queue"})
+		return
+	}
+	if queue == nil {
+		queue = []QueuedStart{}
+	}
+	if concurrency.OverlapPolicy == "" {
+		concurrency.OverlapPolicy = OverlapAllow
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"routineName":       routineName,
+		"maxConcurrentRuns": concurrency.MaxConcurrentRuns,
+		"overlapPolicy":     concurrency.OverlapPolicy,
+		"runningExecutions": concurrency.RunningExecutions,
+		"updatedBy":         concurrency.UpdatedBy,
+		"updatedAt":         concurrency.UpdatedAt,
+		"queued":            queue,
+	})
+}
+
+// loadOwnConcurrency loads the concurrency of one of the caller's routines,
+// answering 404 for routines of other tenants
+func (j *JMIService) loadOwnConcurrency(ctx *gin.Context, routineName string) (*RoutineConcurrency, bool) {
+	definition, err := j.getRoutineVersion(identityFrom(ctx).AccountId, routineName, 0)
+	if err != nil && !errors.Is(err, errRoutineNotFound) {
+		log.Printf("Error loading routine %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load routine"})
+		return nil, false
+	}
+	if definition == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Routine not found"})
+		return nil, false
+	}
+
+	concurrency, err := j.getRoutineConcurrency(identityFrom(ctx).AccountId, routineName)
+	if err != nil {
+		log.Printf("Error loading concurrency of %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load routine concurrency"})
+		return nil, false
+	}
+	return concurrency, true
+}
+
+// PutRoutineConcurrency sets the routine's maxConcurrentRuns and overlap
+// policy, keeping its running-executions counter
+func (j *JMIService) PutRoutineConcurrency(ctx *gin.Context) {
+	routineName := ctx.Param("name")
+	setAuditTarget(ctx, "routine/"+routineName)
+
+	var req RoutineConcurrencyRequest
+	if !bindAndValidate(ctx, "routine-concurrency", &req, nil) {
+		return
+	}
+	if _, ok := j.loadOwnConcurrency(ctx, routineName); !ok {
+		return
+	}
+
+	identity := identityFrom(ctx)
+	result, err := j.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName: aws.String(j.routineConcurrencyTableName()),
+		Key:       routineConcurrencyKey(identity.AccountId, routineName),
+		UpdateExpression: aws.String("SET maxConcurrentRuns = :max, overlapPolicy = :policy, " +
+			"runningExecutions = if_not_exists(runningExecutions, :zero), updatedBy = :subject, updatedAt = :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":max":     &types.AttributeValueMemberN{Value: strconv.Itoa(req.MaxConcurrentRuns)},
+			":policy":  &types.AttributeValueMemberS{Value: req.OverlapPolicy},
+			":zero":    &types.AttributeValueMemberN{Value: "0"},
+			":subject": &types.AttributeValueMemberS{Value: identity.Subject},
+			":now":     &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		log.Printf("Error storing concurrency of %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store routine concurrency"})
+		return
+	}
+
+	var concurrency RoutineConcurrency
+	if err := attributevalue.UnmarshalMap(result.Attributes, &concurrency); err != nil {
+		log.Printf("Error unmarshaling concurrency of %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process routine concurrency"})
+		return
+	}
+
+	log.Printf("JMI set concurrency of routine %s to %d (%s)", routineName, req.MaxConcurrentRuns, req.OverlapPolicy)
+	ctx.JSON(http.StatusOK, concurrency)
+}
+
+// DeleteRoutineConcurrency removes the routine's limit; runs keep being counted
+func (j *JMIService) DeleteRoutineConcurrency(ctx *gin.Context) {
+	routineName := ctx.Param("name")
+	setAuditTarget(ctx, "routine/"+routineName)
+
+	concurrency, ok := j.loadOwnConcurrency(ctx, routineName)
+	if !ok {
+		return
+	}
+	if concurrency.MaxConcurrentRuns == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": errConcurrencyNotFound.Error()})
+		return
+	}
+
+	_, err := j.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:        aws.String(j.routineConcurrencyTableName()),
+		Key:              routineConcurrencyKey(concurrency.AccountId, routineName),
+		UpdateExpression: aws.String("REMOVE maxConcurrentRuns, overlapPolicy"),
+	})
+	if err != nil {
+		log.Printf("Error deleting concurrency of %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete routine concurrency"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Routine concurrency limit removed", "routineName": routineName})
+}
+
+// cancelQueuedStart drops a start still waiting in its routine's queue; stops
+// of executions that are neither running nor queued are reported as missing
+func (j *JMIService) cancelQueuedStart(identity Identity, req StopExecutionRequest) (int, gin.H) {
+	queued, err := j.findQueuedStart(identity.AccountId, req.ExecutionUuid)
+	if errors.Is(err, errQueuedNotFound) || (err == nil && queued.RoutineName != req.ExecutionName) {
+		return http.StatusNotFound, gin.H{"error": "Execution not found"}
+	}
+	if err != nil {
+		log.Printf("Error looking up queued start %s: %v", req.ExecutionUuid, err)
+		return http.StatusInternalServerError, gin.H{"error": "Failed to find execution"}
+	}
+
+	if queued.FailedAt != "" {
+		return http.StatusConflict, gin.H{"error": "Queued execution already failed to start", "reason": queued.Error}
+	}
+
+	removed, err := j.removeQueuedStart(*queued)
+	if err != nil {
+		log.Printf("Error removing queued start %s: %v", req.ExecutionUuid, err)
+		return http.StatusInternalServerError, gin.H{"error": "Failed to cancel queued execution"}
+	}
+	if !removed {
+		// The dispatcher started it in the meantime
+		return http.StatusConflict, gin.H{"error": "Queued execution is being started, stop it again"}
+	}
+
+	log.Printf("JMI cancelled queued execution %s of %s", queued.ExecutionUuid, queued.RoutineName)
+	j.wakeWaiters(identity.AccountId, "execution#"+queued.ExecutionUuid+"#")
+	return http.StatusOK, gin.H{
+		"message":       "Queued execution cancelled",
+		"executionName": queued.RoutineName,
+		"executionUuid": queued.ExecutionUuid,
+		"status":        "cancelled",
+		"stoppedBy":     identity.Subject,
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDispatchOutcome(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		want   string
+	}{
+		{"started", http.StatusOK, dispatchStarted},
+		{"routine still full", http.StatusConflict, dispatchBlocked},
+		{"tenant quota reached", http.StatusTooManyRequests, dispatchBlocked},
+		{"server error", http.StatusInternalServerError, dispatchBlocked},
+		{"queue unavailable", http.StatusServiceUnavailable, dispatchBlocked},
+		{"invalid retake", http.StatusBadRequest, dispatchRefused},
+		{"no longer allowed", http.StatusForbidden, dispatchRefused},
+		{"routine deleted", http.StatusNotFound, dispatchRefused},
+		{"invalid parameters", http.StatusUnprocessableEntity, dispatchRefused},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dispatchOutcome(tt.status); got != tt.want {
+				t.Errorf("dispatchOutcome(%d) = %s, want %s", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewQueuedStart(t *testing.T) {
+	saoPaulo := time.FixedZone("BRT", -3*60*60)
+	identity := Identity{Subject: "ops", AccountId: "acc-1", Acronyms: []string{"FIN"}}
+	req := StartExecutionRequest{ExecutionName: "daily-load", Version: 2, Parameters: map[string]interface{}{"env": "prod"}}
+	queued := newQueuedStart(identity, req, "u-1", time.Date(2025, 6, 1, 7, 0, 0, 500000000, saoPaulo))
+
+	if want := "daily-load#2025-06-01T10:00:00.500000000Z#u-1"; queued.QueueKey != want {
+		t.Errorf("QueueKey = %q, want %q", queued.QueueKey, want)
+	}
+	if queued.QueuedAt != "2025-06-01T10:00:00Z" {
+		t.Errorf("QueuedAt = %q, want UTC", queued.QueuedAt)
+	}
+	if queued.AccountId != "acc-1" || queued.QueuedBy != "ops" || queued.RoutineName != "daily-load" ||
+		queued.ExecutionUuid != "u-1" || queued.Version != 2 || queued.Parameters["env"] != "prod" {
+		t.Errorf("newQueuedStart() = %+v", queued)
+	}
+	// routineQueue reads a routine's queue by this prefix
+	if !strings.HasPrefix(queued.QueueKey, "daily-load#") {
+		t.Errorf("QueueKey %q does not start with the routine name", queued.QueueKey)
+	}
+}
+
+func TestSortQueuedStarts(t *testing.T) {
+	base := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	queue := func(accountId, routineName, uuid string, offset time.Duration) QueuedStart {
+		return newQueuedStart(Identity{AccountId: accountId}, StartExecutionRequest{ExecutionName: routineName}, uuid, base.Add(offset))
+	}
+
+	tests := []struct {
+		name   string
+		queued []QueuedStart
+		want   []string
+	}{
+		{
+			"oldest start first",
+			[]QueuedStart{
+				queue("acc-1", "load", "third", 2*time.Second),
+				queue("acc-1", "load", "first", 0),
+				queue("acc-1", "load", "second", time.Second),
+			},
+			[]string{"first", "second", "third"},
+		},
+		{
+			"fractions of a second",
+			[]QueuedStart{
+				queue("acc-1", "load", "later", 510*time.Millisecond),
+				queue("acc-1", "load", "earlier", 500*time.Millisecond),
+				queue("acc-1", "load", "whole second", 0),
+			},
+			[]string{"whole second", "earlier", "later"},
+		},
+		{
+			"grouped by account and routine",
+			[]QueuedStart{
+				queue("acc-2", "load", "acc-2 load", 0),
+				queue("acc-1", "report", "acc-1 report", 0),
+				queue("acc-1", "load", "acc-1 load later", time.Minute),
+				queue("acc-1", "load", "acc-1 load", 0),
+			},
+			[]string{"acc-1 load", "acc-1 load later", "acc-1 report", "acc-2 load"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sortQueuedStarts(tt.queued)
+			for i, queued := range tt.queued {
+				if queued.ExecutionUuid != tt.want[i] {
+					t.Errorf("position %d = %s, want %s", i, queued.ExecutionUuid, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRoutineBusy(t *testing.T) {
+	status, response := routineBusy(&RoutineConcurrency{
+		RoutineName:       "daily-load",
+		MaxConcurrentRuns: 2,
+		OverlapPolicy:     OverlapSkip,
+		RunningExecutions: 2,
+	})
+	if status != http.StatusConflict {
+		t.Errorf("routineBusy() status = %d, want %d", status, http.StatusConflict)
+	}
+	if response["error"] != "Routine daily-load already runs 2 of 2 allowed concurrent executions" ||
+		response["overlapPolicy"] != OverlapSkip || response["maxConcurrentRuns"] != 2 || response["runningExecutions"] != 2 {
+		t.Errorf("routineBusy() response = %v", response)
+	}
+}
+
+func TestRoutineConcurrencySchema(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		valid bool
+	}{
+		{"queue", `{"maxConcurrentRuns": 1, "overlapPolicy": "queue"}`, true},
+		{"skip", `{"maxConcurrentRuns": 3, "overlapPolicy": "skip"}`, true},
+		{"cancel-previous", `{"maxConcurrentRuns": 1, "overlapPolicy": "cancel-previous"}`, true},
+		{"allow", `{"maxConcurrentRuns": 1, "overlapPolicy": "allow"}`, true},
+		{"zero runs", `{"maxConcurrentRuns": 0, "overlapPolicy": "skip"}`, false},
+		{"fractional runs", `{"maxConcurrentRuns": 1.5, "overlapPolicy": "skip"}`, false},
+		{"unknown policy", `{"maxConcurrentRuns": 1, "overlapPolicy": "replace"}`, false},
+		{"missing policy", `{"maxConcurrentRuns": 1}`, false},
+		{"missing limit", `{"overlapPolicy": "queue"}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := validateSchema("routine-concurrency", []byte(tt.body))
+			if err != nil {
+				t.Fatalf("validateSchema(): %v", err)
+			}
+			if valid := len(violations) == 0; valid != tt.valid {
+				t.Errorf("validateSchema(%s) violations = %v, want valid %v", tt.body, violations, tt.valid)
+			}
+		})
+	}
+}
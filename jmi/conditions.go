@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// Order date keywords, as in Control-M: the execution's (or today's) order
+// date, the day before, the day after, and any date (waits and deletes only)
+const (
+	OrderDateCurrent  = "ODAT"
+	OrderDatePrevious = "PREV"
+	OrderDateNext     = "NEXT"
+	AnyOrderDate      = "****"
+	orderDateLayout   = "20060102"
+)
+
+// Same rule as condition.name in scheduler-routine.schema.json
+var conditionName = regexp.MustCompile(`^[A-Za-z0-9._-]{1,255}$`)
+
+// Condition is a named flag for an order date, e.g. LOAD_OK for 20261016.
+// Steps wait for conditions and add or delete them when they end, and
+// external systems set them through /conditions.
+type Condition struct {
+	Name      string `json:"name" dynamodbav:"name"`
+	OrderDate string `json:"orderDate,omitempty" dynamodbav:"orderDate,omitempty"` // Defaults to ODAT
+}
+
+// ConditionActions are the conditions a step adds and deletes when it ends
+type ConditionActions struct {
+	AddConditions    []Condition `json:"addConditions,omitempty" dynamodbav:"addConditions,omitempty"`
+	DeleteConditions []Condition `json:"deleteConditions,omitempty" dynamodbav:"deleteConditions,omitempty"`
+}
+
+// ConditionRecord is a condition set for a tenant; conditionKey is name#orderDate
+type ConditionRecord struct {
+	AccountId     string `json:"-" dynamodbav:"accountId"`
+	ConditionKey  string `json:"-" dynamodbav:"conditionKey"`
+	Name          string `json:"name" dynamodbav:"name"`
+	OrderDate     string `json:"orderDate" dynamodbav:"orderDate"`
+	CreatedBy     string `json:"createdBy" dynamodbav:"createdBy"`
+	CreatedAt     string `json:"createdAt" dynamodbav:"createdAt"`
+	ExecutionUuid string `json:"executionUuid,omitempty" dynamodbav:"executionUuid,omitempty"` // Set when a step added it
+}
+
+func (j *JMIService) conditionTableName() string {
+	if j.conditionTable == "" {
+		return "conditions"
+	}
+	return j.conditionTable
+}
+
+// resolveOrderDate turns ODAT, PREV, NEXT or a YYYYMMDD date into a YYYYMMDD
+// date relative to today, the order date of conditions set through the API
+func resolveOrderDate(orderDate string) (string, bool) {
+	today := time.Now().UTC()
+	switch orderDate {
+	case "", OrderDateCurrent:
+		return today.Format(orderDateLayout), true
+	case OrderDatePrevious:
+		return today.AddDate(0, 0, -1).Format(orderDateLayout), true
+	case OrderDateNext:
+		return today.AddDate(0, 0, 1).Format(orderDateLayout), true
+	}
+	if _, err := time.Parse(orderDateLayout, orderDate); err != nil {
+		return "", false
+	}
+	return orderDate, true
+}
+
+func conditionKey(name, orderDate string) string {
+	return name + "#" + orderDate
+}
+
+// queryConditions returns the tenant's conditions, optionally only those named name
+func (j *JMIService) queryConditions(accountId, name string) ([]ConditionRecord, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(j.conditionTableName()),
+		KeyConditionExpression: aws.String("accountId = :accountId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: accountId},
+		},
+	}
+	if name != "" {
+		input.KeyConditionExpression = aws.String("accountId = :accountId AND begins_with(conditionKey, :prefix)")
+		input.ExpressionAttributeValues[":prefix"] = &types.AttributeValueMemberS{Value: name + "#"}
+	}
+
+	var conditions []ConditionRecord
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		var pageConditions []ConditionRecord
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageConditions); err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, pageConditions...)
+	}
+	return conditions, nil
+}
+
+// GetConditions lists the tenant's conditions, filtered by ?name= and ?orderDate=
+func (j *JMIService) GetConditions(ctx *gin.Context) {
+	name := ctx.Query("name")
+	orderDate := ctx.Query("orderDate")
+	if name != "" && !conditionName.MatchString(name) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid condition name"})
+		return
+	}
+	if orderDate != "" && orderDate != AnyOrderDate {
+		resolved, ok := resolveOrderDate(orderDate)
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "orderDate must be YYYYMMDD, ODAT, PREV, NEXT or ****"})
+			return
+		}
+		orderDate = resolved
+	}
+
+	conditions, err := j.queryConditions(identityFrom(ctx).AccountId, name)
+	if err != nil {
+		log.Printf("Error querying conditions: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve conditions"})
+		return
+	}
+
+	filtered := make([]ConditionRecord, 0, len(conditions))
+	for _, condition := range conditions {
+		if orderDate == "" || orderDate == AnyOrderDate || condition.OrderDate == orderDate {
+			filtered = append(filtered, condition)
+		}
+	}
+	sort.SliceStable(filtered, func(a, b int) bool {
+		if filtered[a].Name != filtered[b].Name {
+			return filtered[a].Name < filtered[b].Name
+		}
+		return filtered[a].OrderDate < filtered[b].OrderDate
+	})
+	ctx.JSON(http.StatusOK, gin.H{"conditions": filtered, "count": len(filtered)})
+}
+
+// GetCondition reports whether a condition is set for an order date
+func (j *JMIService) GetCondition(ctx *gin.Context) {
+	name := ctx.Param("name")
+	orderDate, ok := resolveOrderDate(ctx.Param("orderDate"))
+	if !conditionName.MatchString(name) || !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid condition name or orderDate"})
+		return
+	}
+
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(j.conditionTableName()),
+		Key: map[string]types.AttributeValue{
+			"accountId":    &types.AttributeValueMemberS{Value: identityFrom(ctx).AccountId},
+			"conditionKey": &types.AttributeValueMemberS{Value: conditionKey(name, orderDate)},
+		},
+	})
+	if err != nil {
+		log.Printf("Error loading condition %s %s: %v", name, orderDate, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve condition"})
+		return
+	}
+	if result.Item == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Condition not found"})
+		return
+	}
+
+	var condition ConditionRecord
+	if err := attributevalue.UnmarshalMap(result.Item, &condition); err != nil {
+		log.Printf("Error unmarshaling condition %s %s: %v", name, orderDate, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process condition"})
+		return
+	}
+	ctx.JSON(http.StatusOK, condition)
+}
+
+// AddCondition sets a condition; setting one that exists is a no-op answered with 200
+func (j *JMIService) AddCondition(ctx *gin.Context) {
+	var req Condition
+	if !bindAndValidate(ctx, "condition", &req, nil) {
+		return
+	}
+	orderDate, ok := resolveOrderDate(req.OrderDate)
+	if !ok {
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": "orderDate is not a valid YYYYMMDD date"})
+		return
+	}
+	setAuditTarget(ctx, "condition/"+req.Name+"/"+orderDate)
+
+	identity := identityFrom(ctx)
+	condition := ConditionRecord{
+		AccountId:    identity.AccountId,
+		ConditionKey: conditionKey(req.Name, orderDate),
+		Name:         req.Name,
+		OrderDate:    orderDate,
+		CreatedBy:    identity.Subject,
+		CreatedAt:    time.Now().Format(time.RFC3339),
+	}
+	item, err := attributevalue.MarshalMap(condition)
+	if err != nil {
+		log.Printf("Error marshaling condition %s %s: %v", req.Name, orderDate, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process condition"})
+		return
+	}
+
+	_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String(j.conditionTableName()),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(conditionKey)"),
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		// Executions that parked while it was being set may still be listed
+		j.wakeConditionWaiters(identity.AccountId, req.Name, orderDate)
+		ctx.JSON(http.StatusOK, gin.H{"name": req.Name, "orderDate": orderDate, "created": false})
+		return
+	}
+	if err != nil {
+		log.Printf("Error storing condition %s %s: %v", req.Name, orderDate, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store condition"})
+		return
+	}
+
+	log.Printf("JMI added condition %s for %s", req.Name, orderDate)
+	j.wakeConditionWaiters(identity.AccountId, req.Name, orderDate)
+	ctx.JSON(http.StatusCreated, condition)
+}
+
+// DeleteCondition removes a condition; orderDate **** removes it for every date
+func (j *JMIService) DeleteCondition(ctx *gin.Context) {
+	identity := identityFrom(ctx)
+	name := ctx.Param("name")
+	orderDate := ctx.Param("orderDate")
+	setAuditTarget(ctx, "condition/"+name+"/"+orderDate)
+
+	if !conditionName.MatchString(name) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid condition name"})
+		return
+	}
+
+	var keys []string
+	if orderDate == AnyOrderDate {
+		conditions, err := j.queryConditions(identity.AccountId, name)
+		if err != nil {
+			log.Printf("Error querying condition %s: %v", name, err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve condition"})
+			return
+		}
+		for _, condition := range conditions {
+			keys = append(keys, condition.ConditionKey)
+		}
+	} else {
+		resolved, ok := resolveOrderDate(orderDate)
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "orderDate must be YYYYMMDD, ODAT, PREV, NEXT or ****"})
+			return
+		}
+		keys = []string{conditionKey(name, resolved)}
+	}
+
+	deleted := 0
+	for _, key := range keys {
+		_, err := j.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+			TableName: aws.String(j.conditionTableName()),
+			Key: map[string]types.AttributeValue{
+				"accountId":    &types.AttributeValueMemberS{Value: identity.AccountId},
+				"conditionKey": &types.AttributeValueMemberS{Value: key},
+			},
+			ConditionExpression: aws.String("attribute_exists(conditionKey)"),
+		})
+		var conditionErr *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionErr) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error deleting condition %s: %v", key, err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete condition"})
+			return
+		}
+		deleted++
+	}
+
+	if deleted == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Condition not found"})
+		return
+	}
+	log.Printf("JMI deleted %d condition(s) %s for %s", deleted, name, orderDate)
+	ctx.JSON(http.StatusOK, gin.H{"name": name, "orderDate": orderDate, "deleted": deleted})
+}
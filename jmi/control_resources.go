@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// Control resource modes: any number of shared holders, or one exclusive holder
+const (
+	LockExclusive = "exclusive"
+	LockShared    = "shared"
+)
+
+// lockSummaryId is the holderId of the item carrying a resource's lock state
+const lockSummaryId = "#"
+
+// ControlResource is a named lock a routine or one of its steps requires.
+// JMW takes every lock of an execution before dispatching it to JMR.
+type ControlResource struct {
+	Name string `json:"name" dynamodbav:"name"`
+	Mode string `json:"mode,omitempty" dynamodbav:"mode,omitempty"` // Defaults to exclusive
+}
+
+// ControlLock is an execution holding, or waiting for, a control resource.
+// The item with holderId "#" carries the resource's exclusiveHolder and
+// sharedCount, which JMW's conditional writes check.
+type ControlLock struct {
+	ResourceKey     string `json:"-" dynamodbav:"resourceKey"` // accountId#name
+	HolderId        string `json:"-" dynamodbav:"holderId"`
+	AccountId       string `json:"-" dynamodbav:"accountId"`
+	Name            string `json:"-" dynamodbav:"name"`
+	State           string `json:"-" dynamodbav:"state,omitempty"`
+	Mode            string `json:"mode,omitempty" dynamodbav:"mode,omitempty"`
+	ExecutionName   string `json:"executionName,omitempty" dynamodbav:"executionName,omitempty"`
+	ExecutionUuid   string `json:"executionUuid,omitempty" dynamodbav:"executionUuid,omitempty"`
+	Since           string `json:"since,omitempty" dynamodbav:"since,omitempty"`
+	ExclusiveHolder string `json:"-" dynamodbav:"exclusiveHolder,omitempty"`
+	SharedCount     int    `json:"-" dynamodbav:"sharedCount,omitempty"`
+}
+
+// controlResourceStatus is a resource as reported by /control-resources
+type controlResourceStatus struct {
+	Name    string        `json:"name"`
+	Mode    string        `json:"mode"` // exclusive, shared or free
+	Holders []ControlLock `json:"holders"`
+	Waiters []ControlLock `json:"waiters"`
+}
+
+func (j *JMIService) controlResourceTableName() string {
+	if j.controlResourceTable == "" {
+		return "control_resources"
+	}
+	return j.controlResourceTable
+}
+
+// releaseControlLocks frees every control resource the execution holds and
+// takes it off the waiter lists. The deletes are conditional, so whichever of
+// JMI (stop) or JMR (completion) gets there first releases the locks.
+func (j *JMIService) releaseControlLocks(executionUuid string) {
+	items, err := j.queryIndex(j.controlResourceTableName(), "executionUuid-index", "executionUuid", executionUuid)
+	if err != nil {
+		log.Printf("ERROR: Failed to query control locks of %s: %v", executionUuid, err)
+		return
+	}
+	var locks []ControlLock
+	if err := attributevalue.UnmarshalListOfMaps(items, &locks); err != nil {
+		log.Printf("ERROR: Failed to unmarshal control locks of %s: %v", executionUuid, err)
+		return
+	}
+
+	for _, lock := range locks {
+		key := map[string]types.AttributeValue{
+			"resourceKey": &types.AttributeValueMemberS{Value: lock.ResourceKey},
+			"holderId":    &types.AttributeValueMemberS{Value: lock.HolderId},
+		}
+		if lock.State != LeaseHeld {
+			if _, err := j.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+				TableName: aws.String(j.controlResourceTableName()),
+				Key:       key,
+			}); err != nil {
+				log.Printf("ERROR: Failed to remove %s from the waiters of %s: %v", executionUuid, lock.Name, err)
+			}
+			continue
+		}
+
+		summary := &types.Update{
+			TableName: aws.String(j.controlResourceTableName()),
+			Key: map[string]types.AttributeValue{
+				"resourceKey": &types.AttributeValueMemberS{Value: lock.ResourceKey},
+				"holderId":    &types.AttributeValueMemberS{Value: lockSummaryId},
+			},
+			UpdateExpression:    aws.String("REMOVE exclusiveHolder"),
+			ConditionExpression: aws.String("exclusiveHolder = :uuid"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":uuid": &types.AttributeValueMemberS{Value: executionUuid},
+			},
+		}
+		if lock.Mode == LockShared {
+			summary.UpdateExpression = aws.String("SET sharedCount = sharedCount - :one")
+			summary.ConditionExpression = aws.String("sharedCount > :zero")
+			summary.ExpressionAttributeValues = map[string]types.AttributeValue{
+				":zero": &types.AttributeValueMemberN{Value: "0"},
+				":one":  &types.AttributeValueMemberN{Value: "1"},
+			}
+		}
+
+		_, err := j.dynamoClient.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+			TransactItems: []types.TransactWriteItem{
+				{Delete: &types.Delete{
+					TableName:                 aws.String(j.controlResourceTableName()),
+					Key:                       key,
+					ConditionExpression:       aws.String("#state = :held"),
+					ExpressionAttributeNames:  map[string]string{"#state": "state"},
+					ExpressionAttributeValues: map[string]types.AttributeValue{":held": &types.AttributeValueMemberS{Value: LeaseHeld}},
+				}},
+				{Update: summary},
+			},
+		})
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			log.Printf("DEBUG: Control resource %s of %s already released", lock.Name, executionUuid)
+			continue
+		}
+		if err != nil {
+			log.Printf("ERROR: Failed to release control resource %s of %s: %v", lock.Name, executionUuid, err)
+			continue
+		}
+		log.Printf("JMI released control resource %s (%s) of %s", lock.Name, lock.Mode, executionUuid)
+	}
+}
+
+// controlResourceStatuses folds lock items into one status per resource,
+// leaving out resources nobody holds or waits for
+func controlResourceStatuses(locks []ControlLock) []controlResourceStatus {
+	byName := make(map[string]*controlResourceStatus)
+	var names []string
+	for _, lock := range locks {
+		if lock.HolderId == lockSummaryId {
+			continue
+		}
+		status, ok := byName[lock.Name]
+		if !ok {
+			status = &controlResourceStatus{Name: lock.Name, Mode: "free", Holders: []ControlLock{}, Waiters: []ControlLock{}}
+			byName[lock.Name] = status
+			names = append(names, lock.Name)
+		}
+		if lock.State == LeaseHeld {
+			status.Holders = append(status.Holders, lock)
+			status.Mode = lock.Mode
+		} else {
+			status.Waiters = append(status.Waiters, lock)
+		}
+	}
+
+	sort.Strings(names)
+	statuses := make([]controlResourceStatus, 0, len(names))
+	for _, name := range names {
+		status := byName[name]
+		for _, list := range [][]ControlLock{status.Holders, status.Waiters} {
+			sort.Slice(list, func(a, b int) bool {
+				return list[a].Since < list[b].Since
+			})
+		}
+		statuses = append(statuses, *status)
+	}
+	return statuses
+}
+
+// GetControlResources lists the caller's control resources in use, with their
+// holders and the executions JMW holds back waiting for them
+func (j *JMIService) GetControlResources(ctx *gin.Context) {
+	items, err := j.queryIndex(j.controlResourceTableName(), "accountId-index", "accountId", identityFrom(ctx).AccountId)
+	if err != nil {
+		log.Printf("Error querying control resources: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve control resources"})
+		return
+	}
+	var locks []ControlLock
+	if err := attributevalue.UnmarshalListOfMaps(items, &locks); err != nil {
+		log.Printf("Error unmarshaling control resources: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process control resources"})
+		return
+	}
+
+	statuses := controlResourceStatuses(locks)
+	ctx.JSON(http.StatusOK, gin.H{"controlResources": statuses, "count": len(statuses)})
+}
+
+// GetControlResource reports one control resource; unused ones are free
+func (j *JMIService) GetControlResource(ctx *gin.Context) {
+	name := ctx.Param("name")
+	if strings.Contains(name, "#") {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid control resource name"})
+		return
+	}
+
+	var locks []ControlLock
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.controlResourceTableName()),
+		KeyConditionExpression: aws.String("resourceKey = :resourceKey"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":resourceKey": &types.AttributeValueMemberS{Value: identityFrom(ctx).AccountId + "#" + name},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error querying control resource %s: %v", name, err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve control resource"})
+			return
+		}
+		var pageLocks []ControlLock
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageLocks); err != nil {
+			log.Printf("Error unmarshaling control resource %s: %v", name, err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process control resource"})
+			return
+		}
+		locks = append(locks, pageLocks...)
+	}
+
+	statuses := controlResourceStatuses(locks)
+	if len(statuses) == 0 {
+		ctx.JSON(http.StatusOK, controlResourceStatus{Name: name, Mode: "free", Holders: []ControlLock{}, Waiters: []ControlLock{}})
+		return
+	}
+	ctx.JSON(http.StatusOK, statuses[0])
+}
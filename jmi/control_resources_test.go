@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestControlResourceStatuses(t *testing.T) {
+	lock := func(name, holderId, state, mode, since string) ControlLock {
+		return ControlLock{
+			ResourceKey:   "acc-1#" + name,
+			HolderId:      holderId,
+			Name:          name,
+			State:         state,
+			Mode:          mode,
+			ExecutionUuid: holderId,
+			Since:         since,
+		}
+	}
+	summary := ControlLock{ResourceKey: "acc-1#erp", HolderId: lockSummaryId, Name: "erp", SharedCount: 2}
+
+	tests := []struct {
+		name        string
+		locks       []ControlLock
+		wantNames   []string
+		wantModes   []string
+		wantHolders [][]string
+		wantWaiters [][]string
+	}{
+		{"nothing in use", nil, nil, nil, nil, nil},
+		{"summary item alone is left out", []ControlLock{summary}, nil, nil, nil, nil},
+		{
+			"shared holders, oldest first",
+			[]ControlLock{
+				summary,
+				lock("erp", "u-2", LeaseHeld, LockShared, "2025-06-01T10:05:00Z"),
+				lock("erp", "u-1", LeaseHeld, LockShared, "2025-06-01T10:00:00Z"),
+			},
+			[]string{"erp"}, []string{LockShared}, [][]string{{"u-1", "u-2"}}, [][]string{{}},
+		},
+		{
+			"exclusive holder with waiters",
+			[]ControlLock{
+				lock("erp", "u-3", LeaseWaiting, LockShared, "2025-06-01T10:10:00Z"),
+				lock("erp", "u-1", LeaseHeld, LockExclusive, "2025-06-01T10:00:00Z"),
+				lock("erp", "u-2", LeaseWaiting, LockExclusive, "2025-06-01T10:05:00Z"),
+			},
+			[]string{"erp"}, []string{LockExclusive}, [][]string{{"u-1"}}, [][]string{{"u-2", "u-3"}},
+		},
+		{
+			"waiters on a released resource",
+			[]ControlLock{lock("erp", "u-2", LeaseWaiting, LockExclusive, "2025-06-01T10:05:00Z")},
+			[]string{"erp"}, []string{"free"}, [][]string{{}}, [][]string{{"u-2"}},
+		},
+		{
+			"resources sorted by name",
+			[]ControlLock{
+				lock("warehouse", "u-1", LeaseHeld, LockExclusive, "2025-06-01T10:00:00Z"),
+				lock("erp", "u-1", LeaseHeld, LockShared, "2025-06-01T10:00:00Z"),
+			},
+			[]string{"erp", "warehouse"}, []string{LockShared, LockExclusive}, [][]string{{"u-1"}, {"u-1"}}, [][]string{{}, {}},
+		},
+	}
+
+	uuids := func(locks []ControlLock) []string {
+		ids := make([]string, 0, len(locks))
+		for _, lock := range locks {
+			ids = append(ids, lock.ExecutionUuid)
+		}
+		return ids
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statuses := controlResourceStatuses(tt.locks)
+			if len(statuses) != len(tt.wantNames) {
+				t.Fatalf("controlResourceStatuses() returned %d resources, want %d", len(statuses), len(tt.wantNames))
+			}
+			for i, status := range statuses {
+				if status.Name != tt.wantNames[i] || status.Mode != tt.wantModes[i] {
+					t.Errorf("resource %d = %s (%s), want %s (%s)", i, status.Name, status.Mode, tt.wantNames[i], tt.wantModes[i])
+				}
+				if holders := uuids(status.Holders); !reflect.DeepEqual(holders, tt.wantHolders[i]) {
+					t.Errorf("%s holders = %v, want %v", status.Name, holders, tt.wantHolders[i])
+				}
+				if waiters := uuids(status.Waiters); !reflect.DeepEqual(waiters, tt.wantWaiters[i]) {
+					t.Errorf("%s waiters = %v, want %v", status.Name, waiters, tt.wantWaiters[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// dynamoCall is one request the service made to DynamoDB, decoded from the wire
+type dynamoCall struct {
+	Operation string
+	Input     map[string]interface{}
+}
+
+// table is the TableName of the call
+func (c dynamoCall) table() string {
+	name, _ := c.Input["TableName"].(string)
+	return name
+}
+
+// value returns the string or number attribute name of a wire item under
+// field (Item, Key, ExpressionAttributeValues)
+func (c dynamoCall) value(field, name string) string {
+	item, _ := c.Input[field].(map[string]interface{})
+	return wireString(item[name])
+}
+
+// dynamoError is an error answered by the fake, such as ConditionalCheckFailedException
+type dynamoError struct {
+	Type    string
+	Reasons []string // CancellationReasons codes of a TransactionCanceledException
+}
+
+// fakeDynamo is a DynamoDB endpoint answering from the test's handler. It
+// records every call so tests can check what the service wrote.
+type fakeDynamo struct {
+	mu     sync.Mutex
+	calls  []dynamoCall
+	handle func(call dynamoCall) (interface{}, *dynamoError)
+}
+
+// newFakeDynamo starts a fake endpoint and returns it with a client pointed at it
+func newFakeDynamo(t *testing.T, handle func(call dynamoCall) (interface{}, *dynamoError)) (*fakeDynamo, *dynamodb.Client) {
+	t.Helper()
+	fake := &fakeDynamo{handle: handle}
+	server := httptest.NewServer(http.HandlerFunc(fake.serve))
+	t.Cleanup(server.Close)
+
+	client := dynamodb.New(dynamodb.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials:  credentials.NewStaticCredentialsProvider("test", "test", ""),
+		Retryer:      aws.NopRetryer{},
+	})
+	return fake, client
+}
+
+func (f *fakeDynamo) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	call := dynamoCall{Operation: strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")}
+	json.Unmarshal(body, &call.Input)
+
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	f.mu.Unlock()
+
+	response, failure := f.handle(call)
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	if failure != nil {
+		answer := map[string]interface{}{"__type": "com.amazonaws.dynamodb.v20120810#" + failure.Type, "message": failure.Type}
+		if len(failure.Reasons) > 0 {
+			reasons := make([]map[string]string, 0, len(failure.Reasons))
+			for _, code := range failure.Reasons {
+				reasons = append(reasons, map[string]string{"Code": code})
+			}
+			answer["CancellationReasons"] = reasons
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(answer)
+		return
+	}
+	if response == nil {
+		response = map[string]interface{}{}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// recorded returns the calls of operation made so far, optionally on one table
+func (f *fakeDynamo) recorded(operation, table string) []dynamoCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []dynamoCall
+	for _, call := range f.calls {
+		if call.Operation == operation && (table == "" || call.table() == table) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// wireItem marshals v as a DynamoDB item in wire JSON
+func wireItem(t *testing.T, v interface{}) map[string]interface{} {
+	t.Helper()
+	item, err := attributevalue.MarshalMap(v)
+	if err != nil {
+		t.Fatalf("MarshalMap(): %v", err)
+	}
+	wire := make(map[string]interface{}, len(item))
+	for name, value := range item {
+		wire[name] = wireValue(value)
+	}
+	return wire
+}
+
+func wireValue(value types.AttributeValue) interface{} {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return map[string]interface{}{"S": v.Value}
+	case *types.AttributeValueMemberN:
+		return map[string]interface{}{"N": v.Value}
+	case *types.AttributeValueMemberBOOL:
+		return map[string]interface{}{"BOOL": v.Value}
+	case *types.AttributeValueMemberNULL:
+		return map[string]interface{}{"NULL": true}
+	case *types.AttributeValueMemberB:
+		return map[string]interface{}{"B": base64.StdEncoding.EncodeToString(v.Value)}
+	case *types.AttributeValueMemberSS:
+		return map[string]interface{}{"SS": v.Value}
+	case *types.AttributeValueMemberL:
+		list := make([]interface{}, 0, len(v.Value))
+		for _, element := range v.Value {
+			list = append(list, wireValue(element))
+		}
+		return map[string]interface{}{"L": list}
+	case *types.AttributeValueMemberM:
+		fields := make(map[string]interface{}, len(v.Value))
+		for name, element := range v.Value {
+			fields[name] = wireValue(element)
+		}
+		return map[string]interface{}{"M": fields}
+	}
+	return map[string]interface{}{"NULL": true}
+}
+
+// wireString is the S or N of a wire attribute value
+func wireString(value interface{}) string {
+	attribute, _ := value.(map[string]interface{})
+	if s, ok := attribute["S"].(string); ok {
+		return s
+	}
+	n, _ := attribute["N"].(string)
+	return n
+}
+
+// requestAs serves one request through handlers registered by routes, as identity
+func requestAs(identity Identity, routes func(r *gin.Engine), method, path, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set(identityContextKey, identity)
+	})
+	routes(router)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
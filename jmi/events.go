@@ -0,0 +1,411 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	eventTypeExecution = "execution"
+	eventTypeQueue     = "queue"
+	eventTypeSLA       = "sla"
+)
+
+// ExecutionEvent is published for every stage record written to the executions table
+type ExecutionEvent struct {
+	ExecutionName  string `json:"executionName"`
+	OriginalName   string `json:"originalName"`
+	ExecutionUuid  string `json:"executionUuid"`
+	AccountId      string `json:"accountId"`
+	Stage          string `json:"stage"`
+	Version        int    `json:"version"`
+	Status         string `json:"status"`
+	PreviousStatus string `json:"previousStatus,omitempty"`
+	ProcessedBy    string `json:"processedBy"`
+	Timestamp      int64  `json:"timestamp"`
+}
+
+// QueueDepthEvent is published when the approximate depth of an SQS queue changes
+type QueueDepthEvent struct {
+	QueueName          string `json:"queueName"`
+	QueueUrl           string `json:"queueUrl"`
+	VisibleMessages    int    `json:"visibleMessages"`
+	NotVisibleMessages int    `json:"notVisibleMessages"`
+	Timestamp          int64  `json:"timestamp"`
+}
+
+// streamEvent is what the hub fans out; accountId and originalName are set for
+// execution and SLA events and drive the per-subscriber filters
+type streamEvent struct {
+	Type         string
+	AccountId    string
+	OriginalName string
+	Payload      interface{}
+}
+
+// eventHub fans events out to the connected SSE clients. Slow clients lose
+// events rather than holding up the stream readers.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan streamEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[chan streamEvent]struct{})}
+}
+
+func (h *eventHub) subscribe() chan streamEvent {
+	ch := make(chan streamEvent, 64)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan streamEvent) {
+	h.mu.Lock()
+	delete(h.subscribers, ch)
+	h.mu.Unlock()
+}
+
+func (h *eventHub) publish(event streamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("WARN: Dropping %s event for a slow subscriber", event.Type)
+		}
+	}
+}
+
+// watchExecutionStream follows the DynamoDB Stream of the executions table,
+// reconnecting when the stream is unavailable or an iterator expires
+func (j *JMIService) watchExecutionStream() {
+	for {
+		err := j.readExecutionStream()
+		if j.receiveCtx.Err() != nil {
+			log.Println("Execution stream reader stopped")
+			return
+		}
+		log.Printf("WARN: Execution stream interrupted, retrying in 10s: %v", err)
+
+		select {
+		case <-j.receiveCtx.Done():
+			return
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+func (j *JMIService) readExecutionStream() error {
+	table, err := j.dynamoClient.DescribeTable(j.receiveCtx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(j.executionTableName()),
+	})
+	if err != nil {
+		return err
+	}
+	if table.Table.LatestStreamArn == nil {
+		return fmt.Errorf("table %s has no stream enabled", j.executionTableName())
+	}
+	streamArn := table.Table.LatestStreamArn
+	log.Printf("Following execution stream %s", *streamArn)
+
+	// Shards are read from TRIM_HORIZON, so the ends of executions written while
+	// JMI was down still reach the webhook outbox, which drops what it already
+	// has. Only records written since we connected go to SSE clients.
+	connectedAt := time.Now()
+	iterators := make(map[string]*string)
+	known := make(map[string]bool)
+	var shardsRefreshedAt time.Time
+
+	for {
+		if j.receiveCtx.Err() != nil {
+			return nil
+		}
+
+		if time.Since(shardsRefreshedAt) > 30*time.Second {
+			shards, err := j.streamShards(streamArn)
+			if err != nil {
+				return err
+			}
+			for _, shardId := range shards {
+				if known[shardId] {
+					continue
+				}
+				iterator, err := j.streamsClient.GetShardIterator(j.receiveCtx, &dynamodbstreams.GetShardIteratorInput{
+					StreamArn:         streamArn,
+					ShardId:           aws.String(shardId),
+					ShardIteratorType: streamtypes.ShardIteratorTypeTrimHorizon,
+				})
+				if err != nil {
+					return err
+				}
+				known[shardId] = true
+				iterators[shardId] = iterator.ShardIterator
+			}
+			shardsRefreshedAt = time.Now()
+		}
+
+		for shardId, iterator := range iterators {
+			output, err := j.streamsClient.GetRecords(j.receiveCtx, &dynamodbstreams.GetRecordsInput{
+				ShardIterator: iterator,
+			})
+			if err != nil {
+				return err
+			}
+			for _, record := range output.Records {
+				live := record.Dynamodb == nil || record.Dynamodb.ApproximateCreationDateTime == nil ||
+					!record.Dynamodb.ApproximateCreationDateTime.Before(connectedAt.Truncate(time.Second))
+				j.publishStageRecord(record, live)
+			}
+			// A nil iterator means the shard is closed and fully read
+			if output.NextShardIterator == nil {
+				delete(iterators, shardId)
+			} else {
+				iterators[shardId] = output.NextShardIterator
+			}
+		}
+
+		select {
+		case <-j.receiveCtx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (j *JMIService) streamShards(streamArn *string) ([]string, error) {
+	var shards []string
+	var lastShardId *string
+	for {
+		output, err := j.streamsClient.DescribeStream(j.receiveCtx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             streamArn,
+			ExclusiveStartShardId: lastShardId,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, shard := range output.StreamDescription.Shards {
+			shards = append(shards, aws.ToString(shard.ShardId))
+		}
+		lastShardId = output.StreamDescription.LastEvaluatedShardId
+		if lastShardId == nil {
+			return shards, nil
+		}
+	}
+}
+
+// publishStageRecord turns an inserted or updated stage record into an execution
+// event; replayed records (live false) only feed the webhooks
+func (j *JMIService) publishStageRecord(record streamtypes.Record, live bool) {
+	if record.Dynamodb == nil || record.Dynamodb.NewImage == nil {
+		return
+	}
+
+	var stage StageRecord
+	if err := unmarshalStreamImage(record.Dynamodb.NewImage, &stage); err != nil {
+		log.Printf("ERROR: Failed to decode execution stream record: %v", err)
+		return
+	}
+
+	event := ExecutionEvent{
+		ExecutionName: stage.ExecutionName,
+		OriginalName:  stage.OriginalName,
+		ExecutionUuid: stage.ExecutionUuid,
+		AccountId:     stage.AccountId,
+		Stage:         stage.Stage,
+		Version:       stage.Version,
+		Status:        stage.Status,
+		ProcessedBy:   stage.ProcessedBy,
+		Timestamp:     stage.Timestamp,
+	}
+	wasTerminal := false
+	if record.Dynamodb.OldImage != nil {
+		var previous StageRecord
+		if err := unmarshalStreamImage(record.Dynamodb.OldImage, &previous); err == nil {
+			event.PreviousStatus = previous.Status
+			_, wasTerminal = terminalStatus(previous)
+		}
+	}
+
+	// A record ends an execution when it turns terminal: written that way, or a
+	// parked jmr-run (waiting, awaiting_approval) overwritten with its outcome.
+	// Rewrites of a record that was already terminal must not notify twice.
+	if !wasTerminal {
+		j.notifyTerminalStage(stage)
+	}
+	if !live {
+		return
+	}
+
+	j.events.publish(streamEvent{
+		Type:         eventTypeExecution,
+		AccountId:    stage.AccountId,
+		OriginalName: stage.OriginalName,
+		Payload:      event,
+	})
+}
+
+func unmarshalStreamImage(image map[string]streamtypes.AttributeValue, out interface{}) error {
+	item, err := attributevalue.FromDynamoDBStreamsMap(image)
+	if err != nil {
+		return err
+	}
+	return attributevalue.UnmarshalMap(item, out)
+}
+
+// watchQueueDepths polls the SQS queues every QUEUE_EVENT_INTERVAL seconds
+// (default 5) and publishes a queue event whenever a depth changes
+func (j *JMIService) watchQueueDepths() {
+	interval := 5 * time.Second
+	if value := os.Getenv("QUEUE_EVENT_INTERVAL"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			interval = time.Duration(seconds) * time.Second
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	depths := make(map[string]QueueDepthEvent)
+	for {
+		select {
+		case <-j.receiveCtx.Done():
+			log.Println("Queue depth watcher stopped")
+			return
+		case <-ticker.C:
+		}
+
+		listOutput, err := j.sqsClient.ListQueues(j.receiveCtx, &sqs.ListQueuesInput{})
+		if err != nil {
+			log.Printf("WARN: Failed to list queues for depth events: %v", err)
+			continue
+		}
+
+		for _, queueUrl := range listOutput.QueueUrls {
+			attrs, err := j.sqsClient.GetQueueAttributes(j.receiveCtx, &sqs.GetQueueAttributesInput{
+				QueueUrl: aws.String(queueUrl),
+				AttributeNames: []sqstypes.QueueAttributeName{
+					sqstypes.QueueAttributeNameApproximateNumberOfMessages,
+					sqstypes.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+				},
+			})
+			if err != nil {
+				continue
+			}
+
+			visible, _ := strconv.Atoi(attrs.Attributes[string(sqstypes.QueueAttributeNameApproximateNumberOfMessages)])
+			notVisible, _ := strconv.Atoi(attrs.Attributes[string(sqstypes.QueueAttributeNameApproximateNumberOfMessagesNotVisible)])
+
+			previous, seen := depths[queueUrl]
+			if seen && previous.VisibleMessages == visible && previous.NotVisibleMessages == notVisible {
+				continue
+			}
+
+			event := QueueDepthEvent{
+				QueueName:          queueUrl[strings.LastIndex(queueUrl, "/")+1:],
+				QueueUrl:           queueUrl,
+				VisibleMessages:    visible,
+				NotVisibleMessages: notVisible,
+				Timestamp:          time.Now().Unix(),
+			}
+			depths[queueUrl] = event
+			j.events.publish(streamEvent{Type: eventTypeQueue, Payload: event})
+		}
+	}
+}
+
+// parseEventTypes reads ?types=execution,queue,sla; all are sent by default
+func parseEventTypes(value string) (map[string]bool, error) {
+	if value == "" {
+		return map[string]bool{eventTypeExecution: true, eventTypeQueue: true, eventTypeSLA: true}, nil
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range splitList(value, ",") {
+		if name != eventTypeExecution && name != eventTypeQueue && name != eventTypeSLA {
+			return nil, errors.New("types must be a comma-separated list of execution, queue and sla")
+		}
+		selected[name] = true
+	}
+	return selected, nil
+}
+
+// StreamEvents is a Server-Sent Events stream of execution stage transitions and
+// SLA breaches of the caller's account and of queue depth changes. It filters by executionName
+// and by event types, and sends a keep-alive comment every 15 seconds.
+func (j *JMIService) StreamEvents(ctx *gin.Context) {
+	identity := identityFrom(ctx)
+
+	if accountId := ctx.Query("accountId"); accountId != "" && accountId != identity.AccountId {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "accountId does not match the caller's account"})
+		return
+	}
+	eventTypes, err := parseEventTypes(ctx.Query("types"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	executionName := ctx.Query("executionName")
+
+	events := j.events.subscribe()
+	defer j.events.unsubscribe(events)
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	fmt.Fprint(ctx.Writer, ": connected\n\n")
+	ctx.Writer.Flush()
+
+	log.Printf("Event stream opened for account %s (executionName=%q)", identity.AccountId, executionName)
+
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Request.Context().Done():
+			return false
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			return true
+		case event := <-events:
+			if !eventTypes[event.Type] {
+				return true
+			}
+			if event.Type != eventTypeQueue {
+				if event.AccountId != identity.AccountId {
+					return true
+				}
+				if executionName != "" && event.OriginalName != executionName {
+					return true
+				}
+			}
+			ctx.SSEvent(event.Type, event.Payload)
+			return true
+		}
+	})
+
+	log.Printf("Event stream closed for account %s", identity.AccountId)
+}
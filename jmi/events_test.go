@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// runImage is the stream image of a jmr-run record with the given status
+func runImage(status string) map[string]streamtypes.AttributeValue {
+	return map[string]streamtypes.AttributeValue{
+		"executionName": &streamtypes.AttributeValueMemberS{Value: "daily-load-1#u-1#v3#jmr-run"},
+		"originalName":  &streamtypes.AttributeValueMemberS{Value: "daily-load"},
+		"executionUuid": &streamtypes.AttributeValueMemberS{Value: "u-1"},
+		"accountId":     &streamtypes.AttributeValueMemberS{Value: "acc-a"},
+		"stage":         &streamtypes.AttributeValueMemberS{Value: "jmr-run"},
+		"status":        &streamtypes.AttributeValueMemberS{Value: status},
+		"version":       &streamtypes.AttributeValueMemberN{Value: "3"},
+		"timestamp":     &streamtypes.AttributeValueMemberN{Value: "1750000000"},
+	}
+}
+
+func TestTerminalWebhookOnStageTransition(t *testing.T) {
+	tests := []struct {
+		name       string
+		eventName  streamtypes.OperationType
+		oldStatus  string // "" for a record without an OldImage
+		newStatus  string
+		wantStatus string // webhook status delivered, "" when none is
+	}{
+		{"parked run finishes", streamtypes.OperationTypeModify, "waiting", "succeeded", WebhookStatusSucceeded},
+		{"run awaiting approval is rejected", streamtypes.OperationTypeModify, "awaiting_approval", "failed", WebhookStatusFailed},
+		{"run written with its outcome", streamtypes.OperationTypeInsert, "", "succeeded", WebhookStatusSucceeded},
+		{"run parks", streamtypes.OperationTypeInsert, "", "waiting", ""},
+		{"parked run is still waiting", streamtypes.OperationTypeModify, "waiting", "waiting", ""},
+		{"finished run is rewritten", streamtypes.OperationTypeModify, "succeeded", "succeeded", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subscription := WebhookSubscription{Id: "wh-1", AccountId: "acc-a", Url: "https://hooks.example.com/", Routines: []string{}, Statuses: []string{}}
+			fake, client := newFakeDynamo(t, func(call dynamoCall) (interface{}, *dynamoError) {
+				if call.Operation == "Query" && call.table() == "webhook_subscriptions" {
+					return map[string]interface{}{"Items": []interface{}{wireItem(t, subscription)}}, nil
+				}
+				return nil, nil
+			})
+			service := &JMIService{dynamoClient: client, events: newEventHub()}
+
+			record := streamtypes.Record{
+				EventName: tt.eventName,
+				Dynamodb:  &streamtypes.StreamRecord{NewImage: runImage(tt.newStatus)},
+			}
+			if tt.oldStatus != "" {
+				record.Dynamodb.OldImage = runImage(tt.oldStatus)
+			}
+			service.publishStageRecord(record, true)
+
+			queued := fake.recorded("PutItem", "webhook_outbox")
+			if tt.wantStatus == "" {
+				if len(queued) > 0 {
+					t.Fatalf("queued %d webhook events for a %s -> %s record, want none", len(queued), tt.oldStatus, tt.newStatus)
+				}
+				return
+			}
+			if len(queued) != 1 {
+				t.Fatalf("queued %d webhook events, want 1", len(queued))
+			}
+			if id := queued[0].value("Item", "outboxId"); id != "daily-load-1#u-1#v3#jmr-run#wh-1" {
+				t.Errorf("outboxId = %q, want the stage key and the subscription", id)
+			}
+			var event WebhookEvent
+			if err := json.Unmarshal([]byte(queued[0].value("Item", "body")), &event); err != nil || event.Status != tt.wantStatus {
+				t.Errorf("queued status %q (%v), want %s", event.Status, err, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// StageRecord is any of the versioned stage records written by JMI, JMW and JMR
+type StageRecord struct {
+	ExecutionName  string       `json:"executionName" dynamodbav:"executionName"`
+	OriginalName   string       `json:"originalName" dynamodbav:"originalName"`
+	ExecutionUuid  string       `json:"executionUuid" dynamodbav:"executionUuid"`
+	AccountId      string       `json:"accountId" dynamodbav:"accountId"`
+	Status         string       `json:"status" dynamodbav:"status"`
+	Version        int          `json:"version" dynamodbav:"version"`
+	Stage          string       `json:"stage" dynamodbav:"stage"`
+	ProcessedBy    string       `json:"processedBy" dynamodbav:"processedBy"`
+	WorkerID       string       `json:"workerID,omitempty" dynamodbav:"workerID,omitempty"`
+	RunnerID       string       `json:"runnerID,omitempty" dynamodbav:"runnerID,omitempty"`
+	CreatedAt      string       `json:"createdAt" dynamodbav:"createdAt"`
+	UpdatedAt      string       `json:"updatedAt" dynamodbav:"updatedAt"`
+	Timestamp      int64        `json:"timestamp" dynamodbav:"timestamp"`
+	RoutineVersion int          `json:"routineVersion,omitempty" dynamodbav:"routineVersion,omitempty"`
+	StartedBy      string       `json:"startedBy,omitempty" dynamodbav:"startedBy,omitempty"`
+	StoppedBy      string       `json:"stoppedBy,omitempty" dynamodbav:"stoppedBy,omitempty"`
+	Tasks          []TaskResult `json:"tasks,omitempty" dynamodbav:"tasks,omitempty"`
+	Reason         string       `json:"reason,omitempty" dynamodbav:"reason,omitempty"` // Why JMW holds a jmw-wait execution
+
+	Parameters map[string]interface{} `json:"parameters,omitempty" dynamodbav:"parameters,omitempty"`
+	Definition *RoutineDefinition     `json:"-" dynamodbav:"definition,omitempty"`            // Only on jmi-start
+	Parent     *ParentExecution       `json:"parent,omitempty" dynamodbav:"parent,omitempty"` // Only on jmi-start
+}
+
+// TaskResult is the outcome of one task as recorded by JMR
+type TaskResult struct {
+	StepId string `json:"stepId" dynamodbav:"stepId"`
+	TaskId string `json:"taskId" dynamodbav:"taskId"`
+	Status string `json:"status" dynamodbav:"status"`
+	Log    string `json:"log" dynamodbav:"log"`
+
+	ChildExecutionUuid string `json:"childExecutionUuid,omitempty" dynamodbav:"childExecutionUuid,omitempty"` // Routine tasks only
+}
+
+// TimelineEntry is one stage in the execution detail, with the time spent since the previous one
+type TimelineEntry struct {
+	Stage           string  `json:"stage"`
+	Version         int     `json:"version"`
+	Status          string  `json:"status"`
+	ProcessedBy     string  `json:"processedBy"`
+	At              string  `json:"at"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Reason          string  `json:"reason,omitempty"`
+}
+
+func (j *JMIService) scheduleTableName() string {
+	if j.scheduleTable == "" {
+		return "schedules"
+	}
+	return j.scheduleTable
+}
+
+func (j *JMIService) adapterTableName() string {
+	if j.adapterTable == "" {
+		return "adapters"
+	}
+	return j.adapterTable
+}
+
+func (j *JMIService) queueMessageTableName() string {
+	if j.queueMessageTable == "" {
+		return "queue_messages"
+	}
+	return j.queueMessageTable
+}
+
+// queryIndex returns every item of an index partition
+func (j *JMIService) queryIndex(tableName, indexName, attribute, value string) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:                aws.String(tableName),
+		IndexName:                aws.String(indexName),
+		KeyConditionExpression:   aws.String("#key = :value"),
+		ExpressionAttributeNames: map[string]string{"#key": attribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":value": &types.AttributeValueMemberS{Value: value},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+	}
+	return items, nil
+}
+
+// currentStatus derives the execution status from the furthest stage reached
+func currentStatus(stages []StageRecord) string {
+	status := "pending"
+	for _, stage := range stages {
+		switch stage.Stage {
+		case "jmi-stop":
+			return "stopped"
+		case "jmr-run":
+			status = stage.Status
+		case "jmw-wait":
+			if status == "pending" {
+				status = "waiting"
+			}
+		case "jmw-process":
+			if status == "pending" || status == "waiting" {
+				status = "running"
+			}
+		}
+	}
+	return status
+}
+
+// inProgress reports whether an execution with this status has not ended yet
+func inProgress(status string) bool {
+	return status == "pending" || status == "waiting" || status == "running" || status == "awaiting_approval"
+}
+
+// GetExecution returns one document describing an execution: its stage timeline,
+// task results and the schedule, adapters and queue messages it produced.
+func (j *JMIService) GetExecution(ctx *gin.Context) {
+	identity := identityFrom(ctx)
+	executionUuid := ctx.Param("executionUuid")
+
+	items, err := j.queryIndex(j.executionTableName(), "executionUuid-timestamp-index", "executionUuid", executionUuid)
+	if err != nil {
+		log.Printf("ERROR: Failed to query stages of execution %s: %v", executionUuid, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load execution"})
+		return
+	}
+
+	var stages []StageRecord
+	if err := attributevalue.UnmarshalListOfMaps(items, &stages); err != nil {
+		log.Printf("ERROR: Failed to unmarshal stages of execution %s: %v", executionUuid, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process execution"})
+		return
+	}
+
+	// A start waiting in its routine's queue has no stages yet
+	if len(stages) == 0 {
+		queued, err := j.findQueuedStart(identity.AccountId, executionUuid)
+		if err == nil {
+			response := gin.H{
+				"executionName": queued.RoutineName,
+				"executionUuid": queued.ExecutionUuid,
+				"status":        "queued",
+				"queuedBy":      queued.QueuedBy,
+				"queuedAt":      queued.QueuedAt,
+				"parent":        queued.Parent,
+			}
+			// JMI refused to start it when its turn came
+			if queued.FailedAt != "" {
+				response["status"] = "failed"
+				response["failedAt"] = queued.FailedAt
+				response["error"] = queued.Error
+			}
+			ctx.JSON(http.StatusOK, response)
+			return
+		}
+		if !errors.Is(err, errQueuedNotFound) {
+			log.Printf("ERROR: Failed to look up queued start %s: %v", executionUuid, err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load execution"})
+			return
+		}
+	}
+
+	// Other tenants' executions are reported as missing
+	if len(stages) == 0 || stages[0].AccountId != identity.AccountId {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Execution not found"})
+		return
+	}
+
+	sort.SliceStable(stages, func(a, b int) bool {
+		return stages[a].Version < stages[b].Version
+	})
+
+	timeline := make([]TimelineEntry, 0, len(stages))
+	var tasks []TaskResult
+	var startedBy, stoppedBy string
+	var previous time.Time
+	for _, stage := range stages {
+		at, _ := time.Parse(time.RFC3339, stage.UpdatedAt)
+		entry := TimelineEntry{
+			Stage:       stage.Stage,
+			Version:     stage.Version,
+			Status:      stage.Status,
+			ProcessedBy: stage.ProcessedBy,
+			At:          stage.UpdatedAt,
+			Reason:      stage.Reason,
+		}
+		if !previous.IsZero() && !at.IsZero() {
+			entry.DurationSeconds = at.Sub(previous).Seconds()
+		}
+		if !at.IsZero() {
+			previous = at
+		}
+		timeline = append(timeline, entry)
+
+		if stage.Tasks != nil {
+			tasks = stage.Tasks
+		}
+		if stage.StartedBy != "" {
+			startedBy = stage.StartedBy
+		}
+		if stage.StoppedBy != "" {
+			stoppedBy = stage.StoppedBy
+		}
+	}
+
+	first, last := stages[0], stages[len(stages)-1]
+	var durationSeconds float64
+	startedAt, errStart := time.Parse(time.RFC3339, first.CreatedAt)
+	lastAt, errLast := time.Parse(time.RFC3339, last.UpdatedAt)
+	if errStart == nil && errLast == nil {
+		durationSeconds = lastAt.Sub(startedAt).Seconds()
+	}
+
+	// Follow the pipeline: JMR forwards the execution to the Scheduler Plugin as
+	// job id = executionUuid, each schedule gets adapters and each adapter queue messages
+	schedules, err := j.linkedRecords(j.scheduleTableName(), "job_id-index", "job_id", []string{executionUuid}, identity.AccountId)
+	if err != nil {
+		log.Printf("ERROR: Failed to load schedules of execution %s: %v", executionUuid, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load linked schedules"})
+		return
+	}
+	adapters, err := j.linkedRecords(j.adapterTableName(), "schedule_id-index", "schedule_id", recordIds(schedules), identity.AccountId)
+	if err != nil {
+		log.Printf("ERROR: Failed to load adapters of execution %s: %v", executionUuid, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load linked adapters"})
+		return
+	}
+	queueMessages, err := j.linkedRecords(j.queueMessageTableName(), "adapter_id-index", "adapter_id", recordIds(adapters), identity.AccountId)
+	if err != nil {
+		log.Printf("ERROR: Failed to load queue messages of execution %s: %v", executionUuid, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load linked queue messages"})
+		return
+	}
+
+	var schedule map[string]interface{}
+	if len(schedules) > 0 {
+		schedule = schedules[0]
+	}
+
+	children, err := j.childExecutions(identity.AccountId, executionUuid)
+	if err != nil {
+		log.Printf("ERROR: Failed to load children of execution %s: %v", executionUuid, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load child executions"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"executionUuid":   executionUuid,
+		"executionName":   first.OriginalName,
+		"accountId":       first.AccountId,
+		"routineVersion":  first.RoutineVersion,
+		"parameters":      first.Parameters,
+		"status":          currentStatus(stages),
+		"startedBy":       startedBy,
+		"stoppedBy":       stoppedBy,
+		"startedAt":       first.CreatedAt,
+		"updatedAt":       last.UpdatedAt,
+		"durationSeconds": durationSeconds,
+		"timeline":        timeline,
+		"tasks":           tasks,
+		"schedule":        schedule,
+		"adapters":        adapters,
+		"queueMessages":   queueMessages,
+		"parent":          first.Parent,
+		"children":        children,
+	})
+}
+
+// linkedRecords loads the records of the caller's account whose attribute matches any of values
+func (j *JMIService) linkedRecords(tableName, indexName, attribute string, values []string, accountId string) ([]map[string]interface{}, error) {
+	records := make([]map[string]interface{}, 0)
+	for _, value := range values {
+		items, err := j.queryIndex(tableName, indexName, attribute, value)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []map[string]interface{}
+		if err := attributevalue.UnmarshalListOfMaps(items, &page); err != nil {
+			return nil, err
+		}
+		for _, record := range page {
+			if record["account_id"] == accountId {
+				records = append(records, record)
+			}
+		}
+	}
+	return records, nil
+}
+
+func recordIds(records []map[string]interface{}) []string {
+	ids := make([]string, 0, len(records))
+	for _, record := range records {
+		if id, ok := record["id"].(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
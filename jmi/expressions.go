@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A when expression gates a step on parameters and earlier results; JMR
+// evaluates it, JMI parses it to reject broken definitions up front. E.g.
+//
+//	params.env == "prod" && steps.prepare.status != "failed"
+//
+// It supports paths, string, number, true/false/null literals, the
+// comparisons == != < <= > >=, &&, ||, ! and parentheses.
+type expression interface {
+	evaluate(scope map[string]interface{}) (interface{}, error)
+}
+
+type literalExpr struct{ value interface{} }
+
+type pathExpr struct{ path []string }
+
+type notExpr struct{ operand expression }
+
+type binaryExpr struct {
+	operator    string
+	left, right expression
+}
+
+func (e literalExpr) evaluate(map[string]interface{}) (interface{}, error) {
+	return e.value, nil
+}
+
+// A missing path is null, so a parameter that was not passed compares unequal
+func (e pathExpr) evaluate(scope map[string]interface{}) (interface{}, error) {
+	var value interface{} = scope
+	for _, segment := range e.path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		value = object[segment]
+	}
+	return value, nil
+}
+
+func (e notExpr) evaluate(scope map[string]interface{}) (interface{}, error) {
+	value, err := e.operand.evaluate(scope)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(value), nil
+}
+
+func (e binaryExpr) evaluate(scope map[string]interface{}) (interface{}, error) {
+	left, err := e.left.evaluate(scope)
+	if err != nil {
+		return nil, err
+	}
+	switch e.operator {
+	case "&&":
+		if !truthy(left) {
+			return false, nil
+		}
+	case "||":
+		if truthy(left) {
+			return true, nil
+		}
+	}
+	right, err := e.right.evaluate(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.operator {
+	case "&&", "||":
+		return truthy(right), nil
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	}
+
+	leftNumber, leftIsNumber := number(left)
+	rightNumber, rightIsNumber := number(right)
+	leftString, leftIsString := left.(string)
+	rightString, rightIsString := right.(string)
+	var order int
+	switch {
+	case leftIsNumber && rightIsNumber:
+		order = compare(leftNumber, rightNumber)
+	case leftIsString && rightIsString:
+		order = strings.Compare(leftString, rightString)
+	default:
+		return nil, fmt.Errorf("cannot compare %v %s %v", left, e.operator, right)
+	}
+	switch e.operator {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	default:
+		return order >= 0, nil
+	}
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	}
+	if n, ok := number(value); ok {
+		return n != 0
+	}
+	return true
+}
+
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func equal(left, right interface{}) bool {
+	leftNumber, leftIsNumber := number(left)
+	rightNumber, rightIsNumber := number(right)
+	if leftIsNumber || rightIsNumber {
+		return leftIsNumber && rightIsNumber && leftNumber == rightNumber
+	}
+	switch left.(type) {
+	case nil, bool, string:
+		return left == right
+	}
+	return false
+}
+
+func compare(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// parseExpression parses a when expression
+func parseExpression(source string) (expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &expressionParser{tokens: tokens}
+	parsed, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.position < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.position].text)
+	}
+	return parsed, nil
+}
+
+type tokenKind int
+
+const (
+	tokenPath tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func isPathStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// Step and task ids often carry dashes, and there is no arithmetic to confuse them with
+func isPathChar(c byte) bool {
+	return isPathStart(c) || (c >= '0' && c <= '9') || c == '.' || c == '-'
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(source) && source[end] != c {
+				if source[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(source) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			text := source[i+1 : end]
+			if c == '"' {
+				unquoted, err := strconv.Unquote(source[i : end+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid string at position %d", i)
+				}
+				text = unquoted
+			}
+			tokens = append(tokens, token{tokenString, text})
+			i = end + 1
+		case (c >= '0' && c <= '9') || (c == '-' && i+1 < len(source) && source[i+1] >= '0' && source[i+1] <= '9'):
+			end := i + 1
+			for end < len(source) && ((source[end] >= '0' && source[end] <= '9') || source[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{tokenNumber, source[i:end]})
+			i = end
+		case isPathStart(c):
+			end := i + 1
+			for end < len(source) && isPathChar(source[end]) {
+				end++
+			}
+			tokens = append(tokens, token{tokenPath, source[i:end]})
+			i = end
+		default:
+			operator := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")"} {
+				if strings.HasPrefix(source[i:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected %q at position %d", c, i)
+			}
+			tokens = append(tokens, token{tokenOperator, operator})
+			i += len(operator)
+		}
+	}
+	return tokens, nil
+}
+
+type expressionParser struct {
+	tokens   []token
+	position int
+}
+
+func (p *expressionParser) accept(operator string) bool {
+	if p.position < len(p.tokens) && p.tokens[p.position].kind == tokenOperator && p.tokens[p.position].text == operator {
+		p.position++
+		return true
+	}
+	return false
+}
+
+func (p *expressionParser) parseOr() (expression, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.accept("||") {
+		var right expression
+		if right, err = p.parseAnd(); err == nil {
+			left = binaryExpr{"||", left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *expressionParser) parseAnd() (expression, error) {
+	left, err := p.parseNot()
+	for err == nil && p.accept("&&") {
+		var right expression
+		if right, err = p.parseNot(); err == nil {
+			left = binaryExpr{"&&", left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *expressionParser) parseNot() (expression, error) {
+	if p.accept("!") {
+		operand, err := p.parseNot()
+		return notExpr{operand}, err
+	}
+	return p.parseComparison()
+}
+
+func (p *expressionParser) parseComparison() (expression, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for _, operator := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.accept(operator) {
+			right, err := p.parsePrimary()
+			return binaryExpr{operator, left, right}, err
+		}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parsePrimary() (expression, error) {
+	if p.position >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	if p.accept("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		return inner, nil
+	}
+
+	current := p.tokens[p.position]
+	p.position++
+	switch current.kind {
+	case tokenString:
+		return literalExpr{current.text}, nil
+	case tokenNumber:
+		value, err := strconv.ParseFloat(current.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", current.text)
+		}
+		return literalExpr{value}, nil
+	case tokenPath:
+		switch current.text {
+		case "true":
+			return literalExpr{true}, nil
+		case "false":
+			return literalExpr{false}, nil
+		case "null":
+			return literalExpr{nil}, nil
+		}
+		return pathExpr{strings.Split(current.text, ".")}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", current.text)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		wantErr bool
+	}{
+		{"path comparison", `params.env == "prod"`, false},
+		{"single quoted string", `params.env != 'dev'`, false},
+		{"dashed step id", `steps.load-data.status == "succeeded"`, false},
+		{"negative number", `params.retries > -1`, false},
+		{"logical operators", `!(params.a && params.b) || params.c`, false},
+		{"literals", `true != false && null == params.missing`, false},
+		{"empty", ``, true},
+		{"unterminated string", `params.env == "prod`, true},
+		{"missing right operand", `params.env ==`, true},
+		{"missing close parenthesis", `(params.a && params.b`, true},
+		{"trailing token", `params.a params.b`, true},
+		{"unknown character", `params.a # 1`, true},
+		{"dangling operator", `params.a &&`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseExpression(tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseExpression(%q) error = %v, wantErr %v", tt.source, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpressionEvaluate(t *testing.T) {
+	scope := map[string]interface{}{
+		"params": map[string]interface{}{
+			"env":     "prod",
+			"retries": float64(3),
+			"count":   2,
+			"enabled": true,
+			"empty":   "",
+		},
+		"steps": map[string]interface{}{
+			"prepare": map[string]interface{}{"status": "succeeded"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		source  string
+		want    interface{}
+		wantErr bool
+	}{
+		{"string equality", `params.env == "prod"`, true, false},
+		{"string inequality", `params.env != "prod"`, false, false},
+		{"nested path", `steps.prepare.status == "succeeded"`, true, false},
+		{"missing path is null", `params.missing == null`, true, false},
+		{"missing path differs from string", `params.missing == "prod"`, false, false},
+		{"path through a non-object", `params.env.inner == null`, true, false},
+		{"float and int compare equal", `params.count == 2`, true, false},
+		{"number against string", `params.retries == "3"`, false, false},
+		{"less than", `params.retries < 5`, true, false},
+		{"greater or equal", `params.retries >= 3`, true, false},
+		{"string ordering", `params.env > "dev"`, true, false},
+		{"and", `params.enabled && params.env == "prod"`, true, false},
+		{"or", `params.empty || params.retries`, true, false},
+		{"not", `!params.empty`, true, false},
+		{"grouping", `!(params.enabled && params.retries < 1)`, true, false},
+		{"and short-circuits", `false && params.env < 1`, false, false},
+		{"or short-circuits", `true || params.env < 1`, true, false},
+		{"bare path", `params.env`, "prod", false},
+		{"mixed ordering fails", `params.env < 1`, nil, true},
+		{"null ordering fails", `params.missing > 0`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseExpression(tt.source)
+			if err != nil {
+				t.Fatalf("parseExpression(%q): %v", tt.source, err)
+			}
+			got, err := parsed.evaluate(scope)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("evaluate(%q) error = %v, wantErr %v", tt.source, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evaluate(%q) = %v, want %v", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruthy(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  bool
+	}{
+		{nil, false},
+		{false, false},
+		{true, true},
+		{"", false},
+		{"x", true},
+		{float64(0), false},
+		{1, true},
+		{int64(-1), true},
+		{map[string]interface{}{}, true},
+	}
+
+	for _, tt := range tests {
+		if got := truthy(tt.value); got != tt.want {
+			t.Errorf("truthy(%#v) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyHeader         = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+
+	// idempotencyRetryAfter is the Retry-After, in seconds, of a 409 for a key
+	// whose first request has not finished; asking again later gets its answer
+	idempotencyRetryAfter = "1"
+)
+
+// Idempotency record states
+const (
+	IdempotencyPending   = "pending"
+	IdempotencyCompleted = "completed"
+)
+
+// IdempotencyRecord remembers the answer to a request sent with an
+// Idempotency-Key, so a retried request gets the same answer instead of
+// running twice
+type IdempotencyRecord struct {
+	AccountId      string `json:"accountId" dynamodbav:"accountId"`
+	IdempotencyKey string `json:"idempotencyKey" dynamodbav:"idempotencyKey"`
+	RequestDigest  string `json:"requestDigest" dynamodbav:"requestDigest"`
+	Status         string `json:"status" dynamodbav:"status"`
+	StatusCode     int    `json:"statusCode,omitempty" dynamodbav:"statusCode,omitempty"`
+	ContentType    string `json:"contentType,omitempty" dynamodbav:"contentType,omitempty"`
+	Body           string `json:"body,omitempty" dynamodbav:"body,omitempty"`
+	CreatedAt      int64  `json:"createdAt" dynamodbav:"createdAt"`
+	ExpiresAt      int64  `json:"expiresAt" dynamodbav:"expiresAt"` // Unix seconds, the table's TTL attribute
+}
+
+// capturingWriter keeps a copy of the response body
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *capturingWriter) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+func (j *JMIService) idempotencyTableName() string {
+	if j.idempotencyTable == "" {
+		return "idempotency_keys"
+	}
+	return j.idempotencyTable
+}
+
+// idempotencyTTL is how long answers are remembered, IDEMPOTENCY_TTL hours (default 24)
+func idempotencyTTL() time.Duration {
+	if value, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_TTL")); err == nil && value > 0 {
+		return time.Duration(value) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// idempotent makes the wrapped route safe to retry. The first request with a
+// given Idempotency-Key runs; later ones with the same key and body get the
+// stored answer (marked Idempotent-Replayed), or 409 with Retry-After while the
+// first is still running. Reusing a key with a different body is rejected. Server errors are
+// not remembered, so the request can be retried. Requests without the header
+// are unaffected.
+func (j *JMIService) idempotent() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(idempotencyHeader)
+		if key == "" {
+			ctx.Next()
+			return
+		}
+		if len(key) > 255 {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			return
+		}
+
+		body, _ := io.ReadAll(ctx.Request.Body)
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+		digest := sha256.Sum256(append([]byte(ctx.Request.Method+" "+ctx.FullPath()+"\n"), body...))
+
+		now := time.Now()
+		record := IdempotencyRecord{
+			AccountId:      identityFrom(ctx).AccountId,
+			IdempotencyKey: key,
+			RequestDigest:  "sha256:" + hex.EncodeToString(digest[:]),
+			Status:         IdempotencyPending,
+			CreatedAt:      now.Unix(),
+			ExpiresAt:      now.Add(idempotencyTTL()).Unix(),
+		}
+
+		claimed, err := j.claimIdempotencyKey(record, now)
+		if err != nil {
+			log.Printf("ERROR: Failed to claim idempotency key %s: %v", key, err)
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			return
+		}
+		if !claimed {
+			j.replayIdempotent(ctx, record)
+			return
+		}
+
+		writer := &capturingWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+		ctx.Next()
+
+		if writer.Status() >= http.StatusInternalServerError {
+			j.releaseIdempotencyKey(record)
+			return
+		}
+		record.Status = IdempotencyCompleted
+		record.StatusCode = writer.Status()
+		record.ContentType = writer.Header().Get("Content-Type")
+		record.Body = writer.body.String()
+		if err := j.putIdempotencyRecord(record, nil); err != nil {
+			log.Printf("ERROR: Failed to store answer for idempotency key %s: %v", key, err)
+		}
+	}
+}
+
+// claimIdempotencyKey stores the pending record unless a live one exists, and
+// reports whether the caller now owns the key
+func (j *JMIService) claimIdempotencyKey(record IdempotencyRecord, now time.Time) (bool, error) {
+	err := j.putIdempotencyRecord(record, &dynamodb.PutItemInput{
+		ConditionExpression: aws.String("attribute_not_exists(idempotencyKey) OR expiresAt < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// putIdempotencyRecord writes the record, with the condition of input if given
+func (j *JMIService) putIdempotencyRecord(record IdempotencyRecord, input *dynamodb.PutItemInput) error {
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return err
+	}
+	if input == nil {
+		input = &dynamodb.PutItemInput{}
+	}
+	input.TableName = aws.String(j.idempotencyTableName())
+	input.Item = item
+	_, err = j.dynamoClient.PutItem(context.TODO(), input)
+	return err
+}
+
+// releaseIdempotencyKey forgets a key whose request failed, so it can be retried
+func (j *JMIService) releaseIdempotencyKey(record IdempotencyRecord) {
+	_, err := j.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(j.idempotencyTableName()),
+		Key: map[string]types.AttributeValue{
+			"accountId":      &types.AttributeValueMemberS{Value: record.AccountId},
+			"idempotencyKey": &types.AttributeValueMemberS{Value: record.IdempotencyKey},
+		},
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to release idempotency key %s: %v", record.IdempotencyKey, err)
+	}
+}
+
+// replayIdempotent answers a repeated request from the stored record
+func (j *JMIService) replayIdempotent(ctx *gin.Context, request IdempotencyRecord) {
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(j.idempotencyTableName()),
+		Key: map[string]types.AttributeValue{
+			"accountId":      &types.AttributeValueMemberS{Value: request.AccountId},
+			"idempotencyKey": &types.AttributeValueMemberS{Value: request.IdempotencyKey},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	var stored IdempotencyRecord
+	if err == nil && result.Item != nil {
+		err = attributevalue.UnmarshalMap(result.Item, &stored)
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to load idempotency key %s: %v", request.IdempotencyKey, err)
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+		return
+	}
+
+	switch {
+	case result.Item == nil:
+		// Released by a failed request in the meantime
+		ctx.Header("Retry-After", idempotencyRetryAfter)
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key just failed, retry"})
+	case stored.RequestDigest != request.RequestDigest:
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+	case stored.Status != IdempotencyCompleted:
+		ctx.Header("Retry-After", idempotencyRetryAfter)
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+	default:
+		ctx.Header(idempotencyReplayedHeader, "true")
+		ctx.Data(stored.StatusCode, stored.ContentType, []byte(stored.Body))
+		ctx.Abort()
+	}
+}
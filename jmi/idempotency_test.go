@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotentRepeatedKey(t *testing.T) {
+	body := `{"executionName": "daily-load"}`
+	digest := sha256.Sum256([]byte("POST /startExecution\n" + body))
+	stored := IdempotencyRecord{
+		AccountId:      "acc-a",
+		IdempotencyKey: "key-1",
+		RequestDigest:  "sha256:" + hex.EncodeToString(digest[:]),
+		ContentType:    "application/json",
+		Body:           `{"executionUuid":"exec-1"}`,
+	}
+	pending, completed, different := stored, stored, stored
+	pending.Status = IdempotencyPending
+	completed.Status = IdempotencyCompleted
+	completed.StatusCode = http.StatusCreated
+	different.Status = IdempotencyCompleted
+	different.RequestDigest = "sha256:other"
+
+	tests := []struct {
+		name           string
+		stored         *IdempotencyRecord
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{"first request still running", &pending, http.StatusConflict, idempotencyRetryAfter},
+		{"first request failed meanwhile", nil, http.StatusConflict, idempotencyRetryAfter},
+		{"first request answered", &completed, http.StatusCreated, ""},
+		{"key reused for another body", &different, http.StatusUnprocessableEntity, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, client := newFakeDynamo(t, func(call dynamoCall) (interface{}, *dynamoError) {
+				switch call.Operation {
+				case "PutItem":
+					return nil, &dynamoError{Type: "ConditionalCheckFailedException"}
+				case "GetItem":
+					if tt.stored != nil {
+						return map[string]interface{}{"Item": wireItem(t, *tt.stored)}, nil
+					}
+				}
+				return nil, nil
+			})
+			service := &JMIService{dynamoClient: client}
+
+			started := false
+			recorder := requestAs(Identity{Subject: "alice", AccountId: "acc-a"}, func(r *gin.Engine) {
+				r.Use(func(ctx *gin.Context) {
+					ctx.Request.Header.Set(idempotencyHeader, "key-1")
+				})
+				r.POST("/startExecution", service.idempotent(), func(ctx *gin.Context) {
+					started = true
+				})
+			}, http.MethodPost, "/startExecution", body)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("POST /startExecution = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if got := recorder.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if started {
+				t.Error("started a second execution for a key already claimed")
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -18,6 +19,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/gin-gonic/gin"
@@ -36,6 +38,22 @@ type ExecutionData struct {
 	Stage         string `dynamodbav:"stage"`
 	ProcessedBy   string `dynamodbav:"processedBy"`
 	Timestamp     int64  `dynamodbav:"timestamp"`
+	AccountId     string `dynamodbav:"accountId,omitempty"`
+	StartedBy     string `dynamodbav:"startedBy,omitempty"`
+	StoppedBy     string `dynamodbav:"stoppedBy,omitempty"`
+
+	// Snapshot of the routine definition this execution ran, if one is registered
+	RoutineVersion int                `dynamodbav:"routineVersion,omitempty"`
+	Definition     *RoutineDefinition `dynamodbav:"definition,omitempty"`
+
+	Parameters map[string]interface{} `dynamodbav:"parameters,omitempty"`
+	Parent     *ParentExecution       `dynamodbav:"parent,omitempty"`
+}
+
+// executionKey builds the primary key of one stage record. The UUID keeps runs of
+// the same routine (and of different tenants) from overwriting each other.
+func executionKey(executionName, executionUuid string, version int, stage string) string {
+	return fmt.Sprintf("%s#%s#v%d#%s", executionName, executionUuid, version, stage)
 }
 
 // applyProcessingDelay aplica uma latência artificial baseada na variável de ambiente
@@ -144,17 +162,31 @@ type SchedulerRoutine struct {
 	Priority      string `json:"priority" dynamodbav:"priority"`
 	Provisioning  string `json:"provisioning" dynamodbav:"provisioning"`
 	Steps         []Step `json:"steps" dynamodbav:"steps"`
+
+	ControlResources []ControlResource `json:"controlResources,omitempty" dynamodbav:"controlResources,omitempty"` // Locks held for the whole execution
 }
 
 type Step struct {
-	StepId string `json:"stepId" dynamodbav:"stepId"`
-	Tasks  []Task `json:"tasks" dynamodbav:"tasks"`
+	StepId   string        `json:"stepId" dynamodbav:"stepId"`
+	Type     string        `json:"type,omitempty" dynamodbav:"type,omitempty"`         // tasks (default) or approval
+	Approval *ApprovalGate `json:"approval,omitempty" dynamodbav:"approval,omitempty"` // Only on approval steps
+	Tasks    []Task        `json:"tasks" dynamodbav:"tasks"`
+	RunIf    string        `json:"runIf,omitempty" dynamodbav:"runIf,omitempty"` // success (default), failure or always
+	When     string        `json:"when,omitempty" dynamodbav:"when,omitempty"`   // Expression over params, steps and tasks
+
+	ControlResources  []ControlResource `json:"controlResources,omitempty" dynamodbav:"controlResources,omitempty"`
+	WaitForConditions []Condition       `json:"waitForConditions,omitempty" dynamodbav:"waitForConditions,omitempty"` // Checked by JMR before the step runs
+	OnSuccess         *ConditionActions `json:"onSuccess,omitempty" dynamodbav:"onSuccess,omitempty"`
+	OnFailure         *ConditionActions `json:"onFailure,omitempty" dynamodbav:"onFailure,omitempty"`
 }
 
 type Task struct {
 	TaskId      string                 `json:"taskId" dynamodbav:"taskId"`
-	RuntimeName string                 `json:"runtimeName" dynamodbav:"runtimeName"`
+	Type        string                 `json:"type,omitempty" dynamodbav:"type,omitempty"` // runtime (default) or routine
+	RuntimeName string                 `json:"runtimeName,omitempty" dynamodbav:"runtimeName,omitempty"`
+	Routine     *SubRoutine            `json:"routine,omitempty" dynamodbav:"routine,omitempty"`
 	Parameters  map[string]interface{} `json:"parameters" dynamodbav:"parameters"`
+	Resources   []ResourceClaim        `json:"resources,omitempty" dynamodbav:"resources,omitempty"` // Pool capacity held while the task runs
 }
 
 type RetakeInfo struct {
@@ -163,8 +195,14 @@ type RetakeInfo struct {
 }
 
 type StartExecutionRequest struct {
-	ExecutionName string      `json:"executionName"`
-	Retake        *RetakeInfo `json:"retake,omitempty"`
+	ExecutionName string                 `json:"executionName"`
+	Version       int                    `json:"version,omitempty"` // Pin a routine definition version (0 = latest)
+	Retake        *RetakeInfo            `json:"retake,omitempty"`
+	Parameters    map[string]interface{} `json:"parameters,omitempty"` // Run-level parameters, e.g. eventDate
+	Parent        *ParentExecution       `json:"parent,omitempty"`     // Set by JMR when a routine task starts this execution
+
+	executionUuid string // Set when starting a queued start, which already has its UUID
+	fromQueue     bool
 }
 
 type StopExecutionRequest struct {
@@ -183,6 +221,7 @@ type Job struct {
 	CreatedAt   time.Time              `json:"created_at" dynamodbav:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at" dynamodbav:"updated_at"`
 	Status      string                 `json:"status" dynamodbav:"status"`
+	AccountId   string                 `json:"account_id" dynamodbav:"account_id"`
 }
 
 type JMIService struct {
@@ -190,8 +229,34 @@ type JMIService struct {
 	executions    []Execution
 	dynamoClient  *dynamodb.Client
 	sqsClient     *sqs.Client
+	streamsClient *dynamodbstreams.Client
+	events        *eventHub
 	tableName     string
 	executionTable string
+	routineTable  string
+	tenantUsageTable   string
+	executionSlotTable string
+	auditTable    string
+	scheduleTable     string
+	adapterTable      string
+	queueMessageTable string
+	webhookTable         string
+	webhookDeliveryTable string
+	webhookOutboxTable   string
+	webhooks      webhookConfig
+	slaTable       string
+	slaBreachTable string
+	idempotencyTable string
+	routineConcurrencyTable string
+	queuedStartTable        string
+	resourcePoolTable       string
+	resourceLeaseTable      string
+	controlResourceTable    string
+	conditionTable          string
+	approvalTable           string
+	executionLinkTable      string
+	waitTable               string
+	quotas        tenantQuotas
 	inQueueURL    string
 	outQueueURL   string
 	receiveCtx    context.Context
@@ -232,8 +297,34 @@ func NewJMIService() *JMIService {
 		executions:    make([]Execution, 0),
 		dynamoClient:  dynamodb.NewFromConfig(cfg),
 		sqsClient:     sqs.NewFromConfig(cfg),
+		streamsClient: dynamodbstreams.NewFromConfig(cfg),
+		events:        newEventHub(),
 		tableName:     os.Getenv("DYNAMODB_TABLE"),
 		executionTable: os.Getenv("EXECUTION_TABLE"),
+		routineTable:  os.Getenv("ROUTINE_TABLE"),
+		tenantUsageTable:   os.Getenv("TENANT_USAGE_TABLE"),
+		executionSlotTable: os.Getenv("EXECUTION_SLOT_TABLE"),
+		auditTable:    os.Getenv("AUDIT_TABLE"),
+		scheduleTable:     os.Getenv("SCHEDULE_TABLE"),
+		adapterTable:      os.Getenv("ADAPTER_TABLE"),
+		queueMessageTable: os.Getenv("QUEUE_MESSAGE_TABLE"),
+		webhookTable:         os.Getenv("WEBHOOK_TABLE"),
+		webhookDeliveryTable: os.Getenv("WEBHOOK_DELIVERY_TABLE"),
+		webhookOutboxTable:   os.Getenv("WEBHOOK_OUTBOX_TABLE"),
+		webhooks:      loadWebhookConfig(),
+		slaTable:       os.Getenv("SLA_TABLE"),
+		slaBreachTable: os.Getenv("SLA_BREACH_TABLE"),
+		idempotencyTable: os.Getenv("IDEMPOTENCY_TABLE"),
+		routineConcurrencyTable: os.Getenv("ROUTINE_CONCURRENCY_TABLE"),
+		queuedStartTable:        os.Getenv("QUEUED_START_TABLE"),
+		resourcePoolTable:       os.Getenv("RESOURCE_POOL_TABLE"),
+		resourceLeaseTable:      os.Getenv("RESOURCE_LEASE_TABLE"),
+		controlResourceTable:    os.Getenv("CONTROL_RESOURCE_TABLE"),
+		conditionTable:          os.Getenv("CONDITION_TABLE"),
+		approvalTable:           os.Getenv("APPROVAL_TABLE"),
+		executionLinkTable:      os.Getenv("EXECUTION_LINK_TABLE"),
+		waitTable:               os.Getenv("WAIT_TABLE"),
+		quotas:        loadTenantQuotas(),
 		inQueueURL:    os.Getenv("SQS_QUEUE_URL"),
 		outQueueURL:   os.Getenv("JMW_QUEUE_URL"),
 		receiveCtx:    ctx,
@@ -243,9 +334,35 @@ func NewJMIService() *JMIService {
 	// Start message receiver
 	go service.startMessageReceiver()
 
+	// Feed the live event stream
+	go service.watchExecutionStream()
+	go service.watchQueueDepths()
+
+	// Compare executions against the routine SLAs
+	go service.startSLAMonitor()
+
+	// Start queued executions as running ones end
+	go service.startQueueDispatcher()
+
+	// Deliver queued webhook events
+	go service.startWebhookWorker()
+
+	// Reject approvals whose timeout ran out
+	go service.startApprovalTimeouts()
+
+	// Send back parked executions whose wait ran out
+	go service.startWaitTimeouts()
+
 	return service
 }
 
+func (j *JMIService) executionTableName() string {
+	if j.executionTable == "" {
+		return "executions"
+	}
+	return j.executionTable
+}
+
 func (j *JMIService) startMessageReceiver() {
 	for {
 		select {
@@ -342,75 +459,140 @@ func (j *JMIService) StopExecution(ctx *gin.Context) {
 		return
 	}
 
-	// Find execution in DynamoDB
-	tableName := j.executionTable
-	if tableName == "" {
-		tableName = "executions"
-	}
+	setAuditTarget(ctx, "execution/"+req.ExecutionName)
+	status, response := j.stopExecution(identityFrom(ctx), req)
+	ctx.JSON(status, response)
+}
 
+// stopExecution stops one of identity's executions and returns the status
+// and body of the answer
+func (j *JMIService) stopExecution(identity Identity, req StopExecutionRequest) (int, gin.H) {
+	tableName := j.executionTableName()
+
+	// The jmi-start record identifies the execution and the tenant that owns it
 	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
 		TableName: aws.String(tableName),
 		Key: map[string]types.AttributeValue{
-			"executionName": &types.AttributeValueMemberS{Value: req.ExecutionName},
+			"executionName": &types.AttributeValueMemberS{Value: executionKey(req.ExecutionName, req.ExecutionUuid, 1, "jmi-start")},
 		},
 	})
 
 	if err != nil {
 		log.Printf("Error getting execution from DynamoDB: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find execution"})
-		return
+		return http.StatusInternalServerError, gin.H{"error": "Failed to find execution"}
 	}
 
 	if result.Item == nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "Execution not found"})
-		return
+		return j.cancelQueuedStart(identity, req)
 	}
 
-	var execution Execution
-	err = attributevalue.UnmarshalMap(result.Item, &execution)
+	var started ExecutionData
+	err = attributevalue.UnmarshalMap(result.Item, &started)
 	if err != nil {
 		log.Printf("Error unmarshaling execution: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process execution data"})
-		return
+		return http.StatusInternalServerError, gin.H{"error": "Failed to process execution data"}
 	}
 
-	// Verify UUID matches
-	if execution.ExecutionUuid != req.ExecutionUuid {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Execution UUID mismatch"})
-		return
+	// Other tenants' executions are reported as missing rather than forbidden
+	if started.AccountId != identity.AccountId {
+		return http.StatusNotFound, gin.H{"error": "Execution not found"}
 	}
 
-	// Update execution status
-	execution.Status = "stopped"
-	execution.UpdatedAt = time.Now()
+	// A run that already ended keeps its outcome; stopping it would send the
+	// subscribers a second terminal webhook
+	finished, err := j.finishedRunStatus(started.OriginalName, started.ExecutionUuid)
+	if err != nil {
+		log.Printf("Error getting run of execution %s: %v", started.ExecutionUuid, err)
+		return http.StatusInternalServerError, gin.H{"error": "Failed to find execution"}
+	}
+	if finished != "" {
+		return http.StatusConflict, gin.H{"error": "Execution already finished", "status": finished}
+	}
 
-	// Store updated execution in DynamoDB
-	item, err := attributevalue.MarshalMap(execution)
+	// Record the stop as its own stage so the start record stays intact
+	now := time.Now()
+	stopped := ExecutionData{
+		ExecutionName:  executionKey(started.OriginalName, started.ExecutionUuid, 4, "jmi-stop"),
+		OriginalName:   started.OriginalName,
+		ExecutionUuid:  started.ExecutionUuid,
+		Status:         "stopped",
+		CreatedAt:      started.CreatedAt,
+		UpdatedAt:      now.Format(time.RFC3339),
+		Version:        4,
+		Stage:          "jmi-stop",
+		ProcessedBy:    "JMI",
+		Timestamp:      now.Unix(),
+		AccountId:      started.AccountId,
+		StartedBy:      started.StartedBy,
+		StoppedBy:      identity.Subject,
+		RoutineVersion: started.RoutineVersion,
+	}
+
+	item, err := attributevalue.MarshalMap(stopped)
 	if err != nil {
 		log.Printf("Error marshaling execution: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process execution"})
-		return
+		return http.StatusInternalServerError, gin.H{"error": "Failed to process execution"}
 	}
 
 	_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
-		TableName: aws.String(tableName),
-		Item:      item,
+		TableName:           aws.String(tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(executionName)"),
 	})
 
 	if err != nil {
+		var conditionErr *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionErr) {
+			return http.StatusConflict, gin.H{"error": "Execution already stopped"}
+		}
 		log.Printf("Error updating execution in DynamoDB: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update execution"})
-		return
+		return http.StatusInternalServerError, gin.H{"error": "Failed to update execution"}
 	}
 
-	log.Printf("JMI stopped execution %s with UUID %s", execution.ExecutionName, execution.ExecutionUuid)
+	j.releaseExecutionSlot(started.AccountId, started.OriginalName, started.ExecutionUuid)
+	j.releaseControlLocks(started.ExecutionUuid)
+	j.cancelApprovals(started.AccountId, started.ExecutionUuid, identity.Subject)
+	stoppedChildren := j.stopChildren(identity, started.ExecutionUuid)
+	// JMR drops a parked execution sent back after its stop and gives back what
+	// it held; a parent parked on this one takes on the stop
+	j.resumeWaits(started.ExecutionUuid)
+	j.wakeWaiters(started.AccountId, "execution#"+started.ExecutionUuid+"#")
 
-	ctx.JSON(http.StatusOK, gin.H{
+	log.Printf("JMI stopped execution %s with UUID %s", stopped.OriginalName, stopped.ExecutionUuid)
+
+	response := gin.H{
 		"message":       "Execution stopped successfully",
-		"executionName": execution.ExecutionName,
-		"executionUuid": execution.ExecutionUuid,
-		"status":        execution.Status,
+		"executionName": stopped.OriginalName,
+		"executionUuid": stopped.ExecutionUuid,
+		"status":        stopped.Status,
+		"stoppedBy":     stopped.StoppedBy,
+	}
+	if len(stoppedChildren) > 0 {
+		response["stoppedChildren"] = stoppedChildren
+	}
+	return http.StatusOK, response
+}
+
+// finishedRunStatus returns the status of the jmr-run record when it ended the
+// execution, or "" while the execution runs or is parked
+func (j *JMIService) finishedRunStatus(executionName, executionUuid string) (string, error) {
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName:      aws.String(j.executionTableName()),
+		Key:            runRecordKey(executionName, executionUuid),
+		ConsistentRead: aws.Bool(true),
 	})
+	if err != nil || result.Item == nil {
+		return "", err
+	}
+
+	var run StageRecord
+	if err := attributevalue.UnmarshalMap(result.Item, &run); err != nil {
+		return "", err
+	}
+	if _, ended := terminalStatus(run); !ended {
+		return "", nil
+	}
+	return run.Status, nil
 }
 
 func (j *JMIService) GetQueues(ctx *gin.Context) {
@@ -488,34 +670,77 @@ func (j *JMIService) GetTables(ctx *gin.Context) {
 }
 
 func (j *JMIService) GetExecutions(ctx *gin.Context) {
-	tableName := "executions"
-	
-	log.Printf("DEBUG: Listing executions from table: %s", tableName)
-	
-	// Scan table using AWS SDK (same pattern as dynamodb-test)
-	scanOutput, err := j.dynamoClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName: aws.String(tableName),
-	})
+	identity := identityFrom(ctx)
+	tableName := j.executionTableName()
+
+	// Executions are always scoped to the caller; asking for another account is an error
+	if accountId := ctx.Query("accountId"); accountId != "" && accountId != identity.AccountId {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "accountId does not match the caller's account"})
+		return
+	}
+
+	page, err := parsePageRequest(ctx)
 	if err != nil {
-		log.Printf("ERROR: Failed to scan executions table: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list executions"})
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, to, err := parseTimeRange(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Unmarshal results
-	var executions []ExecutionData
-	err = attributevalue.UnmarshalListOfMaps(scanOutput.Items, &executions)
+	log.Printf("DEBUG: Listing executions of account %s from table: %s", identity.AccountId, tableName)
+
+	input := &dynamodb.QueryInput{
+		TableName:                aws.String(tableName),
+		ExpressionAttributeNames: map[string]string{"#ts": "timestamp"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":from": &types.AttributeValueMemberN{Value: strconv.FormatInt(from.Unix(), 10)},
+			":to":   &types.AttributeValueMemberN{Value: strconv.FormatInt(to.Unix(), 10)},
+		},
+	}
+
+	filter := newQueryFilter()
+	if originalName := ctx.Query("originalName"); originalName != "" {
+		// One routine's runs come from the originalName GSI, still restricted to the tenant
+		input.IndexName = aws.String("originalName-timestamp-index")
+		input.KeyConditionExpression = aws.String("originalName = :originalName AND #ts BETWEEN :from AND :to")
+		input.ExpressionAttributeValues[":originalName"] = &types.AttributeValueMemberS{Value: originalName}
+		filter.equals("accountId", identity.AccountId)
+	} else {
+		input.IndexName = aws.String("accountId-timestamp-index")
+		input.KeyConditionExpression = aws.String("accountId = :accountId AND #ts BETWEEN :from AND :to")
+		input.ExpressionAttributeValues[":accountId"] = &types.AttributeValueMemberS{Value: identity.AccountId}
+	}
+	filter.equals("status", ctx.Query("status"))
+	filter.equals("stage", ctx.Query("stage"))
+	filter.apply(input)
+
+	items, nextCursor, err := queryPage(j.dynamoClient, input, page)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
+		log.Printf("ERROR: Failed to query executions table: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list executions"})
+		return
+	}
+
+	executions := make([]ExecutionData, 0, len(items))
+	if err := attributevalue.UnmarshalListOfMaps(items, &executions); err != nil {
 		log.Printf("ERROR: Failed to unmarshal executions: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process executions"})
 		return
 	}
 
 	log.Printf("DEBUG: Found %d executions in table via AWS SDK", len(executions))
-	
+
 	ctx.JSON(http.StatusOK, gin.H{
 		"executions": executions,
 		"count":      len(executions),
+		"nextCursor": nextCursor,
 		"table":      tableName,
 		"service":    "jmi",
 	})
@@ -531,23 +756,34 @@ func (j *JMIService) GetHealth(ctx *gin.Context) {
 }
 
 func (j *JMIService) GetJobs(ctx *gin.Context) {
-	// Query DynamoDB for all jobs
-	result, err := j.dynamoClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName: aws.String(j.tableName),
+	identity := identityFrom(ctx)
+
+	// Query the tenant's jobs through the account_id GSI
+	var jobs []Job
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.tableName),
+		IndexName:              aws.String("account_id-index"),
+		KeyConditionExpression: aws.String("account_id = :accountId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: identity.AccountId},
+		},
 	})
 
-	if err != nil {
-		log.Printf("Error scanning DynamoDB: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve jobs"})
-		return
-	}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error querying DynamoDB: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve jobs"})
+			return
+		}
 
-	var jobs []Job
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &jobs)
-	if err != nil {
-		log.Printf("Error unmarshaling jobs: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process jobs data"})
-		return
+		var pageJobs []Job
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageJobs); err != nil {
+			log.Printf("Error unmarshaling jobs: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process jobs data"})
+			return
+		}
+		jobs = append(jobs, pageJobs...)
 	}
 
 	ctx.JSON(http.StatusOK, jobs)
@@ -555,22 +791,106 @@ func (j *JMIService) GetJobs(ctx *gin.Context) {
 
 func (j *JMIService) StartExecution(ctx *gin.Context) {
 	var req StartExecutionRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindAndValidate(ctx, "start-execution", &req, nil) {
 		return
 	}
 
+	setAuditTarget(ctx, "execution/"+req.ExecutionName)
+	if req.Retake != nil {
+		setAuditAction(ctx, "execution.retake")
+	}
+
+	identity := identityFrom(ctx)
+	if status, response := j.checkParent(identity, req.Parent); response != nil {
+		ctx.JSON(status, response)
+		return
+	}
+
+	status, response := j.startExecution(identity, req)
+	if req.Parent != nil && (status == http.StatusOK || status == http.StatusAccepted) {
+		if executionUuid, ok := response["executionUuid"].(string); ok {
+			j.linkChild(identity, req.Parent, req.ExecutionName, executionUuid)
+		}
+	}
+	ctx.JSON(status, response)
+}
+
+// startExecution starts one execution of a routine for identity and returns
+// the status and body of the answer
+func (j *JMIService) startExecution(identity Identity, req StartExecutionRequest) (int, gin.H) {
+	// Resolve the routine definition to snapshot onto the execution
+	definition, err := j.getRoutineVersion(identity.AccountId, req.ExecutionName, req.Version)
+	if err != nil {
+		if !errors.Is(err, errRoutineNotFound) {
+			log.Printf("ERROR: Failed to resolve routine definition: %v", err)
+			return http.StatusInternalServerError, gin.H{"error": "Failed to resolve routine definition"}
+		}
+		if req.Version > 0 {
+			return http.StatusNotFound, gin.H{"error": fmt.Sprintf("Routine %s version %d not found", req.ExecutionName, req.Version)}
+		}
+		// Unregistered routines still run, but without a recorded structure
+		log.Printf("WARN: No routine definition registered for %s", req.ExecutionName)
+		definition = nil
+	}
+
+	if violations := validateRetake(req.Retake, definition); len(violations) > 0 {
+		return http.StatusUnprocessableEntity, gin.H{
+			"error":      "Validation failed",
+			"violations": violations,
+		}
+	}
+
 	// Apply artificial processing delay if configured
 	applyProcessingDelay()
 
 	// Generate execution UUID
-	executionUuid := uuid.New().String()
+	executionUuid := req.executionUuid
+	if executionUuid == "" {
+		executionUuid = uuid.New().String()
+	}
+
+	// Count the execution against the tenant quota and the routine's
+	// concurrency limit before doing any work
+	err = j.acquireExecutionSlot(identity.AccountId, req.ExecutionName, executionUuid)
+	var cancelled []string
+	if errors.Is(err, errRoutineBusy) {
+		var status int
+		var response gin.H
+		if cancelled, status, response = j.resolveOverlap(identity, req, executionUuid); response != nil {
+			return status, response
+		}
+		// cancel-previous freed a slot; take it, unless another start got it first
+		err = j.acquireExecutionSlot(identity.AccountId, req.ExecutionName, executionUuid)
+		if errors.Is(err, errRoutineBusy) {
+			concurrency, loadErr := j.getRoutineConcurrency(identity.AccountId, req.ExecutionName)
+			if loadErr != nil {
+				log.Printf("ERROR: Failed to load concurrency of routine %s: %v", req.ExecutionName, loadErr)
+				return http.StatusInternalServerError, gin.H{"error": "Failed to check routine concurrency"}
+			}
+			status, response := routineBusy(concurrency)
+			response["cancelledExecutions"] = cancelled
+			return status, response
+		}
+	}
+	if err != nil {
+		if errors.Is(err, errQuotaExceeded) {
+			return http.StatusTooManyRequests, gin.H{
+				"error":                   "Concurrent execution quota exceeded",
+				"accountId":               identity.AccountId,
+				"maxConcurrentExecutions": j.quotas.limitFor(identity.AccountId),
+			}
+		}
+		log.Printf("ERROR: Failed to acquire execution slot: %v", err)
+		return http.StatusInternalServerError, gin.H{"error": "Failed to check execution quota"}
+	}
 
 	// Create simple execution record for basic start execution with versioning
 	now := time.Now()
 	execution := map[string]interface{}{
 		"executionName": req.ExecutionName,
 		"executionUuid": executionUuid,
+		"accountId":     identity.AccountId,
+		"startedBy":     identity.Subject,
 		"status":        "started",
 		"createdAt":     now.Format(time.RFC3339),
 		"updatedAt":     now.Format(time.RFC3339),
@@ -584,26 +904,35 @@ func (j *JMIService) StartExecution(ctx *gin.Context) {
 	if req.Retake != nil {
 		execution["retake"] = req.Retake
 	}
+	if len(req.Parameters) > 0 {
+		execution["parameters"] = req.Parameters
+	}
+	if req.Parent != nil {
+		execution["parent"] = req.Parent
+	}
 
-	tableName := j.executionTable
-	if tableName == "" {
-		tableName = "executions"
+	// Forward the snapshot so downstream stages run exactly this definition
+	if definition != nil {
+		execution["routineVersion"] = definition.Version
+		execution["definition"] = definition
 	}
 
+	tableName := j.executionTableName()
+
 	log.Printf("DEBUG: Storing execution in table: %s", tableName)
 	log.Printf("DEBUG: Execution data: %+v", execution)
 
-	// Create composite key for versioning: executionName#version#stage
-	executionKey := fmt.Sprintf("%s#v%d#%s", execution["executionName"], execution["version"], execution["stage"])
-	log.Printf("DEBUG: Generated execution key: %s", executionKey)
+	// Create composite key for versioning: executionName#executionUuid#version#stage
+	itemKey := executionKey(req.ExecutionName, executionUuid, 1, "jmi-start")
+	log.Printf("DEBUG: Generated execution key: %s", itemKey)
 
 	log.Printf("DEBUG: About to store in DynamoDB using WORKING pattern from dynamodb-test")
 	log.Printf("DEBUG: Table name: %s", tableName)
-	log.Printf("DEBUG: Item key: %s", executionKey)
+	log.Printf("DEBUG: Item key: %s", itemKey)
 	
 	// Create ExecutionData struct following the WORKING pattern
 	executionStruct := ExecutionData{
-		ExecutionName: executionKey,
+		ExecutionName: itemKey,
 		OriginalName:  execution["executionName"].(string),
 		ExecutionUuid: execution["executionUuid"].(string),
 		Status:        execution["status"].(string),
@@ -613,7 +942,15 @@ func (j *JMIService) StartExecution(ctx *gin.Context) {
 		Stage:         execution["stage"].(string),
 		ProcessedBy:   execution["processedBy"].(string),
 		Timestamp:     execution["timestamp"].(int64),
+		AccountId:     identity.AccountId,
+		StartedBy:     identity.Subject,
+	}
+	if definition != nil {
+		executionStruct.RoutineVersion = definition.Version
+		executionStruct.Definition = definition
 	}
+	executionStruct.Parameters = req.Parameters
+	executionStruct.Parent = req.Parent
 
 	log.Printf("DEBUG: Execution struct: %+v", executionStruct)
 
@@ -621,8 +958,8 @@ func (j *JMIService) StartExecution(ctx *gin.Context) {
 	item, err := attributevalue.MarshalMap(executionStruct)
 	if err != nil {
 		log.Printf("ERROR: Failed to marshal execution: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process execution"})
-		return
+		j.releaseExecutionSlot(identity.AccountId, req.ExecutionName, executionUuid)
+		return http.StatusInternalServerError, gin.H{"error": "Failed to process execution"}
 	}
 
 	log.Printf("DEBUG: Marshaled item successfully with %d fields", len(item))
@@ -635,8 +972,8 @@ func (j *JMIService) StartExecution(ctx *gin.Context) {
 
 	if err != nil {
 		log.Printf("ERROR: Failed to store execution in DynamoDB: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store execution"})
-		return
+		j.releaseExecutionSlot(identity.AccountId, req.ExecutionName, executionUuid)
+		return http.StatusInternalServerError, gin.H{"error": "Failed to store execution"}
 	}
 
 	log.Printf("DEBUG: Successfully stored execution in DynamoDB using WORKING pattern")
@@ -645,8 +982,8 @@ func (j *JMIService) StartExecution(ctx *gin.Context) {
 	executionJSON, err := json.Marshal(execution)
 	if err != nil {
 		log.Printf("Error marshaling execution for JMW: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process execution"})
-		return
+		j.releaseExecutionSlot(identity.AccountId, req.ExecutionName, executionUuid)
+		return http.StatusInternalServerError, gin.H{"error": "Failed to process execution"}
 	}
 
 	_, err = j.sqsClient.SendMessage(context.TODO(), &sqs.SendMessageInput{
@@ -656,18 +993,23 @@ func (j *JMIService) StartExecution(ctx *gin.Context) {
 
 	if err != nil {
 		log.Printf("Error sending message to JMW queue: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward execution"})
-		return
+		j.releaseExecutionSlot(identity.AccountId, req.ExecutionName, executionUuid)
+		return http.StatusInternalServerError, gin.H{"error": "Failed to forward execution"}
 	}
 
 	log.Printf("JMI started execution %s with UUID %s", execution["executionName"], execution["executionUuid"])
 
-	ctx.JSON(http.StatusOK, gin.H{
-		"message":       "Execution started successfully",
-		"executionName": execution["executionName"],
-		"executionUuid": execution["executionUuid"],
-		"status":        execution["status"],
-	})
+	response := gin.H{
+		"message":        "Execution started successfully",
+		"executionName":  execution["executionName"],
+		"executionUuid":  execution["executionUuid"],
+		"status":         execution["status"],
+		"routineVersion": execution["routineVersion"],
+	}
+	if len(cancelled) > 0 {
+		response["cancelledExecutions"] = cancelled
+	}
+	return http.StatusOK, response
 }
 
 func (j *JMIService) ProcessJob(ctx *gin.Context) {
@@ -677,6 +1019,9 @@ func (j *JMIService) ProcessJob(ctx *gin.Context) {
 		return
 	}
 
+	// Jobs always belong to the caller's tenant
+	job.AccountId = identityFrom(ctx).AccountId
+
 	// Update job status
 	job.Status = "integrated"
 	job.UpdatedAt = time.Now()
@@ -741,20 +1086,95 @@ func main() {
 	
 	// List tables endpoint (replacement for awslocal dynamodb list-tables)
 	r.GET("/tables", service.GetTables)
-	
-	// List executions endpoint (following dynamodb-test pattern)
-	r.GET("/executions", service.GetExecutions)
 
 	// Health check
 	r.GET("/health", service.GetHealth)
 
-	// Execution endpoints (new)
-	r.POST("/startExecution", service.StartExecution)
-	r.POST("/stopExecution", service.StopExecution)
+	// Published JSON Schemas for request payloads
+	r.GET("/schemas", service.GetSchemas)
+	r.GET("/schemas/:name", service.GetSchema)
+
+	// Everything below requires an authenticated caller and is scoped to its tenant
+	tenant := r.Group("/", authMiddleware(loadAuthenticators()))
+	viewer := requireRole(RoleViewer)
+	submitter := requireRole(RoleSubmitter)
+	operator := requireRole(RoleOperator)
+	audit := newAuditor(service.dynamoClient, service.auditTableName(), "jmi")
+	idempotent := service.idempotent()
+
+	// List executions endpoint (following dynamodb-test pattern)
+	tenant.GET("/executions", viewer, service.GetExecutions)
+	tenant.GET("/executions/:executionUuid", viewer, service.GetExecution)
+
+	// Live stream (SSE) of execution transitions and queue depth changes
+	tenant.GET("/events", viewer, service.StreamEvents)
+
+	// Execution endpoints (new); retries carrying the same Idempotency-Key get the first answer
+	tenant.POST("/startExecution", audit("execution.start"), submitter, idempotent, service.StartExecution)
+	tenant.POST("/stopExecution", audit("execution.stop"), operator, idempotent, service.StopExecution)
+
+	// Approval steps: executions paused until someone signs them off
+	tenant.GET("/approvals", viewer, service.GetApprovals)
+	tenant.POST("/executions/:executionUuid/approve", audit("approval.approve"), operator, service.ApproveExecution)
+	tenant.POST("/executions/:executionUuid/reject", audit("approval.reject"), operator, service.RejectExecution)
+
+	// Bulk start, stop and retake by list or selector, with dryRun previews
+	tenant.POST("/bulk/start", audit("execution.bulk-start"), operator, service.bulkHandler(BulkStart))
+	tenant.POST("/bulk/stop", audit("execution.bulk-stop"), operator, service.bulkHandler(BulkStop))
+	tenant.POST("/bulk/retake", audit("execution.bulk-retake"), operator, service.bulkHandler(BulkRetake))
+
+	// Routine definition registry (immutable versions)
+	tenant.GET("/routines", viewer, service.GetRoutines)
+	tenant.POST("/routines", audit("routine.create"), submitter, service.CreateRoutine)
+	tenant.GET("/routines/:name", viewer, service.GetRoutine)
+	tenant.PUT("/routines/:name", audit("routine.update"), submitter, service.UpdateRoutine)
+	tenant.DELETE("/routines/:name", audit("routine.delete"), operator, service.DeleteRoutine)
+	tenant.GET("/routines/:name/versions", viewer, service.GetRoutineVersions)
+	tenant.GET("/routines/:name/versions/:version", viewer, service.GetRoutineVersion)
+	tenant.GET("/routines/:name/concurrency", viewer, service.GetRoutineConcurrency)
+	tenant.PUT("/routines/:name/concurrency", audit("concurrency.update"), submitter, service.PutRoutineConcurrency)
+	tenant.DELETE("/routines/:name/concurrency", audit("concurrency.delete"), operator, service.DeleteRoutineConcurrency)
+
+	// Quantitative resource pools leased by JMR to tasks
+	tenant.GET("/resource-pools", viewer, service.GetResourcePools)
+	tenant.GET("/resource-pools/:name", viewer, service.GetResourcePool)
+	tenant.PUT("/resource-pools/:name", audit("resource-pool.update"), submitter, service.PutResourcePool)
+	tenant.DELETE("/resource-pools/:name", audit("resource-pool.delete"), operator, service.DeleteResourcePool)
+
+	// Control resources (locks) held and awaited by executions
+	tenant.GET("/control-resources", viewer, service.GetControlResources)
+	tenant.GET("/control-resources/:name", viewer, service.GetControlResource)
+
+	// Conditions (flags per order date) coordinating routines and external systems
+	tenant.GET("/conditions", viewer, service.GetConditions)
+	tenant.POST("/conditions", audit("condition.add"), submitter, service.AddCondition)
+	tenant.GET("/conditions/:name/:orderDate", viewer, service.GetCondition)
+	tenant.DELETE("/conditions/:name/:orderDate", audit("condition.delete"), submitter, service.DeleteCondition)
+
+	// Tenant quota usage
+	tenant.GET("/tenant/usage", viewer, service.GetTenantUsage)
+
+	// Audit trail of mutating operations
+	tenant.GET("/audit", operator, service.GetAuditLog)
+
+	// Routine SLAs: status view, breaches and configuration
+	tenant.GET("/slas", viewer, service.GetSLAs)
+	tenant.GET("/slas/breaches", viewer, service.GetSLABreaches)
+	tenant.GET("/slas/:routineName", viewer, service.GetSLA)
+	tenant.PUT("/slas/:routineName", audit("sla.update"), submitter, service.PutSLA)
+	tenant.DELETE("/slas/:routineName", audit("sla.delete"), operator, service.DeleteSLA)
+
+	// Outbound webhooks for terminal execution states and SLA breaches
+	tenant.GET("/webhooks", viewer, service.GetWebhooks)
+	tenant.POST("/webhooks", audit("webhook.create"), operator, service.CreateWebhook)
+	tenant.GET("/webhooks/:id", viewer, service.GetWebhook)
+	tenant.DELETE("/webhooks/:id", audit("webhook.delete"), operator, service.DeleteWebhook)
+	tenant.POST("/webhooks/:id/test", audit("webhook.test"), operator, service.TestWebhook)
+	tenant.GET("/webhooks/:id/deliveries", viewer, service.GetWebhookDeliveries)
 
 	// Job endpoints (legacy)
-	r.GET("/jobs", service.GetJobs)
-	r.POST("/process", service.ProcessJob)
+	tenant.GET("/jobs", viewer, service.GetJobs)
+	tenant.POST("/process", submitter, service.ProcessJob)
 
 	port := os.Getenv("SERVICE_PORT")
 	if port == "" {
@@ -763,4 +1183,4 @@ func main() {
 
 	log.Printf("JMI service starting on port %s", port)
 	log.Fatal(r.Run(":" + port))
-}
\ No newline at end of file
+}
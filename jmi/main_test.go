@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStopExecutionAfterTerminal(t *testing.T) {
+	owner := Identity{Subject: "alice", AccountId: "acc-a", Roles: []string{"operator"}}
+	started := StageRecord{
+		ExecutionName: executionKey("daily-load", "u-1", 1, "jmi-start"),
+		OriginalName:  "daily-load",
+		ExecutionUuid: "u-1",
+		AccountId:     "acc-a",
+		Stage:         "jmi-start",
+		Status:        "started",
+		Version:       1,
+	}
+
+	tests := []struct {
+		name       string
+		runStatus  string // status of the jmr-run record, "" when there is none yet
+		stopExists bool
+		wantStatus int
+		wantStop   bool
+	}{
+		{"running execution", "", false, http.StatusOK, true},
+		{"parked execution", "waiting", false, http.StatusOK, true},
+		{"succeeded execution", "succeeded", false, http.StatusConflict, false},
+		{"failed execution", "failed", false, http.StatusConflict, false},
+		{"stopped execution", "", true, http.StatusConflict, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, client := newFakeDynamo(t, func(call dynamoCall) (interface{}, *dynamoError) {
+				switch {
+				case call.Operation == "GetItem" && strings.HasSuffix(call.value("Key", "executionName"), "#jmi-start"):
+					return map[string]interface{}{"Item": wireItem(t, started)}, nil
+				case call.Operation == "GetItem" && strings.HasSuffix(call.value("Key", "executionName"), "#jmr-run") && tt.runStatus != "":
+					run := started
+					run.ExecutionName, run.Stage, run.Status, run.Version = executionKey("daily-load", "u-1", 3, "jmr-run"), "jmr-run", tt.runStatus, 3
+					return map[string]interface{}{"Item": wireItem(t, run)}, nil
+				case call.Operation == "PutItem" && call.table() == "executions" && tt.stopExists:
+					return nil, &dynamoError{Type: "ConditionalCheckFailedException"}
+				case call.Operation == "Query" || call.Operation == "Scan":
+					return map[string]interface{}{"Items": []interface{}{}}, nil
+				}
+				return nil, nil
+			})
+			service := &JMIService{dynamoClient: client}
+
+			recorder := requestAs(owner, func(r *gin.Engine) {
+				r.POST("/stopExecution", service.StopExecution)
+			}, http.MethodPost, "/stopExecution", `{"executionName": "daily-load", "executionUuid": "u-1"}`)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("POST /stopExecution = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			stops := fake.recorded("PutItem", "executions")
+			if tt.wantStop != (len(stops) == 1) {
+				t.Fatalf("wrote %d jmi-stop records, want stop %v", len(stops), tt.wantStop)
+			}
+			if tt.wantStop && stops[0].value("Item", "stage") != "jmi-stop" {
+				t.Errorf("wrote stage %q, want jmi-stop", stops[0].value("Item", "stage"))
+			}
+		})
+	}
+}
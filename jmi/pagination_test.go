@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		key  map[string]types.AttributeValue
+	}{
+		{"string key", map[string]types.AttributeValue{
+			"accountId": &types.AttributeValueMemberS{Value: "acc-1"},
+			"name":      &types.AttributeValueMemberS{Value: "daily-load"},
+		}},
+		{"numeric key", map[string]types.AttributeValue{
+			"accountId": &types.AttributeValueMemberS{Value: "acc-1"},
+			"version":   &types.AttributeValueMemberN{Value: "42"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := encodeCursor("routines||acc-1", tt.key)
+			if err != nil {
+				t.Fatalf("encodeCursor(): %v", err)
+			}
+			scope, key, err := decodeCursor(cursor)
+			if err != nil {
+				t.Fatalf("decodeCursor(): %v", err)
+			}
+			if scope != "routines||acc-1" {
+				t.Errorf("decodeCursor() scope = %q, want %q", scope, "routines||acc-1")
+			}
+			if !reflect.DeepEqual(key, tt.key) {
+				t.Errorf("decodeCursor() key = %#v, want %#v", key, tt.key)
+			}
+		})
+	}
+}
+
+func TestEncodeCursorUnsupportedAttribute(t *testing.T) {
+	key := map[string]types.AttributeValue{"flag": &types.AttributeValueMemberBOOL{Value: true}}
+	if _, err := encodeCursor("scope", key); err == nil {
+		t.Error("encodeCursor() accepted a BOOL key attribute")
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	encode := func(value string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"not json", encode("cursor")},
+		{"missing scope", encode(`{"key":{"accountId":{"S":"acc-1"}}}`)},
+		{"missing key", encode(`{"scope":"routines||acc-1"}`)},
+		{"empty key", encode(`{"scope":"routines||acc-1","key":{}}`)},
+		{"unknown attribute type", encode(`{"scope":"routines||acc-1","key":{"accountId":{"B":"YQ"}}}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeCursor(tt.cursor); err == nil {
+				t.Errorf("decodeCursor(%q) accepted an invalid cursor", tt.cursor)
+			}
+		})
+	}
+}
+
+func TestCursorScope(t *testing.T) {
+	query := func(table, index, condition string, values map[string]types.AttributeValue) *dynamodb.QueryInput {
+		input := &dynamodb.QueryInput{
+			TableName:                 aws.String(table),
+			KeyConditionExpression:    aws.String(condition),
+			ExpressionAttributeValues: values,
+		}
+		if index != "" {
+			input.IndexName = aws.String(index)
+		}
+		return input
+	}
+	account := func(id string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: id},
+			":from":      &types.AttributeValueMemberS{Value: "2025-06-01T00:00:00Z"},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		input *dynamodb.QueryInput
+		want  string
+	}{
+		{"table and partition", query("routines", "", "accountId = :accountId", account("acc-1")), "routines||acc-1"},
+		{"index", query("executions", "accountId-startedAt-index", "accountId = :accountId AND startedAt >= :from", account("acc-1")), "executions|accountId-startedAt-index|acc-1"},
+		{"numeric partition", query("versions", "", "version = :v", map[string]types.AttributeValue{":v": &types.AttributeValueMemberN{Value: "3"}}), "versions||3"},
+		{"named attribute", query("routines", "", "#pk = :accountId", account("acc-2")), "routines||acc-2"},
+		{"no key condition", query("routines", "", "", nil), "routines||"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cursorScope(tt.input); got != tt.want {
+				t.Errorf("cursorScope() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// A cursor is bound to its tenant: the same query for another account has another scope
+	if cursorScope(query("routines", "", "accountId = :accountId", account("acc-1"))) ==
+		cursorScope(query("routines", "", "accountId = :accountId", account("acc-2"))) {
+		t.Error("cursorScope() is the same for two accounts")
+	}
+}
+
+func TestParsePageRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	valid, err := encodeCursor("routines||acc-1", map[string]types.AttributeValue{"accountId": &types.AttributeValueMemberS{Value: "acc-1"}})
+	if err != nil {
+		t.Fatalf("encodeCursor(): %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    pageRequest
+		wantErr bool
+	}{
+		{"defaults", "", pageRequest{Limit: defaultPageSize}, false},
+		{"limit and ascending order", "?limit=10&order=asc", pageRequest{Limit: 10, Ascending: true}, false},
+		{"largest limit", "?limit=500", pageRequest{Limit: maxPageSize}, false},
+		{"cursor", "?cursor=" + valid, pageRequest{Limit: defaultPageSize, Cursor: valid}, false},
+		{"zero limit", "?limit=0", pageRequest{}, true},
+		{"limit too large", "?limit=501", pageRequest{}, true},
+		{"limit not a number", "?limit=ten", pageRequest{}, true},
+		{"unknown order", "?order=random", pageRequest{}, true},
+		{"invalid cursor", "?cursor=garbage", pageRequest{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest("GET", "/routines"+tt.query, nil)
+			got, err := parsePageRequest(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePageRequest(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parsePageRequest(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
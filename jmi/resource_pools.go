@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// Lease states, as written by JMR
+const (
+	LeaseHeld    = "held"
+	LeaseWaiting = "waiting"
+)
+
+var errResourcePoolNotFound = errors.New("resource pool not found")
+
+// Same rule as resourceClaim.pool in scheduler-routine.schema.json
+var resourcePoolName = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// ResourceClaim is how much of a named resource pool a task holds while it runs
+type ResourceClaim struct {
+	Pool     string `json:"pool" dynamodbav:"pool"`
+	Quantity int    `json:"quantity,omitempty" dynamodbav:"quantity,omitempty"` // Defaults to 1
+}
+
+// ResourcePool is a quantitative resource shared by every JMR runner. InUse is
+// the atomic counter JMR increments when it leases capacity to a task.
+type ResourcePool struct {
+	AccountId   string `json:"accountId" dynamodbav:"accountId"`
+	PoolName    string `json:"poolName" dynamodbav:"poolName"`
+	Capacity    int    `json:"capacity" dynamodbav:"capacity"`
+	InUse       int    `json:"inUse" dynamodbav:"inUse"`
+	Available   int    `json:"available" dynamodbav:"-"`
+	Description string `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	UpdatedBy   string `json:"updatedBy,omitempty" dynamodbav:"updatedBy,omitempty"`
+	UpdatedAt   string `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+}
+
+// ResourcePoolRequest is the payload of PUT /resource-pools/:name
+type ResourcePoolRequest struct {
+	Capacity    int    `json:"capacity"`
+	Description string `json:"description"`
+}
+
+// ResourceLease is a task holding, or waiting for, capacity of a pool
+type ResourceLease struct {
+	PoolKey       string `json:"-" dynamodbav:"poolKey"` // accountId#poolName
+	LeaseId       string `json:"leaseId" dynamodbav:"leaseId"`
+	AccountId     string `json:"-" dynamodbav:"accountId"`
+	PoolName      string `json:"-" dynamodbav:"poolName"`
+	State         string `json:"-" dynamodbav:"state"`
+	Quantity      int    `json:"quantity" dynamodbav:"quantity"`
+	ExecutionName string `json:"executionName" dynamodbav:"executionName"`
+	ExecutionUuid string `json:"executionUuid" dynamodbav:"executionUuid"`
+	TaskId        string `json:"taskId" dynamodbav:"taskId"`
+	RunnerID      string `json:"runnerId" dynamodbav:"runnerID"`
+	Since         string `json:"since" dynamodbav:"since"`
+}
+
+func (j *JMIService) resourcePoolTableName() string {
+	if j.resourcePoolTable == "" {
+		return "resource_pools"
+	}
+	return j.resourcePoolTable
+}
+
+func (j *JMIService) resourceLeaseTableName() string {
+	if j.resourceLeaseTable == "" {
+		return "resource_leases"
+	}
+	return j.resourceLeaseTable
+}
+
+func (j *JMIService) getResourcePool(accountId, poolName string) (*ResourcePool, error) {
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(j.resourcePoolTableName()),
+		Key: map[string]types.AttributeValue{
+			"accountId": &types.AttributeValueMemberS{Value: accountId},
+			"poolName":  &types.AttributeValueMemberS{Value: poolName},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errResourcePoolNotFound
+	}
+
+	var pool ResourcePool
+	if err := attributevalue.UnmarshalMap(result.Item, &pool); err != nil {
+		return nil, err
+	}
+	pool.Available = max(pool.Capacity-pool.InUse, 0)
+	return &pool, nil
+}
+
+// poolLeases returns the holders and the waiters of a pool, oldest first
+func (j *JMIService) poolLeases(accountId, poolName string) ([]ResourceLease, []ResourceLease, error) {
+	var leases []ResourceLease
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.resourceLeaseTableName()),
+		KeyConditionExpression: aws.String("poolKey = :poolKey"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":poolKey": &types.AttributeValueMemberS{Value: accountId + "#" + poolName},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, nil, err
+		}
+		var pageLeases []ResourceLease
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageLeases); err != nil {
+			return nil, nil, err
+		}
+		leases = append(leases, pageLeases...)
+	}
+
+	sort.Slice(leases, func(a, b int) bool {
+		return leases[a].Since < leases[b].Since
+	})
+	holders := make([]ResourceLease, 0, len(leases))
+	waiters := make([]ResourceLease, 0)
+	for _, lease := range leases {
+		if lease.State == LeaseHeld {
+			holders = append(holders, lease)
+		} else {
+			waiters = append(waiters, lease)
+		}
+	}
+	return holders, waiters, nil
+}
+
+// GetResourcePools lists the caller's pools with their current usage
+func (j *JMIService) GetResourcePools(ctx *gin.Context) {
+	identity := identityFrom(ctx)
+
+	var pools []ResourcePool
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.resourcePoolTableName()),
+		KeyConditionExpression: aws.String("accountId = :accountId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: identity.AccountId},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error querying resource pools: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve resource pools"})
+			return
+		}
+		var pagePools []ResourcePool
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pagePools); err != nil {
+			log.Printf("Error unmarshaling resource pools: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process resource pools"})
+			return
+		}
+		pools = append(pools, pagePools...)
+	}
+	if pools == nil {
+		pools = []ResourcePool{}
+	}
+	for i := range pools {
+		pools[i].Available = max(pools[i].Capacity-pools[i].InUse, 0)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"pools": pools, "count": len(pools)})
+}
+
+// GetResourcePool reports a pool with the tasks holding it and those waiting for it
+func (j *JMIService) GetResourcePool(ctx *gin.Context) {
+	identity := identityFrom(ctx)
+	poolName := ctx.Param("name")
+
+	pool, err := j.getResourcePool(identity.AccountId, poolName)
+	if errors.Is(err, errResourcePoolNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Resource pool not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading resource pool %s: %v", poolName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load resource pool"})
+		return
+	}
+
+	holders, waiters, err := j.poolLeases(identity.AccountId, poolName)
+	if err != nil {
+		log.Printf("Error loading leases of resource pool %s: %v", poolName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load resource pool leases"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"pool":    pool,
+		"holders": holders,
+		"waiters": waiters,
+	})
+}
+
+// PutResourcePool creates a pool or changes its capacity, keeping the leases
+// already granted. A capacity below inUse only stops new leases until enough
+// holders finish; 0 blocks the pool.
+func (j *JMIService) PutResourcePool(ctx *gin.Context) {
+	poolName := ctx.Param("name")
+	setAuditTarget(ctx, "resource-pool/"+poolName)
+
+	if !resourcePoolName.MatchString(poolName) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Resource pool names are 1 to 64 letters, digits, '.', '_' or '-'"})
+		return
+	}
+	var req ResourcePoolRequest
+	if !bindAndValidate(ctx, "resource-pool", &req, nil) {
+		return
+	}
+
+	identity := identityFrom(ctx)
+	result, err := j.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName: aws.String(j.resourcePoolTableName()),
+		Key: map[string]types.AttributeValue{
+			"accountId": &types.AttributeValueMemberS{Value: identity.AccountId},
+			"poolName":  &types.AttributeValueMemberS{Value: poolName},
+		},
+		UpdateExpression: aws.String("SET capacity = :capacity, inUse = if_not_exists(inUse, :zero), " +
+			"description = :description, updatedBy = :subject, updatedAt = :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":capacity":    &types.AttributeValueMemberN{Value: strconv.Itoa(req.Capacity)},
+			":zero":        &types.AttributeValueMemberN{Value: "0"},
+			":description": &types.AttributeValueMemberS{Value: req.Description},
+			":subject":     &types.AttributeValueMemberS{Value: identity.Subject},
+			":now":         &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		log.Printf("Error storing resource pool %s: %v", poolName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store resource pool"})
+		return
+	}
+
+	var pool ResourcePool
+	if err := attributevalue.UnmarshalMap(result.Attributes, &pool); err != nil {
+		log.Printf("Error unmarshaling resource pool %s: %v", poolName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process resource pool"})
+		return
+	}
+	pool.Available = max(pool.Capacity-pool.InUse, 0)
+
+	log.Printf("JMI set capacity of resource pool %s to %d", poolName, req.Capacity)
+	ctx.JSON(http.StatusOK, pool)
+}
+
+// DeleteResourcePool removes a pool nobody holds
+func (j *JMIService) DeleteResourcePool(ctx *gin.Context) {
+	identity := identityFrom(ctx)
+	poolName := ctx.Param("name")
+	setAuditTarget(ctx, "resource-pool/"+poolName)
+
+	_, err := j.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(j.resourcePoolTableName()),
+		Key: map[string]types.AttributeValue{
+			"accountId": &types.AttributeValueMemberS{Value: identity.AccountId},
+			"poolName":  &types.AttributeValueMemberS{Value: poolName},
+		},
+		ConditionExpression: aws.String("attribute_exists(poolName) AND inUse = :zero"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":zero": &types.AttributeValueMemberN{Value: "0"},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		pool, loadErr := j.getResourcePool(identity.AccountId, poolName)
+		if errors.Is(loadErr, errResourcePoolNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Resource pool not found"})
+			return
+		}
+		if loadErr != nil {
+			log.Printf("Error loading resource pool %s: %v", poolName, loadErr)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load resource pool"})
+			return
+		}
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Resource pool is in use", "inUse": pool.InUse})
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting resource pool %s: %v", poolName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete resource pool"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Resource pool deleted", "poolName": poolName})
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// RoutineDefinition is one immutable version of a routine's structure.
+// Every change is stored as a new version; existing versions are never rewritten.
+// Deleting a routine stores a tombstone version, so the history stays and a
+// routine created again under the name carries on from the next number.
+// Versions are keyed by RoutineKey (accountId#routineName): each tenant has
+// its own namespace of routine names.
+type RoutineDefinition struct {
+	RoutineKey       string                 `json:"-" dynamodbav:"routineKey"`
+	RoutineName      string                 `json:"routineName" dynamodbav:"routineName"`
+	Version          int                    `json:"version" dynamodbav:"version"`
+	Description      string                 `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	AccountId        string                 `json:"accountId" dynamodbav:"accountId"`
+	CommonProperties map[string]interface{} `json:"commonProperties" dynamodbav:"commonProperties"`
+	Runtimes         []Runtime              `json:"runtimes" dynamodbav:"runtimes"`
+	SchedulerRoutine SchedulerRoutine       `json:"schedulerRoutine" dynamodbav:"schedulerRoutine"`
+	CreatedAt        time.Time              `json:"createdAt" dynamodbav:"createdAt"`
+	CreatedBy        string                 `json:"createdBy,omitempty" dynamodbav:"createdBy,omitempty"`
+	Deleted          bool                   `json:"deleted,omitempty" dynamodbav:"deleted,omitempty"`
+}
+
+// RoutineDefinitionRequest is the payload accepted by the routine CRUD endpoints
+type RoutineDefinitionRequest struct {
+	RoutineName      string                 `json:"routineName"`
+	Description      string                 `json:"description"`
+	AccountId        string                 `json:"accountId"`
+	CommonProperties map[string]interface{} `json:"commonProperties"`
+	Runtimes         []Runtime              `json:"runtimes"`
+	SchedulerRoutine SchedulerRoutine       `json:"schedulerRoutine"`
+}
+
+var errRoutineNotFound = errors.New("routine definition not found")
+
+func (j *JMIService) routineTableName() string {
+	if j.routineTable == "" {
+		return "routine_definitions"
+	}
+	return j.routineTable
+}
+
+// routineKey is the partition key of an account's routine
+func routineKey(accountId, routineName string) string {
+	return accountId + "#" + routineName
+}
+
+// getRoutineVersion loads a pinned version of an account's routine, or the
+// latest one when version is 0. A deleted routine, or its tombstone, is not found.
+func (j *JMIService) getRoutineVersion(accountId, routineName string, version int) (*RoutineDefinition, error) {
+	var definition *RoutineDefinition
+	var err error
+	if version > 0 {
+		definition, err = j.getPinnedRoutineVersion(accountId, routineName, version)
+	} else {
+		definition, err = j.latestRoutineVersion(accountId, routineName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if definition.Deleted {
+		return nil, errRoutineNotFound
+	}
+	return definition, nil
+}
+
+func (j *JMIService) getPinnedRoutineVersion(accountId, routineName string, version int) (*RoutineDefinition, error) {
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(j.routineTableName()),
+		Key: map[string]types.AttributeValue{
+			"routineKey": &types.AttributeValueMemberS{Value: routineKey(accountId, routineName)},
+			"version":    &types.AttributeValueMemberN{Value: strconv.Itoa(version)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errRoutineNotFound
+	}
+
+	var definition RoutineDefinition
+	if err := attributevalue.UnmarshalMap(result.Item, &definition); err != nil {
+		return nil, err
+	}
+	return &definition, nil
+}
+
+// latestRoutineVersion loads the highest version of a routine, tombstones included
+func (j *JMIService) latestRoutineVersion(accountId, routineName string) (*RoutineDefinition, error) {
+	result, err := j.dynamoClient.Query(context.TODO(), &dynamodb.QueryInput{
+		TableName:              aws.String(j.routineTableName()),
+		KeyConditionExpression: aws.String("routineKey = :key"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":key": &types.AttributeValueMemberS{Value: routineKey(accountId, routineName)},
+		},
+		ScanIndexForward: aws.Bool(false), // Highest version first
+		Limit:            aws.Int32(1),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 {
+		return nil, errRoutineNotFound
+	}
+
+	var definition RoutineDefinition
+	if err := attributevalue.UnmarshalMap(result.Items[0], &definition); err != nil {
+		return nil, err
+	}
+	return &definition, nil
+}
+
+// putRoutineVersion stores req as the next version of the account's routine,
+// recording who wrote it. The conditional write keeps versions immutable when
+// two writers race. Numbers continue past a tombstone.
+func (j *JMIService) putRoutineVersion(req RoutineDefinitionRequest, createdBy string) (*RoutineDefinition, error) {
+	nextVersion := 1
+	latest, err := j.latestRoutineVersion(req.AccountId, req.RoutineName)
+	if err != nil && !errors.Is(err, errRoutineNotFound) {
+		return nil, err
+	}
+	if latest != nil {
+		nextVersion = latest.Version + 1
+	}
+
+	definition := RoutineDefinition{
+		RoutineKey:       routineKey(req.AccountId, req.RoutineName),
+		RoutineName:      req.RoutineName,
+		Version:          nextVersion,
+		Description:      req.Description,
+		AccountId:        req.AccountId,
+		CommonProperties: req.CommonProperties,
+		Runtimes:         req.Runtimes,
+		SchedulerRoutine: req.SchedulerRoutine,
+		CreatedAt:        time.Now(),
+		CreatedBy:        createdBy,
+	}
+
+	item, err := attributevalue.MarshalMap(definition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal routine definition: %v", err)
+	}
+
+	_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String(j.routineTableName()),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(routineKey)"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &definition, nil
+}
+
+func (j *JMIService) CreateRoutine(ctx *gin.Context) {
+	var req RoutineDefinitionRequest
+	if !bindAndValidate(ctx, "routine-definition", &req, func() []Violation {
+		return validateRoutineStructure(req.Runtimes, req.SchedulerRoutine)
+	}) {
+		return
+	}
+
+	if req.RoutineName == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "routineName is required"})
+		return
+	}
+	setAuditTarget(ctx, "routine/"+req.RoutineName)
+
+	if !bindRoutineTenant(ctx, &req) {
+		return
+	}
+
+	j.storeRoutineVersion(ctx, req, http.StatusCreated)
+}
+
+func (j *JMIService) UpdateRoutine(ctx *gin.Context) {
+	setAuditTarget(ctx, "routine/"+ctx.Param("name"))
+
+	var req RoutineDefinitionRequest
+	if !bindAndValidate(ctx, "routine-definition", &req, func() []Violation {
+		return validateRoutineStructure(req.Runtimes, req.SchedulerRoutine)
+	}) {
+		return
+	}
+
+	routineName := ctx.Param("name")
+	if req.RoutineName != "" && req.RoutineName != routineName {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "routineName in body does not match path"})
+		return
+	}
+	req.RoutineName = routineName
+
+	if !bindRoutineTenant(ctx, &req) {
+		return
+	}
+
+	latest, err := j.getRoutineVersion(req.AccountId, routineName, 0)
+	if err != nil && !errors.Is(err, errRoutineNotFound) {
+		log.Printf("Error loading routine %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load routine"})
+		return
+	}
+	if latest == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Routine not found"})
+		return
+	}
+
+	j.storeRoutineVersion(ctx, req, http.StatusOK)
+}
+
+// bindRoutineTenant assigns the routine to the caller's account, rejecting
+// bodies that try to write on behalf of another one
+func bindRoutineTenant(ctx *gin.Context, req *RoutineDefinitionRequest) bool {
+	identity := identityFrom(ctx)
+	if req.AccountId != "" && req.AccountId != identity.AccountId {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "accountId does not match the caller's account"})
+		return false
+	}
+	req.AccountId = identity.AccountId
+	return true
+}
+
+func (j *JMIService) storeRoutineVersion(ctx *gin.Context, req RoutineDefinitionRequest, status int) {
+	definition, err := j.putRoutineVersion(req, identityFrom(ctx).Subject)
+	if err != nil {
+		var conditionErr *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionErr) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Routine was modified concurrently, retry"})
+			return
+		}
+		log.Printf("Error storing routine %s: %v", req.RoutineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store routine"})
+		return
+	}
+
+	log.Printf("JMI stored routine %s version %d", definition.RoutineName, definition.Version)
+
+	ctx.JSON(status, definition)
+}
+
+func (j *JMIService) GetRoutines(ctx *gin.Context) {
+	routines, err := j.latestRoutines(identityFrom(ctx).AccountId)
+	if err != nil {
+		log.Printf("Error querying routines: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve routines"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"routines": routines,
+		"count":    len(routines),
+	})
+}
+
+// latestRoutines returns the latest version of each of the account's routines
+func (j *JMIService) latestRoutines(accountId string) ([]RoutineDefinition, error) {
+	// Query the tenant's routines through the accountId GSI
+	var definitions []RoutineDefinition
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.routineTableName()),
+		IndexName:              aws.String("accountId-routineName-index"),
+		KeyConditionExpression: aws.String("accountId = :accountId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: accountId},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+
+		var pageDefinitions []RoutineDefinition
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageDefinitions); err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, pageDefinitions...)
+	}
+
+	// Keep only the latest version of each routine, leaving deleted ones out
+	latest := make(map[string]RoutineDefinition)
+	for _, definition := range definitions {
+		if current, ok := latest[definition.RoutineName]; !ok || definition.Version > current.Version {
+			latest[definition.RoutineName] = definition
+		}
+	}
+
+	routines := make([]RoutineDefinition, 0, len(latest))
+	for _, definition := range latest {
+		if !definition.Deleted {
+			routines = append(routines, definition)
+		}
+	}
+	return routines, nil
+}
+
+func (j *JMIService) GetRoutine(ctx *gin.Context) {
+	j.respondWithRoutineVersion(ctx, ctx.Param("name"), 0)
+}
+
+func (j *JMIService) GetRoutineVersion(ctx *gin.Context) {
+	version, err := strconv.Atoi(ctx.Param("version"))
+	if err != nil || version <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "version must be a positive integer"})
+		return
+	}
+
+	j.respondWithRoutineVersion(ctx, ctx.Param("name"), version)
+}
+
+func (j *JMIService) respondWithRoutineVersion(ctx *gin.Context, routineName string, version int) {
+	definition, err := j.getRoutineVersion(identityFrom(ctx).AccountId, routineName, version)
+	if err != nil {
+		if errors.Is(err, errRoutineNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Routine not found"})
+			return
+		}
+		log.Printf("Error loading routine %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load routine"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, definition)
+}
+
+// queryRoutineVersions returns every stored version of an account's routine, oldest first
+func (j *JMIService) queryRoutineVersions(accountId, routineName string) ([]RoutineDefinition, error) {
+	var definitions []RoutineDefinition
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.routineTableName()),
+		KeyConditionExpression: aws.String("routineKey = :key"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":key": &types.AttributeValueMemberS{Value: routineKey(accountId, routineName)},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+
+		var pageDefinitions []RoutineDefinition
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageDefinitions); err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, pageDefinitions...)
+	}
+
+	return definitions, nil
+}
+
+func (j *JMIService) GetRoutineVersions(ctx *gin.Context) {
+	routineName := ctx.Param("name")
+
+	definitions, err := j.queryRoutineVersions(identityFrom(ctx).AccountId, routineName)
+	if err != nil {
+		log.Printf("Error listing versions of routine %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve routine versions"})
+		return
+	}
+
+	if len(definitions) == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Routine not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"routineName": routineName,
+		"versions":    definitions,
+		"count":       len(definitions),
+	})
+}
+
+// DeleteRoutine stores a tombstone as the routine's next version. The routine
+// is no longer listed nor has a latest version, but its past versions stay
+// readable, and executions keep their own snapshot of the definition they ran.
+func (j *JMIService) DeleteRoutine(ctx *gin.Context) {
+	routineName := ctx.Param("name")
+	setAuditTarget(ctx, "routine/"+routineName)
+
+	identity := identityFrom(ctx)
+	latest, err := j.getRoutineVersion(identity.AccountId, routineName, 0)
+	if err != nil && !errors.Is(err, errRoutineNotFound) {
+		log.Printf("Error loading routine %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete routine"})
+		return
+	}
+	if latest == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Routine not found"})
+		return
+	}
+
+	tombstone := RoutineDefinition{
+		RoutineKey:  latest.RoutineKey,
+		RoutineName: routineName,
+		Version:     latest.Version + 1,
+		AccountId:   latest.AccountId,
+		CreatedAt:   time.Now(),
+		CreatedBy:   identity.Subject,
+		Deleted:     true,
+	}
+	item, err := attributevalue.MarshalMap(tombstone)
+	if err != nil {
+		log.Printf("Error marshaling tombstone of routine %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete routine"})
+		return
+	}
+
+	_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String(j.routineTableName()),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(routineKey)"),
+	})
+	if err != nil {
+		var conditionErr *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionErr) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Routine was modified concurrently, retry"})
+			return
+		}
+		log.Printf("Error deleting routine %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete routine"})
+		return
+	}
+
+	log.Printf("JMI deleted routine %s at version %d", routineName, tombstone.Version)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":     "Routine deleted successfully",
+		"routineName": routineName,
+		"version":     tombstone.Version,
+	})
+}
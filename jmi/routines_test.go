@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRoutineNamesPerAccount(t *testing.T) {
+	owner := Identity{Subject: "alice", AccountId: "acc-a", Roles: []string{"operator"}}
+	other := Identity{Subject: "bob", AccountId: "acc-b", Roles: []string{"operator"}}
+	stored := RoutineDefinition{
+		RoutineKey:  routineKey("acc-a", "daily-load"),
+		RoutineName: "daily-load",
+		Version:     3,
+		AccountId:   "acc-a",
+		Runtimes:    []Runtime{{RuntimeName: "python"}},
+	}
+	body := `{"routineName": "daily-load", "runtimes": [{"runtimeName": "python"}], "schedulerRoutine": {"steps": [{"stepId": "load", "tasks": [{"taskId": "run", "runtimeName": "python"}]}]}}`
+
+	tests := []struct {
+		name        string
+		identity    Identity
+		method      string
+		path        string
+		body        string
+		wantStatus  int
+		wantVersion int
+		wantKey     string // routineKey written, "" when nothing is
+	}{
+		{"owner reads the latest version", owner, http.MethodGet, "/routines/daily-load", "", http.StatusOK, 3, ""},
+		{"other account does not see the name", other, http.MethodGet, "/routines/daily-load", "", http.StatusNotFound, 0, ""},
+		{"other account does not see a pinned version", other, http.MethodGet, "/routines/daily-load/versions/3", "", http.StatusNotFound, 0, ""},
+		{"other account does not see the history", other, http.MethodGet, "/routines/daily-load/versions", "", http.StatusNotFound, 0, ""},
+		{"other account creates its own routine", other, http.MethodPost, "/routines", body, http.StatusCreated, 1, "acc-b#daily-load"},
+		{"owner writes the next version", owner, http.MethodPut, "/routines/daily-load", body, http.StatusOK, 4, "acc-a#daily-load"},
+		{"other account cannot update the name", other, http.MethodPut, "/routines/daily-load", body, http.StatusNotFound, 0, ""},
+		{"other account cannot delete the name", other, http.MethodDelete, "/routines/daily-load", "", http.StatusNotFound, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, client := newFakeDynamo(t, func(call dynamoCall) (interface{}, *dynamoError) {
+				switch call.Operation {
+				case "Query":
+					if call.value("ExpressionAttributeValues", ":key") == stored.RoutineKey {
+						return map[string]interface{}{"Items": []interface{}{wireItem(t, stored)}}, nil
+					}
+					return map[string]interface{}{"Items": []interface{}{}}, nil
+				case "GetItem":
+					if call.value("Key", "routineKey") == stored.RoutineKey && call.value("Key", "version") == "3" {
+						return map[string]interface{}{"Item": wireItem(t, stored)}, nil
+					}
+				}
+				return nil, nil
+			})
+			service := &JMIService{dynamoClient: client}
+
+			recorder := requestAs(tt.identity, func(r *gin.Engine) {
+				r.POST("/routines", service.CreateRoutine)
+				r.GET("/routines/:name", service.GetRoutine)
+				r.PUT("/routines/:name", service.UpdateRoutine)
+				r.DELETE("/routines/:name", service.DeleteRoutine)
+				r.GET("/routines/:name/versions", service.GetRoutineVersions)
+				r.GET("/routines/:name/versions/:version", service.GetRoutineVersion)
+			}, tt.method, tt.path, tt.body)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("%s %s = %d, want %d: %s", tt.method, tt.path, recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantVersion > 0 {
+				var definition RoutineDefinition
+				if err := json.Unmarshal(recorder.Body.Bytes(), &definition); err != nil || definition.Version != tt.wantVersion {
+					t.Errorf("answered version %d (%v), want %d", definition.Version, err, tt.wantVersion)
+				}
+			}
+
+			puts := fake.recorded("PutItem", "")
+			if tt.wantKey == "" {
+				if len(puts) > 0 {
+					t.Errorf("wrote %d routine versions, want none", len(puts))
+				}
+				return
+			}
+			if len(puts) != 1 || puts[0].value("Item", "routineKey") != tt.wantKey {
+				t.Fatalf("PutItem calls = %+v, want one for %s", puts, tt.wantKey)
+			}
+			if condition, _ := puts[0].Input["ConditionExpression"].(string); condition != "attribute_not_exists(routineKey)" {
+				t.Errorf("ConditionExpression = %q, want attribute_not_exists(routineKey)", condition)
+			}
+		})
+	}
+}
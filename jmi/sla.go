@@ -0,0 +1,646 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+	_ "time/tzdata" // SLA timezones must resolve in slim images too
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// Kinds of SLA breach
+const (
+	BreachMissedStart  = "missed_start"
+	BreachLateStart    = "late_start"
+	BreachMissedFinish = "missed_finish"
+	BreachLateFinish   = "late_finish"
+	BreachMaxDuration  = "max_duration"
+)
+
+var errSLANotFound = errors.New("routine SLA not found")
+
+// RoutineSLA is the expected completion of a routine. StartBy and FinishBy are
+// times of day in Timezone and apply on the days the routine's cron fires
+// (every day when it has none); MaxDurationSeconds applies to every execution.
+type RoutineSLA struct {
+	RoutineName        string    `json:"routineName" dynamodbav:"routineName"`
+	AccountId          string    `json:"accountId" dynamodbav:"accountId"`
+	StartBy            string    `json:"startBy,omitempty" dynamodbav:"startBy,omitempty"`
+	FinishBy           string    `json:"finishBy,omitempty" dynamodbav:"finishBy,omitempty"`
+	MaxDurationSeconds int       `json:"maxDurationSeconds,omitempty" dynamodbav:"maxDurationSeconds,omitempty"`
+	Timezone           string    `json:"timezone" dynamodbav:"timezone"`
+	Severity           string    `json:"severity" dynamodbav:"severity"`
+	UpdatedBy          string    `json:"updatedBy,omitempty" dynamodbav:"updatedBy,omitempty"`
+	UpdatedAt          time.Time `json:"updatedAt" dynamodbav:"updatedAt"`
+}
+
+// RoutineSLARequest is the payload of PUT /slas/:routineName
+type RoutineSLARequest struct {
+	StartBy            string `json:"startBy"`
+	FinishBy           string `json:"finishBy"`
+	MaxDurationSeconds int    `json:"maxDurationSeconds"`
+	Timezone           string `json:"timezone"`
+	Severity           string `json:"severity"`
+	AccountId          string `json:"accountId"`
+}
+
+// SLABreach is raised once per routine, day and kind (or per execution for max_duration)
+type SLABreach struct {
+	BreachId      string `json:"breachId" dynamodbav:"breachId"`
+	AccountId     string `json:"accountId" dynamodbav:"accountId"`
+	RoutineName   string `json:"routineName" dynamodbav:"routineName"`
+	Kind          string `json:"kind" dynamodbav:"kind"`
+	Severity      string `json:"severity" dynamodbav:"severity"`
+	Message       string `json:"message" dynamodbav:"message"`
+	ExecutionUuid string `json:"executionUuid,omitempty" dynamodbav:"executionUuid,omitempty"`
+	Deadline      string `json:"deadline,omitempty" dynamodbav:"deadline,omitempty"`
+	Day           string `json:"day" dynamodbav:"day"`
+	Timestamp     int64  `json:"timestamp" dynamodbav:"timestamp"` // Unix milliseconds, sort key of the GSI
+	Time          string `json:"time" dynamodbav:"time"`
+}
+
+// slaExecution is one of today's executions of a routine, folded from its stage records
+type slaExecution struct {
+	ExecutionUuid string     `json:"executionUuid"`
+	Status        string     `json:"status"`
+	StartedAt     time.Time  `json:"startedAt"`
+	FinishedAt    *time.Time `json:"finishedAt,omitempty"`
+}
+
+// slaStatus is the evaluation of an SLA at a point in time
+type slaStatus struct {
+	SLA         RoutineSLA     `json:"sla"`
+	State       string         `json:"state"` // ok, pending, breached or not_scheduled
+	Day         string         `json:"day"`
+	ScheduledAt *time.Time     `json:"scheduledAt,omitempty"`
+	Executions  []slaExecution `json:"executions"`
+	Breaches    []SLABreach    `json:"breaches"`
+}
+
+func (j *JMIService) slaTableName() string {
+	if j.slaTable == "" {
+		return "routine_slas"
+	}
+	return j.slaTable
+}
+
+func (j *JMIService) slaBreachTableName() string {
+	if j.slaBreachTable == "" {
+		return "sla_breaches"
+	}
+	return j.slaBreachTable
+}
+
+// timeOfDay turns "HH:MM" into that time on the day of dayStart
+func timeOfDay(dayStart time.Time, clock string) time.Time {
+	parsed, _ := time.Parse("15:04", clock)
+	return time.Date(dayStart.Year(), dayStart.Month(), dayStart.Day(), parsed.Hour(), parsed.Minute(), 0, 0, dayStart.Location())
+}
+
+// evaluateSLA compares today's executions of the routine (in the SLA timezone)
+// against the SLA and returns the breaches observed so far
+func (j *JMIService) evaluateSLA(sla RoutineSLA, now time.Time) (*slaStatus, error) {
+	location, err := time.LoadLocation(sla.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	now = now.In(location)
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	day := dayStart.Format("2006-01-02")
+
+	status := &slaStatus{SLA: sla, State: "ok", Day: day, Executions: []slaExecution{}, Breaches: []SLABreach{}}
+
+	// The start/finish deadlines only apply on days the routine is scheduled
+	scheduled := true
+	definition, err := j.getRoutineVersion(sla.AccountId, sla.RoutineName, 0)
+	if err != nil && !errors.Is(err, errRoutineNotFound) {
+		return nil, err
+	}
+	if definition != nil && definition.SchedulerRoutine.Cron != "" {
+		if schedule, err := cronParser.Parse(definition.SchedulerRoutine.Cron); err == nil {
+			next := schedule.Next(dayStart.Add(-time.Second))
+			scheduled = next.Before(dayStart.AddDate(0, 0, 1))
+			if scheduled {
+				status.ScheduledAt = &next
+			}
+		}
+	}
+
+	executions, err := j.routineExecutionsSince(sla, dayStart, location)
+	if err != nil {
+		return nil, err
+	}
+	status.Executions = executions
+
+	breach := func(kind, executionUuid, deadline, message string) {
+		id := sla.RoutineName + "#" + day + "#" + kind
+		if executionUuid != "" {
+			id = sla.RoutineName + "#" + executionUuid + "#" + kind
+		}
+		status.Breaches = append(status.Breaches, SLABreach{
+			BreachId:      id,
+			AccountId:     sla.AccountId,
+			RoutineName:   sla.RoutineName,
+			Kind:          kind,
+			Severity:      sla.Severity,
+			Message:       message,
+			ExecutionUuid: executionUuid,
+			Deadline:      deadline,
+			Day:           day,
+		})
+	}
+
+	var firstStart, firstSuccess *slaExecution
+	for i := range executions {
+		execution := &executions[i]
+		if firstStart == nil || execution.StartedAt.Before(firstStart.StartedAt) {
+			firstStart = execution
+		}
+		if execution.Status == "succeeded" && execution.FinishedAt != nil &&
+			(firstSuccess == nil || execution.FinishedAt.Before(*firstSuccess.FinishedAt)) {
+			firstSuccess = execution
+		}
+
+		if sla.MaxDurationSeconds > 0 {
+			end := now
+			if execution.FinishedAt != nil {
+				end = *execution.FinishedAt
+			}
+			if elapsed := end.Sub(execution.StartedAt); elapsed > time.Duration(sla.MaxDurationSeconds)*time.Second {
+				breach(BreachMaxDuration, execution.ExecutionUuid, "",
+					fmt.Sprintf("execution ran for %s, more than the %ds allowed", elapsed.Round(time.Second), sla.MaxDurationSeconds))
+			}
+		}
+	}
+
+	if scheduled && sla.StartBy != "" {
+		deadline := timeOfDay(dayStart, sla.StartBy)
+		switch {
+		case firstStart == nil && now.After(deadline):
+			breach(BreachMissedStart, "", deadline.Format(time.RFC3339), "routine has not started by "+sla.StartBy)
+		case firstStart != nil && firstStart.StartedAt.After(deadline):
+			breach(BreachLateStart, "", deadline.Format(time.RFC3339),
+				fmt.Sprintf("routine started at %s, after %s", firstStart.StartedAt.Format("15:04:05"), sla.StartBy))
+		}
+	}
+
+	if scheduled && sla.FinishBy != "" {
+		deadline := timeOfDay(dayStart, sla.FinishBy)
+		switch {
+		case firstSuccess == nil && now.After(deadline):
+			breach(BreachMissedFinish, "", deadline.Format(time.RFC3339), "routine has not succeeded by "+sla.FinishBy)
+		case firstSuccess != nil && firstSuccess.FinishedAt.After(deadline):
+			breach(BreachLateFinish, "", deadline.Format(time.RFC3339),
+				fmt.Sprintf("routine finished at %s, after %s", firstSuccess.FinishedAt.Format("15:04:05"), sla.FinishBy))
+		}
+	}
+
+	switch {
+	case len(status.Breaches) > 0:
+		status.State = "breached"
+	case !scheduled && len(executions) == 0:
+		status.State = "not_scheduled"
+	case firstSuccess == nil && (sla.StartBy != "" || sla.FinishBy != ""):
+		status.State = "pending"
+	}
+	return status, nil
+}
+
+// routineExecutionsSince folds the stage records of a routine written since
+// dayStart into one entry per execution, oldest first
+func (j *JMIService) routineExecutionsSince(sla RoutineSLA, dayStart time.Time, location *time.Location) ([]slaExecution, error) {
+	var stages []StageRecord
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:                aws.String(j.executionTableName()),
+		IndexName:                aws.String("originalName-timestamp-index"),
+		KeyConditionExpression:   aws.String("originalName = :name AND #ts >= :from"),
+		FilterExpression:         aws.String("accountId = :accountId"),
+		ExpressionAttributeNames: map[string]string{"#ts": "timestamp"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":name":      &types.AttributeValueMemberS{Value: sla.RoutineName},
+			":from":      &types.AttributeValueMemberN{Value: strconv.FormatInt(dayStart.Unix(), 10)},
+			":accountId": &types.AttributeValueMemberS{Value: sla.AccountId},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		var pageStages []StageRecord
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageStages); err != nil {
+			return nil, err
+		}
+		stages = append(stages, pageStages...)
+	}
+
+	byUuid := make(map[string]*slaExecution)
+	for _, stage := range stages {
+		execution, ok := byUuid[stage.ExecutionUuid]
+		if !ok {
+			execution = &slaExecution{ExecutionUuid: stage.ExecutionUuid, Status: "running"}
+			byUuid[stage.ExecutionUuid] = execution
+		}
+
+		at := time.Unix(stage.Timestamp, 0).In(location)
+		switch stage.Stage {
+		case "jmi-start":
+			execution.StartedAt = at
+		case "jmr-run", "jmi-stop":
+			if status, ok := terminalStatus(stage); ok {
+				execution.Status = map[string]string{
+					WebhookStatusSucceeded: "succeeded",
+					WebhookStatusFailed:    "failed",
+					WebhookStatusStopped:   "stopped",
+				}[status]
+				execution.FinishedAt = &at
+			}
+		}
+	}
+
+	executions := make([]slaExecution, 0, len(byUuid))
+	for _, execution := range byUuid {
+		// Records of executions that started yesterday carry no start today
+		if !execution.StartedAt.IsZero() {
+			executions = append(executions, *execution)
+		}
+	}
+	sort.Slice(executions, func(a, b int) bool {
+		return executions[a].StartedAt.Before(executions[b].StartedAt)
+	})
+	return executions, nil
+}
+
+// startSLAMonitor evaluates every SLA each SLA_CHECK_INTERVAL seconds (default 60)
+func (j *JMIService) startSLAMonitor() {
+	interval := 60 * time.Second
+	if value, err := strconv.Atoi(os.Getenv("SLA_CHECK_INTERVAL")); err == nil && value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.receiveCtx.Done():
+			log.Println("SLA monitor stopped")
+			return
+		case <-ticker.C:
+			j.checkSLAs()
+		}
+	}
+}
+
+func (j *JMIService) checkSLAs() {
+	var slas []RoutineSLA
+	paginator := dynamodb.NewScanPaginator(j.dynamoClient, &dynamodb.ScanInput{
+		TableName: aws.String(j.slaTableName()),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("ERROR: Failed to load SLAs: %v", err)
+			return
+		}
+		var pageSLAs []RoutineSLA
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageSLAs); err != nil {
+			log.Printf("ERROR: Failed to unmarshal SLAs: %v", err)
+			return
+		}
+		slas = append(slas, pageSLAs...)
+	}
+
+	now := time.Now()
+	for _, sla := range slas {
+		status, err := j.evaluateSLA(sla, now)
+		if err != nil {
+			log.Printf("ERROR: Failed to evaluate SLA of %s: %v", sla.RoutineName, err)
+			continue
+		}
+		for _, breach := range status.Breaches {
+			j.raiseSLABreach(breach, now)
+		}
+	}
+}
+
+// raiseSLABreach records a breach the first time it is observed and then
+// publishes it on the event stream and to the SLA_BREACHED webhooks
+func (j *JMIService) raiseSLABreach(breach SLABreach, now time.Time) {
+	breach.Timestamp = now.UnixMilli()
+	breach.Time = now.Format(time.RFC3339)
+
+	item, err := attributevalue.MarshalMap(breach)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal SLA breach: %v", err)
+		return
+	}
+
+	_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String(j.slaBreachTableName()),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(breachId)"),
+	})
+	if err != nil {
+		var conditionErr *types.ConditionalCheckFailedException
+		if !errors.As(err, &conditionErr) {
+			log.Printf("ERROR: Failed to record SLA breach %s: %v", breach.BreachId, err)
+		}
+		return
+	}
+
+	log.Printf("SLA breach %s (%s): %s", breach.BreachId, breach.Severity, breach.Message)
+
+	j.events.publish(streamEvent{
+		Type:         eventTypeSLA,
+		AccountId:    breach.AccountId,
+		OriginalName: breach.RoutineName,
+		Payload:      breach,
+	})
+	j.dispatchWebhookEvent(WebhookEvent{
+		EventId:       breach.BreachId,
+		Type:          "sla.breached",
+		Status:        WebhookStatusSLABreached,
+		AccountId:     breach.AccountId,
+		RoutineName:   breach.RoutineName,
+		ExecutionUuid: breach.ExecutionUuid,
+		Timestamp:     now.Unix(),
+		Details: map[string]interface{}{
+			"kind":     breach.Kind,
+			"severity": breach.Severity,
+			"message":  breach.Message,
+			"deadline": breach.Deadline,
+		},
+	})
+}
+
+func (j *JMIService) getSLA(routineName, accountId string) (*RoutineSLA, error) {
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(j.slaTableName()),
+		Key: map[string]types.AttributeValue{
+			"routineName": &types.AttributeValueMemberS{Value: routineName},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errSLANotFound
+	}
+
+	var sla RoutineSLA
+	if err := attributevalue.UnmarshalMap(result.Item, &sla); err != nil {
+		return nil, err
+	}
+	if sla.AccountId != accountId {
+		return nil, errSLANotFound
+	}
+	return &sla, nil
+}
+
+// PutSLA sets (or replaces) the SLA of one of the caller's routines
+func (j *JMIService) PutSLA(ctx *gin.Context) {
+	routineName := ctx.Param("routineName")
+	setAuditTarget(ctx, "sla/"+routineName)
+
+	var req RoutineSLARequest
+	if !bindAndValidate(ctx, "routine-sla", &req, func() []Violation {
+		if req.Timezone == "" {
+			return nil
+		}
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return []Violation{{Path: "$.timezone", Message: fmt.Sprintf("unknown timezone %q", req.Timezone)}}
+		}
+		return nil
+	}) {
+		return
+	}
+
+	identity := identityFrom(ctx)
+	if req.AccountId != "" && req.AccountId != identity.AccountId {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "accountId does not match the caller's account"})
+		return
+	}
+
+	definition, err := j.getRoutineVersion(identity.AccountId, routineName, 0)
+	if err != nil && !errors.Is(err, errRoutineNotFound) {
+		log.Printf("Error loading routine %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load routine"})
+		return
+	}
+	if definition == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Routine not found"})
+		return
+	}
+
+	sla := RoutineSLA{
+		RoutineName:        routineName,
+		AccountId:          identity.AccountId,
+		StartBy:            req.StartBy,
+		FinishBy:           req.FinishBy,
+		MaxDurationSeconds: req.MaxDurationSeconds,
+		Timezone:           req.Timezone,
+		Severity:           req.Severity,
+		UpdatedBy:          identity.Subject,
+		UpdatedAt:          time.Now(),
+	}
+	if sla.Timezone == "" {
+		sla.Timezone = "UTC"
+	}
+	if sla.Severity == "" {
+		sla.Severity = "major"
+	}
+
+	item, err := attributevalue.MarshalMap(sla)
+	if err != nil {
+		log.Printf("Error marshaling SLA: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store SLA"})
+		return
+	}
+
+	_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(j.slaTableName()),
+		Item:      item,
+	})
+	if err != nil {
+		log.Printf("Error storing SLA of %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store SLA"})
+		return
+	}
+
+	log.Printf("JMI stored SLA of routine %s", routineName)
+
+	ctx.JSON(http.StatusOK, sla)
+}
+
+// GetSLAs is the status view: every SLA of the caller with today's evaluation
+func (j *JMIService) GetSLAs(ctx *gin.Context) {
+	identity := identityFrom(ctx)
+
+	var slas []RoutineSLA
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.slaTableName()),
+		IndexName:              aws.String("accountId-index"),
+		KeyConditionExpression: aws.String("accountId = :accountId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: identity.AccountId},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error querying SLAs: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve SLAs"})
+			return
+		}
+		var pageSLAs []RoutineSLA
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageSLAs); err != nil {
+			log.Printf("Error unmarshaling SLAs: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process SLAs"})
+			return
+		}
+		slas = append(slas, pageSLAs...)
+	}
+
+	now := time.Now()
+	statuses := make([]*slaStatus, 0, len(slas))
+	summary := map[string]int{"ok": 0, "pending": 0, "breached": 0, "not_scheduled": 0}
+	for _, sla := range slas {
+		status, err := j.evaluateSLA(sla, now)
+		if err != nil {
+			log.Printf("Error evaluating SLA of %s: %v", sla.RoutineName, err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate SLAs"})
+			return
+		}
+		summary[status.State]++
+		statuses = append(statuses, status)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"slas":      statuses,
+		"count":     len(statuses),
+		"summary":   summary,
+		"checkedAt": now.Format(time.RFC3339),
+	})
+}
+
+func (j *JMIService) GetSLA(ctx *gin.Context) {
+	routineName := ctx.Param("routineName")
+	sla, err := j.getSLA(routineName, identityFrom(ctx).AccountId)
+	if err != nil {
+		if errors.Is(err, errSLANotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "SLA not found"})
+			return
+		}
+		log.Printf("Error loading SLA of %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load SLA"})
+		return
+	}
+
+	status, err := j.evaluateSLA(*sla, time.Now())
+	if err != nil {
+		log.Printf("Error evaluating SLA of %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate SLA"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, status)
+}
+
+func (j *JMIService) DeleteSLA(ctx *gin.Context) {
+	routineName := ctx.Param("routineName")
+	setAuditTarget(ctx, "sla/"+routineName)
+
+	if _, err := j.getSLA(routineName, identityFrom(ctx).AccountId); err != nil {
+		if errors.Is(err, errSLANotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "SLA not found"})
+			return
+		}
+		log.Printf("Error loading SLA of %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load SLA"})
+		return
+	}
+
+	_, err := j.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(j.slaTableName()),
+		Key: map[string]types.AttributeValue{
+			"routineName": &types.AttributeValueMemberS{Value: routineName},
+		},
+	})
+	if err != nil {
+		log.Printf("Error deleting SLA of %s: %v", routineName, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete SLA"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "SLA deleted", "routineName": routineName})
+}
+
+// GetSLABreaches pages through the caller's recorded breaches, newest first,
+// filtered by routineName, kind, severity and an RFC3339 from/to range
+func (j *JMIService) GetSLABreaches(ctx *gin.Context) {
+	identity := identityFrom(ctx)
+
+	page, err := parsePageRequest(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, to, err := parseTimeRange(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                aws.String(j.slaBreachTableName()),
+		IndexName:                aws.String("accountId-timestamp-index"),
+		KeyConditionExpression:   aws.String("accountId = :accountId AND #ts BETWEEN :from AND :to"),
+		ExpressionAttributeNames: map[string]string{"#ts": "timestamp"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: identity.AccountId},
+			":from":      &types.AttributeValueMemberN{Value: strconv.FormatInt(from.UnixMilli(), 10)},
+			":to":        &types.AttributeValueMemberN{Value: strconv.FormatInt(to.UnixMilli(), 10)},
+		},
+	}
+	filter := newQueryFilter()
+	filter.equals("routineName", ctx.Query("routineName"))
+	filter.equals("kind", ctx.Query("kind"))
+	filter.equals("severity", ctx.Query("severity"))
+	filter.apply(input)
+
+	items, nextCursor, err := queryPage(j.dynamoClient, input, page)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error querying SLA breaches: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve SLA breaches"})
+		return
+	}
+
+	breaches := []SLABreach{}
+	if err := attributevalue.UnmarshalListOfMaps(items, &breaches); err != nil {
+		log.Printf("Error unmarshaling SLA breaches: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process SLA breaches"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"breaches":   breaches,
+		"count":      len(breaches),
+		"nextCursor": nextCursor,
+	})
+}
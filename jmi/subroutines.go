@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// TaskRoutine is the task type that runs another registered routine
+const TaskRoutine = "routine"
+
+// maxSubroutineDepth bounds chains of routines starting routines, so a routine
+// that ends up calling itself fails instead of running forever
+const maxSubroutineDepth = 5
+
+var errExecutionNotFound = errors.New("execution not found")
+
+// SubRoutine is the routine a routine task starts, with the parameters mapped
+// from the parent's: "${params.x}" takes the parent's parameter x
+type SubRoutine struct {
+	Name       string                 `json:"name" dynamodbav:"name"`
+	Version    int                    `json:"version,omitempty" dynamodbav:"version,omitempty"` // 0 = latest
+	Parameters map[string]interface{} `json:"parameters,omitempty" dynamodbav:"parameters,omitempty"`
+}
+
+// ParentExecution links an execution started by a routine task to its parent
+type ParentExecution struct {
+	ExecutionUuid string `json:"executionUuid" dynamodbav:"executionUuid"`
+	ExecutionName string `json:"executionName,omitempty" dynamodbav:"executionName,omitempty"`
+	TaskId        string `json:"taskId" dynamodbav:"taskId"`
+	Depth         int    `json:"depth,omitempty" dynamodbav:"depth,omitempty"` // 1 for the child of a top-level execution
+}
+
+// ExecutionLink is a child execution as listed on its parent
+type ExecutionLink struct {
+	ParentExecutionUuid string `json:"-" dynamodbav:"parentExecutionUuid"`
+	ExecutionUuid       string `json:"executionUuid" dynamodbav:"childExecutionUuid"`
+	ExecutionName       string `json:"executionName" dynamodbav:"executionName"`
+	TaskId              string `json:"taskId" dynamodbav:"taskId"`
+	AccountId           string `json:"-" dynamodbav:"accountId"`
+	CreatedAt           string `json:"createdAt" dynamodbav:"createdAt"`
+	Status              string `json:"status" dynamodbav:"-"`
+}
+
+func (j *JMIService) executionLinkTableName() string {
+	if j.executionLinkTable == "" {
+		return "execution_links"
+	}
+	return j.executionLinkTable
+}
+
+// executionStatus derives the current status of one of accountId's executions;
+// a start still waiting in its routine's queue is queued
+func (j *JMIService) executionStatus(accountId, executionUuid string) (string, error) {
+	items, err := j.queryIndex(j.executionTableName(), "executionUuid-timestamp-index", "executionUuid", executionUuid)
+	if err != nil {
+		return "", err
+	}
+	var stages []StageRecord
+	if err := attributevalue.UnmarshalListOfMaps(items, &stages); err != nil {
+		return "", err
+	}
+	if len(stages) > 0 {
+		if stages[0].AccountId != accountId {
+			return "", errExecutionNotFound
+		}
+		sort.SliceStable(stages, func(a, b int) bool {
+			return stages[a].Version < stages[b].Version
+		})
+		return currentStatus(stages), nil
+	}
+
+	if _, err := j.findQueuedStart(accountId, executionUuid); err != nil {
+		if errors.Is(err, errQueuedNotFound) {
+			return "", errExecutionNotFound
+		}
+		return "", err
+	}
+	return "queued", nil
+}
+
+// checkParent validates the parent a routine task passed when starting its child
+func (j *JMIService) checkParent(identity Identity, parent *ParentExecution) (int, gin.H) {
+	if parent == nil {
+		return http.StatusOK, nil
+	}
+	if parent.Depth > maxSubroutineDepth {
+		return http.StatusUnprocessableEntity, gin.H{
+			"error": "Validation failed",
+			"violations": []Violation{{
+				Path:    "$.parent.depth",
+				Message: fmt.Sprintf("routines may nest at most %d levels deep", maxSubroutineDepth),
+			}},
+		}
+	}
+
+	if _, err := j.executionStatus(identity.AccountId, parent.ExecutionUuid); err != nil {
+		if errors.Is(err, errExecutionNotFound) {
+			return http.StatusUnprocessableEntity, gin.H{
+				"error": "Validation failed",
+				"violations": []Violation{{
+					Path:    "$.parent.executionUuid",
+					Message: fmt.Sprintf("execution %s does not exist", parent.ExecutionUuid),
+				}},
+			}
+		}
+		log.Printf("ERROR: Failed to load parent execution %s: %v", parent.ExecutionUuid, err)
+		return http.StatusInternalServerError, gin.H{"error": "Failed to load parent execution"}
+	}
+	return http.StatusOK, nil
+}
+
+// linkChild records a started (or queued) child on its parent
+func (j *JMIService) linkChild(identity Identity, parent *ParentExecution, executionName, executionUuid string) {
+	item, err := attributevalue.MarshalMap(ExecutionLink{
+		ParentExecutionUuid: parent.ExecutionUuid,
+		ExecutionUuid:       executionUuid,
+		ExecutionName:       executionName,
+		TaskId:              parent.TaskId,
+		AccountId:           identity.AccountId,
+		CreatedAt:           time.Now().Format(time.RFC3339),
+	})
+	if err == nil {
+		_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+			TableName: aws.String(j.executionLinkTableName()),
+			Item:      item,
+		})
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to link execution %s to parent %s: %v", executionUuid, parent.ExecutionUuid, err)
+	}
+}
+
+// childExecutions lists the executions the parent's routine tasks started, with their status
+func (j *JMIService) childExecutions(accountId, parentUuid string) ([]ExecutionLink, error) {
+	links := make([]ExecutionLink, 0)
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.executionLinkTableName()),
+		KeyConditionExpression: aws.String("parentExecutionUuid = :parent"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":parent": &types.AttributeValueMemberS{Value: parentUuid},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		var pageLinks []ExecutionLink
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageLinks); err != nil {
+			return nil, err
+		}
+		for _, link := range pageLinks {
+			if link.AccountId != accountId {
+				continue
+			}
+			status, err := j.executionStatus(accountId, link.ExecutionUuid)
+			if err != nil && !errors.Is(err, errExecutionNotFound) {
+				return nil, err
+			}
+			link.Status = status
+			links = append(links, link)
+		}
+	}
+
+	sort.Slice(links, func(a, b int) bool {
+		return links[a].CreatedAt < links[b].CreatedAt
+	})
+	return links, nil
+}
+
+// stopChildren cascades a stop to the children still running or queued, and
+// through them to their own children
+func (j *JMIService) stopChildren(identity Identity, parentUuid string) []string {
+	children, err := j.childExecutions(identity.AccountId, parentUuid)
+	if err != nil {
+		log.Printf("ERROR: Failed to load children of %s: %v", parentUuid, err)
+		return nil
+	}
+
+	stopped := make([]string, 0)
+	for _, child := range children {
+		if !inProgress(child.Status) && child.Status != "queued" {
+			continue
+		}
+		status, response := j.stopExecution(identity, StopExecutionRequest{
+			ExecutionName: child.ExecutionName,
+			ExecutionUuid: child.ExecutionUuid,
+		})
+		if status != http.StatusOK {
+			log.Printf("WARN: Could not stop child %s of %s: %v", child.ExecutionUuid, parentUuid, response["error"])
+			continue
+		}
+		stopped = append(stopped, child.ExecutionUuid)
+	}
+	return stopped
+}
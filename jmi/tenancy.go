@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+const identityContextKey = "identity"
+
+// Identity is the authenticated caller a request is scoped to. Every
+// tenant-scoped read and write uses AccountId; Acronyms, when set, further
+// restricts which acronyms the caller may act on.
+type Identity struct {
+	Subject   string   `json:"subject"`
+	AccountId string   `json:"accountId"`
+	Acronyms  []string `json:"acronyms,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// CanAccessAcronym reports whether the identity may act on the given acronym
+func (i Identity) CanAccessAcronym(acronym string) bool {
+	if len(i.Acronyms) == 0 {
+		return true
+	}
+	for _, allowed := range i.Acronyms {
+		if allowed == acronym {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether any of the identity's roles grants the given one
+func (i Identity) HasRole(role string) bool {
+	for _, granted := range i.Roles {
+		if roleRank[granted] >= roleRank[role] {
+			return true
+		}
+	}
+	return false
+}
+
+// identityFrom returns the identity resolved by authMiddleware
+func identityFrom(ctx *gin.Context) Identity {
+	identity, _ := ctx.MustGet(identityContextKey).(Identity)
+	return identity
+}
+
+var errQuotaExceeded = errors.New("tenant concurrent execution quota exceeded")
+
+// tenantQuotas holds the per-account limit on concurrent executions.
+// TENANT_MAX_CONCURRENT_EXECUTIONS is the default (0 = unlimited) and
+// TENANT_QUOTAS overrides it per account, e.g. "017820684888=5,123456789012=10".
+type tenantQuotas struct {
+	defaultLimit int
+	limits       map[string]int
+}
+
+func loadTenantQuotas() tenantQuotas {
+	quotas := tenantQuotas{limits: make(map[string]int)}
+
+	if value, err := strconv.Atoi(os.Getenv("TENANT_MAX_CONCURRENT_EXECUTIONS")); err == nil && value > 0 {
+		quotas.defaultLimit = value
+	}
+
+	for _, entry := range strings.Split(os.Getenv("TENANT_QUOTAS"), ",") {
+		accountId, limit, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found {
+			continue
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(limit))
+		if err != nil || value < 0 {
+			log.Printf("WARN: Ignoring invalid tenant quota %q", entry)
+			continue
+		}
+		quotas.limits[strings.TrimSpace(accountId)] = value
+	}
+
+	return quotas
+}
+
+func (q tenantQuotas) limitFor(accountId string) int {
+	if limit, ok := q.limits[accountId]; ok {
+		return limit
+	}
+	return q.defaultLimit
+}
+
+func (j *JMIService) tenantUsageTableName() string {
+	if j.tenantUsageTable == "" {
+		return "tenant_usage"
+	}
+	return j.tenantUsageTable
+}
+
+func (j *JMIService) executionSlotTableName() string {
+	if j.executionSlotTable == "" {
+		return "execution_slots"
+	}
+	return j.executionSlotTable
+}
+
+// acquireExecutionSlot counts a new execution against the tenant quota and
+// the routine's maxConcurrentRuns. Both counter increments and the slot record
+// are written in one transaction, so the limits hold across JMI replicas.
+// The routine condition reads the policy stored on the counter item itself.
+func (j *JMIService) acquireExecutionSlot(accountId, routineName, executionUuid string) error {
+	now := time.Now().Format(time.RFC3339)
+	update := &types.Update{
+		TableName: aws.String(j.tenantUsageTableName()),
+		Key: map[string]types.AttributeValue{
+			"accountId": &types.AttributeValueMemberS{Value: accountId},
+		},
+		UpdateExpression: aws.String("SET runningExecutions = if_not_exists(runningExecutions, :zero) + :one, updatedAt = :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":zero": &types.AttributeValueMemberN{Value: "0"},
+			":one":  &types.AttributeValueMemberN{Value: "1"},
+			":now":  &types.AttributeValueMemberS{Value: now},
+		},
+	}
+
+	if limit := j.quotas.limitFor(accountId); limit > 0 {
+		update.ConditionExpression = aws.String("attribute_not_exists(runningExecutions) OR runningExecutions < :max")
+		update.ExpressionAttributeValues[":max"] = &types.AttributeValueMemberN{Value: strconv.Itoa(limit)}
+	}
+
+	_, err := j.dynamoClient.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Update: update},
+			{Update: &types.Update{
+				TableName:        aws.String(j.routineConcurrencyTableName()),
+				Key:              routineConcurrencyKey(accountId, routineName),
+				UpdateExpression: aws.String("SET runningExecutions = if_not_exists(runningExecutions, :zero) + :one"),
+				ConditionExpression: aws.String("attribute_not_exists(maxConcurrentRuns) OR overlapPolicy = :allow OR " +
+					"attribute_not_exists(runningExecutions) OR runningExecutions < maxConcurrentRuns"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":zero":  &types.AttributeValueMemberN{Value: "0"},
+					":one":   &types.AttributeValueMemberN{Value: "1"},
+					":allow": &types.AttributeValueMemberS{Value: OverlapAllow},
+				},
+			}},
+			{Put: &types.Put{
+				TableName: aws.String(j.executionSlotTableName()),
+				Item: map[string]types.AttributeValue{
+					"executionUuid": &types.AttributeValueMemberS{Value: executionUuid},
+					"accountId":     &types.AttributeValueMemberS{Value: accountId},
+					"routineName":   &types.AttributeValueMemberS{Value: routineName},
+					"acquiredAt":    &types.AttributeValueMemberS{Value: now},
+				},
+				ConditionExpression: aws.String("attribute_not_exists(executionUuid)"),
+			}},
+		},
+	})
+	if err != nil {
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) && len(canceled.CancellationReasons) > 1 {
+			if aws.ToString(canceled.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+				return errQuotaExceeded
+			}
+			if aws.ToString(canceled.CancellationReasons[1].Code) == "ConditionalCheckFailed" {
+				return errRoutineBusy
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// releaseExecutionSlot gives the slot back. Deleting the slot record is
+// conditional, so whichever of JMI (stop) or JMR (completion) gets there
+// first releases it and the other is a no-op.
+func (j *JMIService) releaseExecutionSlot(accountId, routineName, executionUuid string) {
+	now := time.Now().Format(time.RFC3339)
+	release := func(slotCondition string, routineCounted bool) error {
+		items := []types.TransactWriteItem{
+			{Delete: &types.Delete{
+				TableName: aws.String(j.executionSlotTableName()),
+				Key: map[string]types.AttributeValue{
+					"executionUuid": &types.AttributeValueMemberS{Value: executionUuid},
+				},
+				ConditionExpression: aws.String(slotCondition),
+			}},
+			{Update: &types.Update{
+				TableName: aws.String(j.tenantUsageTableName()),
+				Key: map[string]types.AttributeValue{
+					"accountId": &types.AttributeValueMemberS{Value: accountId},
+				},
+				UpdateExpression:    aws.String("SET runningExecutions = runningExecutions - :one, updatedAt = :now"),
+				ConditionExpression: aws.String("runningExecutions > :zero"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":zero": &types.AttributeValueMemberN{Value: "0"},
+					":one":  &types.AttributeValueMemberN{Value: "1"},
+					":now":  &types.AttributeValueMemberS{Value: now},
+				},
+			}},
+		}
+		if routineCounted {
+			items[0].Delete.ExpressionAttributeValues = map[string]types.AttributeValue{
+				":routineName": &types.AttributeValueMemberS{Value: routineName},
+			}
+			items = append(items, types.TransactWriteItem{Update: &types.Update{
+				TableName:           aws.String(j.routineConcurrencyTableName()),
+				Key:                 routineConcurrencyKey(accountId, routineName),
+				UpdateExpression:    aws.String("SET runningExecutions = runningExecutions - :one"),
+				ConditionExpression: aws.String("runningExecutions > :zero"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":zero": &types.AttributeValueMemberN{Value: "0"},
+					":one":  &types.AttributeValueMemberN{Value: "1"},
+				},
+			}})
+		}
+		_, err := j.dynamoClient.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{TransactItems: items})
+		return err
+	}
+
+	err := release("routineName = :routineName", true)
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		// Slots taken before routines were counted carry no routineName
+		err = release("attribute_exists(executionUuid) AND attribute_not_exists(routineName)", false)
+	}
+	if err != nil {
+		if errors.As(err, &canceled) {
+			log.Printf("DEBUG: Execution slot %s already released", executionUuid)
+			return
+		}
+		log.Printf("ERROR: Failed to release execution slot %s: %v", executionUuid, err)
+	}
+}
+
+// TenantUsage is the concurrency counter kept per account
+type TenantUsage struct {
+	AccountId         string `json:"accountId" dynamodbav:"accountId"`
+	RunningExecutions int    `json:"runningExecutions" dynamodbav:"runningExecutions"`
+	UpdatedAt         string `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+}
+
+func (j *JMIService) GetTenantUsage(ctx *gin.Context) {
+	identity := identityFrom(ctx)
+
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(j.tenantUsageTableName()),
+		Key: map[string]types.AttributeValue{
+			"accountId": &types.AttributeValueMemberS{Value: identity.AccountId},
+		},
+	})
+	if err != nil {
+		log.Printf("Error loading tenant usage for %s: %v", identity.AccountId, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load tenant usage"})
+		return
+	}
+
+	usage := TenantUsage{AccountId: identity.AccountId}
+	if result.Item != nil {
+		if err := attributevalue.UnmarshalMap(result.Item, &usage); err != nil {
+			log.Printf("Error unmarshaling tenant usage: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process tenant usage"})
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"accountId":               identity.AccountId,
+		"runningExecutions":       usage.RunningExecutions,
+		"maxConcurrentExecutions": j.quotas.limitFor(identity.AccountId),
+		"updatedAt":               usage.UpdatedAt,
+	})
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// ExecutionWait lists an execution JMR parked under one thing it waits for: a
+// condition or a child execution. Whoever ends the wait sends the stored
+// message back; the token on the jmr-run record lets only one of them do it.
+type ExecutionWait struct {
+	AccountId     string `dynamodbav:"accountId"`
+	WaitKey       string `dynamodbav:"waitKey"` // condition#name#orderDate#uuid or execution#childUuid#uuid
+	ExecutionUuid string `dynamodbav:"executionUuid"`
+	ExecutionName string `dynamodbav:"executionName"`
+	StepId        string `dynamodbav:"stepId"`
+	TaskId        string `dynamodbav:"taskId,omitempty"`
+	Token         string `dynamodbav:"token"`
+	Message       string `dynamodbav:"message"`
+	CreatedAt     string `dynamodbav:"createdAt"`
+	Deadline      int64  `dynamodbav:"deadline"`
+	ExpiresAt     int64  `dynamodbav:"expiresAt"`
+}
+
+func (j *JMIService) waitTableName() string {
+	if j.waitTable == "" {
+		return "execution_waits"
+	}
+	return j.waitTable
+}
+
+// runRecordKey is the key of the jmr-run stage, which holds the wait token
+func runRecordKey(executionName, executionUuid string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"executionName": &types.AttributeValueMemberS{Value: executionKey(executionName, executionUuid, 3, "jmr-run")},
+	}
+}
+
+// wakeConditionWaiters sends back the executions parked on a condition just
+// added, for its order date or for any
+func (j *JMIService) wakeConditionWaiters(accountId, name, orderDate string) {
+	j.wakeWaiters(accountId, "condition#"+name+"#"+orderDate+"#")
+	j.wakeWaiters(accountId, "condition#"+name+"#"+AnyOrderDate+"#")
+}
+
+// wakeWaiters sends back every execution of the tenant listed under waitKeys
+// starting with prefix
+func (j *JMIService) wakeWaiters(accountId, prefix string) {
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.waitTableName()),
+		KeyConditionExpression: aws.String("accountId = :accountId AND begins_with(waitKey, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: accountId},
+			":prefix":    &types.AttributeValueMemberS{Value: prefix},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("ERROR: Failed to query waits %s: %v", prefix, err)
+			return
+		}
+		var waits []ExecutionWait
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &waits); err != nil {
+			log.Printf("ERROR: Failed to unmarshal waits %s: %v", prefix, err)
+			return
+		}
+		for _, wait := range waits {
+			j.wakeWait(wait)
+		}
+	}
+}
+
+// wakeWait sends a parked execution back through JMW, as a decided approval
+// does, unless another waker already did and this listing is left over. An
+// execution whose message could not be sent keeps its listings and token.
+func (j *JMIService) wakeWait(wait ExecutionWait) {
+	_, err := j.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:           aws.String(j.executionTableName()),
+		Key:                 runRecordKey(wait.ExecutionName, wait.ExecutionUuid),
+		UpdateExpression:    aws.String("REMOVE waitToken"),
+		ConditionExpression: aws.String("waitToken = :token"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":token": &types.AttributeValueMemberS{Value: wait.Token},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		j.deleteWait(wait)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to resume execution %s: %v", wait.ExecutionUuid, err)
+		return
+	}
+
+	_, err = j.sqsClient.SendMessage(context.TODO(), &sqs.SendMessageInput{
+		QueueUrl:    aws.String(j.outQueueURL),
+		MessageBody: aws.String(wait.Message),
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to resume execution %s: %v", wait.ExecutionUuid, err)
+		_, err = j.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+			TableName:           aws.String(j.executionTableName()),
+			Key:                 runRecordKey(wait.ExecutionName, wait.ExecutionUuid),
+			UpdateExpression:    aws.String("SET waitToken = :token"),
+			ConditionExpression: aws.String("attribute_not_exists(waitToken)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":token": &types.AttributeValueMemberS{Value: wait.Token},
+			},
+		})
+		if err != nil {
+			log.Printf("ERROR: Failed to restore wait of %s: %v", wait.ExecutionUuid, err)
+		}
+		return
+	}
+	j.cancelWaits(wait.ExecutionUuid)
+	log.Printf("JMI resumed execution %s waiting at step %s", wait.ExecutionUuid, wait.StepId)
+}
+
+// executionWaits lists everything an execution is parked on
+func (j *JMIService) executionWaits(executionUuid string) ([]ExecutionWait, error) {
+	var waits []ExecutionWait
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.waitTableName()),
+		IndexName:              aws.String("executionUuid-index"),
+		KeyConditionExpression: aws.String("executionUuid = :uuid"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uuid": &types.AttributeValueMemberS{Value: executionUuid},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		var pageWaits []ExecutionWait
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageWaits); err != nil {
+			return nil, err
+		}
+		waits = append(waits, pageWaits...)
+	}
+	return waits, nil
+}
+
+// resumeWaits sends an execution back from whatever it is parked on
+func (j *JMIService) resumeWaits(executionUuid string) {
+	waits, err := j.executionWaits(executionUuid)
+	if err != nil {
+		log.Printf("ERROR: Failed to query waits of %s: %v", executionUuid, err)
+		return
+	}
+	for _, wait := range waits {
+		j.wakeWait(wait)
+	}
+}
+
+// cancelWaits drops every listing of an execution once it is resumed
+func (j *JMIService) cancelWaits(executionUuid string) {
+	waits, err := j.executionWaits(executionUuid)
+	if err != nil {
+		log.Printf("ERROR: Failed to query waits of %s: %v", executionUuid, err)
+		return
+	}
+	for _, wait := range waits {
+		j.deleteWait(wait)
+	}
+}
+
+func (j *JMIService) deleteWait(wait ExecutionWait) {
+	_, err := j.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(j.waitTableName()),
+		Key: map[string]types.AttributeValue{
+			"accountId": &types.AttributeValueMemberS{Value: wait.AccountId},
+			"waitKey":   &types.AttributeValueMemberS{Value: wait.WaitKey},
+		},
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to delete wait %s: %v", wait.WaitKey, err)
+	}
+}
+
+// startWaitTimeouts sends back the parked executions whose deadline passed, so
+// JMR fails the step that waited, checking every WAIT_CHECK_INTERVAL seconds
+// (default 30)
+func (j *JMIService) startWaitTimeouts() {
+	interval := 30 * time.Second
+	if value, err := strconv.Atoi(os.Getenv("WAIT_CHECK_INTERVAL")); err == nil && value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.receiveCtx.Done():
+			log.Println("Wait timeouts stopped")
+			return
+		case <-ticker.C:
+			j.expireWaits()
+		}
+	}
+}
+
+func (j *JMIService) expireWaits() {
+	paginator := dynamodb.NewScanPaginator(j.dynamoClient, &dynamodb.ScanInput{
+		TableName:        aws.String(j.waitTableName()),
+		FilterExpression: aws.String("deadline <= :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("ERROR: Failed to scan waits: %v", err)
+			return
+		}
+		var expired []ExecutionWait
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &expired); err != nil {
+			log.Printf("ERROR: Failed to unmarshal waits: %v", err)
+			return
+		}
+		for _, wait := range expired {
+			j.wakeWait(wait)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), internal like the private ones
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// webhookTargets decides where webhooks may be sent. Hosts resolving to
+// loopback, link-local, private or unspecified addresses are refused, so a
+// subscription cannot make JMI call into its own network. WEBHOOK_ALLOWED_HOSTS
+// lists host names and CIDRs let through anyway, e.g. "webhook-sink,10.1.0.0/16".
+type webhookTargets struct {
+	hosts    map[string]bool
+	networks []*net.IPNet
+	resolver *net.Resolver
+}
+
+func loadWebhookTargets() webhookTargets {
+	return parseWebhookTargets(os.Getenv("WEBHOOK_ALLOWED_HOSTS"))
+}
+
+func parseWebhookTargets(allowed string) webhookTargets {
+	targets := webhookTargets{hosts: make(map[string]bool)}
+	for _, entry := range strings.Split(allowed, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			targets.networks = append(targets.networks, network)
+			continue
+		}
+		targets.hosts[entry] = true
+	}
+	return targets
+}
+
+// refused reports whether ip is internal and not in an allowed CIDR
+func (t webhookTargets) refused(ip net.IP) bool {
+	for _, network := range t.networks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		sharedAddressSpace.Contains(ip)
+}
+
+// resolve returns the addresses of host, failing when any of them is refused
+func (t webhookTargets) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if ip := net.ParseIP(host); ip != nil {
+		if !t.hosts[host] && t.refused(ip) {
+			return nil, fmt.Errorf("%s is a loopback, link-local or private address", host)
+		}
+		return []net.IP{ip}, nil
+	}
+
+	resolver := t.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %s: %v", host, err)
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if !t.hosts[host] && t.refused(addr.IP) {
+			return nil, fmt.Errorf("%s resolves to %s, a loopback, link-local or private address", host, addr.IP)
+		}
+		ips = append(ips, addr.IP)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("%s has no addresses", host)
+	}
+	return ips, nil
+}
+
+// checkURL reports why a subscription url may not be used, or nil
+func (t webhookTargets) checkURL(ctx context.Context, raw string) error {
+	target, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if target.Hostname() == "" {
+		return errors.New("url has no host")
+	}
+	_, err = t.resolve(ctx, target.Hostname())
+	return err
+}
+
+// dialContext connects only to addresses resolve lets through, so a host whose
+// DNS changed after the subscription was created, or a redirect to an internal
+// address, is refused at delivery too
+func (t webhookTargets) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := t.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	for _, ip := range ips {
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
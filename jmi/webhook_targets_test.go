@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWebhookTargetsCheckURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed string
+		url     string
+		wantErr bool
+	}{
+		{"public address", "", "https://93.184.216.34/hooks", false},
+		{"loopback", "", "http://127.0.0.1:8080/hooks", true},
+		{"loopback name", "", "http://localhost/hooks", true},
+		{"IPv6 loopback", "", "http://[::1]/hooks", true},
+		{"private range", "", "http://10.0.0.5/hooks", true},
+		{"instance metadata", "", "http://169.254.169.254/latest/meta-data", true},
+		{"carrier-grade NAT", "", "http://100.64.1.1/", true},
+		{"unspecified", "", "http://0.0.0.0/", true},
+		{"allowed CIDR", "10.1.0.0/16", "http://10.1.2.3/hooks", false},
+		{"outside the allowed CIDR", "10.1.0.0/16", "http://10.2.0.1/hooks", true},
+		{"allowed host", "webhook-sink, localhost", "http://localhost:8089/hooks", false},
+		{"no host", "", "http:///hooks", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseWebhookTargets(tt.allowed).checkURL(context.Background(), tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkURL(%q) with %q allowed = %v, wantErr %v", tt.url, tt.allowed, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateWebhookRefusesInternalURL(t *testing.T) {
+	fake, client := newFakeDynamo(t, func(call dynamoCall) (interface{}, *dynamoError) {
+		return nil, nil
+	})
+	service := &JMIService{dynamoClient: client, webhooks: webhookConfig{targets: parseWebhookTargets("")}}
+
+	recorder := requestAs(Identity{Subject: "alice", AccountId: "acc-a", Roles: []string{"operator"}}, func(r *gin.Engine) {
+		r.POST("/webhooks", service.CreateWebhook)
+	}, http.MethodPost, "/webhooks", `{"url": "http://169.254.169.254/latest/meta-data"}`)
+
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("POST /webhooks = %d, want %d: %s", recorder.Code, http.StatusUnprocessableEntity, recorder.Body)
+	}
+	if puts := fake.recorded("PutItem", ""); len(puts) > 0 {
+		t.Errorf("stored %d subscriptions, want none", len(puts))
+	}
+}
+
+func TestWebhookClientRefusesInternalAddress(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	tests := []struct {
+		name    string
+		allowed string
+		wantErr bool
+	}{
+		{"loopback refused", "", true},
+		{"loopback allowed", "127.0.0.0/8", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WEBHOOK_ALLOWED_HOSTS", tt.allowed)
+			config := loadWebhookConfig()
+			service := &JMIService{webhooks: config, receiveCtx: context.Background()}
+
+			_, err := service.postWebhook(WebhookSubscription{Id: "wh-1", Url: receiver.URL, Secret: "s"}, "d-1", "webhook.test", []byte(`{}`))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("postWebhook() to %s = %v, wantErr %v", receiver.URL, err, tt.wantErr)
+			}
+		})
+	}
+}
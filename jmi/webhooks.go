@@ -0,0 +1,790 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Statuses a subscription can follow: the terminal states of an execution and SLA breaches
+const (
+	WebhookStatusSucceeded   = "SUCCEEDED"
+	WebhookStatusFailed      = "FAILED"
+	WebhookStatusStopped     = "STOPPED"
+	WebhookStatusSLABreached = "SLA_BREACHED"
+)
+
+var errWebhookNotFound = errors.New("webhook subscription not found")
+
+// WebhookSubscription is where and for what a tenant wants to be notified.
+// Empty Routines or Statuses match everything.
+type WebhookSubscription struct {
+	Id          string    `json:"id" dynamodbav:"id"`
+	AccountId   string    `json:"accountId" dynamodbav:"accountId"`
+	Url         string    `json:"url" dynamodbav:"url"`
+	Secret      string    `json:"secret,omitempty" dynamodbav:"secret"` // Only returned when the subscription is created
+	Description string    `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	Routines    []string  `json:"routines" dynamodbav:"routines"`
+	Statuses    []string  `json:"statuses" dynamodbav:"statuses"`
+	CreatedBy   string    `json:"createdBy,omitempty" dynamodbav:"createdBy,omitempty"`
+	CreatedAt   time.Time `json:"createdAt" dynamodbav:"createdAt"`
+}
+
+// WebhookSubscriptionRequest is the payload of POST /webhooks
+type WebhookSubscriptionRequest struct {
+	Url         string   `json:"url"`
+	Secret      string   `json:"secret"`
+	Description string   `json:"description"`
+	AccountId   string   `json:"accountId"`
+	Routines    []string `json:"routines"`
+	Statuses    []string `json:"statuses"`
+}
+
+// WebhookEvent is the body POSTed to subscribers
+type WebhookEvent struct {
+	EventId       string                 `json:"eventId"` // Stable per event, so receivers can drop duplicates
+	Type          string                 `json:"type"`
+	Status        string                 `json:"status"`
+	AccountId     string                 `json:"accountId"`
+	RoutineName   string                 `json:"routineName"`
+	ExecutionUuid string                 `json:"executionUuid,omitempty"`
+	Stage         string                 `json:"stage,omitempty"`
+	Timestamp     int64                  `json:"timestamp"`
+	Details       map[string]interface{} `json:"details,omitempty"`
+}
+
+// WebhookDelivery is one attempt to deliver an event, kept as the delivery log
+type WebhookDelivery struct {
+	DeliveryId     string `json:"deliveryId" dynamodbav:"deliveryId"`
+	SubscriptionId string `json:"subscriptionId" dynamodbav:"subscriptionId"`
+	AccountId      string `json:"accountId" dynamodbav:"accountId"`
+	EventId        string `json:"eventId" dynamodbav:"eventId"`
+	EventType      string `json:"eventType" dynamodbav:"eventType"`
+	EventStatus    string `json:"eventStatus" dynamodbav:"eventStatus"`
+	Url            string `json:"url" dynamodbav:"url"`
+	Attempt        int    `json:"attempt" dynamodbav:"attempt"`
+	Result         string `json:"result" dynamodbav:"result"` // success, retrying or failure
+	StatusCode     int    `json:"statusCode,omitempty" dynamodbav:"statusCode,omitempty"`
+	Error          string `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	DurationMs     int64  `json:"durationMs" dynamodbav:"durationMs"`
+	Timestamp      int64  `json:"timestamp" dynamodbav:"timestamp"` // Unix milliseconds, sort key of the GSI
+	Time           string `json:"time" dynamodbav:"time"`
+}
+
+// WebhookOutboxEntry is an event waiting to be delivered to one subscription.
+// Entries are keyed by eventId#subscriptionId, so the replicas reading the
+// stream and records replayed after a restart enqueue each event once.
+type WebhookOutboxEntry struct {
+	OutboxId       string `dynamodbav:"outboxId"`
+	EventId        string `dynamodbav:"eventId"`
+	SubscriptionId string `dynamodbav:"subscriptionId"`
+	AccountId      string `dynamodbav:"accountId"`
+	EventType      string `dynamodbav:"eventType"`
+	EventStatus    string `dynamodbav:"eventStatus"`
+	Body           string `dynamodbav:"body"`          // The JSON POSTed, as signed
+	Attempt        int    `dynamodbav:"attempt"`       // Attempts made so far
+	NextAttemptAt  int64  `dynamodbav:"nextAttemptAt"` // Unix milliseconds
+	ClaimedAt      int64  `dynamodbav:"claimedAt,omitempty"`
+	CompletedAt    string `dynamodbav:"completedAt,omitempty"`
+	Result         string `dynamodbav:"result,omitempty"` // success, failure or dropped
+	ExpiresAt      int64  `dynamodbav:"expiresAt,omitempty"`
+}
+
+// webhookClaimTimeout is how long a worker's claim holds an outbox entry; an
+// older claim belongs to a replica that died mid-delivery
+const webhookClaimTimeout = 2 * time.Minute
+
+// webhookOutboxRetention keeps finished entries past the 24h a stream record
+// can be replayed, so a replay finds them and does not notify twice
+const webhookOutboxRetention = 7 * 24 * time.Hour
+
+// webhookConfig controls deliveries: WEBHOOK_MAX_ATTEMPTS (default 5),
+// WEBHOOK_RETRY_BACKOFF seconds before the first retry, doubled on each one
+// (default 2), and WEBHOOK_TIMEOUT seconds per attempt (default 10). The
+// client only connects to the addresses targets lets through.
+type webhookConfig struct {
+	maxAttempts int
+	backoff     time.Duration
+	targets     webhookTargets
+	client      *http.Client
+}
+
+func loadWebhookConfig() webhookConfig {
+	seconds := func(name string, fallback int) int {
+		if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+			return value
+		}
+		return fallback
+	}
+
+	targets := loadWebhookTargets()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = targets.dialContext
+
+	return webhookConfig{
+		maxAttempts: seconds("WEBHOOK_MAX_ATTEMPTS", 5),
+		backoff:     time.Duration(seconds("WEBHOOK_RETRY_BACKOFF", 2)) * time.Second,
+		targets:     targets,
+		client: &http.Client{
+			Timeout:   time.Duration(seconds("WEBHOOK_TIMEOUT", 10)) * time.Second,
+			Transport: transport,
+		},
+	}
+}
+
+func (j *JMIService) webhookTableName() string {
+	if j.webhookTable == "" {
+		return "webhook_subscriptions"
+	}
+	return j.webhookTable
+}
+
+func (j *JMIService) webhookDeliveryTableName() string {
+	if j.webhookDeliveryTable == "" {
+		return "webhook_deliveries"
+	}
+	return j.webhookDeliveryTable
+}
+
+func (j *JMIService) webhookOutboxTableName() string {
+	if j.webhookOutboxTable == "" {
+		return "webhook_outbox"
+	}
+	return j.webhookOutboxTable
+}
+
+// terminalStatus maps the stage records that end an execution to a webhook status
+func terminalStatus(stage StageRecord) (string, bool) {
+	switch {
+	case stage.Stage == "jmi-stop":
+		return WebhookStatusStopped, true
+	case stage.Stage == "jmr-run" && stage.Status == "succeeded":
+		return WebhookStatusSucceeded, true
+	case stage.Stage == "jmr-run" && stage.Status == "failed":
+		return WebhookStatusFailed, true
+	}
+	return "", false
+}
+
+// notifyTerminalStage sends the execution.completed webhooks for a stage record
+// that ends an execution; other stages are ignored
+func (j *JMIService) notifyTerminalStage(stage StageRecord) {
+	status, ok := terminalStatus(stage)
+	if !ok {
+		return
+	}
+
+	event := WebhookEvent{
+		EventId:       stage.ExecutionName,
+		Type:          "execution.completed",
+		Status:        status,
+		AccountId:     stage.AccountId,
+		RoutineName:   stage.OriginalName,
+		ExecutionUuid: stage.ExecutionUuid,
+		Stage:         stage.Stage,
+		Timestamp:     stage.Timestamp,
+	}
+	if len(stage.Tasks) > 0 {
+		event.Details = map[string]interface{}{"tasks": stage.Tasks}
+	}
+
+	j.dispatchWebhookEvent(event)
+}
+
+// dispatchWebhookEvent queues event for every matching subscription of its account
+func (j *JMIService) dispatchWebhookEvent(event WebhookEvent) {
+	subscriptions, err := j.accountWebhooks(event.AccountId)
+	if err != nil {
+		log.Printf("ERROR: Failed to load webhooks of account %s: %v", event.AccountId, err)
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		if !subscription.matches(event) {
+			continue
+		}
+		if err := j.enqueueWebhook(subscription, event); err != nil {
+			log.Printf("ERROR: Failed to queue event %s for webhook %s: %v", event.EventId, subscription.Id, err)
+		}
+	}
+}
+
+// enqueueWebhook adds event to the outbox of subscription. An entry already
+// there, queued by another replica or by an earlier read of the same record,
+// is left as it is.
+func (j *JMIService) enqueueWebhook(subscription WebhookSubscription, event WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(WebhookOutboxEntry{
+		OutboxId:       event.EventId + "#" + subscription.Id,
+		EventId:        event.EventId,
+		SubscriptionId: subscription.Id,
+		AccountId:      subscription.AccountId,
+		EventType:      event.Type,
+		EventStatus:    event.Status,
+		Body:           string(body),
+		NextAttemptAt:  time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String(j.webhookOutboxTableName()),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(outboxId)"),
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return nil
+	}
+	return err
+}
+
+func (s WebhookSubscription) matches(event WebhookEvent) bool {
+	return (len(s.Routines) == 0 || contains(s.Routines, event.RoutineName)) &&
+		(len(s.Statuses) == 0 || contains(s.Statuses, event.Status))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// signWebhook returns the X-Webhook-Signature value: HMAC-SHA256 of "timestamp.body"
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// startWebhookWorker delivers the outbox, checking every WEBHOOK_OUTBOX_INTERVAL
+// seconds (default 2). Any replica may deliver an entry; the claim keeps the
+// others off it.
+func (j *JMIService) startWebhookWorker() {
+	interval := 2 * time.Second
+	if value, err := strconv.Atoi(os.Getenv("WEBHOOK_OUTBOX_INTERVAL")); err == nil && value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.receiveCtx.Done():
+			log.Println("Webhook worker stopped")
+			return
+		case <-ticker.C:
+			j.deliverWebhookOutbox()
+		}
+	}
+}
+
+func (j *JMIService) deliverWebhookOutbox() {
+	now := time.Now()
+	var entries []WebhookOutboxEntry
+	paginator := dynamodb.NewScanPaginator(j.dynamoClient, &dynamodb.ScanInput{
+		TableName:        aws.String(j.webhookOutboxTableName()),
+		FilterExpression: aws.String("attribute_not_exists(completedAt) AND nextAttemptAt <= :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixMilli(), 10)},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("ERROR: Failed to scan the webhook outbox: %v", err)
+			return
+		}
+		var pageEntries []WebhookOutboxEntry
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageEntries); err != nil {
+			log.Printf("ERROR: Failed to unmarshal webhook outbox entries: %v", err)
+			return
+		}
+		entries = append(entries, pageEntries...)
+	}
+
+	var wg sync.WaitGroup
+	for _, entry := range entries {
+		claimed, err := j.claimWebhook(entry, now)
+		if err != nil {
+			log.Printf("ERROR: Failed to claim event %s for webhook %s: %v", entry.EventId, entry.SubscriptionId, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		wg.Add(1)
+		go func(entry WebhookOutboxEntry) {
+			defer wg.Done()
+			j.attemptWebhook(entry)
+		}(entry)
+	}
+	wg.Wait()
+}
+
+func webhookOutboxKey(entry WebhookOutboxEntry) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"outboxId": &types.AttributeValueMemberS{Value: entry.OutboxId},
+	}
+}
+
+// claimWebhook marks a due entry as being delivered by this replica, reporting
+// false when another replica holds it or it was finished meanwhile
+func (j *JMIService) claimWebhook(entry WebhookOutboxEntry, now time.Time) (bool, error) {
+	_, err := j.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:        aws.String(j.webhookOutboxTableName()),
+		Key:              webhookOutboxKey(entry),
+		UpdateExpression: aws.String("SET claimedAt = :now"),
+		ConditionExpression: aws.String("attribute_not_exists(completedAt) AND nextAttemptAt <= :now AND " +
+			"(attribute_not_exists(claimedAt) OR claimedAt < :stale)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now":   &types.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixMilli(), 10)},
+			":stale": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(-webhookClaimTimeout).UnixMilli(), 10)},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// attemptWebhook makes the next delivery attempt of a claimed entry, writes it
+// to the delivery log and then finishes the entry or schedules a retry with
+// exponential backoff
+func (j *JMIService) attemptWebhook(entry WebhookOutboxEntry) {
+	subscription, err := j.getWebhook(entry.SubscriptionId, entry.AccountId)
+	if errors.Is(err, errWebhookNotFound) {
+		log.Printf("Dropped event %s: webhook %s was deleted", entry.EventId, entry.SubscriptionId)
+		j.finishWebhook(entry, entry.Attempt, "dropped")
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to load webhook %s: %v", entry.SubscriptionId, err)
+		j.scheduleWebhook(entry, entry.Attempt, time.Now())
+		return
+	}
+
+	attempt := entry.Attempt + 1
+	delivery := WebhookDelivery{
+		DeliveryId:     uuid.New().String(),
+		SubscriptionId: subscription.Id,
+		AccountId:      subscription.AccountId,
+		EventId:        entry.EventId,
+		EventType:      entry.EventType,
+		EventStatus:    entry.EventStatus,
+		Url:            subscription.Url,
+		Attempt:        attempt,
+	}
+
+	started := time.Now()
+	statusCode, err := j.postWebhook(*subscription, delivery.DeliveryId, entry.EventType, []byte(entry.Body))
+	delivery.DurationMs = time.Since(started).Milliseconds()
+	delivery.StatusCode = statusCode
+	delivery.Timestamp = started.UnixMilli()
+	delivery.Time = started.Format(time.RFC3339)
+
+	switch {
+	case err == nil:
+		delivery.Result = "success"
+	case attempt < j.webhooks.maxAttempts:
+		delivery.Result = "retrying"
+		delivery.Error = err.Error()
+	default:
+		delivery.Result = "failure"
+		delivery.Error = err.Error()
+	}
+	j.recordWebhookDelivery(delivery)
+
+	if err == nil {
+		log.Printf("Webhook %s delivered event %s (attempt %d)", subscription.Id, entry.EventId, attempt)
+		j.finishWebhook(entry, attempt, delivery.Result)
+		return
+	}
+	log.Printf("WARN: Webhook %s attempt %d for event %s failed: %v", subscription.Id, attempt, entry.EventId, err)
+
+	if attempt < j.webhooks.maxAttempts {
+		j.scheduleWebhook(entry, attempt, time.Now().Add(j.webhooks.backoff<<(attempt-1)))
+		return
+	}
+	j.finishWebhook(entry, attempt, delivery.Result)
+}
+
+// scheduleWebhook gives a claimed entry back to the outbox for an attempt at next
+func (j *JMIService) scheduleWebhook(entry WebhookOutboxEntry, attempt int, next time.Time) {
+	_, err := j.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:        aws.String(j.webhookOutboxTableName()),
+		Key:              webhookOutboxKey(entry),
+		UpdateExpression: aws.String("SET attempt = :attempt, nextAttemptAt = :next REMOVE claimedAt"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":attempt": &types.AttributeValueMemberN{Value: strconv.Itoa(attempt)},
+			":next":    &types.AttributeValueMemberN{Value: strconv.FormatInt(next.UnixMilli(), 10)},
+		},
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to reschedule event %s for webhook %s: %v", entry.EventId, entry.SubscriptionId, err)
+	}
+}
+
+// finishWebhook closes an entry; it is kept until expiresAt so the event is not queued again
+func (j *JMIService) finishWebhook(entry WebhookOutboxEntry, attempt int, result string) {
+	now := time.Now().UTC()
+	_, err := j.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:        aws.String(j.webhookOutboxTableName()),
+		Key:              webhookOutboxKey(entry),
+		UpdateExpression: aws.String("SET attempt = :attempt, completedAt = :now, #result = :result, expiresAt = :expiresAt REMOVE claimedAt"),
+		ExpressionAttributeNames: map[string]string{
+			"#result": "result",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":attempt":   &types.AttributeValueMemberN{Value: strconv.Itoa(attempt)},
+			":now":       &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+			":result":    &types.AttributeValueMemberS{Value: result},
+			":expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(webhookOutboxRetention).Unix(), 10)},
+		},
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to finish event %s for webhook %s: %v", entry.EventId, entry.SubscriptionId, err)
+	}
+}
+
+func (j *JMIService) postWebhook(subscription WebhookSubscription, deliveryId, eventType string, body []byte) (int, error) {
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(j.receiveCtx, http.MethodPost, subscription.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "poc-bdd-jmi-webhooks")
+	req.Header.Set("X-Webhook-Id", subscription.Id)
+	req.Header.Set("X-Webhook-Delivery", deliveryId)
+	req.Header.Set("X-Webhook-Event", eventType)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", signWebhook(subscription.Secret, timestamp, body))
+
+	resp, err := j.webhooks.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (j *JMIService) recordWebhookDelivery(delivery WebhookDelivery) {
+	item, err := attributevalue.MarshalMap(delivery)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal webhook delivery: %v", err)
+		return
+	}
+
+	_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(j.webhookDeliveryTableName()),
+		Item:      item,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to record webhook delivery %s: %v", delivery.DeliveryId, err)
+	}
+}
+
+// accountWebhooks returns every subscription of an account through the accountId GSI
+func (j *JMIService) accountWebhooks(accountId string) ([]WebhookSubscription, error) {
+	var subscriptions []WebhookSubscription
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.webhookTableName()),
+		IndexName:              aws.String("accountId-index"),
+		KeyConditionExpression: aws.String("accountId = :accountId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: accountId},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+
+		var pageSubscriptions []WebhookSubscription
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageSubscriptions); err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, pageSubscriptions...)
+	}
+	return subscriptions, nil
+}
+
+// getWebhook loads a subscription of the given account; others' are reported as missing
+func (j *JMIService) getWebhook(id, accountId string) (*WebhookSubscription, error) {
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(j.webhookTableName()),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errWebhookNotFound
+	}
+
+	var subscription WebhookSubscription
+	if err := attributevalue.UnmarshalMap(result.Item, &subscription); err != nil {
+		return nil, err
+	}
+	if subscription.AccountId != accountId {
+		return nil, errWebhookNotFound
+	}
+	return &subscription, nil
+}
+
+// loadWebhook answers 404/500 itself and returns nil when the handler should stop
+func (j *JMIService) loadWebhook(ctx *gin.Context) *WebhookSubscription {
+	id := ctx.Param("id")
+	subscription, err := j.getWebhook(id, identityFrom(ctx).AccountId)
+	if err != nil {
+		if errors.Is(err, errWebhookNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return nil
+		}
+		log.Printf("Error loading webhook %s: %v", id, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load webhook"})
+		return nil
+	}
+	return subscription
+}
+
+func (j *JMIService) CreateWebhook(ctx *gin.Context) {
+	var req WebhookSubscriptionRequest
+	if !bindAndValidate(ctx, "webhook-subscription", &req, func() []Violation {
+		if err := j.webhooks.targets.checkURL(ctx.Request.Context(), req.Url); err != nil {
+			return []Violation{{Path: "$.url", Message: err.Error()}}
+		}
+		return nil
+	}) {
+		return
+	}
+
+	identity := identityFrom(ctx)
+	if req.AccountId != "" && req.AccountId != identity.AccountId {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "accountId does not match the caller's account"})
+		return
+	}
+
+	// Generate a signing secret when the caller does not bring one
+	if req.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Printf("Error generating webhook secret: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+			return
+		}
+		req.Secret = hex.EncodeToString(secret)
+	}
+
+	subscription := WebhookSubscription{
+		Id:          uuid.New().String(),
+		AccountId:   identity.AccountId,
+		Url:         req.Url,
+		Secret:      req.Secret,
+		Description: req.Description,
+		Routines:    req.Routines,
+		Statuses:    req.Statuses,
+		CreatedBy:   identity.Subject,
+		CreatedAt:   time.Now(),
+	}
+	if subscription.Routines == nil {
+		subscription.Routines = []string{}
+	}
+	if subscription.Statuses == nil {
+		subscription.Statuses = []string{}
+	}
+	setAuditTarget(ctx, "webhook/"+subscription.Id)
+
+	item, err := attributevalue.MarshalMap(subscription)
+	if err != nil {
+		log.Printf("Error marshaling webhook: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(j.webhookTableName()),
+		Item:      item,
+	})
+	if err != nil {
+		log.Printf("Error storing webhook: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	log.Printf("JMI created webhook %s for account %s -> %s", subscription.Id, subscription.AccountId, subscription.Url)
+
+	ctx.JSON(http.StatusCreated, subscription)
+}
+
+func (j *JMIService) GetWebhooks(ctx *gin.Context) {
+	subscriptions, err := j.accountWebhooks(identityFrom(ctx).AccountId)
+	if err != nil {
+		log.Printf("Error querying webhooks: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve webhooks"})
+		return
+	}
+
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	if subscriptions == nil {
+		subscriptions = []WebhookSubscription{}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"webhooks": subscriptions,
+		"count":    len(subscriptions),
+	})
+}
+
+func (j *JMIService) GetWebhook(ctx *gin.Context) {
+	subscription := j.loadWebhook(ctx)
+	if subscription == nil {
+		return
+	}
+
+	subscription.Secret = ""
+	ctx.JSON(http.StatusOK, subscription)
+}
+
+func (j *JMIService) DeleteWebhook(ctx *gin.Context) {
+	setAuditTarget(ctx, "webhook/"+ctx.Param("id"))
+
+	subscription := j.loadWebhook(ctx)
+	if subscription == nil {
+		return
+	}
+
+	_, err := j.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(j.webhookTableName()),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: subscription.Id},
+		},
+	})
+	if err != nil {
+		log.Printf("Error deleting webhook %s: %v", subscription.Id, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	log.Printf("JMI deleted webhook %s", subscription.Id)
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Webhook deleted", "id": subscription.Id})
+}
+
+// TestWebhook sends a webhook.test event to the subscription, regardless of its filters
+func (j *JMIService) TestWebhook(ctx *gin.Context) {
+	setAuditTarget(ctx, "webhook/"+ctx.Param("id"))
+
+	subscription := j.loadWebhook(ctx)
+	if subscription == nil {
+		return
+	}
+
+	event := WebhookEvent{
+		EventId:   "test-" + uuid.New().String(),
+		Type:      "webhook.test",
+		Status:    "TEST",
+		AccountId: subscription.AccountId,
+		Timestamp: time.Now().Unix(),
+	}
+	if err := j.enqueueWebhook(*subscription, event); err != nil {
+		log.Printf("Error queueing test event for webhook %s: %v", subscription.Id, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue test event"})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{"message": "Test event queued", "eventId": event.EventId})
+}
+
+// GetWebhookDeliveries pages through the delivery log of a subscription, newest first
+func (j *JMIService) GetWebhookDeliveries(ctx *gin.Context) {
+	subscription := j.loadWebhook(ctx)
+	if subscription == nil {
+		return
+	}
+
+	page, err := parsePageRequest(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(j.webhookDeliveryTableName()),
+		IndexName:              aws.String("subscriptionId-timestamp-index"),
+		KeyConditionExpression: aws.String("subscriptionId = :subscriptionId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":subscriptionId": &types.AttributeValueMemberS{Value: subscription.Id},
+		},
+	}
+	filter := newQueryFilter()
+	filter.equals("result", ctx.Query("result"))
+	filter.equals("eventId", ctx.Query("eventId"))
+	filter.apply(input)
+
+	items, nextCursor, err := queryPage(j.dynamoClient, input, page)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error querying deliveries of webhook %s: %v", subscription.Id, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve deliveries"})
+		return
+	}
+
+	deliveries := []WebhookDelivery{}
+	if err := attributevalue.UnmarshalListOfMaps(items, &deliveries); err != nil {
+		log.Printf("Error unmarshaling webhook deliveries: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process deliveries"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"count":      len(deliveries),
+		"nextCursor": nextCursor,
+	})
+}
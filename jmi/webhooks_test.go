@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookOutboxDelivery(t *testing.T) {
+	tests := []struct {
+		name           string
+		attempt        int // attempts the entry already had
+		claimLost      bool
+		deleted        bool
+		receiverStatus int
+		wantPosts      int
+		wantLog        string // result written to the delivery log, "" when none is
+		wantFinish     string // result the entry is closed with, "" when it is rescheduled
+		wantAttempt    string
+	}{
+		{"due entry is delivered", 0, false, false, http.StatusOK, 1, "success", "success", "1"},
+		{"another replica holds the entry", 0, true, false, http.StatusOK, 0, "", "", ""},
+		{"failed attempt is retried later", 0, false, false, http.StatusInternalServerError, 1, "retrying", "", "1"},
+		{"last attempt fails", 2, false, false, http.StatusInternalServerError, 1, "failure", "failure", "3"},
+		{"deleted subscription drops the entry", 0, false, true, http.StatusOK, 0, "", "dropped", "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var posts []*http.Request
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				posts = append(posts, r)
+				mu.Unlock()
+				w.WriteHeader(tt.receiverStatus)
+			}))
+			defer receiver.Close()
+
+			subscription := WebhookSubscription{Id: "wh-1", AccountId: "acc-a", Url: receiver.URL, Secret: "s", Routines: []string{}, Statuses: []string{}}
+			entry := WebhookOutboxEntry{
+				OutboxId:       "ev-1#wh-1",
+				EventId:        "ev-1",
+				SubscriptionId: "wh-1",
+				AccountId:      "acc-a",
+				EventType:      "execution.completed",
+				EventStatus:    WebhookStatusSucceeded,
+				Body:           `{"eventId":"ev-1"}`,
+				Attempt:        tt.attempt,
+				NextAttemptAt:  time.Now().Add(-time.Second).UnixMilli(),
+			}
+			fake, client := newFakeDynamo(t, func(call dynamoCall) (interface{}, *dynamoError) {
+				switch {
+				case call.Operation == "Scan":
+					return map[string]interface{}{"Items": []interface{}{wireItem(t, entry)}}, nil
+				case call.Operation == "UpdateItem" && call.Input["ConditionExpression"] != nil && tt.claimLost:
+					return nil, &dynamoError{Type: "ConditionalCheckFailedException"}
+				case call.Operation == "GetItem" && !tt.deleted:
+					return map[string]interface{}{"Item": wireItem(t, subscription)}, nil
+				}
+				return nil, nil
+			})
+			service := &JMIService{
+				dynamoClient: client,
+				webhooks:     webhookConfig{maxAttempts: 3, backoff: time.Minute, client: receiver.Client()},
+				receiveCtx:   context.Background(),
+			}
+
+			service.deliverWebhookOutbox()
+
+			if len(posts) != tt.wantPosts {
+				t.Fatalf("POSTed %d times, want %d", len(posts), tt.wantPosts)
+			}
+			if tt.wantPosts > 0 {
+				timestamp, _ := strconv.ParseInt(posts[0].Header.Get("X-Webhook-Timestamp"), 10, 64)
+				if signature := posts[0].Header.Get("X-Webhook-Signature"); signature != signWebhook("s", timestamp, []byte(entry.Body)) {
+					t.Errorf("X-Webhook-Signature = %q does not sign the queued body", signature)
+				}
+			}
+
+			deliveries := fake.recorded("PutItem", "webhook_deliveries")
+			if tt.wantLog == "" && len(deliveries) > 0 {
+				t.Errorf("logged %d deliveries, want none", len(deliveries))
+			}
+			if tt.wantLog != "" && (len(deliveries) != 1 || deliveries[0].value("Item", "result") != tt.wantLog) {
+				t.Errorf("delivery log = %+v, want one %s", deliveries, tt.wantLog)
+			}
+
+			updates := fake.recorded("UpdateItem", "webhook_outbox")
+			if tt.claimLost {
+				if len(updates) != 1 {
+					t.Errorf("made %d outbox updates after losing the claim, want only the claim", len(updates))
+				}
+				return
+			}
+			if len(updates) != 2 {
+				t.Fatalf("made %d outbox updates, want the claim and one more", len(updates))
+			}
+			last := updates[1]
+			if finish := last.value("ExpressionAttributeValues", ":result"); finish != tt.wantFinish {
+				t.Errorf("entry closed with %q, want %q", finish, tt.wantFinish)
+			}
+			if attempt := last.value("ExpressionAttributeValues", ":attempt"); attempt != tt.wantAttempt {
+				t.Errorf("entry attempt = %s, want %s", attempt, tt.wantAttempt)
+			}
+		})
+	}
+}
+
+func TestEnqueueWebhookOnce(t *testing.T) {
+	fake, client := newFakeDynamo(t, func(call dynamoCall) (interface{}, *dynamoError) {
+		return nil, &dynamoError{Type: "ConditionalCheckFailedException"}
+	})
+	service := &JMIService{dynamoClient: client}
+
+	subscription := WebhookSubscription{Id: "wh-1", AccountId: "acc-a"}
+	if err := service.enqueueWebhook(subscription, WebhookEvent{EventId: "ev-1", AccountId: "acc-a"}); err != nil {
+		t.Fatalf("enqueueWebhook() of an event already queued = %v, want nil", err)
+	}
+	puts := fake.recorded("PutItem", "webhook_outbox")
+	if len(puts) != 1 || puts[0].Input["ConditionExpression"] != "attribute_not_exists(outboxId)" {
+		t.Errorf("PutItem calls = %+v, want one conditional on outboxId", puts)
+	}
+}
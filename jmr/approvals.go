@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// StepApproval is the step type that pauses an execution until someone signs it off
+const StepApproval = "approval"
+
+// StatusAwaitingApproval is the run status of an execution paused at an approval step
+const StatusAwaitingApproval = "awaiting_approval"
+
+// ApprovalGate configures an approval step
+type ApprovalGate struct {
+	Description    string `json:"description,omitempty"`
+	TimeoutSeconds int    `json:"timeoutSeconds,omitempty"`
+}
+
+// ApprovalDecision is added by JMI to the execution it sends back once an
+// approval step is approved or rejected
+type ApprovalDecision struct {
+	StepId    string `json:"stepId"`
+	Status    string `json:"status"` // approved or rejected
+	DecidedBy string `json:"decidedBy"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+// approval is the request JMI lists and decides
+type approval struct {
+	AccountId     string `dynamodbav:"accountId"`
+	ApprovalId    string `dynamodbav:"approvalId"` // executionUuid#stepId
+	ExecutionName string `dynamodbav:"executionName"`
+	ExecutionUuid string `dynamodbav:"executionUuid"`
+	StepId        string `dynamodbav:"stepId"`
+	Description   string `dynamodbav:"description,omitempty"`
+	Status        string `dynamodbav:"status"`
+	RequestedAt   string `dynamodbav:"requestedAt"`
+	ExpiresAt     int64  `dynamodbav:"expiresAt,omitempty"`
+	Message       string `dynamodbav:"message"`
+}
+
+func (j *JMRService) approvalTableName() string {
+	if j.approvalTable == "" {
+		return "approvals"
+	}
+	return j.approvalTable
+}
+
+// requestApproval records the approval an execution now waits for. The
+// execution message is kept with it, so JMI can send it back when decided.
+func (j *JMRService) requestApproval(execution ExecutionMessage, step Step) error {
+	now := time.Now()
+	request := approval{
+		AccountId:     execution.AccountId,
+		ApprovalId:    execution.ExecutionUuid + "#" + step.StepId,
+		ExecutionName: execution.ExecutionName,
+		ExecutionUuid: execution.ExecutionUuid,
+		StepId:        step.StepId,
+		Status:        "pending",
+		RequestedAt:   now.Format(time.RFC3339),
+		Message:       execution.raw,
+	}
+	if step.Approval != nil {
+		request.Description = step.Approval.Description
+		if step.Approval.TimeoutSeconds > 0 {
+			request.ExpiresAt = now.Add(time.Duration(step.Approval.TimeoutSeconds) * time.Second).Unix()
+		}
+	}
+
+	item, err := attributevalue.MarshalMap(request)
+	if err != nil {
+		return err
+	}
+	// A redelivered message finds its approval already requested
+	_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String(j.approvalTableName()),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(approvalId)"),
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return nil
+	}
+	return err
+}
+
+// priorRun loads the jmr-run record of an earlier delivery of the execution,
+// or nil on its first run
+func (j *JMRService) priorRun(execution ExecutionMessage) (*RunRecord, error) {
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(j.tableName),
+		Key: map[string]types.AttributeValue{
+			"executionName": &types.AttributeValueMemberS{Value: fmt.Sprintf("%s#%s#v%d#%s", execution.ExecutionName, execution.ExecutionUuid, 3, "jmr-run")},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var record RunRecord
+	if err := attributevalue.UnmarshalMap(result.Item, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// approvalResult is the outcome of the approval step JMI decided
+func approvalResult(step Step, decision *ApprovalDecision) TaskResult {
+	result := TaskResult{StepId: step.StepId, TaskId: step.StepId, Status: "succeeded"}
+	verb := "Approved"
+	if decision.Status != "approved" {
+		result.Status = "failed"
+		verb = "Rejected"
+	}
+	result.Log = fmt.Sprintf("%s by %s", verb, decision.DecidedBy)
+	if decision.Comment != "" {
+		result.Log += ": " + decision.Comment
+	}
+	return result
+}
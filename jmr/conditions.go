@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Order date keywords, resolved against the execution's order date
+const (
+	OrderDateCurrent  = "ODAT"
+	OrderDatePrevious = "PREV"
+	OrderDateNext     = "NEXT"
+	AnyOrderDate      = "****"
+	orderDateLayout   = "20060102"
+)
+
+// Condition is a named flag for an order date, set and awaited by steps
+type Condition struct {
+	Name      string `json:"name"`
+	OrderDate string `json:"orderDate,omitempty"`
+}
+
+// ConditionActions are the conditions a step adds and deletes when it ends
+type ConditionActions struct {
+	AddConditions    []Condition `json:"addConditions,omitempty"`
+	DeleteConditions []Condition `json:"deleteConditions,omitempty"`
+}
+
+// conditionRecord is a condition as stored in the table JMI serves
+type conditionRecord struct {
+	AccountId     string `dynamodbav:"accountId"`
+	ConditionKey  string `dynamodbav:"conditionKey"` // name#orderDate
+	Name          string `dynamodbav:"name"`
+	OrderDate     string `dynamodbav:"orderDate"`
+	CreatedBy     string `dynamodbav:"createdBy"`
+	CreatedAt     string `dynamodbav:"createdAt"`
+	ExecutionUuid string `dynamodbav:"executionUuid,omitempty"`
+}
+
+func (j *JMRService) conditionTableName() string {
+	if j.conditionTable == "" {
+		return "conditions"
+	}
+	return j.conditionTable
+}
+
+// conditionWaitTimeout reads CONDITION_WAIT_TIMEOUT, the seconds a step waits
+// for its conditions before failing (default 3600)
+func conditionWaitTimeout() time.Duration {
+	if value, err := strconv.Atoi(os.Getenv("CONDITION_WAIT_TIMEOUT")); err == nil && value > 0 {
+		return time.Duration(value) * time.Second
+	}
+	return 3600 * time.Second
+}
+
+// orderDateOf is the execution's order date: the orderDate parameter, the
+// eventDate of a backfill run, or else the day it was started
+func orderDateOf(execution ExecutionMessage) string {
+	if orderDate, ok := execution.Parameters["orderDate"].(string); ok {
+		if _, err := time.Parse(orderDateLayout, orderDate); err == nil {
+			return orderDate
+		}
+	}
+	if eventDate, ok := execution.Parameters["eventDate"].(string); ok {
+		if date, err := time.Parse("2006-01-02", eventDate); err == nil {
+			return date.Format(orderDateLayout)
+		}
+	}
+	if createdAt, err := time.Parse(time.RFC3339, execution.CreatedAt); err == nil {
+		return createdAt.UTC().Format(orderDateLayout)
+	}
+	return time.Now().UTC().Format(orderDateLayout)
+}
+
+// resolveOrderDate turns a condition's orderDate keyword into a date; **** is kept
+func resolveOrderDate(orderDate, executionDate string) string {
+	date, err := time.Parse(orderDateLayout, executionDate)
+	switch {
+	case orderDate == "" || orderDate == OrderDateCurrent:
+		return executionDate
+	case orderDate == OrderDatePrevious && err == nil:
+		return date.AddDate(0, 0, -1).Format(orderDateLayout)
+	case orderDate == OrderDateNext && err == nil:
+		return date.AddDate(0, 0, 1).Format(orderDateLayout)
+	}
+	return orderDate
+}
+
+// conditionExists checks one condition; with **** any order date will do
+func (j *JMRService) conditionExists(accountId, name, orderDate string) (bool, error) {
+	if orderDate == AnyOrderDate {
+		result, err := j.dynamoClient.Query(context.TODO(), &dynamodb.QueryInput{
+			TableName:              aws.String(j.conditionTableName()),
+			KeyConditionExpression: aws.String("accountId = :accountId AND begins_with(conditionKey, :prefix)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":accountId": &types.AttributeValueMemberS{Value: accountId},
+				":prefix":    &types.AttributeValueMemberS{Value: name + "#"},
+			},
+			Limit: aws.Int32(1),
+		})
+		if err != nil {
+			return false, err
+		}
+		return len(result.Items) > 0, nil
+	}
+
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(j.conditionTableName()),
+		Key: map[string]types.AttributeValue{
+			"accountId":    &types.AttributeValueMemberS{Value: accountId},
+			"conditionKey": &types.AttributeValueMemberS{Value: name + "#" + orderDate},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.Item != nil, nil
+}
+
+// missingConditions lists the conditions the step waits for that are not set
+// yet, resolved to their order dates
+func (j *JMRService) missingConditions(execution ExecutionMessage, conditions []Condition) ([]Condition, error) {
+	executionDate := orderDateOf(execution)
+	var missing []Condition
+	for _, condition := range conditions {
+		orderDate := resolveOrderDate(condition.OrderDate, executionDate)
+		exists, err := j.conditionExists(execution.AccountId, condition.Name, orderDate)
+		if err != nil {
+			return nil, fmt.Errorf("checking condition %s: %w", condition.Name, err)
+		}
+		if !exists {
+			missing = append(missing, Condition{Name: condition.Name, OrderDate: orderDate})
+		}
+	}
+	return missing, nil
+}
+
+// checkConditions lets the step run once every condition it waits for is set.
+// Until then the run parks under the missing conditions, and adding one of
+// them sends it back; after CONDITION_WAIT_TIMEOUT the step fails.
+func (j *JMRService) checkConditions(execution ExecutionMessage, stepId string, conditions []Condition, prior *RunRecord) (*runWait, error) {
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+	missing, err := j.missingConditions(execution, conditions)
+	if err != nil || len(missing) == 0 {
+		return nil, err
+	}
+
+	names := make([]string, len(missing))
+	waitKeys := make([]string, len(missing))
+	for i, condition := range missing {
+		names[i] = condition.Name + " " + condition.OrderDate
+		waitKeys[i] = conditionWaitKey(condition.Name, condition.OrderDate, execution.ExecutionUuid)
+	}
+
+	waitTimeout := conditionWaitTimeout()
+	since := waitSince(prior, stepId, "")
+	deadline := since.Add(waitTimeout)
+	if !time.Now().Before(deadline) {
+		return nil, fmt.Errorf("timed out after %s waiting for conditions %s", waitTimeout, strings.Join(names, ", "))
+	}
+
+	log.Printf("Runner %s: step %s of %s waits for conditions %s", j.runnerID, stepId, execution.ExecutionUuid, strings.Join(names, ", "))
+	return &runWait{
+		stepId:   stepId,
+		reason:   "Waiting for conditions " + strings.Join(names, ", "),
+		since:    since,
+		deadline: deadline,
+		waitKeys: waitKeys,
+		ready: func() (bool, error) {
+			missing, err := j.missingConditions(execution, conditions)
+			return len(missing) == 0, err
+		},
+	}, nil
+}
+
+// applyConditionActions adds and deletes the conditions a step sets when it ends
+func (j *JMRService) applyConditionActions(execution ExecutionMessage, stepId string, actions *ConditionActions) {
+	if actions == nil {
+		return
+	}
+	executionDate := orderDateOf(execution)
+
+	for _, condition := range actions.AddConditions {
+		orderDate := resolveOrderDate(condition.OrderDate, executionDate)
+		item, err := attributevalue.MarshalMap(conditionRecord{
+			AccountId:     execution.AccountId,
+			ConditionKey:  condition.Name + "#" + orderDate,
+			Name:          condition.Name,
+			OrderDate:     orderDate,
+			CreatedBy:     "execution:" + execution.ExecutionName,
+			CreatedAt:     time.Now().Format(time.RFC3339),
+			ExecutionUuid: execution.ExecutionUuid,
+		})
+		if err == nil {
+			_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+				TableName: aws.String(j.conditionTableName()),
+				Item:      item,
+			})
+		}
+		if err != nil {
+			log.Printf("Error adding condition %s %s for step %s of %s: %v", condition.Name, orderDate, stepId, execution.ExecutionUuid, err)
+			continue
+		}
+		log.Printf("Runner %s: step %s of %s added condition %s %s", j.runnerID, stepId, execution.ExecutionUuid, condition.Name, orderDate)
+		j.wakeConditionWaiters(execution.AccountId, condition.Name, orderDate)
+	}
+
+	for _, condition := range actions.DeleteConditions {
+		orderDate := resolveOrderDate(condition.OrderDate, executionDate)
+		keys := []string{condition.Name + "#" + orderDate}
+		if orderDate == AnyOrderDate {
+			var err error
+			if keys, err = j.conditionKeys(execution.AccountId, condition.Name); err != nil {
+				log.Printf("Error querying condition %s for step %s of %s: %v", condition.Name, stepId, execution.ExecutionUuid, err)
+				continue
+			}
+		}
+		for _, key := range keys {
+			if _, err := j.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+				TableName: aws.String(j.conditionTableName()),
+				Key: map[string]types.AttributeValue{
+					"accountId":    &types.AttributeValueMemberS{Value: execution.AccountId},
+					"conditionKey": &types.AttributeValueMemberS{Value: key},
+				},
+			}); err != nil {
+				log.Printf("Error deleting condition %s for step %s of %s: %v", key, stepId, execution.ExecutionUuid, err)
+			}
+		}
+		log.Printf("Runner %s: step %s of %s deleted condition %s %s", j.runnerID, stepId, execution.ExecutionUuid, condition.Name, orderDate)
+	}
+}
+
+// conditionKeys lists the keys of a condition across every order date
+func (j *JMRService) conditionKeys(accountId, name string) ([]string, error) {
+	var keys []string
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.conditionTableName()),
+		KeyConditionExpression: aws.String("accountId = :accountId AND begins_with(conditionKey, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: accountId},
+			":prefix":    &types.AttributeValueMemberS{Value: name + "#"},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		var records []conditionRecord
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &records); err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			keys = append(keys, record.ConditionKey)
+		}
+	}
+	return keys, nil
+}
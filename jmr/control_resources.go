@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// lockSummaryId is the holderId of the item carrying a resource's lock state
+const lockSummaryId = "#"
+
+// controlLock is an execution holding, or waiting for, a control resource.
+// JMW takes the locks before dispatch; JMR gives them back when the run ends.
+type controlLock struct {
+	ResourceKey string `dynamodbav:"resourceKey"` // accountId#name
+	HolderId    string `dynamodbav:"holderId"`
+	Name        string `dynamodbav:"name"`
+	State       string `dynamodbav:"state"`
+	Mode        string `dynamodbav:"mode"`
+}
+
+func (j *JMRService) controlResourceTableName() string {
+	if j.controlResourceTable == "" {
+		return "control_resources"
+	}
+	return j.controlResourceTable
+}
+
+// releaseControlLocks frees the control resources an execution holds. The
+// deletes are conditional, so a stop already released by JMI is skipped.
+func (j *JMRService) releaseControlLocks(executionUuid string) {
+	result, err := j.dynamoClient.Query(context.TODO(), &dynamodb.QueryInput{
+		TableName:              aws.String(j.controlResourceTableName()),
+		IndexName:              aws.String("executionUuid-index"),
+		KeyConditionExpression: aws.String("executionUuid = :uuid"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uuid": &types.AttributeValueMemberS{Value: executionUuid},
+		},
+	})
+	if err != nil {
+		log.Printf("Error querying control locks of %s: %v", executionUuid, err)
+		return
+	}
+	var locks []controlLock
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &locks); err != nil {
+		log.Printf("Error unmarshaling control locks of %s: %v", executionUuid, err)
+		return
+	}
+
+	for _, lock := range locks {
+		if lock.State != LeaseHeld {
+			continue
+		}
+		summary := &types.Update{
+			TableName: aws.String(j.controlResourceTableName()),
+			Key: map[string]types.AttributeValue{
+				"resourceKey": &types.AttributeValueMemberS{Value: lock.ResourceKey},
+				"holderId":    &types.AttributeValueMemberS{Value: lockSummaryId},
+			},
+			UpdateExpression:    aws.String("REMOVE exclusiveHolder"),
+			ConditionExpression: aws.String("exclusiveHolder = :uuid"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":uuid": &types.AttributeValueMemberS{Value: executionUuid},
+			},
+		}
+		if lock.Mode == "shared" {
+			summary.UpdateExpression = aws.String("SET sharedCount = sharedCount - :one")
+			summary.ConditionExpression = aws.String("sharedCount > :zero")
+			summary.ExpressionAttributeValues = map[string]types.AttributeValue{
+				":zero": &types.AttributeValueMemberN{Value: "0"},
+				":one":  &types.AttributeValueMemberN{Value: "1"},
+			}
+		}
+
+		_, err := j.dynamoClient.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+			TransactItems: []types.TransactWriteItem{
+				{Delete: &types.Delete{
+					TableName: aws.String(j.controlResourceTableName()),
+					Key: map[string]types.AttributeValue{
+						"resourceKey": &types.AttributeValueMemberS{Value: lock.ResourceKey},
+						"holderId":    &types.AttributeValueMemberS{Value: lock.HolderId},
+					},
+					ConditionExpression:       aws.String("#state = :held"),
+					ExpressionAttributeNames:  map[string]string{"#state": "state"},
+					ExpressionAttributeValues: map[string]types.AttributeValue{":held": &types.AttributeValueMemberS{Value: LeaseHeld}},
+				}},
+				{Update: summary},
+			},
+		})
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			log.Printf("DEBUG: Control resource %s of %s already released", lock.Name, executionUuid)
+			continue
+		}
+		if err != nil {
+			log.Printf("ERROR: Failed to release control resource %s of %s: %v", lock.Name, executionUuid, err)
+			continue
+		}
+		log.Printf("Runner %s released control resource %s (%s) of %s", j.runnerID, lock.Name, lock.Mode, executionUuid)
+	}
+}
@@ -0,0 +1,610 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// ExecutionMessage is the execution JMW forwards after its processing stage
+type ExecutionMessage struct {
+	ExecutionName  string             `json:"executionName"`
+	ExecutionUuid  string             `json:"executionUuid"`
+	AccountId      string             `json:"accountId"`
+	CreatedAt      string             `json:"createdAt"`
+	RoutineVersion int                `json:"routineVersion,omitempty"`
+	Definition     *RoutineDefinition `json:"definition,omitempty"`
+	Retake         *RetakeInfo        `json:"retake,omitempty"`
+
+	// Run-level parameters from the start request; task parameters take precedence
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+
+	// Set when JMI sends a paused execution back with the approval decision
+	Approval *ApprovalDecision `json:"approval,omitempty"`
+
+	// Set when a routine task of another execution started this one
+	Parent *ParentExecution `json:"parent,omitempty"`
+
+	raw string // The message as received, kept with an approval request
+}
+
+// RoutineDefinition is the part of JMI's definition snapshot the runner needs
+type RoutineDefinition struct {
+	SchedulerRoutine struct {
+		Steps []Step `json:"steps"`
+	} `json:"schedulerRoutine"`
+}
+
+type Step struct {
+	StepId   string        `json:"stepId"`
+	Type     string        `json:"type,omitempty"`
+	Approval *ApprovalGate `json:"approval,omitempty"`
+	Tasks    []Task        `json:"tasks"`
+	RunIf    string        `json:"runIf,omitempty"` // success (default), failure or always
+	When     string        `json:"when,omitempty"`
+
+	WaitForConditions []Condition       `json:"waitForConditions,omitempty"`
+	OnSuccess         *ConditionActions `json:"onSuccess,omitempty"`
+	OnFailure         *ConditionActions `json:"onFailure,omitempty"`
+}
+
+type Task struct {
+	TaskId      string                 `json:"taskId"`
+	Type        string                 `json:"type,omitempty"` // runtime (default) or routine
+	RuntimeName string                 `json:"runtimeName,omitempty"`
+	Routine     *SubRoutine            `json:"routine,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters"`
+	Resources   []ResourceClaim        `json:"resources,omitempty"`
+}
+
+type RetakeInfo struct {
+	FromStepId     string   `json:"fromStepId"`
+	ExcludingTasks []string `json:"excludingTasks"`
+}
+
+// TaskResult is the outcome of one task in a run
+type TaskResult struct {
+	StepId string `json:"stepId" dynamodbav:"stepId"`
+	TaskId string `json:"taskId" dynamodbav:"taskId"`
+	Status string `json:"status" dynamodbav:"status"`
+	Log    string `json:"log" dynamodbav:"log"`
+
+	ChildExecutionUuid string `json:"childExecutionUuid,omitempty" dynamodbav:"childExecutionUuid,omitempty"` // Routine tasks only
+}
+
+// RunRecord is the jmr-run stage record, stored next to the JMI and JMW stages
+type RunRecord struct {
+	ExecutionName  string       `dynamodbav:"executionName"`
+	OriginalName   string       `dynamodbav:"originalName"`
+	ExecutionUuid  string       `dynamodbav:"executionUuid"`
+	Status         string       `dynamodbav:"status"`
+	CreatedAt      string       `dynamodbav:"createdAt"`
+	UpdatedAt      string       `dynamodbav:"updatedAt"`
+	Version        int          `dynamodbav:"version"`
+	Stage          string       `dynamodbav:"stage"`
+	ProcessedBy    string       `dynamodbav:"processedBy"`
+	RunnerID       string       `dynamodbav:"runnerID"`
+	Timestamp      int64        `dynamodbav:"timestamp"`
+	AccountId      string       `dynamodbav:"accountId,omitempty"`
+	RoutineVersion int          `dynamodbav:"routineVersion,omitempty"`
+	Tasks          []TaskResult `dynamodbav:"tasks,omitempty"`
+
+	// Where a waiting run parked, what for and since when
+	Reason       string `dynamodbav:"reason,omitempty"`
+	WaitStepId   string `dynamodbav:"waitStepId,omitempty"`
+	WaitTaskId   string `dynamodbav:"waitTaskId,omitempty"`
+	WaitingSince string `dynamodbav:"waitingSince,omitempty"`
+	WaitToken    string `dynamodbav:"waitToken,omitempty"` // Claimed by whoever resumes a run parked in the waits table
+}
+
+// processExecution runs one delivery of an execution and returns how long to
+// hold the message back before it is delivered again, 0 once it is handled
+func (j *JMRService) processExecution(messageBody string) time.Duration {
+	var execution ExecutionMessage
+	if err := json.Unmarshal([]byte(messageBody), &execution); err != nil {
+		log.Printf("Error unmarshaling execution message: %v", err)
+		return 0
+	}
+	execution.raw = messageBody
+
+	// A parked run resumes from its record; a run that already ended, or that
+	// still awaits its approval, was delivered twice
+	prior, err := j.priorRun(execution)
+	if err != nil {
+		log.Printf("Error loading run record of %s: %v", execution.ExecutionUuid, err)
+		return retryInterval
+	}
+	if prior != nil {
+		switch {
+		case prior.Status == "succeeded" || prior.Status == "failed":
+			log.Printf("Runner %s skipped execution %s, which already ended %s", j.runnerID, execution.ExecutionUuid, prior.Status)
+			return 0
+		case prior.Status == StatusAwaitingApproval && execution.Approval == nil:
+			log.Printf("Runner %s skipped execution %s, which still awaits approval", j.runnerID, execution.ExecutionUuid)
+			return 0
+		case prior.Status == StatusWaiting:
+			stopped, err := j.stoppedInJMI(execution)
+			if err != nil {
+				log.Printf("Error checking stop of %s: %v", execution.ExecutionUuid, err)
+				return retryInterval
+			}
+			if stopped {
+				log.Printf("Runner %s dropped parked execution %s, which was stopped", j.runnerID, execution.ExecutionUuid)
+				j.releaseParkedLeases(execution, prior)
+				return 0
+			}
+		}
+	}
+
+	log.Printf("Runner %s running execution %s (%s)", j.runnerID, execution.ExecutionName, execution.ExecutionUuid)
+
+	results, status, wait := j.runExecution(execution, prior)
+
+	now := time.Now()
+	record := RunRecord{
+		ExecutionName:  fmt.Sprintf("%s#%s#v%d#%s", execution.ExecutionName, execution.ExecutionUuid, 3, "jmr-run"),
+		OriginalName:   execution.ExecutionName,
+		ExecutionUuid:  execution.ExecutionUuid,
+		Status:         status,
+		CreatedAt:      execution.CreatedAt,
+		UpdatedAt:      now.Format(time.RFC3339),
+		Version:        3,
+		Stage:          "jmr-run",
+		ProcessedBy:    "JMR",
+		RunnerID:       j.runnerID,
+		Timestamp:      now.Unix(),
+		AccountId:      execution.AccountId,
+		RoutineVersion: execution.RoutineVersion,
+		Tasks:          results,
+	}
+	if wait != nil {
+		record.Reason = wait.reason
+		record.WaitStepId = wait.stepId
+		record.WaitTaskId = wait.taskId
+		record.WaitingSince = wait.since.Format(time.RFC3339)
+		if len(wait.waitKeys) > 0 {
+			record.WaitToken = fmt.Sprintf("%s-%d", j.runnerID, now.UnixNano())
+		}
+	}
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		log.Printf("Error marshaling run record: %v", err)
+		return 0
+	}
+
+	_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(j.tableName),
+		Item:      item,
+	})
+
+	if err != nil {
+		// The run resumes from the last record stored once the message is back
+		log.Printf("Error storing run record in DynamoDB: %v", err)
+		return retryInterval
+	}
+
+	// A paused or parked execution keeps its slot and locks until it resumes
+	if status == StatusAwaitingApproval {
+		log.Printf("Runner %s paused execution %s for approval", j.runnerID, execution.ExecutionUuid)
+		return 0
+	}
+	if status == StatusWaiting {
+		if len(wait.waitKeys) > 0 {
+			return j.parkExecution(execution, record.WaitToken, wait)
+		}
+		log.Printf("Runner %s parked execution %s: %s", j.runnerID, execution.ExecutionUuid, wait.reason)
+		return wait.retryAfter
+	}
+
+	// The run is over, give the tenant's and the routine's concurrency slot and
+	// the control resources back
+	if execution.AccountId != "" {
+		j.releaseExecutionSlot(execution.AccountId, execution.ExecutionName, execution.ExecutionUuid)
+	}
+	j.releaseControlLocks(execution.ExecutionUuid)
+
+	// A parent parked on this execution takes on its outcome now
+	if execution.Parent != nil {
+		j.wakeWaiters(execution.AccountId, childWaitKey(execution.ExecutionUuid, ""))
+	}
+
+	// Forward to Scheduler Plugin queue in the job shape it expects
+	jobJSON, err := json.Marshal(map[string]interface{}{
+		"id":         execution.ExecutionUuid,
+		"job_name":   execution.ExecutionName,
+		"status":     status,
+		"account_id": execution.AccountId,
+		"runner_id":  j.runnerID,
+	})
+	if err != nil {
+		log.Printf("Error marshaling execution for SP: %v", err)
+		return 0
+	}
+
+	_, err = j.sqsClient.SendMessage(context.TODO(), &sqs.SendMessageInput{
+		QueueUrl:    aws.String(j.outQueueURL),
+		MessageBody: aws.String(string(jobJSON)),
+	})
+
+	if err != nil {
+		log.Printf("Error sending message to SP queue: %v", err)
+		return 0
+	}
+
+	log.Printf("Runner %s finished execution %s with status %s and forwarded to Scheduler Plugin", j.runnerID, execution.ExecutionUuid, status)
+	return 0
+}
+
+// runExecution simulates every task of the snapshotted definition, honouring a
+// retake and the conditions each step waits for and sets when it ends. A task
+// whose parameters set simulateFailure fails the run. Steps run while nothing
+// failed unless their runIf or when says otherwise; a failure stays the run's
+// status even when a failure-handling step then succeeds. An approval step
+// pauses the run; JMI sends it back with the decision and it resumes from there.
+// A task whose resource pools are full parks the run instead of blocking the
+// runner; the run resumes from its record when the message comes back.
+// A routine task starts another routine through JMI and waits for its outcome.
+func (j *JMRService) runExecution(execution ExecutionMessage, prior *RunRecord) ([]TaskResult, string, *runWait) {
+	if execution.Definition == nil {
+		return nil, "succeeded", nil
+	}
+
+	excluded := make(map[string]bool)
+	started := execution.Retake == nil
+	if execution.Retake != nil {
+		for _, taskId := range execution.Retake.ExcludingTasks {
+			excluded[taskId] = true
+		}
+	}
+
+	// Tasks that ended before the run paused or parked keep their results
+	done := endedTasks(prior)
+
+	var results []TaskResult
+	status := "succeeded"
+	stepStatuses := make(map[string]string)
+	for _, step := range execution.Definition.SchedulerRoutine.Steps {
+		if !started && step.StepId == execution.Retake.FromStepId {
+			started = true
+		}
+
+		if stepResults, ended := endedResults(done, step); ended {
+			stepStatuses[step.StepId] = stepOutcome(stepResults)
+			if stepStatuses[step.StepId] == "failed" {
+				status = "failed"
+			}
+			results = append(results, stepResults...)
+			continue
+		}
+
+		// Conditional steps are recorded as skipped with the reason
+		if started {
+			run, reason := shouldRunStep(step, status, execution.Parameters, stepStatuses, results)
+			if !run {
+				for _, taskId := range stepTaskIds(step) {
+					results = append(results, TaskResult{StepId: step.StepId, TaskId: taskId, Status: reason.status, Log: reason.log})
+				}
+				stepStatuses[step.StepId] = reason.status
+				if reason.status == "failed" {
+					status = "failed"
+					j.applyConditionActions(execution, step.StepId, step.OnFailure)
+				}
+				continue
+			}
+		}
+
+		if step.Type == StepApproval {
+			result := TaskResult{StepId: step.StepId, TaskId: step.StepId}
+			switch {
+			case !started:
+				result.Status = "skipped"
+			case execution.Approval != nil && execution.Approval.StepId == step.StepId:
+				result = approvalResult(step, execution.Approval)
+			default:
+				if err := j.requestApproval(execution, step); err != nil {
+					result.Status = "failed"
+					result.Log = fmt.Sprintf("Step %s could not request approval: %v", step.StepId, err)
+					break
+				}
+				log.Printf("Runner %s: execution %s awaits approval of step %s", j.runnerID, execution.ExecutionUuid, step.StepId)
+				result.Status = StatusAwaitingApproval
+				result.Log = "Waiting for approval"
+				return append(results, result), StatusAwaitingApproval, nil
+			}
+			if result.Status == "failed" {
+				status = "failed"
+				j.applyConditionActions(execution, step.StepId, step.OnFailure)
+			} else if result.Status == "succeeded" {
+				j.applyConditionActions(execution, step.StepId, step.OnSuccess)
+			}
+			stepStatuses[step.StepId] = result.Status
+			results = append(results, result)
+			continue
+		}
+
+		// The step runs once the conditions it waits for are set; a step
+		// resumed after some of its tasks ended already got past them
+		var conditionErr error
+		if started && !stepBegun(done, step) {
+			var wait *runWait
+			if wait, conditionErr = j.checkConditions(execution, step.StepId, step.WaitForConditions, prior); wait != nil {
+				for _, task := range step.Tasks {
+					results = append(results, TaskResult{StepId: step.StepId, TaskId: task.TaskId, Status: StatusWaiting, Log: wait.reason})
+				}
+				return results, StatusWaiting, wait
+			}
+		}
+
+		stepStatus := ""
+		for _, task := range step.Tasks {
+			result := TaskResult{StepId: step.StepId, TaskId: task.TaskId}
+			previous, ended := done[step.StepId+"#"+task.TaskId]
+			switch {
+			case ended:
+				result = previous
+				if result.Status == "failed" {
+					status = "failed"
+				}
+			case !started || excluded[task.TaskId]:
+				result.Status = "skipped"
+			case stepStatus == "failed":
+				result.Status = "skipped"
+				result.Log = "Skipped after an earlier failure"
+			case conditionErr != nil:
+				result.Status = "failed"
+				result.Log = fmt.Sprintf("Step %s did not start: %v", step.StepId, conditionErr)
+				status = "failed"
+			default:
+				// Hold the task's share of its resource pools while it runs; a
+				// routine task parked on its child kept them
+				var leases []resourceLease
+				if task.Type == TaskRoutine && parkedChild(prior, step.StepId, task.TaskId) != "" {
+					leases = j.taskLeases(execution, task.TaskId, mergeClaims(task.Resources), time.Now())
+				} else {
+					var wait *runWait
+					var err error
+					leases, wait, err = j.acquireResources(execution, step.StepId, task.TaskId, task.Resources, prior)
+					if err != nil {
+						result.Status = "failed"
+						result.Log = fmt.Sprintf("Task %s could not lease its resources: %v", task.TaskId, err)
+						status = "failed"
+						break
+					}
+					if wait != nil {
+						result.Status = StatusWaiting
+						result.Log = wait.reason
+						return append(results, result), StatusWaiting, wait
+					}
+				}
+
+				if task.Type == TaskRoutine {
+					// A routine task takes on the outcome of the routine it starts
+					var wait *runWait
+					result, wait = j.runSubroutine(execution, step.StepId, task, prior)
+					if wait != nil {
+						if result.ChildExecutionUuid == "" {
+							j.releaseResources(leases)
+						}
+						return append(results, result), StatusWaiting, wait
+					}
+					if result.Status == "failed" {
+						status = "failed"
+					}
+					j.releaseResources(leases)
+					break
+				}
+
+				time.Sleep(100 * time.Millisecond)
+				parameters := mergeParameters(execution.Parameters, task.Parameters)
+				if failure, _ := parameters["simulateFailure"].(bool); failure {
+					result.Status = "failed"
+					result.Log = fmt.Sprintf("Task %s failed on runtime %s", task.TaskId, task.RuntimeName)
+					status = "failed"
+				} else {
+					result.Status = "succeeded"
+					result.Log = fmt.Sprintf("Task %s executed on runtime %s", task.TaskId, task.RuntimeName)
+				}
+				j.releaseResources(leases)
+			}
+			if result.Status == "failed" || (result.Status == "succeeded" && stepStatus == "") {
+				stepStatus = result.Status
+			}
+			results = append(results, result)
+		}
+
+		stepStatuses[step.StepId] = stepStatus
+		if stepStatus == "" {
+			stepStatuses[step.StepId] = "skipped"
+		}
+
+		// Skipped steps neither add nor delete conditions
+		switch stepStatus {
+		case "succeeded":
+			j.applyConditionActions(execution, step.StepId, step.OnSuccess)
+		case "failed":
+			j.applyConditionActions(execution, step.StepId, step.OnFailure)
+		}
+	}
+
+	return results, status, nil
+}
+
+func (j *JMRService) tenantUsageTableName() string {
+	if j.tenantUsageTable == "" {
+		return "tenant_usage"
+	}
+	return j.tenantUsageTable
+}
+
+func (j *JMRService) executionSlotTableName() string {
+	if j.executionSlotTable == "" {
+		return "execution_slots"
+	}
+	return j.executionSlotTable
+}
+
+func (j *JMRService) routineConcurrencyTableName() string {
+	if j.routineConcurrencyTable == "" {
+		return "routine_concurrency"
+	}
+	return j.routineConcurrencyTable
+}
+
+// releaseExecutionSlot gives the tenant's and the routine's slot back. It
+// mirrors JMI: deleting the slot record is conditional, so a stop that
+// already released it makes this a no-op.
+func (j *JMRService) releaseExecutionSlot(accountId, routineName, executionUuid string) {
+	now := time.Now().Format(time.RFC3339)
+	release := func(slotCondition string, routineCounted bool) error {
+		items := []types.TransactWriteItem{
+			{Delete: &types.Delete{
+				TableName: aws.String(j.executionSlotTableName()),
+				Key: map[string]types.AttributeValue{
+					"executionUuid": &types.AttributeValueMemberS{Value: executionUuid},
+				},
+				ConditionExpression: aws.String(slotCondition),
+			}},
+			{Update: &types.Update{
+				TableName: aws.String(j.tenantUsageTableName()),
+				Key: map[string]types.AttributeValue{
+					"accountId": &types.AttributeValueMemberS{Value: accountId},
+				},
+				UpdateExpression:    aws.String("SET runningExecutions = runningExecutions - :one, updatedAt = :now"),
+				ConditionExpression: aws.String("runningExecutions > :zero"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":zero": &types.AttributeValueMemberN{Value: "0"},
+					":one":  &types.AttributeValueMemberN{Value: "1"},
+					":now":  &types.AttributeValueMemberS{Value: now},
+				},
+			}},
+		}
+		if routineCounted {
+			items[0].Delete.ExpressionAttributeValues = map[string]types.AttributeValue{
+				":routineName": &types.AttributeValueMemberS{Value: routineName},
+			}
+			items = append(items, types.TransactWriteItem{Update: &types.Update{
+				TableName: aws.String(j.routineConcurrencyTableName()),
+				Key: map[string]types.AttributeValue{
+					"routineName": &types.AttributeValueMemberS{Value: routineName},
+				},
+				UpdateExpression:    aws.String("SET runningExecutions = runningExecutions - :one"),
+				ConditionExpression: aws.String("runningExecutions > :zero"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":zero": &types.AttributeValueMemberN{Value: "0"},
+					":one":  &types.AttributeValueMemberN{Value: "1"},
+				},
+			}})
+		}
+		_, err := j.dynamoClient.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{TransactItems: items})
+		return err
+	}
+
+	err := release("routineName = :routineName", true)
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		// Slots taken before routines were counted carry no routineName
+		err = release("attribute_exists(executionUuid) AND attribute_not_exists(routineName)", false)
+	}
+	if err != nil {
+		if errors.As(err, &canceled) {
+			log.Printf("DEBUG: Execution slot %s already released", executionUuid)
+			return
+		}
+		log.Printf("ERROR: Failed to release execution slot %s: %v", executionUuid, err)
+	}
+}
+
+// Step runIf values; a step without one runs only while nothing has failed
+const (
+	RunIfSuccess = "success"
+	RunIfFailure = "failure"
+	RunIfAlways  = "always"
+)
+
+// stepSkip is why a conditional step did not run. A when expression that
+// cannot be evaluated fails the step rather than skipping it silently.
+type stepSkip struct {
+	status string
+	log    string
+}
+
+// shouldRunStep applies the step's runIf to the run so far, then its when
+// expression to the run's parameters (params), the status of earlier steps
+// (steps.<stepId>.status) and tasks (tasks.<taskId>.status) and the run's
+// own status (status)
+func shouldRunStep(step Step, status string, parameters map[string]interface{}, stepStatuses map[string]string, results []TaskResult) (bool, stepSkip) {
+	switch step.RunIf {
+	case RunIfAlways:
+	case RunIfFailure:
+		if status != "failed" {
+			return false, stepSkip{"skipped", "Skipped: runs only after a failure"}
+		}
+	default:
+		if status == "failed" {
+			return false, stepSkip{"skipped", "Skipped after an earlier failure"}
+		}
+	}
+	if step.When == "" {
+		return true, stepSkip{}
+	}
+
+	steps := make(map[string]interface{}, len(stepStatuses))
+	for stepId, stepStatus := range stepStatuses {
+		steps[stepId] = map[string]interface{}{"status": stepStatus}
+	}
+	tasks := make(map[string]interface{}, len(results))
+	for _, result := range results {
+		tasks[result.TaskId] = map[string]interface{}{"status": result.Status}
+	}
+	scope := map[string]interface{}{
+		"params": parameters,
+		"steps":  steps,
+		"tasks":  tasks,
+		"status": status,
+	}
+
+	holds, err := evaluateWhen(step.When, scope)
+	if err != nil {
+		return false, stepSkip{"failed", fmt.Sprintf("Step %s could not evaluate when %q: %v", step.StepId, step.When, err)}
+	}
+	if !holds {
+		return false, stepSkip{"skipped", fmt.Sprintf("Skipped: when %q is false", step.When)}
+	}
+	return true, stepSkip{}
+}
+
+// stepOutcome folds a step's task results into the step's status
+func stepOutcome(results []TaskResult) string {
+	outcome := "skipped"
+	for _, result := range results {
+		switch result.Status {
+		case "failed":
+			return "failed"
+		case "succeeded":
+			outcome = "succeeded"
+		}
+	}
+	return outcome
+}
+
+// mergeParameters overlays the task's parameters on the run's
+func mergeParameters(run, task map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(run)+len(task))
+	for key, value := range run {
+		merged[key] = value
+	}
+	for key, value := range task {
+		merged[key] = value
+	}
+	return merged
+}
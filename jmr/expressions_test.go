@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestEvaluateWhen(t *testing.T) {
+	scope := map[string]interface{}{
+		"params": map[string]interface{}{
+			"env":       "prod",
+			"threshold": float64(10),
+			"dryRun":    false,
+		},
+		"steps": map[string]interface{}{
+			"prepare":   map[string]interface{}{"status": "succeeded"},
+			"load-data": map[string]interface{}{"status": "failed"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		source  string
+		want    bool
+		wantErr bool
+	}{
+		{"parameter matches", `params.env == "prod"`, true, false},
+		{"parameter differs", `params.env == "dev"`, false, false},
+		{"earlier step succeeded", `steps.prepare.status == "succeeded"`, true, false},
+		{"dashed step id", `steps.load-data.status != "failed"`, false, false},
+		{"missing parameter is false", `params.region`, false, false},
+		{"missing parameter is null", `params.region == null`, true, false},
+		{"numeric threshold", `params.threshold >= 10 && params.threshold < 11`, true, false},
+		{"negated flag", `!params.dryRun`, true, false},
+		{"or with grouping", `(params.env == "dev" || params.env == "prod") && !params.dryRun`, true, false},
+		{"string result is truthy", `params.env`, true, false},
+		{"comparing string to number fails", `params.env > 1`, false, true},
+		{"syntax error fails", `params.env ==`, false, true},
+		{"unterminated string fails", `params.env == 'prod`, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evaluateWhen(tt.source, scope)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("evaluateWhen(%q) error = %v, wantErr %v", tt.source, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("evaluateWhen(%q) = %v, want %v", tt.source, got, tt.want)
+			}
+		})
+	}
+}
@@ -43,6 +43,21 @@ type JMRService struct {
 	outQueueURL   string
 	receiveCtx    context.Context
 	receiveCancel context.CancelFunc
+
+	tenantUsageTable        string
+	executionSlotTable      string
+	routineConcurrencyTable string
+	resourcePoolTable       string
+	resourceLeaseTable      string
+	controlResourceTable    string
+	conditionTable          string
+	approvalTable           string
+	waitTable               string
+
+	// JMI starts the routines that routine tasks run
+	jmiURL    string
+	jmiAPIKey string
+	jmiClient *http.Client
 }
 
 func NewJMRService() *JMRService {
@@ -72,6 +87,11 @@ func NewJMRService() *JMRService {
 		log.Fatalf("Unable to load SDK config: %v", err)
 	}
 
+	jmiURL := os.Getenv("JMI_URL")
+	if jmiURL == "" {
+		jmiURL = "http://jmi:8080"
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	service := &JMRService{
@@ -84,6 +104,20 @@ func NewJMRService() *JMRService {
 		outQueueURL:   os.Getenv("SP_QUEUE_URL"),
 		receiveCtx:    ctx,
 		receiveCancel: cancel,
+
+		tenantUsageTable:        os.Getenv("TENANT_USAGE_TABLE"),
+		executionSlotTable:      os.Getenv("EXECUTION_SLOT_TABLE"),
+		routineConcurrencyTable: os.Getenv("ROUTINE_CONCURRENCY_TABLE"),
+		resourcePoolTable:       os.Getenv("RESOURCE_POOL_TABLE"),
+		resourceLeaseTable:      os.Getenv("RESOURCE_LEASE_TABLE"),
+		controlResourceTable:    os.Getenv("CONTROL_RESOURCE_TABLE"),
+		conditionTable:          os.Getenv("CONDITION_TABLE"),
+		approvalTable:           os.Getenv("APPROVAL_TABLE"),
+		waitTable:               os.Getenv("WAIT_TABLE"),
+
+		jmiURL:    jmiURL,
+		jmiAPIKey: os.Getenv("JMI_API_KEY"),
+		jmiClient: &http.Client{Timeout: 10 * time.Second},
 	}
 
 	// Start message receiver
@@ -113,8 +147,18 @@ func (j *JMRService) startMessageReceiver() {
 			}
 
 			for _, message := range result.Messages {
-				// Process the message
-				j.processMessage(*message.Body)
+				// A parked run goes back to the queue instead of holding up the runner
+				if wait := j.processMessage(*message.Body); wait > 0 {
+					_, err := j.sqsClient.ChangeMessageVisibility(context.TODO(), &sqs.ChangeMessageVisibilityInput{
+						QueueUrl:          aws.String(j.inQueueURL),
+						ReceiptHandle:     message.ReceiptHandle,
+						VisibilityTimeout: int32(wait.Seconds()),
+					})
+					if err != nil {
+						log.Printf("Error delaying message: %v", err)
+					}
+					continue
+				}
 
 				// Delete the message from the queue
 				_, err := j.sqsClient.DeleteMessage(context.TODO(), &sqs.DeleteMessageInput{
@@ -130,11 +174,21 @@ func (j *JMRService) startMessageReceiver() {
 	}
 }
 
-func (j *JMRService) processMessage(messageBody string) {
+// processMessage handles one message and returns how long to hold it back
+// before it is delivered again, 0 once it can be deleted
+func (j *JMRService) processMessage(messageBody string) time.Duration {
+	// Executions from JMW carry executionName; anything else is a legacy job
+	var probe map[string]interface{}
+	if err := json.Unmarshal([]byte(messageBody), &probe); err == nil {
+		if _, isExecution := probe["executionName"]; isExecution {
+			return j.processExecution(messageBody)
+		}
+	}
+
 	var job Job
 	if err := json.Unmarshal([]byte(messageBody), &job); err != nil {
 		log.Printf("Error unmarshaling message: %v", err)
-		return
+		return 0
 	}
 
 	log.Printf("Runner %s executing job %s", j.runnerID, job.ID)
@@ -152,7 +206,7 @@ func (j *JMRService) processMessage(messageBody string) {
 	item, err := attributevalue.MarshalMap(job)
 	if err != nil {
 		log.Printf("Error marshaling job: %v", err)
-		return
+		return 0
 	}
 
 	_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
@@ -162,7 +216,7 @@ func (j *JMRService) processMessage(messageBody string) {
 
 	if err != nil {
 		log.Printf("Error updating job in DynamoDB: %v", err)
-		return
+		return 0
 	}
 
 	// Add to local cache
@@ -172,7 +226,7 @@ func (j *JMRService) processMessage(messageBody string) {
 	jobJSON, err := json.Marshal(job)
 	if err != nil {
 		log.Printf("Error marshaling job for SP: %v", err)
-		return
+		return 0
 	}
 
 	_, err = j.sqsClient.SendMessage(context.TODO(), &sqs.SendMessageInput{
@@ -182,10 +236,11 @@ func (j *JMRService) processMessage(messageBody string) {
 
 	if err != nil {
 		log.Printf("Error sending message to SP queue: %v", err)
-		return
+		return 0
 	}
 
 	log.Printf("Runner %s completed execution of job %s and forwarded to Scheduler Plugin", j.runnerID, job.ID)
+	return 0
 }
 
 func (j *JMRService) executeJob(job Job) string {
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Lease states, as shown by JMI's /resource-pools/:name
+const (
+	LeaseHeld    = "held"
+	LeaseWaiting = "waiting"
+)
+
+// ResourceClaim is how much of a named resource pool a task holds while it runs
+type ResourceClaim struct {
+	Pool     string `json:"pool"`
+	Quantity int    `json:"quantity,omitempty"`
+}
+
+// resourcePool is the part of a pool the runner needs to lease from it
+type resourcePool struct {
+	Capacity int `dynamodbav:"capacity"`
+	InUse    int `dynamodbav:"inUse"`
+}
+
+// resourceLease is a task holding, or waiting for, capacity of a pool.
+// Waiters carry expiresAt, the table's TTL attribute, so a crashed runner's
+// wait disappears on its own; held leases carry leaseExpiresAt instead, since
+// their capacity must be given back to the pool when they are reaped.
+type resourceLease struct {
+	PoolKey        string `dynamodbav:"poolKey"`
+	LeaseId        string `dynamodbav:"leaseId"`
+	AccountId      string `dynamodbav:"accountId"`
+	PoolName       string `dynamodbav:"poolName"`
+	State          string `dynamodbav:"state"`
+	Quantity       int    `dynamodbav:"quantity"`
+	ExecutionName  string `dynamodbav:"executionName"`
+	ExecutionUuid  string `dynamodbav:"executionUuid"`
+	TaskId         string `dynamodbav:"taskId"`
+	RunnerID       string `dynamodbav:"runnerID"`
+	Since          string `dynamodbav:"since"`
+	ExpiresAt      int64  `dynamodbav:"expiresAt,omitempty"`
+	LeaseExpiresAt int64  `dynamodbav:"leaseExpiresAt,omitempty"`
+}
+
+func (j *JMRService) resourcePoolTableName() string {
+	if j.resourcePoolTable == "" {
+		return "resource_pools"
+	}
+	return j.resourcePoolTable
+}
+
+func (j *JMRService) resourceLeaseTableName() string {
+	if j.resourceLeaseTable == "" {
+		return "resource_leases"
+	}
+	return j.resourceLeaseTable
+}
+
+// resourceSettings reads RESOURCE_WAIT_TIMEOUT, the seconds a task waits for
+// its pools before failing (default 300), RESOURCE_POLL_INTERVAL, the seconds
+// before a parked run tries again (default 2), and RESOURCE_LEASE_TTL, the
+// seconds after which a held lease is taken as abandoned by a crashed runner
+// (default 3600)
+func resourceSettings() (wait, poll, ttl time.Duration) {
+	number := func(name string, fallback int) time.Duration {
+		if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+			return time.Duration(value) * time.Second
+		}
+		return time.Duration(fallback) * time.Second
+	}
+	return number("RESOURCE_WAIT_TIMEOUT", 300), number("RESOURCE_POLL_INTERVAL", 2), number("RESOURCE_LEASE_TTL", 3600)
+}
+
+// mergeClaims adds up the claims on each pool, since one transaction cannot
+// update the same pool twice
+func mergeClaims(claims []ResourceClaim) []ResourceClaim {
+	quantities := make(map[string]int)
+	for _, claim := range claims {
+		if claim.Quantity < 1 {
+			claim.Quantity = 1
+		}
+		quantities[claim.Pool] += claim.Quantity
+	}
+
+	merged := make([]ResourceClaim, 0, len(quantities))
+	for pool, quantity := range quantities {
+		merged = append(merged, ResourceClaim{Pool: pool, Quantity: quantity})
+	}
+	sort.Slice(merged, func(a, b int) bool {
+		return merged[a].Pool < merged[b].Pool
+	})
+	return merged
+}
+
+// acquireResources leases every pool the task claims, all at once so two tasks
+// needing the same pools never hold part of them each. While a pool is full
+// the task is listed as a waiter and the run parks instead of holding up the
+// runner: the message comes back after RESOURCE_POLL_INTERVAL and tries again,
+// until RESOURCE_WAIT_TIMEOUT after the first attempt.
+func (j *JMRService) acquireResources(execution ExecutionMessage, stepId, taskId string, claims []ResourceClaim, prior *RunRecord) ([]resourceLease, *runWait, error) {
+	claims = mergeClaims(claims)
+	if len(claims) == 0 {
+		return nil, nil, nil
+	}
+
+	waitTimeout, pollInterval, leaseTTL := resourceSettings()
+	since := waitSince(prior, stepId, taskId)
+	deadline := since.Add(waitTimeout)
+	leases := j.taskLeases(execution, taskId, claims, since)
+
+	busy, err := j.tryAcquireResources(leases, leaseTTL)
+	if err != nil {
+		j.removeWaiters(leases)
+		return nil, nil, err
+	}
+	if busy == "" {
+		log.Printf("Runner %s leased %v for task %s of %s", j.runnerID, claims, taskId, execution.ExecutionUuid)
+		return leases, nil, nil
+	}
+
+	j.reapExpiredLeases(execution.AccountId + "#" + busy)
+	if time.Now().Add(pollInterval).After(deadline) {
+		j.removeWaiters(leases)
+		return nil, nil, fmt.Errorf("timed out after %s waiting for resource pool %s", waitTimeout, busy)
+	}
+
+	log.Printf("Runner %s: task %s of %s waits for resource pool %s", j.runnerID, taskId, execution.ExecutionUuid, busy)
+	j.registerWaiters(leases, deadline)
+	return nil, &runWait{
+		stepId:     stepId,
+		taskId:     taskId,
+		reason:     fmt.Sprintf("Waiting for resource pool %s", busy),
+		since:      since,
+		retryAfter: pollInterval,
+	}, nil
+}
+
+// taskLeases builds the leases a task takes on the pools it claims
+func (j *JMRService) taskLeases(execution ExecutionMessage, taskId string, claims []ResourceClaim, since time.Time) []resourceLease {
+	leases := make([]resourceLease, len(claims))
+	for i, claim := range claims {
+		leases[i] = resourceLease{
+			PoolKey:       execution.AccountId + "#" + claim.Pool,
+			LeaseId:       execution.ExecutionUuid + "#" + taskId,
+			AccountId:     execution.AccountId,
+			PoolName:      claim.Pool,
+			Quantity:      claim.Quantity,
+			ExecutionName: execution.ExecutionName,
+			ExecutionUuid: execution.ExecutionUuid,
+			TaskId:        taskId,
+			RunnerID:      j.runnerID,
+			Since:         since.UTC().Format(time.RFC3339Nano),
+		}
+	}
+	return leases
+}
+
+// releaseParkedLeases gives back the leases routine tasks kept while the run
+// was parked on their children
+func (j *JMRService) releaseParkedLeases(execution ExecutionMessage, prior *RunRecord) {
+	if execution.Definition == nil {
+		return
+	}
+	for _, step := range execution.Definition.SchedulerRoutine.Steps {
+		for _, task := range step.Tasks {
+			if task.Type == TaskRoutine && parkedChild(prior, step.StepId, task.TaskId) != "" {
+				j.releaseResources(j.taskLeases(execution, task.TaskId, mergeClaims(task.Resources), time.Now()))
+			}
+		}
+	}
+}
+
+// tryAcquireResources makes one attempt at leasing every pool and returns the
+// name of a pool without room for the task, or "" once all are leased. Each
+// pool's counter only moves if its capacity is still the one read, so a
+// capacity change between the read and the write just means another attempt.
+func (j *JMRService) tryAcquireResources(leases []resourceLease, leaseTTL time.Duration) (string, error) {
+	now := time.Now()
+	var items []types.TransactWriteItem
+	for i := range leases {
+		lease := &leases[i]
+		pool, err := j.getResourcePool(lease.AccountId, lease.PoolName)
+		if err != nil {
+			return "", err
+		}
+		if lease.Quantity > pool.Capacity && pool.Capacity > 0 {
+			return "", fmt.Errorf("task needs %d of resource pool %s, whose capacity is %d", lease.Quantity, lease.PoolName, pool.Capacity)
+		}
+		if pool.InUse+lease.Quantity > pool.Capacity {
+			return lease.PoolName, nil
+		}
+
+		items = append(items, types.TransactWriteItem{Update: &types.Update{
+			TableName: aws.String(j.resourcePoolTableName()),
+			Key: map[string]types.AttributeValue{
+				"accountId": &types.AttributeValueMemberS{Value: lease.AccountId},
+				"poolName":  &types.AttributeValueMemberS{Value: lease.PoolName},
+			},
+			UpdateExpression:    aws.String("SET inUse = inUse + :quantity"),
+			ConditionExpression: aws.String("capacity = :capacity AND inUse <= :max"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":quantity": &types.AttributeValueMemberN{Value: strconv.Itoa(lease.Quantity)},
+				":capacity": &types.AttributeValueMemberN{Value: strconv.Itoa(pool.Capacity)},
+				":max":      &types.AttributeValueMemberN{Value: strconv.Itoa(pool.Capacity - lease.Quantity)},
+			},
+		}})
+
+		held := *lease
+		held.State = LeaseHeld
+		held.ExpiresAt = 0
+		held.LeaseExpiresAt = now.Add(leaseTTL).Unix()
+		item, err := attributevalue.MarshalMap(held)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, types.TransactWriteItem{Put: &types.Put{
+			TableName:                aws.String(j.resourceLeaseTableName()),
+			Item:                     item,
+			ConditionExpression:      aws.String("attribute_not_exists(leaseId) OR #state = :waiting"),
+			ExpressionAttributeNames: map[string]string{"#state": "state"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":waiting": &types.AttributeValueMemberS{Value: LeaseWaiting},
+			},
+		}})
+	}
+
+	_, err := j.dynamoClient.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		for i, reason := range canceled.CancellationReasons {
+			if aws.ToString(reason.Code) != "ConditionalCheckFailed" {
+				continue
+			}
+			if i%2 == 1 {
+				// A redelivered message is running the same task elsewhere
+				return "", fmt.Errorf("lease %s on resource pool %s is already held", leases[i/2].LeaseId, leases[i/2].PoolName)
+			}
+			return leases[i/2].PoolName, nil
+		}
+		// Conflicting with another runner's transaction; try again
+		return leases[0].PoolName, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	for i := range leases {
+		leases[i].State = LeaseHeld
+	}
+	return "", nil
+}
+
+func (j *JMRService) getResourcePool(accountId, poolName string) (*resourcePool, error) {
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(j.resourcePoolTableName()),
+		Key: map[string]types.AttributeValue{
+			"accountId": &types.AttributeValueMemberS{Value: accountId},
+			"poolName":  &types.AttributeValueMemberS{Value: poolName},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, fmt.Errorf("resource pool %s does not exist", poolName)
+	}
+
+	var pool resourcePool
+	if err := attributevalue.UnmarshalMap(result.Item, &pool); err != nil {
+		return nil, err
+	}
+	return &pool, nil
+}
+
+// registerWaiters lists the task as waiting on each of its pools
+func (j *JMRService) registerWaiters(leases []resourceLease, deadline time.Time) {
+	for _, lease := range leases {
+		lease.State = LeaseWaiting
+		lease.ExpiresAt = deadline.Add(time.Minute).Unix()
+		item, err := attributevalue.MarshalMap(lease)
+		if err == nil {
+			// A lease already held under this id is left alone
+			_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+				TableName:           aws.String(j.resourceLeaseTableName()),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(leaseId)"),
+			})
+		}
+		var conditionErr *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &conditionErr) {
+			log.Printf("Error registering waiter %s on resource pool %s: %v", lease.LeaseId, lease.PoolName, err)
+		}
+	}
+}
+
+// removeWaiters takes the task off the waiter lists it gave up on
+func (j *JMRService) removeWaiters(leases []resourceLease) {
+	for _, lease := range leases {
+		_, err := j.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+			TableName: aws.String(j.resourceLeaseTableName()),
+			Key: map[string]types.AttributeValue{
+				"poolKey": &types.AttributeValueMemberS{Value: lease.PoolKey},
+				"leaseId": &types.AttributeValueMemberS{Value: lease.LeaseId},
+			},
+			ConditionExpression: aws.String("#state = :waiting"),
+			ExpressionAttributeNames: map[string]string{
+				"#state": "state",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":waiting": &types.AttributeValueMemberS{Value: LeaseWaiting},
+			},
+		})
+		var conditionErr *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &conditionErr) {
+			log.Printf("Error removing waiter %s from resource pool %s: %v", lease.LeaseId, lease.PoolName, err)
+		}
+	}
+}
+
+// releaseResources gives the task's leases back to their pools
+func (j *JMRService) releaseResources(leases []resourceLease) {
+	for _, lease := range leases {
+		j.releaseLease(lease, "")
+	}
+}
+
+// releaseLease deletes a held lease and returns its capacity in one
+// transaction. With expiredBefore set, only a lease that expired by then is
+// released, so a reaper never takes capacity from a live holder.
+func (j *JMRService) releaseLease(lease resourceLease, expiredBefore string) {
+	leaseCondition := "#state = :held"
+	values := map[string]types.AttributeValue{
+		":held": &types.AttributeValueMemberS{Value: LeaseHeld},
+	}
+	if expiredBefore != "" {
+		leaseCondition += " AND leaseExpiresAt < :now"
+		values[":now"] = &types.AttributeValueMemberN{Value: expiredBefore}
+	}
+
+	_, err := j.dynamoClient.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Delete: &types.Delete{
+				TableName: aws.String(j.resourceLeaseTableName()),
+				Key: map[string]types.AttributeValue{
+					"poolKey": &types.AttributeValueMemberS{Value: lease.PoolKey},
+					"leaseId": &types.AttributeValueMemberS{Value: lease.LeaseId},
+				},
+				ConditionExpression:       aws.String(leaseCondition),
+				ExpressionAttributeNames:  map[string]string{"#state": "state"},
+				ExpressionAttributeValues: values,
+			}},
+			{Update: &types.Update{
+				TableName: aws.String(j.resourcePoolTableName()),
+				Key: map[string]types.AttributeValue{
+					"accountId": &types.AttributeValueMemberS{Value: lease.AccountId},
+					"poolName":  &types.AttributeValueMemberS{Value: lease.PoolName},
+				},
+				UpdateExpression:    aws.String("SET inUse = inUse - :quantity"),
+				ConditionExpression: aws.String("inUse >= :quantity"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":quantity": &types.AttributeValueMemberN{Value: strconv.Itoa(lease.Quantity)},
+				},
+			}},
+		},
+	})
+	if err != nil {
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			log.Printf("DEBUG: Lease %s on resource pool %s already released", lease.LeaseId, lease.PoolName)
+			return
+		}
+		log.Printf("ERROR: Failed to release lease %s on resource pool %s: %v", lease.LeaseId, lease.PoolName, err)
+		return
+	}
+	if expiredBefore != "" {
+		log.Printf("Runner %s reaped expired lease %s of runner %s on resource pool %s", j.runnerID, lease.LeaseId, lease.RunnerID, lease.PoolName)
+	}
+}
+
+// reapExpiredLeases releases the leases of a pool whose runner stopped
+// without giving them back
+func (j *JMRService) reapExpiredLeases(poolKey string) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.resourceLeaseTableName()),
+		KeyConditionExpression: aws.String("poolKey = :poolKey"),
+		FilterExpression:       aws.String("#state = :held AND leaseExpiresAt < :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#state": "state",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":poolKey": &types.AttributeValueMemberS{Value: poolKey},
+			":held":    &types.AttributeValueMemberS{Value: LeaseHeld},
+			":now":     &types.AttributeValueMemberN{Value: now},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error querying expired leases of %s: %v", poolKey, err)
+			return
+		}
+		var expired []resourceLease
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &expired); err != nil {
+			log.Printf("Error unmarshaling expired leases of %s: %v", poolKey, err)
+			return
+		}
+		for _, lease := range expired {
+			j.releaseLease(lease, now)
+		}
+	}
+}
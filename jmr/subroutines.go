@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TaskRoutine is the task type that starts another registered routine through
+// JMI and takes on its outcome
+const TaskRoutine = "routine"
+
+// SubRoutine is the routine a routine task starts
+type SubRoutine struct {
+	Name       string                 `json:"name"`
+	Version    int                    `json:"version,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// ParentExecution is set on an execution a routine task started
+type ParentExecution struct {
+	ExecutionUuid string `json:"executionUuid"`
+	ExecutionName string `json:"executionName,omitempty"`
+	TaskId        string `json:"taskId"`
+	Depth         int    `json:"depth,omitempty"`
+}
+
+// subroutineWaitTimeout reads SUBROUTINE_WAIT_TIMEOUT, the seconds a routine
+// task waits for its child before failing (default 86400)
+func subroutineWaitTimeout() time.Duration {
+	if value, err := strconv.Atoi(os.Getenv("SUBROUTINE_WAIT_TIMEOUT")); err == nil && value > 0 {
+		return time.Duration(value) * time.Second
+	}
+	return 86400 * time.Second
+}
+
+// childWaitKey lists a parent under the child execution it waits for
+func childWaitKey(childUuid, executionUuid string) string {
+	return "execution#" + childUuid + "#" + executionUuid
+}
+
+// parkedChild is the child a routine task started before the run parked on it
+func parkedChild(prior *RunRecord, stepId, taskId string) string {
+	if prior == nil {
+		return ""
+	}
+	for _, result := range prior.Tasks {
+		if result.StepId == stepId && result.TaskId == taskId && result.Status == StatusWaiting {
+			return result.ChildExecutionUuid
+		}
+	}
+	return ""
+}
+
+// mapSubroutineParameters builds the child's parameters: a value that is
+// exactly "${params.x}" takes the parent's parameter x as is, "${params.x}"
+// inside a longer string is replaced by its text, anything else is passed on
+func mapSubroutineParameters(mapping, parent map[string]interface{}) map[string]interface{} {
+	if len(mapping) == 0 {
+		return nil
+	}
+	mapped := make(map[string]interface{}, len(mapping))
+	for key, value := range mapping {
+		text, ok := value.(string)
+		if !ok {
+			mapped[key] = value
+			continue
+		}
+		if strings.HasPrefix(text, "${params.") && strings.HasSuffix(text, "}") && strings.Count(text, "${") == 1 {
+			mapped[key] = parent[strings.TrimSuffix(strings.TrimPrefix(text, "${params."), "}")]
+			continue
+		}
+		for {
+			start := strings.Index(text, "${params.")
+			if start < 0 {
+				break
+			}
+			end := strings.Index(text[start:], "}")
+			if end < 0 {
+				break
+			}
+			name := text[start+len("${params.") : start+end]
+			replacement := ""
+			if parentValue, ok := parent[name]; ok && parentValue != nil {
+				replacement = fmt.Sprint(parentValue)
+			}
+			text = text[:start] + replacement + text[start+end+1:]
+		}
+		mapped[key] = text
+	}
+	return mapped
+}
+
+// jmiRequest calls JMI on behalf of the execution's tenant
+func (j *JMRService) jmiRequest(execution ExecutionMessage, method, path string, body interface{}, idempotencyKey string) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %v", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(j.receiveCtx, method, j.jmiURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build JMI request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if j.jmiAPIKey != "" {
+		req.Header.Set("X-API-Key", j.jmiAPIKey)
+	}
+	// JMI_API_KEY is a service key, which acts for the tenant named here
+	req.Header.Set("X-Account-Id", execution.AccountId)
+	req.Header.Set("X-Subject", "execution:"+execution.ExecutionName)
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := j.jmiClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call JMI: %v", err)
+	}
+	return resp, nil
+}
+
+// startChildExecution starts the routine task's child and returns its UUID. A
+// redelivered message sends the same Idempotency-Key and gets the same child.
+// retry is true when JMI could not take it now.
+func (j *JMRService) startChildExecution(execution ExecutionMessage, stepId string, task Task) (string, bool, error) {
+	depth := 1
+	if execution.Parent != nil {
+		depth = execution.Parent.Depth + 1
+	}
+	body := map[string]interface{}{
+		"executionName": task.Routine.Name,
+		"parent": ParentExecution{
+			ExecutionUuid: execution.ExecutionUuid,
+			ExecutionName: execution.ExecutionName,
+			TaskId:        task.TaskId,
+			Depth:         depth,
+		},
+	}
+	if task.Routine.Version > 0 {
+		body["version"] = task.Routine.Version
+	}
+	if parameters := mapSubroutineParameters(task.Routine.Parameters, execution.Parameters); parameters != nil {
+		body["parameters"] = parameters
+	}
+
+	idempotencyKey := "subroutine:" + execution.ExecutionUuid + "#" + stepId + "#" + task.TaskId
+	resp, err := j.jmiRequest(execution, http.MethodPost, "/startExecution", body, idempotencyKey)
+	if err != nil {
+		return "", true, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ExecutionUuid string `json:"executionUuid"`
+		Error         string `json:"error"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&result)
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		return "", true, fmt.Errorf("JMI returned status %d", resp.StatusCode)
+	case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted:
+		if result.Error != "" {
+			return "", false, fmt.Errorf("JMI returned status %d: %s", resp.StatusCode, result.Error)
+		}
+		return "", false, fmt.Errorf("JMI returned status %d", resp.StatusCode)
+	case decodeErr != nil || result.ExecutionUuid == "":
+		return "", false, errors.New("JMI returned no executionUuid")
+	}
+	return result.ExecutionUuid, false, nil
+}
+
+// errChildNotFound is a child JMI no longer knows, such as a queued start
+// that was cancelled
+var errChildNotFound = errors.New("child execution not found")
+
+// childStatus reads the status of the child execution from JMI
+func (j *JMRService) childStatus(execution ExecutionMessage, executionUuid string) (string, error) {
+	resp, err := j.jmiRequest(execution, http.MethodGet, "/executions/"+executionUuid, nil, "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", errChildNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("JMI returned status %d", resp.StatusCode)
+	}
+	var result struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode JMI response: %v", err)
+	}
+	return result.Status, nil
+}
+
+// runSubroutine starts the task's routine, or picks up the child it started
+// before the run parked, and takes on the child's outcome once it ends. Until
+// then the run parks under the child, whose end sends it back; a start JMI
+// could not take now is retried by redelivering the message. After
+// SUBROUTINE_WAIT_TIMEOUT the task fails.
+func (j *JMRService) runSubroutine(execution ExecutionMessage, stepId string, task Task, prior *RunRecord) (TaskResult, *runWait) {
+	result := TaskResult{StepId: stepId, TaskId: task.TaskId, Status: "failed"}
+	if task.Routine == nil {
+		result.Log = fmt.Sprintf("Task %s names no routine", task.TaskId)
+		return result, nil
+	}
+
+	waitTimeout := subroutineWaitTimeout()
+	since := waitSince(prior, stepId, task.TaskId)
+	deadline := since.Add(waitTimeout)
+	expired := !time.Now().Before(deadline)
+	wait := &runWait{stepId: stepId, taskId: task.TaskId, since: since, deadline: deadline}
+
+	childUuid := parkedChild(prior, stepId, task.TaskId)
+	if childUuid == "" {
+		var retry bool
+		var err error
+		childUuid, retry, err = j.startChildExecution(execution, stepId, task)
+		if err != nil {
+			if !retry || expired {
+				result.Log = fmt.Sprintf("Task %s could not start routine %s: %v", task.TaskId, task.Routine.Name, err)
+				return result, nil
+			}
+			log.Printf("Runner %s: retrying start of routine %s for task %s of %s: %v", j.runnerID, task.Routine.Name, task.TaskId, execution.ExecutionUuid, err)
+			result.Status = StatusWaiting
+			result.Log = fmt.Sprintf("Retrying start of routine %s", task.Routine.Name)
+			wait.reason = result.Log
+			wait.retryAfter = retryInterval
+			return result, wait
+		}
+		log.Printf("Runner %s: task %s of %s started routine %s as %s", j.runnerID, task.TaskId, execution.ExecutionUuid, task.Routine.Name, childUuid)
+	}
+	result.ChildExecutionUuid = childUuid
+
+	status, err := j.childStatus(execution, childUuid)
+	if errors.Is(err, errChildNotFound) {
+		result.Log = fmt.Sprintf("Routine %s (%s) was cancelled", task.Routine.Name, childUuid)
+		return result, nil
+	}
+	if err != nil {
+		log.Printf("Error reading status of child %s of %s: %v", childUuid, execution.ExecutionUuid, err)
+	}
+	switch status {
+	case "succeeded":
+		result.Status = "succeeded"
+		result.Log = fmt.Sprintf("Routine %s (%s) succeeded", task.Routine.Name, childUuid)
+		return result, nil
+	case "failed", "stopped":
+		result.Log = fmt.Sprintf("Routine %s (%s) %s", task.Routine.Name, childUuid, status)
+		return result, nil
+	}
+	if expired {
+		result.Log = fmt.Sprintf("Gave up after %s waiting for routine %s (%s)", waitTimeout, task.Routine.Name, childUuid)
+		return result, nil
+	}
+
+	result.Status = StatusWaiting
+	result.Log = fmt.Sprintf("Waiting for routine %s (%s)", task.Routine.Name, childUuid)
+	wait.reason = result.Log
+	if err != nil {
+		// JMI could not be asked; look again once the message is back
+		wait.retryAfter = retryInterval
+		return result, wait
+	}
+	wait.waitKeys = []string{childWaitKey(childUuid, execution.ExecutionUuid)}
+	wait.ready = func() (bool, error) {
+		status, err := j.childStatus(execution, childUuid)
+		if errors.Is(err, errChildNotFound) {
+			return true, nil
+		}
+		return status == "succeeded" || status == "failed" || status == "stopped", err
+	}
+	return result, wait
+}
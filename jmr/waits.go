@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// StatusWaiting is the run status of an execution parked until what it waits
+// for is available; the runner moves on to other messages meanwhile
+const StatusWaiting = "waiting"
+
+// retryInterval is how soon a message the runner could not handle comes back
+const retryInterval = 10 * time.Second
+
+// runWait is where a parked run stopped and what it waits for. With
+// retryAfter set the message is redelivered after it and the run resumes
+// from the jmr-run record it left. With waitKeys set the message is let go and
+// the run is listed in the waits table until whoever ends the wait, or JMI at
+// the deadline, sends it back.
+type runWait struct {
+	stepId     string
+	taskId     string
+	reason     string
+	since      time.Time
+	retryAfter time.Duration
+
+	deadline time.Time
+	waitKeys []string
+	ready    func() (bool, error) // Checked again once the run is listed
+}
+
+// executionWait lists a parked run under one thing it waits for, with the
+// message that resumes it
+type executionWait struct {
+	AccountId     string `dynamodbav:"accountId"`
+	WaitKey       string `dynamodbav:"waitKey"` // condition#name#orderDate#uuid or execution#childUuid#uuid
+	ExecutionUuid string `dynamodbav:"executionUuid"`
+	ExecutionName string `dynamodbav:"executionName"`
+	StepId        string `dynamodbav:"stepId"`
+	TaskId        string `dynamodbav:"taskId,omitempty"`
+	Token         string `dynamodbav:"token"`
+	Message       string `dynamodbav:"message"`
+	CreatedAt     string `dynamodbav:"createdAt"`
+	Deadline      int64  `dynamodbav:"deadline"`
+	ExpiresAt     int64  `dynamodbav:"expiresAt"`
+}
+
+func (j *JMRService) waitTableName() string {
+	if j.waitTable == "" {
+		return "execution_waits"
+	}
+	return j.waitTable
+}
+
+// conditionWaitKey lists a run under a condition it waits for; **** waiters
+// are listed under that order date
+func conditionWaitKey(name, orderDate, executionUuid string) string {
+	return "condition#" + name + "#" + orderDate + "#" + executionUuid
+}
+
+// waitSince is when the run started waiting at this step and task, carried
+// over from the parked record so timeouts count from the first attempt
+func waitSince(prior *RunRecord, stepId, taskId string) time.Time {
+	if prior != nil && prior.Status == StatusWaiting && prior.WaitStepId == stepId && prior.WaitTaskId == taskId {
+		if since, err := time.Parse(time.RFC3339, prior.WaitingSince); err == nil {
+			return since
+		}
+	}
+	return time.Now()
+}
+
+// endedResults returns the results a step recorded on an earlier delivery
+// when every one of its tasks had ended, so a resumed run does not repeat it
+func endedResults(done map[string]TaskResult, step Step) ([]TaskResult, bool) {
+	if len(done) == 0 {
+		return nil, false
+	}
+	taskIds := stepTaskIds(step)
+	if len(taskIds) == 0 {
+		return nil, false
+	}
+	results := make([]TaskResult, 0, len(taskIds))
+	for _, taskId := range taskIds {
+		result, ok := done[step.StepId+"#"+taskId]
+		if !ok {
+			return nil, false
+		}
+		results = append(results, result)
+	}
+	return results, true
+}
+
+// stepBegun reports whether any task of the step ended on an earlier delivery
+func stepBegun(done map[string]TaskResult, step Step) bool {
+	for _, taskId := range stepTaskIds(step) {
+		if _, ok := done[step.StepId+"#"+taskId]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// stepTaskIds lists the ids a step records its results under; an approval
+// step records one under its own id
+func stepTaskIds(step Step) []string {
+	if step.Type == StepApproval {
+		return []string{step.StepId}
+	}
+	taskIds := make([]string, 0, len(step.Tasks))
+	for _, task := range step.Tasks {
+		taskIds = append(taskIds, task.TaskId)
+	}
+	return taskIds
+}
+
+// endedTasks indexes the results of tasks that ended on earlier deliveries by
+// stepId#taskId
+func endedTasks(prior *RunRecord) map[string]TaskResult {
+	done := make(map[string]TaskResult)
+	if prior == nil {
+		return done
+	}
+	for _, result := range prior.Tasks {
+		switch result.Status {
+		case "succeeded", "failed", "skipped":
+			done[result.StepId+"#"+result.TaskId] = result
+		}
+	}
+	return done
+}
+
+// stoppedInJMI reports whether the execution was stopped in JMI while parked,
+// so its message is dropped instead of resuming it
+func (j *JMRService) stoppedInJMI(execution ExecutionMessage) (bool, error) {
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(j.tableName),
+		Key: map[string]types.AttributeValue{
+			"executionName": &types.AttributeValueMemberS{Value: fmt.Sprintf("%s#%s#v%d#%s", execution.ExecutionName, execution.ExecutionUuid, 4, "jmi-stop")},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.Item != nil, nil
+}
+
+// parkExecution lists the run, whose record already holds token, under what it
+// waits for and lets its message go. When the wait ended while it was being
+// listed, or the listing failed, the run takes its token back and keeps the
+// message for a redelivery instead; a waker that claimed the token first has
+// already sent the message again.
+func (j *JMRService) parkExecution(execution ExecutionMessage, token string, wait *runWait) time.Duration {
+	now := time.Now()
+	var err error
+	for _, waitKey := range wait.waitKeys {
+		var item map[string]types.AttributeValue
+		item, err = attributevalue.MarshalMap(executionWait{
+			AccountId:     execution.AccountId,
+			WaitKey:       waitKey,
+			ExecutionUuid: execution.ExecutionUuid,
+			ExecutionName: execution.ExecutionName,
+			StepId:        wait.stepId,
+			TaskId:        wait.taskId,
+			Token:         token,
+			Message:       execution.raw,
+			CreatedAt:     now.Format(time.RFC3339),
+			Deadline:      wait.deadline.Unix(),
+			ExpiresAt:     wait.deadline.Add(24 * time.Hour).Unix(),
+		})
+		if err == nil {
+			_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+				TableName: aws.String(j.waitTableName()),
+				Item:      item,
+			})
+		}
+		if err != nil {
+			log.Printf("Error listing execution %s under %s: %v", execution.ExecutionUuid, waitKey, err)
+			break
+		}
+	}
+
+	if err == nil {
+		var ready bool
+		if ready, err = wait.ready(); err == nil && !ready {
+			log.Printf("Runner %s parked execution %s: %s", j.runnerID, execution.ExecutionUuid, wait.reason)
+			return 0
+		}
+	}
+
+	claimed, claimErr := j.claimWait(execution.ExecutionName, execution.ExecutionUuid, token)
+	if claimErr != nil {
+		log.Printf("Error resuming execution %s: %v", execution.ExecutionUuid, claimErr)
+		return retryInterval
+	}
+	if !claimed {
+		return 0
+	}
+	j.removeWaits(execution.ExecutionUuid)
+	if err != nil {
+		return retryInterval
+	}
+	return time.Second
+}
+
+// claimWait takes the token off a parked run record; only the one caller that
+// gets it resumes the run
+func (j *JMRService) claimWait(executionName, executionUuid, token string) (bool, error) {
+	_, err := j.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName: aws.String(j.tableName),
+		Key: map[string]types.AttributeValue{
+			"executionName": &types.AttributeValueMemberS{Value: fmt.Sprintf("%s#%s#v%d#%s", executionName, executionUuid, 3, "jmr-run")},
+		},
+		UpdateExpression:    aws.String("REMOVE waitToken"),
+		ConditionExpression: aws.String("waitToken = :token"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":token": &types.AttributeValueMemberS{Value: token},
+		},
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// removeWaits drops every listing of a resumed run
+func (j *JMRService) removeWaits(executionUuid string) {
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.waitTableName()),
+		IndexName:              aws.String("executionUuid-index"),
+		KeyConditionExpression: aws.String("executionUuid = :uuid"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uuid": &types.AttributeValueMemberS{Value: executionUuid},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error querying waits of %s: %v", executionUuid, err)
+			return
+		}
+		var waits []executionWait
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &waits); err != nil {
+			log.Printf("Error unmarshaling waits of %s: %v", executionUuid, err)
+			return
+		}
+		for _, wait := range waits {
+			j.deleteWait(wait)
+		}
+	}
+}
+
+func (j *JMRService) deleteWait(wait executionWait) {
+	_, err := j.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(j.waitTableName()),
+		Key: map[string]types.AttributeValue{
+			"accountId": &types.AttributeValueMemberS{Value: wait.AccountId},
+			"waitKey":   &types.AttributeValueMemberS{Value: wait.WaitKey},
+		},
+	})
+	if err != nil {
+		log.Printf("Error deleting wait %s: %v", wait.WaitKey, err)
+	}
+}
+
+// wakeConditionWaiters sends back the runs parked on a condition just added,
+// for its order date or for any
+func (j *JMRService) wakeConditionWaiters(accountId, name, orderDate string) {
+	j.wakeWaiters(accountId, "condition#"+name+"#"+orderDate+"#")
+	j.wakeWaiters(accountId, "condition#"+name+"#"+AnyOrderDate+"#")
+}
+
+// wakeWaiters sends back every run of the tenant listed under waitKeys
+// starting with prefix
+func (j *JMRService) wakeWaiters(accountId, prefix string) {
+	paginator := dynamodb.NewQueryPaginator(j.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(j.waitTableName()),
+		KeyConditionExpression: aws.String("accountId = :accountId AND begins_with(waitKey, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: accountId},
+			":prefix":    &types.AttributeValueMemberS{Value: prefix},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error querying waits %s: %v", prefix, err)
+			return
+		}
+		var waits []executionWait
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &waits); err != nil {
+			log.Printf("Error unmarshaling waits %s: %v", prefix, err)
+			return
+		}
+		for _, wait := range waits {
+			j.wakeWait(wait)
+		}
+	}
+}
+
+// wakeWait resumes a parked run through the runner queue, unless another
+// waker already did and this listing is left over. A run whose message could
+// not be sent keeps its listings and token, to be woken again.
+func (j *JMRService) wakeWait(wait executionWait) {
+	claimed, err := j.claimWait(wait.ExecutionName, wait.ExecutionUuid, wait.Token)
+	if err != nil {
+		log.Printf("Error resuming execution %s: %v", wait.ExecutionUuid, err)
+		return
+	}
+	if !claimed {
+		j.deleteWait(wait)
+		return
+	}
+
+	_, err = j.sqsClient.SendMessage(context.TODO(), &sqs.SendMessageInput{
+		QueueUrl:    aws.String(j.inQueueURL),
+		MessageBody: aws.String(wait.Message),
+	})
+	if err != nil {
+		log.Printf("Error resuming execution %s: %v", wait.ExecutionUuid, err)
+		j.restoreWait(wait)
+		return
+	}
+	j.removeWaits(wait.ExecutionUuid)
+	log.Printf("Runner %s resumed execution %s waiting at step %s", j.runnerID, wait.ExecutionUuid, wait.StepId)
+}
+
+// restoreWait gives a claimed token back to a run that could not be resumed
+func (j *JMRService) restoreWait(wait executionWait) {
+	_, err := j.dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName: aws.String(j.tableName),
+		Key: map[string]types.AttributeValue{
+			"executionName": &types.AttributeValueMemberS{Value: fmt.Sprintf("%s#%s#v%d#%s", wait.ExecutionName, wait.ExecutionUuid, 3, "jmr-run")},
+		},
+		UpdateExpression:    aws.String("SET waitToken = :token"),
+		ConditionExpression: aws.String("attribute_not_exists(waitToken)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":token": &types.AttributeValueMemberS{Value: wait.Token},
+		},
+	})
+	if err != nil {
+		log.Printf("Error restoring wait of %s: %v", wait.ExecutionUuid, err)
+	}
+}
@@ -0,0 +1,532 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Control resource modes: any number of shared holders, or one exclusive holder
+const (
+	LockExclusive = "exclusive"
+	LockShared    = "shared"
+)
+
+// Lock item states, as shown by JMI's /control-resources
+const (
+	LockHeld    = "held"
+	LockWaiting = "waiting"
+)
+
+// lockSummaryId is the holderId of the item carrying a resource's lock state
+const lockSummaryId = "#"
+
+// ControlResource is a named lock a routine or one of its steps requires
+type ControlResource struct {
+	Name string `json:"name"`
+	Mode string `json:"mode,omitempty"`
+}
+
+// controlLock is an execution holding, or waiting for, a control resource
+type controlLock struct {
+	ResourceKey     string `dynamodbav:"resourceKey"` // accountId#name
+	HolderId        string `dynamodbav:"holderId"`
+	AccountId       string `dynamodbav:"accountId"`
+	Name            string `dynamodbav:"name"`
+	State           string `dynamodbav:"state,omitempty"`
+	Mode            string `dynamodbav:"mode,omitempty"`
+	ExecutionName   string `dynamodbav:"executionName,omitempty"`
+	ExecutionUuid   string `dynamodbav:"executionUuid,omitempty"`
+	Since           string `dynamodbav:"since,omitempty"`
+	ExclusiveHolder string `dynamodbav:"exclusiveHolder,omitempty"`
+	SharedCount     int    `dynamodbav:"sharedCount,omitempty"`
+}
+
+// lockedExecution is the part of an execution message JMW needs to lock it
+type lockedExecution struct {
+	ExecutionName string `json:"executionName"`
+	ExecutionUuid string `json:"executionUuid"`
+	AccountId     string `json:"accountId"`
+	CreatedAt     string `json:"createdAt"`
+	Definition    *struct {
+		SchedulerRoutine SchedulerRoutine `json:"schedulerRoutine"`
+	} `json:"definition"`
+}
+
+func (j *JMWService) controlResourceTableName() string {
+	if j.controlResourceTable == "" {
+		return "control_resources"
+	}
+	return j.controlResourceTable
+}
+
+// lockRetryInterval is how long a blocked execution waits before JMW checks
+// its control resources again, LOCK_RETRY_INTERVAL seconds (default 10)
+func lockRetryInterval() time.Duration {
+	if value, err := strconv.Atoi(os.Getenv("LOCK_RETRY_INTERVAL")); err == nil && value > 0 {
+		return time.Duration(value) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// lockReapInterval is how often JMW looks for control resources held by
+// executions that are over, LOCK_REAP_INTERVAL seconds (default 60)
+func lockReapInterval() time.Duration {
+	if value, err := strconv.Atoi(os.Getenv("LOCK_REAP_INTERVAL")); err == nil && value > 0 {
+		return time.Duration(value) * time.Second
+	}
+	return time.Minute
+}
+
+// requiredLocks gathers the control resources of the routine and of its steps.
+// JMW dispatches whole executions, so step locks are held for the whole run
+// too; a resource required in both modes is taken exclusively.
+func requiredLocks(routine SchedulerRoutine) []ControlResource {
+	modes := make(map[string]string)
+	add := func(resources []ControlResource) {
+		for _, resource := range resources {
+			mode := resource.Mode
+			if mode != LockShared {
+				mode = LockExclusive
+			}
+			if modes[resource.Name] != LockExclusive {
+				modes[resource.Name] = mode
+			}
+		}
+	}
+	add(routine.ControlResources)
+	for _, step := range routine.Steps {
+		add(step.ControlResources)
+	}
+
+	locks := make([]ControlResource, 0, len(modes))
+	for name, mode := range modes {
+		locks = append(locks, ControlResource{Name: name, Mode: mode})
+	}
+	sort.Slice(locks, func(a, b int) bool {
+		return locks[a].Name < locks[b].Name
+	})
+	return locks
+}
+
+// awaitControlResources takes the control resources an execution requires
+// before it is dispatched. It returns how long to hold the message back while
+// they are taken by others, and whether the message should be dropped because
+// the execution was stopped while it waited.
+func (j *JMWService) awaitControlResources(messageBody string) (time.Duration, bool) {
+	var execution lockedExecution
+	if err := json.Unmarshal([]byte(messageBody), &execution); err != nil || execution.Definition == nil {
+		return 0, false
+	}
+	locks := requiredLocks(execution.Definition.SchedulerRoutine)
+	if len(locks) == 0 {
+		return 0, false
+	}
+
+	stopped, err := j.isStopped(execution)
+	if err != nil {
+		log.Printf("Error checking whether %s was stopped: %v", execution.ExecutionUuid, err)
+		return lockRetryInterval(), false
+	}
+	if stopped {
+		log.Printf("Worker %s dropped stopped execution %s", j.workerID, execution.ExecutionUuid)
+		j.releaseControlLocks(execution.ExecutionUuid)
+		return 0, true
+	}
+
+	blocker, err := j.acquireControlLocks(execution, locks)
+	if err != nil {
+		log.Printf("Error taking control resources of %s: %v", execution.ExecutionUuid, err)
+		j.recordWait(execution, "Could not check control resources, retrying")
+		return lockRetryInterval(), false
+	}
+	if blocker != nil {
+		reason := j.describeBlocker(execution.AccountId, *blocker)
+		log.Printf("Worker %s holds execution %s back: %s", j.workerID, execution.ExecutionUuid, reason)
+		j.registerLockWaiters(execution, locks)
+		j.recordWait(execution, reason)
+		return lockRetryInterval(), false
+	}
+
+	// A stop that came in while the locks were being taken could not release them
+	if stopped, err := j.isStopped(execution); err == nil && stopped {
+		j.releaseControlLocks(execution.ExecutionUuid)
+		return 0, true
+	}
+
+	log.Printf("Worker %s took control resources %v for %s", j.workerID, locks, execution.ExecutionUuid)
+	return 0, false
+}
+
+// isStopped reports whether JMI recorded a stop of the execution
+func (j *JMWService) isStopped(execution lockedExecution) (bool, error) {
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(j.tableName),
+		Key: map[string]types.AttributeValue{
+			"executionName": &types.AttributeValueMemberS{Value: fmt.Sprintf("%s#%s#v%d#%s", execution.ExecutionName, execution.ExecutionUuid, 4, "jmi-stop")},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.Item != nil, nil
+}
+
+// acquireControlLocks takes every lock at once and returns the first one held
+// by someone else, or nil once the execution holds them all
+func (j *JMWService) acquireControlLocks(execution lockedExecution, locks []ControlResource) (*ControlResource, error) {
+	// A redelivered message may already hold its locks
+	held := 0
+	for _, lock := range locks {
+		result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+			TableName: aws.String(j.controlResourceTableName()),
+			Key: map[string]types.AttributeValue{
+				"resourceKey": &types.AttributeValueMemberS{Value: execution.AccountId + "#" + lock.Name},
+				"holderId":    &types.AttributeValueMemberS{Value: execution.ExecutionUuid},
+			},
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if state, ok := result.Item["state"].(*types.AttributeValueMemberS); ok && state.Value == LockHeld {
+			held++
+		}
+	}
+	if held == len(locks) {
+		return nil, nil
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	var items []types.TransactWriteItem
+	for _, lock := range locks {
+		resourceKey := execution.AccountId + "#" + lock.Name
+		summary := &types.Update{
+			TableName: aws.String(j.controlResourceTableName()),
+			Key: map[string]types.AttributeValue{
+				"resourceKey": &types.AttributeValueMemberS{Value: resourceKey},
+				"holderId":    &types.AttributeValueMemberS{Value: lockSummaryId},
+			},
+			UpdateExpression:         aws.String("SET exclusiveHolder = :uuid, accountId = :accountId, #name = :name"),
+			ConditionExpression:      aws.String("attribute_not_exists(exclusiveHolder) AND (attribute_not_exists(sharedCount) OR sharedCount = :zero)"),
+			ExpressionAttributeNames: map[string]string{"#name": "name"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":uuid":      &types.AttributeValueMemberS{Value: execution.ExecutionUuid},
+				":accountId": &types.AttributeValueMemberS{Value: execution.AccountId},
+				":name":      &types.AttributeValueMemberS{Value: lock.Name},
+				":zero":      &types.AttributeValueMemberN{Value: "0"},
+			},
+		}
+		if lock.Mode == LockShared {
+			summary.UpdateExpression = aws.String("SET sharedCount = if_not_exists(sharedCount, :zero) + :one, accountId = :accountId, #name = :name")
+			summary.ConditionExpression = aws.String("attribute_not_exists(exclusiveHolder)")
+			delete(summary.ExpressionAttributeValues, ":uuid")
+			summary.ExpressionAttributeValues[":one"] = &types.AttributeValueMemberN{Value: "1"}
+		}
+		items = append(items, types.TransactWriteItem{Update: summary})
+
+		holder, err := attributevalue.MarshalMap(controlLock{
+			ResourceKey:   resourceKey,
+			HolderId:      execution.ExecutionUuid,
+			AccountId:     execution.AccountId,
+			Name:          lock.Name,
+			State:         LockHeld,
+			Mode:          lock.Mode,
+			ExecutionName: execution.ExecutionName,
+			ExecutionUuid: execution.ExecutionUuid,
+			Since:         now,
+		})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, types.TransactWriteItem{Put: &types.Put{
+			TableName: aws.String(j.controlResourceTableName()),
+			Item:      holder,
+		}})
+	}
+
+	_, err := j.dynamoClient.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		return blockingLock(locks, canceled.CancellationReasons), nil
+	}
+	return nil, err
+}
+
+// blockingLock is the lock whose condition failed in a canceled acquire
+// transaction, which writes two items per lock, summary first
+func blockingLock(locks []ControlResource, reasons []types.CancellationReason) *ControlResource {
+	for i, reason := range reasons {
+		if aws.ToString(reason.Code) == "ConditionalCheckFailed" && i/2 < len(locks) {
+			return &locks[i/2]
+		}
+	}
+	// Collided with another worker's transaction
+	return &locks[0]
+}
+
+// describeBlocker explains what holds the lock an execution waits for
+func (j *JMWService) describeBlocker(accountId string, lock ControlResource) string {
+	holders, err := j.lockHolders(accountId, lock.Name)
+	if err != nil || len(holders) == 0 {
+		return fmt.Sprintf("Waiting for %s lock on control resource %s", lock.Mode, lock.Name)
+	}
+
+	names := make([]string, 0, len(holders))
+	for _, holder := range holders {
+		names = append(names, fmt.Sprintf("%s (%s)", holder.ExecutionName, holder.ExecutionUuid))
+	}
+	return fmt.Sprintf("Waiting for %s lock on control resource %s, held %s by %s",
+		lock.Mode, lock.Name, holders[0].Mode, strings.Join(names, ", "))
+}
+
+// lockHolders returns the executions holding a control resource
+func (j *JMWService) lockHolders(accountId, name string) ([]controlLock, error) {
+	result, err := j.dynamoClient.Query(context.TODO(), &dynamodb.QueryInput{
+		TableName:                aws.String(j.controlResourceTableName()),
+		KeyConditionExpression:   aws.String("resourceKey = :resourceKey"),
+		FilterExpression:         aws.String("#state = :held"),
+		ExpressionAttributeNames: map[string]string{"#state": "state"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":resourceKey": &types.AttributeValueMemberS{Value: accountId + "#" + name},
+			":held":        &types.AttributeValueMemberS{Value: LockHeld},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var holders []controlLock
+	err = attributevalue.UnmarshalListOfMaps(result.Items, &holders)
+	return holders, err
+}
+
+// registerLockWaiters lists the execution as waiting on each resource it does not hold
+func (j *JMWService) registerLockWaiters(execution lockedExecution, locks []ControlResource) {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	for _, lock := range locks {
+		item, err := attributevalue.MarshalMap(controlLock{
+			ResourceKey:   execution.AccountId + "#" + lock.Name,
+			HolderId:      execution.ExecutionUuid,
+			AccountId:     execution.AccountId,
+			Name:          lock.Name,
+			State:         LockWaiting,
+			Mode:          lock.Mode,
+			ExecutionName: execution.ExecutionName,
+			ExecutionUuid: execution.ExecutionUuid,
+			Since:         now,
+		})
+		if err == nil {
+			// Keeps the original wait time on later checks
+			_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+				TableName:           aws.String(j.controlResourceTableName()),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(holderId)"),
+			})
+		}
+		var conditionErr *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &conditionErr) {
+			log.Printf("Error registering %s as waiter of %s: %v", execution.ExecutionUuid, lock.Name, err)
+		}
+	}
+}
+
+// recordWait writes the jmw-wait stage, so the execution shows as waiting
+// with the reason in JMI
+func (j *JMWService) recordWait(execution lockedExecution, reason string) {
+	now := time.Now()
+	item, err := attributevalue.MarshalMap(map[string]interface{}{
+		"executionName": fmt.Sprintf("%s#%s#v%d#%s", execution.ExecutionName, execution.ExecutionUuid, 2, "jmw-wait"),
+		"originalName":  execution.ExecutionName,
+		"executionUuid": execution.ExecutionUuid,
+		"accountId":     execution.AccountId,
+		"status":        "waiting",
+		"reason":        reason,
+		"createdAt":     execution.CreatedAt,
+		"updatedAt":     now.Format(time.RFC3339),
+		"version":       2,
+		"stage":         "jmw-wait",
+		"processedBy":   "JMW",
+		"workerID":      j.workerID,
+		"timestamp":     now.Unix(),
+	})
+	if err == nil {
+		_, err = j.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+			TableName: aws.String(j.tableName),
+			Item:      item,
+		})
+	}
+	if err != nil {
+		log.Printf("Error recording wait of %s: %v", execution.ExecutionUuid, err)
+	}
+}
+
+// releaseControlLocks frees the execution's control resources and waits; used
+// when it is stopped, or cannot be dispatched after taking them
+func (j *JMWService) releaseControlLocks(executionUuid string) {
+	result, err := j.dynamoClient.Query(context.TODO(), &dynamodb.QueryInput{
+		TableName:              aws.String(j.controlResourceTableName()),
+		IndexName:              aws.String("executionUuid-index"),
+		KeyConditionExpression: aws.String("executionUuid = :uuid"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uuid": &types.AttributeValueMemberS{Value: executionUuid},
+		},
+	})
+	if err != nil {
+		log.Printf("Error querying control locks of %s: %v", executionUuid, err)
+		return
+	}
+	var locks []controlLock
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &locks); err != nil {
+		log.Printf("Error unmarshaling control locks of %s: %v", executionUuid, err)
+		return
+	}
+
+	for _, lock := range locks {
+		key := map[string]types.AttributeValue{
+			"resourceKey": &types.AttributeValueMemberS{Value: lock.ResourceKey},
+			"holderId":    &types.AttributeValueMemberS{Value: lock.HolderId},
+		}
+		if lock.State != LockHeld {
+			if _, err := j.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+				TableName: aws.String(j.controlResourceTableName()),
+				Key:       key,
+			}); err != nil {
+				log.Printf("Error removing %s from the waiters of %s: %v", executionUuid, lock.Name, err)
+			}
+			continue
+		}
+
+		summary := &types.Update{
+			TableName: aws.String(j.controlResourceTableName()),
+			Key: map[string]types.AttributeValue{
+				"resourceKey": &types.AttributeValueMemberS{Value: lock.ResourceKey},
+				"holderId":    &types.AttributeValueMemberS{Value: lockSummaryId},
+			},
+			UpdateExpression:    aws.String("REMOVE exclusiveHolder"),
+			ConditionExpression: aws.String("exclusiveHolder = :uuid"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":uuid": &types.AttributeValueMemberS{Value: executionUuid},
+			},
+		}
+		if lock.Mode == LockShared {
+			summary.UpdateExpression = aws.String("SET sharedCount = sharedCount - :one")
+			summary.ConditionExpression = aws.String("sharedCount > :zero")
+			summary.ExpressionAttributeValues = map[string]types.AttributeValue{
+				":zero": &types.AttributeValueMemberN{Value: "0"},
+				":one":  &types.AttributeValueMemberN{Value: "1"},
+			}
+		}
+
+		_, err := j.dynamoClient.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+			TransactItems: []types.TransactWriteItem{
+				{Delete: &types.Delete{
+					TableName:                 aws.String(j.controlResourceTableName()),
+					Key:                       key,
+					ConditionExpression:       aws.String("#state = :held"),
+					ExpressionAttributeNames:  map[string]string{"#state": "state"},
+					ExpressionAttributeValues: map[string]types.AttributeValue{":held": &types.AttributeValueMemberS{Value: LockHeld}},
+				}},
+				{Update: summary},
+			},
+		})
+		var canceled *types.TransactionCanceledException
+		if err != nil && !errors.As(err, &canceled) {
+			log.Printf("Error releasing control resource %s of %s: %v", lock.Name, executionUuid, err)
+		}
+	}
+}
+
+// startLockReaper frees, every LOCK_REAP_INTERVAL, the control resources of
+// executions that finished or were stopped without releasing them, e.g. when
+// the service that should have released them failed at that moment
+func (j *JMWService) startLockReaper() {
+	ticker := time.NewTicker(lockReapInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.receiveCtx.Done():
+			return
+		case now := <-ticker.C:
+			j.reapControlLocks(now)
+		}
+	}
+}
+
+// reapControlLocks releases the locks and waits of every execution that has
+// held one for over a reap interval and is over by now
+func (j *JMWService) reapControlLocks(now time.Time) {
+	paginator := dynamodb.NewScanPaginator(j.dynamoClient, &dynamodb.ScanInput{
+		TableName:        aws.String(j.controlResourceTableName()),
+		FilterExpression: aws.String("holderId <> :summary"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":summary": &types.AttributeValueMemberS{Value: lockSummaryId},
+		},
+	})
+
+	checked := make(map[string]bool)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error scanning control locks: %v", err)
+			return
+		}
+		var locks []controlLock
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &locks); err != nil {
+			log.Printf("Error unmarshaling control locks: %v", err)
+			return
+		}
+
+		for _, lock := range locks {
+			// Recent locks belong to executions JMW or JMR are still handling
+			since, err := time.Parse(time.RFC3339Nano, lock.Since)
+			if checked[lock.ExecutionUuid] || (err == nil && now.Sub(since) < lockReapInterval()) {
+				continue
+			}
+			checked[lock.ExecutionUuid] = true
+
+			over, err := j.executionOver(lockedExecution{ExecutionName: lock.ExecutionName, ExecutionUuid: lock.ExecutionUuid})
+			if err != nil {
+				log.Printf("Error checking whether %s is over: %v", lock.ExecutionUuid, err)
+				continue
+			}
+			if over {
+				log.Printf("Worker %s frees control resources left by execution %s", j.workerID, lock.ExecutionUuid)
+				j.releaseControlLocks(lock.ExecutionUuid)
+			}
+		}
+	}
+}
+
+// executionOver reports whether the execution was stopped, or JMR recorded
+// it succeeded or failed
+func (j *JMWService) executionOver(execution lockedExecution) (bool, error) {
+	stopped, err := j.isStopped(execution)
+	if err != nil || stopped {
+		return stopped, err
+	}
+
+	result, err := j.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(j.tableName),
+		Key: map[string]types.AttributeValue{
+			"executionName": &types.AttributeValueMemberS{Value: fmt.Sprintf("%s#%s#v%d#%s", execution.ExecutionName, execution.ExecutionUuid, 3, "jmr-run")},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	status, _ := result.Item["status"].(*types.AttributeValueMemberS)
+	return status != nil && (status.Value == "succeeded" || status.Value == "failed"), nil
+}
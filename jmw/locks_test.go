@@ -0,0 +1,189 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestRequiredLocks(t *testing.T) {
+	tests := []struct {
+		name    string
+		routine SchedulerRoutine
+		want    []ControlResource
+	}{
+		{"no locks", SchedulerRoutine{Steps: []Step{{StepId: "load"}}}, []ControlResource{}},
+		{
+			"mode defaults to exclusive",
+			SchedulerRoutine{ControlResources: []ControlResource{{Name: "erp"}}},
+			[]ControlResource{{Name: "erp", Mode: LockExclusive}},
+		},
+		{
+			"unknown mode is exclusive",
+			SchedulerRoutine{ControlResources: []ControlResource{{Name: "erp", Mode: "read"}}},
+			[]ControlResource{{Name: "erp", Mode: LockExclusive}},
+		},
+		{
+			"step locks held for the whole run, sorted by name",
+			SchedulerRoutine{
+				ControlResources: []ControlResource{{Name: "warehouse", Mode: LockShared}},
+				Steps:            []Step{{StepId: "load", ControlResources: []ControlResource{{Name: "erp", Mode: LockShared}}}},
+			},
+			[]ControlResource{{Name: "erp", Mode: LockShared}, {Name: "warehouse", Mode: LockShared}},
+		},
+		{
+			"shared then exclusive is exclusive",
+			SchedulerRoutine{
+				ControlResources: []ControlResource{{Name: "erp", Mode: LockShared}},
+				Steps:            []Step{{StepId: "close", ControlResources: []ControlResource{{Name: "erp", Mode: LockExclusive}}}},
+			},
+			[]ControlResource{{Name: "erp", Mode: LockExclusive}},
+		},
+		{
+			"exclusive then shared stays exclusive",
+			SchedulerRoutine{
+				ControlResources: []ControlResource{{Name: "erp"}},
+				Steps: []Step{
+					{StepId: "read", ControlResources: []ControlResource{{Name: "erp", Mode: LockShared}}},
+					{StepId: "report", ControlResources: []ControlResource{{Name: "erp", Mode: LockShared}}},
+				},
+			},
+			[]ControlResource{{Name: "erp", Mode: LockExclusive}},
+		},
+		{
+			"same resource in two steps is taken once",
+			SchedulerRoutine{Steps: []Step{
+				{StepId: "a", ControlResources: []ControlResource{{Name: "erp", Mode: LockShared}}},
+				{StepId: "b", ControlResources: []ControlResource{{Name: "erp", Mode: LockShared}}},
+			}},
+			[]ControlResource{{Name: "erp", Mode: LockShared}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requiredLocks(tt.routine); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requiredLocks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockingLock(t *testing.T) {
+	locks := []ControlResource{{Name: "erp", Mode: LockShared}, {Name: "warehouse", Mode: LockExclusive}}
+	reason := func(code string) types.CancellationReason {
+		return types.CancellationReason{Code: aws.String(code)}
+	}
+
+	tests := []struct {
+		name    string
+		reasons []types.CancellationReason
+		want    string
+	}{
+		{"first summary held", []types.CancellationReason{reason("ConditionalCheckFailed"), reason("None"), reason("None"), reason("None")}, "erp"},
+		{"second summary held", []types.CancellationReason{reason("None"), reason("None"), reason("ConditionalCheckFailed"), reason("None")}, "warehouse"},
+		{"transaction conflict", []types.CancellationReason{reason("TransactionConflict"), reason("None"), reason("None"), reason("None")}, "erp"},
+		{"no reasons", nil, "erp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blockingLock(locks, tt.reasons); got.Name != tt.want {
+				t.Errorf("blockingLock() = %s, want %s", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocksReleasedWhenDispatchFails(t *testing.T) {
+	message := `{"executionName": "daily-load", "executionUuid": "exec-1", "accountId": "acc-a", "createdAt": "2026-10-18T10:00:00Z",
+		"definition": {"schedulerRoutine": {"controlResources": [{"name": "erp"}]}}}`
+
+	fake, client := newFakeDynamo(t, func(call dynamoCall) (interface{}, *dynamoError) {
+		switch call.Operation {
+		case "PutItem":
+			// The jmw-process stage cannot be stored
+			return nil, &dynamoError{Type: "ProvisionedThroughputExceededException"}
+		case "Query":
+			return map[string]interface{}{"Items": []interface{}{wireItem(t, controlLock{
+				ResourceKey:   "acc-a#erp",
+				HolderId:      "exec-1",
+				Name:          "erp",
+				State:         LockHeld,
+				Mode:          LockExclusive,
+				ExecutionUuid: "exec-1",
+			})}}, nil
+		}
+		return nil, nil
+	})
+	service := &JMWService{dynamoClient: client, tableName: "executions", workerID: "jmw-test"}
+
+	service.processMessage(message)
+
+	queries := fake.recorded("Query", "control_resources")
+	if len(queries) != 1 || queries[0].value("ExpressionAttributeValues", ":uuid") != "exec-1" {
+		t.Fatalf("Query calls = %+v, want the locks of exec-1 looked up", queries)
+	}
+	releases := fake.recorded("TransactWriteItems", "")
+	if len(releases) != 1 {
+		t.Fatalf("TransactWriteItems calls = %d, want the erp lock released", len(releases))
+	}
+}
+
+func TestReapControlLocks(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-2 * lockReapInterval()).UTC().Format(time.RFC3339Nano)
+	holder := func(uuid, since string) map[string]interface{} {
+		return wireItem(t, controlLock{
+			ResourceKey:   "acc-a#erp",
+			HolderId:      uuid,
+			Name:          "erp",
+			State:         LockHeld,
+			Mode:          LockShared,
+			ExecutionName: "daily-load",
+			ExecutionUuid: uuid,
+			Since:         since,
+		})
+	}
+	runs := map[string]string{
+		"daily-load#exec-done#v3#jmr-run":    "succeeded",
+		"daily-load#exec-running#v3#jmr-run": "running",
+		"daily-load#exec-recent#v3#jmr-run":  "failed",
+	}
+
+	fake, client := newFakeDynamo(t, func(call dynamoCall) (interface{}, *dynamoError) {
+		switch call.Operation {
+		case "Scan":
+			return map[string]interface{}{"Items": []interface{}{
+				holder("exec-done", old),
+				holder("exec-running", old),
+				holder("exec-stopped", old),
+				holder("exec-recent", now.UTC().Format(time.RFC3339Nano)),
+			}}, nil
+		case "GetItem":
+			key := call.value("Key", "executionName")
+			if key == "daily-load#exec-stopped#v4#jmi-stop" {
+				return map[string]interface{}{"Item": map[string]interface{}{"executionName": map[string]interface{}{"S": key}}}, nil
+			}
+			if status, ok := runs[key]; ok {
+				return map[string]interface{}{"Item": map[string]interface{}{"status": map[string]interface{}{"S": status}}}, nil
+			}
+		}
+		return nil, nil
+	})
+	service := &JMWService{dynamoClient: client, tableName: "executions", workerID: "jmw-test"}
+
+	service.reapControlLocks(now)
+
+	released := make(map[string]bool)
+	for _, query := range fake.recorded("Query", "control_resources") {
+		released[query.value("ExpressionAttributeValues", ":uuid")] = true
+	}
+	want := map[string]bool{"exec-done": true, "exec-stopped": true}
+	if !reflect.DeepEqual(released, want) {
+		t.Errorf("released the locks of %v, want %v", released, want)
+	}
+}
@@ -59,17 +59,62 @@ type SchedulerRoutine struct {
 	Priority      string `json:"priority"`
 	Provisioning  string `json:"provisioning"`
 	Steps         []Step `json:"steps"`
+
+	ControlResources []ControlResource `json:"controlResources,omitempty"`
 }
 
 type Step struct {
-	StepId string `json:"stepId"`
-	Tasks  []Task `json:"tasks"`
+	StepId   string        `json:"stepId"`
+	Type     string        `json:"type,omitempty"`
+	Approval *ApprovalGate `json:"approval,omitempty"`
+	Tasks    []Task        `json:"tasks"`
+	RunIf    string        `json:"runIf,omitempty"`
+	When     string        `json:"when,omitempty"`
+
+	ControlResources  []ControlResource `json:"controlResources,omitempty"`
+	WaitForConditions []Condition       `json:"waitForConditions,omitempty"`
+	OnSuccess         *ConditionActions `json:"onSuccess,omitempty"`
+	OnFailure         *ConditionActions `json:"onFailure,omitempty"`
 }
 
 type Task struct {
 	TaskId      string                 `json:"taskId"`
-	RuntimeName string                 `json:"runtimeName"`
+	Type        string                 `json:"type,omitempty"` // runtime (default) or routine
+	RuntimeName string                 `json:"runtimeName,omitempty"`
+	Routine     *SubRoutine            `json:"routine,omitempty"`
 	Parameters  map[string]interface{} `json:"parameters"`
+	Resources   []ResourceClaim        `json:"resources,omitempty"`
+}
+
+// SubRoutine is the registered routine a routine task starts and waits for
+type SubRoutine struct {
+	Name       string                 `json:"name"`
+	Version    int                    `json:"version,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// ResourceClaim is how much of a named resource pool a task holds while it runs
+type ResourceClaim struct {
+	Pool     string `json:"pool"`
+	Quantity int    `json:"quantity,omitempty"`
+}
+
+// Condition is a named flag for an order date, set and awaited by steps
+type Condition struct {
+	Name      string `json:"name"`
+	OrderDate string `json:"orderDate,omitempty"`
+}
+
+// ConditionActions are the conditions a step adds and deletes when it ends
+type ConditionActions struct {
+	AddConditions    []Condition `json:"addConditions,omitempty"`
+	DeleteConditions []Condition `json:"deleteConditions,omitempty"`
+}
+
+// ApprovalGate configures a step that waits for a human sign-off
+type ApprovalGate struct {
+	Description    string `json:"description,omitempty"`
+	TimeoutSeconds int    `json:"timeoutSeconds,omitempty"`
 }
 
 // Legacy Job struct for backward compatibility
@@ -87,15 +132,16 @@ type Job struct {
 }
 
 type JMWService struct {
-	jobs          []Job
-	workerID      string
-	dynamoClient  *dynamodb.Client
-	sqsClient     *sqs.Client
-	tableName     string
-	inQueueURL    string
-	outQueueURL   string
-	receiveCtx    context.Context
-	receiveCancel context.CancelFunc
+	jobs                 []Job
+	workerID             string
+	dynamoClient         *dynamodb.Client
+	sqsClient            *sqs.Client
+	tableName            string
+	controlResourceTable string
+	inQueueURL           string
+	outQueueURL          string
+	receiveCtx           context.Context
+	receiveCancel        context.CancelFunc
 }
 
 func NewJMWService() *JMWService {
@@ -128,20 +174,24 @@ func NewJMWService() *JMWService {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	service := &JMWService{
-		jobs:          make([]Job, 0),
-		workerID:      "jmw-" + time.Now().Format("20060102150405"),
-		dynamoClient:  dynamodb.NewFromConfig(cfg),
-		sqsClient:     sqs.NewFromConfig(cfg),
-		tableName:     os.Getenv("DYNAMODB_TABLE"),
-		inQueueURL:    os.Getenv("JMW_QUEUE_URL"),
-		outQueueURL:   os.Getenv("JMR_QUEUE_URL"),
-		receiveCtx:    ctx,
-		receiveCancel: cancel,
+		jobs:                 make([]Job, 0),
+		workerID:             "jmw-" + time.Now().Format("20060102150405"),
+		dynamoClient:         dynamodb.NewFromConfig(cfg),
+		sqsClient:            sqs.NewFromConfig(cfg),
+		tableName:            os.Getenv("DYNAMODB_TABLE"),
+		controlResourceTable: os.Getenv("CONTROL_RESOURCE_TABLE"),
+		inQueueURL:           os.Getenv("JMW_QUEUE_URL"),
+		outQueueURL:          os.Getenv("JMR_QUEUE_URL"),
+		receiveCtx:           ctx,
+		receiveCancel:        cancel,
 	}
 
 	// Start message receiver
 	go service.startMessageReceiver()
 
+	// Free control resources still held by executions that are over
+	go service.startLockReaper()
+
 	return service
 }
 
@@ -166,8 +216,24 @@ func (j *JMWService) startMessageReceiver() {
 			}
 
 			for _, message := range result.Messages {
+				// Executions blocked by a control resource go back to the queue until it is free
+				wait, stopped := j.awaitControlResources(*message.Body)
+				if wait > 0 {
+					_, err := j.sqsClient.ChangeMessageVisibility(context.TODO(), &sqs.ChangeMessageVisibilityInput{
+						QueueUrl:          aws.String(j.inQueueURL),
+						ReceiptHandle:     message.ReceiptHandle,
+						VisibilityTimeout: int32(wait.Seconds()),
+					})
+					if err != nil {
+						log.Printf("Error delaying message: %v", err)
+					}
+					continue
+				}
+
 				// Process the message
-				j.processMessage(*message.Body)
+				if !stopped {
+					j.processMessage(*message.Body)
+				}
 
 				// Delete the message from the queue
 				_, err := j.sqsClient.DeleteMessage(context.TODO(), &sqs.DeleteMessageInput{
@@ -197,6 +263,16 @@ func (j *JMWService) processMessage(messageBody string) {
 	// Check if it's an execution (has executionName) or a job (has id)
 	if executionName, hasExecutionName := execution["executionName"]; hasExecutionName {
 		log.Printf("Worker %s processing execution %v", j.workerID, executionName)
+
+		// The message is deleted whatever happens here, so control resources
+		// taken for the execution go back unless it reaches JMR
+		executionUuid, _ := execution["executionUuid"].(string)
+		forwarded := false
+		defer func() {
+			if !forwarded && executionUuid != "" {
+				j.releaseControlLocks(executionUuid)
+			}
+		}()
 		
 		// Create versioned execution record for JMW processing
 		now := time.Now()
@@ -214,7 +290,7 @@ func (j *JMWService) processMessage(messageBody string) {
 		}
 
 		// Create composite key for versioning
-		executionKey := fmt.Sprintf("%s#v%d#%s", versionedExecution["executionName"], versionedExecution["version"], versionedExecution["stage"])
+		executionKey := fmt.Sprintf("%s#%s#v%d#%s", versionedExecution["executionName"], versionedExecution["executionUuid"], versionedExecution["version"], versionedExecution["stage"])
 		
 		// Create versioned struct for DynamoDB
 		type VersionedExecution struct {
@@ -229,6 +305,8 @@ func (j *JMWService) processMessage(messageBody string) {
 			ProcessedBy       string `dynamodbav:"processedBy"`
 			WorkerID          string `dynamodbav:"workerID"`
 			Timestamp         int64  `dynamodbav:"timestamp"`
+			RoutineVersion    int    `dynamodbav:"routineVersion,omitempty"` // Definition version snapshotted by JMI
+			AccountId         string `dynamodbav:"accountId,omitempty"`      // Tenant que disparou a execução
 		}
 
 		versionedExec := VersionedExecution{
@@ -244,6 +322,12 @@ func (j *JMWService) processMessage(messageBody string) {
 			WorkerID:      versionedExecution["workerID"].(string),
 			Timestamp:     versionedExecution["timestamp"].(int64),
 		}
+		if routineVersion, ok := execution["routineVersion"].(float64); ok {
+			versionedExec.RoutineVersion = int(routineVersion)
+		}
+		if accountId, ok := execution["accountId"].(string); ok {
+			versionedExec.AccountId = accountId
+		}
 
 		// Store versioned execution in DynamoDB
 		item, err := attributevalue.MarshalMap(versionedExec)
@@ -278,6 +362,7 @@ func (j *JMWService) processMessage(messageBody string) {
 			log.Printf("Error sending message to JMR queue: %v", err)
 			return
 		}
+		forwarded = true
 
 		log.Printf("Worker %s completed execution %v and forwarded to JMR", j.workerID, executionName)
 	} else {
@@ -413,10 +498,18 @@ func (j *JMWService) ProcessJob(ctx *gin.Context) {
 
 func (j *JMWService) Start(ctx *gin.Context) {
 	var req StartRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindAndValidate(ctx, "execution", &req, func() []Violation {
+		return validateRoutineStructure(req.Runtimes, req.SchedulerRoutine)
+	}) {
+		return
+	}
+
+	identity := identityFrom(ctx)
+	if req.AccountId != "" && req.AccountId != identity.AccountId {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "accountId does not match the caller's account"})
 		return
 	}
+	req.AccountId = identity.AccountId
 
 	// Generate execution UUID
 	executionUuid := uuid.New().String()
@@ -488,11 +581,15 @@ func main() {
 	// Worker stats
 	r.GET("/stats", service.GetStats)
 
+	// Tenant-scoped endpoints require an authenticated caller
+	tenant := r.Group("/", authMiddleware(loadAuthenticators()))
+	submitter := requireRole(RoleSubmitter)
+
 	// Start execution endpoint (new)
-	r.POST("/start", service.Start)
+	tenant.POST("/start", submitter, service.Start)
 
 	// Job processing (legacy)
-	r.POST("/process", service.ProcessJob)
+	tenant.POST("/process", submitter, service.ProcessJob)
 
 	port := os.Getenv("SERVICE_PORT")
 	if port == "" {
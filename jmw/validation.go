@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+//go:embed schemas/*.schema.json
+var schemaFiles embed.FS
+
+// Violation is one problem found in a request body, located by its JSON path
+type Violation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// cronParser accepts both 5-field and 6-field (with seconds) expressions,
+// since routines and schedules in this pipeline use both.
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+var schemas = mustCompileSchemas()
+
+func mustCompileSchemas() map[string]*jsonschema.Schema {
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+
+	entries, err := schemaFiles.ReadDir("schemas")
+	if err != nil {
+		log.Fatalf("Unable to read embedded schemas: %v", err)
+	}
+
+	for _, entry := range entries {
+		data, err := schemaFiles.ReadFile(path.Join("schemas", entry.Name()))
+		if err != nil {
+			log.Fatalf("Unable to read schema %s: %v", entry.Name(), err)
+		}
+		if err := compiler.AddResource(entry.Name(), bytes.NewReader(data)); err != nil {
+			log.Fatalf("Unable to load schema %s: %v", entry.Name(), err)
+		}
+	}
+
+	compiled := make(map[string]*jsonschema.Schema)
+	for _, entry := range entries {
+		schema, err := compiler.Compile(entry.Name())
+		if err != nil {
+			log.Fatalf("Unable to compile schema %s: %v", entry.Name(), err)
+		}
+		compiled[strings.TrimSuffix(entry.Name(), ".schema.json")] = schema
+	}
+
+	return compiled
+}
+
+// toJSONPath turns a JSON pointer such as /schedulerRoutine/steps/0 into $.schedulerRoutine.steps[0]
+func toJSONPath(pointer string) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, segment := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		segment = strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+		if _, err := strconv.Atoi(segment); err == nil {
+			b.WriteString("[" + segment + "]")
+		} else {
+			b.WriteString("." + segment)
+		}
+	}
+	return b.String()
+}
+
+func collectSchemaViolations(err *jsonschema.ValidationError, violations []Violation) []Violation {
+	if len(err.Causes) == 0 {
+		return append(violations, Violation{Path: toJSONPath(err.InstanceLocation), Message: err.Message})
+	}
+	for _, cause := range err.Causes {
+		violations = collectSchemaViolations(cause, violations)
+	}
+	return violations
+}
+
+// validateSchema checks body against a published schema and returns every violation
+func validateSchema(schemaName string, body []byte) ([]Violation, error) {
+	schema, ok := schemas[schemaName]
+	if !ok {
+		return nil, fmt.Errorf("unknown schema %s", schemaName)
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+
+	if err := schema.Validate(document); err != nil {
+		var validationErr *jsonschema.ValidationError
+		if errors.As(err, &validationErr) {
+			return collectSchemaViolations(validationErr, nil), nil
+		}
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// bindAndValidate reads the body, validates it against schemaName, decodes it into
+// target and runs the semantic checks. It writes 400/422 itself and returns false
+// when the handler should stop.
+func bindAndValidate(ctx *gin.Context, schemaName string, target interface{}, semantic func() []Violation) bool {
+	body, err := ctx.GetRawData()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	violations, err := validateSchema(schemaName, body)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	// A body that fails the schema may not decode into the struct; report what we have
+	if err := json.Unmarshal(body, target); err != nil {
+		if len(violations) == 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+	} else if semantic != nil {
+		violations = append(violations, semantic()...)
+	}
+
+	if len(violations) > 0 {
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      "Validation failed",
+			"violations": violations,
+		})
+		return false
+	}
+
+	return true
+}
+
+// validateRoutineStructure checks referential integrity the schema cannot express:
+// unique runtimes/steps/tasks, tasks pointing at declared runtimes and a parseable cron.
+func validateRoutineStructure(runtimes []Runtime, routine SchedulerRoutine) []Violation {
+	var violations []Violation
+
+	declaredRuntimes := make(map[string]bool)
+	for i, runtime := range runtimes {
+		if runtime.RuntimeName == "" {
+			continue
+		}
+		if declaredRuntimes[runtime.RuntimeName] {
+			violations = append(violations, Violation{
+				Path:    fmt.Sprintf("$.runtimes[%d].runtimeName", i),
+				Message: fmt.Sprintf("duplicate runtimeName %q", runtime.RuntimeName),
+			})
+		}
+		declaredRuntimes[runtime.RuntimeName] = true
+	}
+
+	if routine.Cron != "" {
+		if _, err := cronParser.Parse(routine.Cron); err != nil {
+			violations = append(violations, Violation{
+				Path:    "$.schedulerRoutine.cron",
+				Message: fmt.Sprintf("invalid cron expression: %v", err),
+			})
+		}
+	}
+
+	stepIds := make(map[string]bool)
+	taskIds := make(map[string]bool)
+	for i, step := range routine.Steps {
+		if step.StepId != "" {
+			if stepIds[step.StepId] {
+				violations = append(violations, Violation{
+					Path:    fmt.Sprintf("$.schedulerRoutine.steps[%d].stepId", i),
+					Message: fmt.Sprintf("duplicate stepId %q", step.StepId),
+				})
+			}
+			stepIds[step.StepId] = true
+		}
+
+		for k, task := range step.Tasks {
+			if task.TaskId != "" {
+				if taskIds[task.TaskId] {
+					violations = append(violations, Violation{
+						Path:    fmt.Sprintf("$.schedulerRoutine.steps[%d].tasks[%d].taskId", i, k),
+						Message: fmt.Sprintf("duplicate taskId %q", task.TaskId),
+					})
+				}
+				taskIds[task.TaskId] = true
+			}
+
+			if task.RuntimeName != "" && !declaredRuntimes[task.RuntimeName] {
+				violations = append(violations, Violation{
+					Path:    fmt.Sprintf("$.schedulerRoutine.steps[%d].tasks[%d].runtimeName", i, k),
+					Message: fmt.Sprintf("runtimeName %q is not declared in runtimes", task.RuntimeName),
+				})
+			}
+		}
+	}
+
+	return violations
+}
@@ -7,17 +7,76 @@ awslocal dynamodb create-table \
     --table-name jobs \
     --attribute-definitions \
         AttributeName=id,AttributeType=S \
+        AttributeName=account_id,AttributeType=S \
     --key-schema \
         AttributeName=id,KeyType=HASH \
+    --global-secondary-indexes \
+        "IndexName=account_id-index,KeySchema=[{AttributeName=account_id,KeyType=HASH}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
     --provisioned-throughput \
         ReadCapacityUnits=5,WriteCapacityUnits=5
 
+awslocal dynamodb create-table \
+    --table-name controlm_jobs \
+    --attribute-definitions \
+        AttributeName=id,AttributeType=S \
+        AttributeName=account_id,AttributeType=S \
+        AttributeName=created_at,AttributeType=S \
+    --key-schema \
+        AttributeName=id,KeyType=HASH \
+    --global-secondary-indexes \
+        "IndexName=account_id-created_at-index,KeySchema=[{AttributeName=account_id,KeyType=HASH},{AttributeName=created_at,KeyType=RANGE}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name controlm_folders \
+    --attribute-definitions \
+        AttributeName=account_id,AttributeType=S \
+        AttributeName=folder,AttributeType=S \
+    --key-schema \
+        AttributeName=account_id,KeyType=HASH \
+        AttributeName=folder,KeyType=RANGE \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name controlm_runs \
+    --attribute-definitions \
+        AttributeName=run_id,AttributeType=S \
+    --key-schema \
+        AttributeName=run_id,KeyType=HASH \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name controlm_operations \
+    --attribute-definitions \
+        AttributeName=id,AttributeType=S \
+    --key-schema \
+        AttributeName=id,KeyType=HASH \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb update-time-to-live \
+    --table-name controlm_operations \
+    --time-to-live-specification Enabled=true,AttributeName=expiresAt
+
 awslocal dynamodb create-table \
     --table-name executions \
     --attribute-definitions \
         AttributeName=executionName,AttributeType=S \
+        AttributeName=accountId,AttributeType=S \
+        AttributeName=timestamp,AttributeType=N \
+        AttributeName=originalName,AttributeType=S \
+        AttributeName=executionUuid,AttributeType=S \
     --key-schema \
         AttributeName=executionName,KeyType=HASH \
+    --global-secondary-indexes \
+        "IndexName=accountId-timestamp-index,KeySchema=[{AttributeName=accountId,KeyType=HASH},{AttributeName=timestamp,KeyType=RANGE}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+        "IndexName=originalName-timestamp-index,KeySchema=[{AttributeName=originalName,KeyType=HASH},{AttributeName=timestamp,KeyType=RANGE}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+        "IndexName=executionUuid-timestamp-index,KeySchema=[{AttributeName=executionUuid,KeyType=HASH},{AttributeName=timestamp,KeyType=RANGE}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+    --stream-specification \
+        StreamEnabled=true,StreamViewType=NEW_AND_OLD_IMAGES \
     --provisioned-throughput \
         ReadCapacityUnits=5,WriteCapacityUnits=5
 
@@ -25,8 +84,14 @@ awslocal dynamodb create-table \
     --table-name schedules \
     --attribute-definitions \
         AttributeName=id,AttributeType=S \
+        AttributeName=account_id,AttributeType=S \
+        AttributeName=created_at,AttributeType=S \
+        AttributeName=job_id,AttributeType=S \
     --key-schema \
         AttributeName=id,KeyType=HASH \
+    --global-secondary-indexes \
+        "IndexName=account_id-created_at-index,KeySchema=[{AttributeName=account_id,KeyType=HASH},{AttributeName=created_at,KeyType=RANGE}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+        "IndexName=job_id-index,KeySchema=[{AttributeName=job_id,KeyType=HASH}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
     --provisioned-throughput \
         ReadCapacityUnits=5,WriteCapacityUnits=5
 
@@ -34,8 +99,14 @@ awslocal dynamodb create-table \
     --table-name adapters \
     --attribute-definitions \
         AttributeName=id,AttributeType=S \
+        AttributeName=account_id,AttributeType=S \
+        AttributeName=created_at,AttributeType=S \
+        AttributeName=schedule_id,AttributeType=S \
     --key-schema \
         AttributeName=id,KeyType=HASH \
+    --global-secondary-indexes \
+        "IndexName=account_id-created_at-index,KeySchema=[{AttributeName=account_id,KeyType=HASH},{AttributeName=created_at,KeyType=RANGE}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+        "IndexName=schedule_id-index,KeySchema=[{AttributeName=schedule_id,KeyType=HASH}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
     --provisioned-throughput \
         ReadCapacityUnits=5,WriteCapacityUnits=5
 
@@ -43,8 +114,297 @@ awslocal dynamodb create-table \
     --table-name queue_messages \
     --attribute-definitions \
         AttributeName=id,AttributeType=S \
+        AttributeName=account_id,AttributeType=S \
+        AttributeName=created_at,AttributeType=S \
+        AttributeName=adapter_id,AttributeType=S \
     --key-schema \
         AttributeName=id,KeyType=HASH \
+    --global-secondary-indexes \
+        "IndexName=account_id-created_at-index,KeySchema=[{AttributeName=account_id,KeyType=HASH},{AttributeName=created_at,KeyType=RANGE}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+        "IndexName=adapter_id-index,KeySchema=[{AttributeName=adapter_id,KeyType=HASH}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name routine_definitions \
+    --attribute-definitions \
+        AttributeName=routineKey,AttributeType=S \
+        AttributeName=version,AttributeType=N \
+        AttributeName=accountId,AttributeType=S \
+        AttributeName=routineName,AttributeType=S \
+    --key-schema \
+        AttributeName=routineKey,KeyType=HASH \
+        AttributeName=version,KeyType=RANGE \
+    --global-secondary-indexes \
+        "IndexName=accountId-routineName-index,KeySchema=[{AttributeName=accountId,KeyType=HASH},{AttributeName=routineName,KeyType=RANGE}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name tenant_usage \
+    --attribute-definitions \
+        AttributeName=accountId,AttributeType=S \
+    --key-schema \
+        AttributeName=accountId,KeyType=HASH \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name execution_slots \
+    --attribute-definitions \
+        AttributeName=executionUuid,AttributeType=S \
+    --key-schema \
+        AttributeName=executionUuid,KeyType=HASH \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name audit_log \
+    --attribute-definitions \
+        AttributeName=auditId,AttributeType=S \
+        AttributeName=accountId,AttributeType=S \
+        AttributeName=actor,AttributeType=S \
+        AttributeName=target,AttributeType=S \
+        AttributeName=timestamp,AttributeType=N \
+    --key-schema \
+        AttributeName=auditId,KeyType=HASH \
+    --global-secondary-indexes \
+        "IndexName=accountId-timestamp-index,KeySchema=[{AttributeName=accountId,KeyType=HASH},{AttributeName=timestamp,KeyType=RANGE}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+        "IndexName=actor-timestamp-index,KeySchema=[{AttributeName=actor,KeyType=HASH},{AttributeName=timestamp,KeyType=RANGE}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+        "IndexName=target-timestamp-index,KeySchema=[{AttributeName=target,KeyType=HASH},{AttributeName=timestamp,KeyType=RANGE}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name webhook_subscriptions \
+    --attribute-definitions \
+        AttributeName=id,AttributeType=S \
+        AttributeName=accountId,AttributeType=S \
+    --key-schema \
+        AttributeName=id,KeyType=HASH \
+    --global-secondary-indexes \
+        "IndexName=accountId-index,KeySchema=[{AttributeName=accountId,KeyType=HASH}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name webhook_deliveries \
+    --attribute-definitions \
+        AttributeName=deliveryId,AttributeType=S \
+        AttributeName=subscriptionId,AttributeType=S \
+        AttributeName=timestamp,AttributeType=N \
+    --key-schema \
+        AttributeName=deliveryId,KeyType=HASH \
+    --global-secondary-indexes \
+        "IndexName=subscriptionId-timestamp-index,KeySchema=[{AttributeName=subscriptionId,KeyType=HASH},{AttributeName=timestamp,KeyType=RANGE}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name webhook_outbox \
+    --attribute-definitions \
+        AttributeName=outboxId,AttributeType=S \
+    --key-schema \
+        AttributeName=outboxId,KeyType=HASH \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb update-time-to-live \
+    --table-name webhook_outbox \
+    --time-to-live-specification Enabled=true,AttributeName=expiresAt
+
+awslocal dynamodb create-table \
+    --table-name routine_slas \
+    --attribute-definitions \
+        AttributeName=routineName,AttributeType=S \
+        AttributeName=accountId,AttributeType=S \
+    --key-schema \
+        AttributeName=routineName,KeyType=HASH \
+    --global-secondary-indexes \
+        "IndexName=accountId-index,KeySchema=[{AttributeName=accountId,KeyType=HASH}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name sla_breaches \
+    --attribute-definitions \
+        AttributeName=breachId,AttributeType=S \
+        AttributeName=accountId,AttributeType=S \
+        AttributeName=timestamp,AttributeType=N \
+    --key-schema \
+        AttributeName=breachId,KeyType=HASH \
+    --global-secondary-indexes \
+        "IndexName=accountId-timestamp-index,KeySchema=[{AttributeName=accountId,KeyType=HASH},{AttributeName=timestamp,KeyType=RANGE}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name idempotency_keys \
+    --attribute-definitions \
+        AttributeName=accountId,AttributeType=S \
+        AttributeName=idempotencyKey,AttributeType=S \
+    --key-schema \
+        AttributeName=accountId,KeyType=HASH \
+        AttributeName=idempotencyKey,KeyType=RANGE \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb update-time-to-live \
+    --table-name idempotency_keys \
+    --time-to-live-specification Enabled=true,AttributeName=expiresAt
+
+awslocal dynamodb create-table \
+    --table-name routine_concurrency \
+    --attribute-definitions \
+        AttributeName=accountId,AttributeType=S \
+        AttributeName=routineName,AttributeType=S \
+    --key-schema \
+        AttributeName=accountId,KeyType=HASH \
+        AttributeName=routineName,KeyType=RANGE \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name queued_starts \
+    --attribute-definitions \
+        AttributeName=accountId,AttributeType=S \
+        AttributeName=queueKey,AttributeType=S \
+        AttributeName=executionUuid,AttributeType=S \
+    --key-schema \
+        AttributeName=accountId,KeyType=HASH \
+        AttributeName=queueKey,KeyType=RANGE \
+    --global-secondary-indexes \
+        "IndexName=executionUuid-index,KeySchema=[{AttributeName=executionUuid,KeyType=HASH}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb update-time-to-live \
+    --table-name queued_starts \
+    --time-to-live-specification Enabled=true,AttributeName=expiresAt
+
+awslocal dynamodb create-table \
+    --table-name resource_pools \
+    --attribute-definitions \
+        AttributeName=accountId,AttributeType=S \
+        AttributeName=poolName,AttributeType=S \
+    --key-schema \
+        AttributeName=accountId,KeyType=HASH \
+        AttributeName=poolName,KeyType=RANGE \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name resource_leases \
+    --attribute-definitions \
+        AttributeName=poolKey,AttributeType=S \
+        AttributeName=leaseId,AttributeType=S \
+    --key-schema \
+        AttributeName=poolKey,KeyType=HASH \
+        AttributeName=leaseId,KeyType=RANGE \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb update-time-to-live \
+    --table-name resource_leases \
+    --time-to-live-specification Enabled=true,AttributeName=expiresAt
+
+awslocal dynamodb create-table \
+    --table-name control_resources \
+    --attribute-definitions \
+        AttributeName=resourceKey,AttributeType=S \
+        AttributeName=holderId,AttributeType=S \
+        AttributeName=executionUuid,AttributeType=S \
+        AttributeName=accountId,AttributeType=S \
+    --key-schema \
+        AttributeName=resourceKey,KeyType=HASH \
+        AttributeName=holderId,KeyType=RANGE \
+    --global-secondary-indexes \
+        "IndexName=executionUuid-index,KeySchema=[{AttributeName=executionUuid,KeyType=HASH}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+        "IndexName=accountId-index,KeySchema=[{AttributeName=accountId,KeyType=HASH}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name conditions \
+    --attribute-definitions \
+        AttributeName=accountId,AttributeType=S \
+        AttributeName=conditionKey,AttributeType=S \
+    --key-schema \
+        AttributeName=accountId,KeyType=HASH \
+        AttributeName=conditionKey,KeyType=RANGE \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name approvals \
+    --attribute-definitions \
+        AttributeName=accountId,AttributeType=S \
+        AttributeName=approvalId,AttributeType=S \
+    --key-schema \
+        AttributeName=accountId,KeyType=HASH \
+        AttributeName=approvalId,KeyType=RANGE \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name execution_links \
+    --attribute-definitions \
+        AttributeName=parentExecutionUuid,AttributeType=S \
+        AttributeName=childExecutionUuid,AttributeType=S \
+    --key-schema \
+        AttributeName=parentExecutionUuid,KeyType=HASH \
+        AttributeName=childExecutionUuid,KeyType=RANGE \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name execution_waits \
+    --attribute-definitions \
+        AttributeName=accountId,AttributeType=S \
+        AttributeName=waitKey,AttributeType=S \
+        AttributeName=executionUuid,AttributeType=S \
+    --key-schema \
+        AttributeName=accountId,KeyType=HASH \
+        AttributeName=waitKey,KeyType=RANGE \
+    --global-secondary-indexes \
+        "IndexName=executionUuid-index,KeySchema=[{AttributeName=executionUuid,KeyType=HASH}],Projection={ProjectionType=ALL},ProvisionedThroughput={ReadCapacityUnits=5,WriteCapacityUnits=5}" \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb update-time-to-live \
+    --table-name execution_waits \
+    --time-to-live-specification Enabled=true,AttributeName=expiresAt
+
+awslocal dynamodb create-table \
+    --table-name calendars \
+    --attribute-definitions \
+        AttributeName=account_id,AttributeType=S \
+        AttributeName=name,AttributeType=S \
+    --key-schema \
+        AttributeName=account_id,KeyType=HASH \
+        AttributeName=name,KeyType=RANGE \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name acronym_pauses \
+    --attribute-definitions \
+        AttributeName=account_id,AttributeType=S \
+        AttributeName=acronym,AttributeType=S \
+    --key-schema \
+        AttributeName=account_id,KeyType=HASH \
+        AttributeName=acronym,KeyType=RANGE \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5
+
+awslocal dynamodb create-table \
+    --table-name backfills \
+    --attribute-definitions \
+        AttributeName=account_id,AttributeType=S \
+        AttributeName=id,AttributeType=S \
+    --key-schema \
+        AttributeName=account_id,KeyType=HASH \
+        AttributeName=id,KeyType=RANGE \
     --provisioned-throughput \
         ReadCapacityUnits=5,WriteCapacityUnits=5
 
@@ -0,0 +1,835 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Backfill states. Pausing or cancelling stops new runs from starting; runs
+// already started in JMI are still followed to the end.
+const (
+	BackfillStatusRunning   = "running"
+	BackfillStatusPaused    = "paused"
+	BackfillStatusCancelled = "cancelled"
+	BackfillStatusCompleted = "completed"
+)
+
+// Backfill run states
+const (
+	BackfillRunPending   = "pending"
+	BackfillRunRunning   = "running"
+	BackfillRunSucceeded = "succeeded"
+	BackfillRunFailed    = "failed"
+	BackfillRunSkipped   = "skipped" // the backfill was cancelled before the run started
+)
+
+const (
+	defaultBackfillConcurrency = 1
+	maxBackfillConcurrency     = 10
+	maxBackfillRuns            = 1000
+)
+
+var errBackfillNotFound = errors.New("backfill not found")
+
+// BackfillRequest is the body of POST /schedules/:id/backfill. From and To are
+// dates (YYYY-MM-DD, To inclusive) in the schedule's timezone, or RFC3339 timestamps.
+type BackfillRequest struct {
+	From          string                 `json:"from"`
+	To            string                 `json:"to"`
+	Concurrency   int                    `json:"concurrency,omitempty"`
+	ExecutionName string                 `json:"execution_name,omitempty"` // defaults to the schedule's
+	Parameters    map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// BackfillRun is the execution of one missed fire time
+type BackfillRun struct {
+	FireTime      time.Time  `json:"fire_time" dynamodbav:"fire_time"`
+	EventDate     string     `json:"event_date" dynamodbav:"event_date"`
+	Status        string     `json:"status" dynamodbav:"status"`
+	ExecutionUuid string     `json:"execution_uuid,omitempty" dynamodbav:"execution_uuid,omitempty"`
+	Error         string     `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	StartedAt     *time.Time `json:"started_at,omitempty" dynamodbav:"started_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty" dynamodbav:"finished_at,omitempty"`
+}
+
+// BackfillCounts summarises the runs of a backfill by state
+type BackfillCounts struct {
+	Pending   int `json:"pending" dynamodbav:"pending"`
+	Running   int `json:"running" dynamodbav:"running"`
+	Succeeded int `json:"succeeded" dynamodbav:"succeeded"`
+	Failed    int `json:"failed" dynamodbav:"failed"`
+	Skipped   int `json:"skipped" dynamodbav:"skipped"`
+}
+
+// Backfill re-runs a schedule once per fire time of a past date range
+type Backfill struct {
+	ID            string                 `json:"id" dynamodbav:"id"`
+	AccountId     string                 `json:"account_id" dynamodbav:"account_id"`
+	ScheduleID    string                 `json:"schedule_id" dynamodbav:"schedule_id"`
+	ExecutionName string                 `json:"execution_name" dynamodbav:"execution_name"`
+	Acronym       string                 `json:"acronym,omitempty" dynamodbav:"acronym,omitempty"`
+	From          time.Time              `json:"from" dynamodbav:"from"`
+	To            time.Time              `json:"to" dynamodbav:"to"`
+	Concurrency   int                    `json:"concurrency" dynamodbav:"concurrency"`
+	Parameters    map[string]interface{} `json:"parameters,omitempty" dynamodbav:"parameters,omitempty"`
+	Status        string                 `json:"status" dynamodbav:"status"`
+	StatusReason  string                 `json:"status_reason,omitempty" dynamodbav:"status_reason,omitempty"`
+	Counts        BackfillCounts         `json:"counts" dynamodbav:"counts"`
+	Runs          []BackfillRun          `json:"runs" dynamodbav:"runs"`
+	RequestedBy   string                 `json:"requested_by" dynamodbav:"requested_by"`
+	Acronyms      []string               `json:"-" dynamodbav:"acronyms,omitempty"` // caller scope, replayed to JMI
+	CreatedAt     time.Time              `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at" dynamodbav:"updated_at"`
+	CompletedAt   *time.Time             `json:"completed_at,omitempty" dynamodbav:"completed_at,omitempty"`
+}
+
+// count refreshes Counts from the runs
+func (b *Backfill) count() {
+	b.Counts = BackfillCounts{}
+	for _, run := range b.Runs {
+		switch run.Status {
+		case BackfillRunPending:
+			b.Counts.Pending++
+		case BackfillRunRunning:
+			b.Counts.Running++
+		case BackfillRunSucceeded:
+			b.Counts.Succeeded++
+		case BackfillRunFailed:
+			b.Counts.Failed++
+		case BackfillRunSkipped:
+			b.Counts.Skipped++
+		}
+	}
+}
+
+// nextPending returns the index of the earliest pending run, or -1
+func (b *Backfill) nextPending() int {
+	for i, run := range b.Runs {
+		if run.Status == BackfillRunPending {
+			return i
+		}
+	}
+	return -1
+}
+
+// backfillRunner drives one backfill; the service keeps at most one per backfill
+type backfillRunner struct {
+	mu       sync.Mutex
+	backfill *Backfill
+	wake     chan struct{}
+	done     bool
+}
+
+// signal wakes the runner up after its backfill was resumed
+func (r *backfillRunner) signal() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *SchedulerPluginService) backfillTableName() string {
+	if s.backfillTable == "" {
+		return "backfills"
+	}
+	return s.backfillTable
+}
+
+// parseBackfillBound reads a date or an RFC3339 timestamp. A date bound covers
+// the whole day in location, so the end of a "to" date is the next midnight.
+func parseBackfillBound(value, name string, location *time.Location, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("%s is required", name)
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		if end {
+			parsed = parsed.Add(time.Nanosecond)
+		}
+		return parsed, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be a date (YYYY-MM-DD) or an RFC3339 timestamp", name)
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// backfillRuns lists the fire times of the plan in [from, to)
+func backfillRuns(plan *runPlan, from, to time.Time) ([]BackfillRun, error) {
+	var runs []BackfillRun
+	after := from.Add(-time.Nanosecond)
+	for {
+		fire := plan.next(after)
+		if fire.IsZero() || !fire.Before(to) {
+			return runs, nil
+		}
+		if len(runs) == maxBackfillRuns {
+			return nil, fmt.Errorf("the range has more than %d runs; split it into smaller backfills", maxBackfillRuns)
+		}
+		runs = append(runs, BackfillRun{
+			FireTime:  fire.UTC(),
+			EventDate: fire.In(plan.location).Format("2006-01-02"),
+			Status:    BackfillRunPending,
+		})
+		after = fire
+	}
+}
+
+// getBackfill loads one of the account's backfills
+func (s *SchedulerPluginService) getBackfill(accountId, id string) (*Backfill, error) {
+	result, err := s.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(s.backfillTableName()),
+		Key: map[string]types.AttributeValue{
+			"account_id": &types.AttributeValueMemberS{Value: accountId},
+			"id":         &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errBackfillNotFound
+	}
+
+	var backfill Backfill
+	if err := attributevalue.UnmarshalMap(result.Item, &backfill); err != nil {
+		return nil, err
+	}
+	return &backfill, nil
+}
+
+// putBackfill stores the backfill with fresh counts
+func (s *SchedulerPluginService) putBackfill(backfill *Backfill) error {
+	backfill.count()
+	backfill.UpdatedAt = time.Now()
+	item, err := attributevalue.MarshalMap(backfill)
+	if err != nil {
+		return err
+	}
+	_, err = s.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(s.backfillTableName()),
+		Item:      item,
+	})
+	return err
+}
+
+// CreateBackfill starts one execution per fire time of the schedule between
+// from and to, with the logical eventDate of each run in its parameters
+func (s *SchedulerPluginService) CreateBackfill(ctx *gin.Context) {
+	id := ctx.Param("id")
+	setAuditTarget(ctx, "schedule/"+id)
+
+	var req BackfillRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Concurrency == 0 {
+		req.Concurrency = defaultBackfillConcurrency
+	}
+	if req.Concurrency < 1 || req.Concurrency > maxBackfillConcurrency {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("concurrency must be between 1 and %d", maxBackfillConcurrency)})
+		return
+	}
+
+	schedule := s.loadSchedule(ctx, id)
+	if schedule == nil {
+		return
+	}
+	identity := identityFrom(ctx)
+	if schedule.Acronym != "" && !identity.CanAccessAcronym(schedule.Acronym) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Acronym " + schedule.Acronym + " is not accessible to the caller"})
+		return
+	}
+
+	executionName := strings.TrimSpace(req.ExecutionName)
+	if executionName == "" {
+		executionName = schedule.ExecutionName
+	}
+	if executionName == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "execution_name is required: the schedule has none"})
+		return
+	}
+
+	plan, err := s.planFor(schedule.AccountId, schedule)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseBackfillBound(req.From, "from", plan.location, false)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseBackfillBound(req.To, "to", plan.location, true)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !from.Before(to) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+	if to.After(time.Now()) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "to must not be in the future"})
+		return
+	}
+
+	runs, err := backfillRuns(plan, from, to)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(runs) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "the schedule has no runs between from and to"})
+		return
+	}
+
+	now := time.Now()
+	backfill := &Backfill{
+		ID:            uuid.New().String(),
+		AccountId:     identity.AccountId,
+		ScheduleID:    schedule.ID,
+		ExecutionName: executionName,
+		Acronym:       schedule.Acronym,
+		From:          from.UTC(),
+		To:            to.UTC(),
+		Concurrency:   req.Concurrency,
+		Parameters:    req.Parameters,
+		Status:        BackfillStatusRunning,
+		Runs:          runs,
+		RequestedBy:   identity.Subject,
+		Acronyms:      identity.Acronyms,
+		CreatedAt:     now,
+	}
+	if err := s.putBackfill(backfill); err != nil {
+		log.Printf("Error storing backfill %s: %v", backfill.ID, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store backfill"})
+		return
+	}
+
+	s.startBackfillRunner(backfill)
+	log.Printf("Scheduler Plugin started backfill %s of schedule %s with %d runs", backfill.ID, schedule.ID, len(runs))
+	ctx.JSON(http.StatusCreated, backfill)
+}
+
+// GetBackfills lists the caller's backfills, newest first, optionally by schedule_id and status
+func (s *SchedulerPluginService) GetBackfills(ctx *gin.Context) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.backfillTableName()),
+		KeyConditionExpression: aws.String("account_id = :accountId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: identityFrom(ctx).AccountId},
+		},
+	}
+	filter := newQueryFilter()
+	filter.equals("schedule_id", ctx.Query("schedule_id"))
+	filter.equals("status", ctx.Query("status"))
+	filter.apply(input)
+
+	var backfills []Backfill
+	paginator := dynamodb.NewQueryPaginator(s.dynamoClient, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error querying backfills: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve backfills"})
+			return
+		}
+		var items []Backfill
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			log.Printf("Error unmarshaling backfills: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process backfills data"})
+			return
+		}
+		backfills = append(backfills, items...)
+	}
+
+	sort.Slice(backfills, func(i, j int) bool {
+		return backfills[i].CreatedAt.After(backfills[j].CreatedAt)
+	})
+	// Runs are only listed by GET /backfills/:id
+	for i := range backfills {
+		backfills[i].Runs = nil
+	}
+	if backfills == nil {
+		backfills = []Backfill{}
+	}
+	ctx.JSON(http.StatusOK, backfills)
+}
+
+// GetBackfill returns a backfill with the state of each of its runs
+func (s *SchedulerPluginService) GetBackfill(ctx *gin.Context) {
+	backfill := s.loadBackfill(ctx)
+	if backfill == nil {
+		return
+	}
+	ctx.JSON(http.StatusOK, backfill)
+}
+
+// loadBackfill answers 404/500 itself and returns nil when the backfill is unusable.
+// A backfill that is being run is read from its runner, which holds the latest state.
+func (s *SchedulerPluginService) loadBackfill(ctx *gin.Context) *Backfill {
+	id := ctx.Param("id")
+	accountId := identityFrom(ctx).AccountId
+
+	if runner := s.backfillRunner(id); runner != nil {
+		runner.mu.Lock()
+		defer runner.mu.Unlock()
+		if !runner.done && runner.backfill.AccountId == accountId {
+			snapshot := *runner.backfill
+			snapshot.Runs = append([]BackfillRun(nil), runner.backfill.Runs...)
+			snapshot.count()
+			return &snapshot
+		}
+	}
+
+	backfill, err := s.getBackfill(accountId, id)
+	if errors.Is(err, errBackfillNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Backfill not found"})
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error loading backfill %s: %v", id, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load backfill"})
+		return nil
+	}
+	return backfill
+}
+
+// PauseBackfill stops the backfill from starting new runs until it is resumed
+func (s *SchedulerPluginService) PauseBackfill(ctx *gin.Context) {
+	s.changeBackfillStatus(ctx, BackfillStatusPaused)
+}
+
+// ResumeBackfill lets a paused backfill start its pending runs again
+func (s *SchedulerPluginService) ResumeBackfill(ctx *gin.Context) {
+	s.changeBackfillStatus(ctx, BackfillStatusRunning)
+}
+
+// CancelBackfill skips every run that has not started yet
+func (s *SchedulerPluginService) CancelBackfill(ctx *gin.Context) {
+	s.changeBackfillStatus(ctx, BackfillStatusCancelled)
+}
+
+// changeBackfillStatus applies a pause, resume or cancel, through the runner
+// when the backfill is being run
+func (s *SchedulerPluginService) changeBackfillStatus(ctx *gin.Context, status string) {
+	id := ctx.Param("id")
+	setAuditTarget(ctx, "backfill/"+id)
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	backfill := s.loadBackfill(ctx)
+	if backfill == nil {
+		return
+	}
+	if backfill.Acronym != "" && !identityFrom(ctx).CanAccessAcronym(backfill.Acronym) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Acronym " + backfill.Acronym + " is not accessible to the caller"})
+		return
+	}
+
+	s.backfillMu.Lock()
+	defer s.backfillMu.Unlock()
+
+	runner := s.backfillRunners[id]
+	if runner != nil {
+		runner.mu.Lock()
+		defer runner.mu.Unlock()
+		if runner.done {
+			runner = nil
+		} else {
+			backfill = runner.backfill
+		}
+	}
+
+	switch {
+	case backfill.Status == BackfillStatusCompleted || backfill.Status == BackfillStatusCancelled:
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Backfill is already " + backfill.Status})
+		return
+	case status == BackfillStatusPaused && backfill.Status != BackfillStatusRunning:
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Backfill is not running"})
+		return
+	case status == BackfillStatusRunning && backfill.Status != BackfillStatusPaused:
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Backfill is not paused"})
+		return
+	}
+
+	backfill.Status = status
+	backfill.StatusReason = strings.TrimSpace(req.Reason)
+	if status == BackfillStatusCancelled {
+		for i := range backfill.Runs {
+			if backfill.Runs[i].Status == BackfillRunPending {
+				backfill.Runs[i].Status = BackfillRunSkipped
+			}
+		}
+	}
+	if err := s.putBackfill(backfill); err != nil {
+		log.Printf("Error storing backfill %s: %v", id, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store backfill"})
+		return
+	}
+
+	if runner != nil {
+		runner.signal()
+	} else if status == BackfillStatusRunning {
+		s.launchBackfillRunner(backfill)
+	}
+
+	log.Printf("Scheduler Plugin backfill %s is now %s", id, status)
+	snapshot := *backfill
+	snapshot.Runs = append([]BackfillRun(nil), backfill.Runs...)
+	ctx.JSON(http.StatusOK, snapshot)
+}
+
+// backfillRunner returns the live runner of a backfill, if any
+func (s *SchedulerPluginService) backfillRunner(id string) *backfillRunner {
+	s.backfillMu.Lock()
+	defer s.backfillMu.Unlock()
+	return s.backfillRunners[id]
+}
+
+// startBackfillRunner runs the backfill in the background
+func (s *SchedulerPluginService) startBackfillRunner(backfill *Backfill) {
+	s.backfillMu.Lock()
+	defer s.backfillMu.Unlock()
+	s.launchBackfillRunner(backfill)
+}
+
+// launchBackfillRunner expects backfillMu to be held
+func (s *SchedulerPluginService) launchBackfillRunner(backfill *Backfill) {
+	runner := &backfillRunner{backfill: backfill, wake: make(chan struct{}, 1)}
+	s.backfillRunners[backfill.ID] = runner
+	go s.runBackfill(runner)
+}
+
+// runBackfill starts pending runs up to the backfill's concurrency and follows
+// them until they finish. It returns once nothing is in flight and the backfill
+// is completed, paused or cancelled.
+func (s *SchedulerPluginService) runBackfill(runner *backfillRunner) {
+	runner.mu.Lock()
+	finished := make(chan struct{}, len(runner.backfill.Runs))
+	runner.mu.Unlock()
+	inFlight := 0
+	track := func(index int) {
+		inFlight++
+		go func() {
+			s.executeBackfillRun(runner, index)
+			finished <- struct{}{}
+		}()
+	}
+
+	// Runs left in flight by a previous instance are followed again
+	runner.mu.Lock()
+	for i, run := range runner.backfill.Runs {
+		if run.Status == BackfillRunRunning {
+			track(i)
+		}
+	}
+	runner.mu.Unlock()
+
+	for {
+		runner.mu.Lock()
+		backfill := runner.backfill
+		for backfill.Status == BackfillStatusRunning && inFlight < backfill.Concurrency {
+			index := backfill.nextPending()
+			if index < 0 {
+				break
+			}
+			now := time.Now()
+			backfill.Runs[index].Status = BackfillRunRunning
+			backfill.Runs[index].StartedAt = &now
+			track(index)
+		}
+
+		if inFlight == 0 && (backfill.Status != BackfillStatusRunning || backfill.nextPending() < 0) {
+			if backfill.Status == BackfillStatusRunning {
+				now := time.Now()
+				backfill.Status = BackfillStatusCompleted
+				backfill.CompletedAt = &now
+			}
+			if err := s.putBackfill(backfill); err != nil {
+				log.Printf("Error storing backfill %s: %v", backfill.ID, err)
+			}
+			runner.done = true
+			runner.mu.Unlock()
+
+			s.backfillMu.Lock()
+			if s.backfillRunners[backfill.ID] == runner {
+				delete(s.backfillRunners, backfill.ID)
+			}
+			s.backfillMu.Unlock()
+			log.Printf("Scheduler Plugin backfill %s stopped as %s", backfill.ID, backfill.Status)
+			return
+		}
+
+		if err := s.putBackfill(backfill); err != nil {
+			log.Printf("Error storing backfill %s: %v", backfill.ID, err)
+		}
+		runner.mu.Unlock()
+
+		select {
+		case <-s.receiveCtx.Done():
+			log.Printf("Backfill %s runner stopped", backfill.ID)
+			return
+		case <-finished:
+			inFlight--
+		case <-runner.wake:
+		}
+	}
+}
+
+// executeBackfillRun starts one run in JMI, unless it already was, and waits
+// for the execution to end
+func (s *SchedulerPluginService) executeBackfillRun(runner *backfillRunner, index int) {
+	runner.mu.Lock()
+	backfill := runner.backfill
+	run := backfill.Runs[index]
+	executionName := backfill.ExecutionName
+	parameters := make(map[string]interface{}, len(backfill.Parameters)+3)
+	for key, value := range backfill.Parameters {
+		parameters[key] = value
+	}
+	parameters["eventDate"] = run.EventDate
+	parameters["fireTime"] = run.FireTime.UTC().Format(time.RFC3339)
+	parameters["backfillId"] = backfill.ID
+	runner.mu.Unlock()
+
+	finish := func(status, message string) {
+		runner.mu.Lock()
+		defer runner.mu.Unlock()
+		now := time.Now()
+		backfill.Runs[index].Status = status
+		backfill.Runs[index].Error = message
+		backfill.Runs[index].FinishedAt = &now
+	}
+
+	executionUuid := run.ExecutionUuid
+	for executionUuid == "" {
+		started, retry, err := s.startJMIExecution(backfill, index, executionName, parameters)
+		if err == nil {
+			executionUuid = started
+			break
+		}
+		if !retry {
+			log.Printf("Error starting backfill %s run %s: %v", backfill.ID, run.EventDate, err)
+			finish(BackfillRunFailed, err.Error())
+			return
+		}
+		if !s.waitBackfillPoll() {
+			return
+		}
+	}
+
+	runner.mu.Lock()
+	backfill.Runs[index].ExecutionUuid = executionUuid
+	if err := s.putBackfill(backfill); err != nil {
+		log.Printf("Error storing backfill %s: %v", backfill.ID, err)
+	}
+	runner.mu.Unlock()
+	log.Printf("Scheduler Plugin backfill %s started execution %s for %s", backfill.ID, executionUuid, run.EventDate)
+
+	for {
+		if !s.waitBackfillPoll() {
+			return
+		}
+		status, retry, err := s.jmiExecutionStatus(backfill, executionUuid)
+		if err != nil {
+			log.Printf("Error polling execution %s of backfill %s: %v", executionUuid, backfill.ID, err)
+			if !retry {
+				finish(BackfillRunFailed, err.Error())
+				return
+			}
+			continue
+		}
+		switch status {
+		case "succeeded":
+			finish(BackfillRunSucceeded, "")
+			return
+		case "failed", "stopped":
+			finish(BackfillRunFailed, "execution "+status)
+			return
+		}
+	}
+}
+
+// waitBackfillPoll sleeps BACKFILL_POLL_INTERVAL seconds (default 5) and
+// reports false when the service is shutting down
+func (s *SchedulerPluginService) waitBackfillPoll() bool {
+	interval := 5 * time.Second
+	if value, err := strconv.Atoi(os.Getenv("BACKFILL_POLL_INTERVAL")); err == nil && value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+	select {
+	case <-s.receiveCtx.Done():
+		return false
+	case <-time.After(interval):
+		return true
+	}
+}
+
+// jmiRequest calls JMI on behalf of the backfill's requester. A non-empty
+// idempotencyKey lets JMI answer a repeated call with its first answer.
+func (s *SchedulerPluginService) jmiRequest(backfill *Backfill, method, path string, body interface{}, idempotencyKey string) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %v", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(s.receiveCtx, method, s.jmiURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build JMI request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.jmiAPIKey != "" {
+		req.Header.Set("X-API-Key", s.jmiAPIKey)
+	}
+	// JMI_API_KEY is a service key, which acts for the tenant named here
+	req.Header.Set("X-Account-Id", backfill.AccountId)
+	req.Header.Set("X-Subject", backfill.RequestedBy)
+	if len(backfill.Acronyms) > 0 {
+		req.Header.Set("X-Acronyms", strings.Join(backfill.Acronyms, ","))
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := s.jmiClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call JMI: %v", err)
+	}
+	return resp, nil
+}
+
+// startJMIExecution starts one execution and returns its UUID. Any 2xx with
+// a UUID is a start: a routine with the queue policy answers 202 and runs it
+// later. retry is true when JMI could not take it now (unreachable, throttled
+// or unavailable). The Idempotency-Key names the run, so a start whose answer
+// was lost, or that a restarted instance makes again, is not made twice.
+func (s *SchedulerPluginService) startJMIExecution(backfill *Backfill, index int, executionName string, parameters map[string]interface{}) (string, bool, error) {
+	resp, err := s.jmiRequest(backfill, http.MethodPost, "/startExecution", gin.H{
+		"executionName": executionName,
+		"parameters":    parameters,
+	}, backfillRunKey(backfill.ID, index))
+	if err != nil {
+		return "", true, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ExecutionUuid string `json:"executionUuid"`
+		Error         string `json:"error"`
+		OverlapPolicy string `json:"overlapPolicy"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&result)
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		return "", true, fmt.Errorf("JMI returned status %d", resp.StatusCode)
+	case resp.StatusCode == http.StatusConflict && result.OverlapPolicy == "":
+		// The same key is still being answered, not a routine at its limit
+		return "", true, fmt.Errorf("JMI returned status %d: %s", resp.StatusCode, result.Error)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		if result.Error != "" {
+			return "", false, fmt.Errorf("JMI returned status %d: %s", resp.StatusCode, result.Error)
+		}
+		return "", false, fmt.Errorf("JMI returned status %d", resp.StatusCode)
+	case decodeErr != nil || result.ExecutionUuid == "":
+		return "", false, errors.New("JMI returned no executionUuid")
+	}
+	return result.ExecutionUuid, false, nil
+}
+
+// backfillRunKey is the Idempotency-Key of the start of one run
+func backfillRunKey(backfillId string, index int) string {
+	return "backfill-" + backfillId + "-" + strconv.Itoa(index)
+}
+
+// jmiExecutionStatus reads the status of an execution from JMI. retry is
+// false when JMI will not answer for it (gone, or no longer the requester's).
+func (s *SchedulerPluginService) jmiExecutionStatus(backfill *Backfill, executionUuid string) (string, bool, error) {
+	resp, err := s.jmiRequest(backfill, http.MethodGet, "/executions/"+executionUuid, nil, "")
+	if err != nil {
+		return "", true, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		return "", true, fmt.Errorf("JMI returned status %d", resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return "", false, fmt.Errorf("JMI returned status %d for execution %s", resp.StatusCode, executionUuid)
+	}
+	var result struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", true, fmt.Errorf("failed to decode JMI response: %v", err)
+	}
+	return result.Status, true, nil
+}
+
+// resumeBackfills picks up the backfills left running, or with runs in flight,
+// by a previous instance
+func (s *SchedulerPluginService) resumeBackfills() {
+	paginator := dynamodb.NewScanPaginator(s.dynamoClient, &dynamodb.ScanInput{
+		TableName:        aws.String(s.backfillTableName()),
+		FilterExpression: aws.String("#status = :running OR counts.running > :none"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":running": &types.AttributeValueMemberS{Value: BackfillStatusRunning},
+			":none":    &types.AttributeValueMemberN{Value: "0"},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error scanning backfills: %v", err)
+			return
+		}
+		var backfills []Backfill
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &backfills); err != nil {
+			log.Printf("Error unmarshaling backfills: %v", err)
+			return
+		}
+		for i := range backfills {
+			log.Printf("Scheduler Plugin resuming backfill %s", backfills[i].ID)
+			s.startBackfillRunner(&backfills[i])
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackfillRuns(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		cronExpr   string
+		rule       *ScheduleRule
+		location   *time.Location
+		from, to   string
+		wantFires  []string
+		wantEvents []string
+		wantErr    bool
+	}{
+		{
+			name: "daily, from inclusive and to exclusive", cronExpr: "0 0 9 * * *", location: time.UTC,
+			from: "2025-06-01T09:00:00Z", to: "2025-06-04T09:00:00Z",
+			wantFires:  []string{"2025-06-01T09:00:00Z", "2025-06-02T09:00:00Z", "2025-06-03T09:00:00Z"},
+			wantEvents: []string{"2025-06-01", "2025-06-02", "2025-06-03"},
+		},
+		{
+			name: "business days only", cronExpr: "0 0 9 * * *", rule: &ScheduleRule{Type: RuleBusinessDays}, location: time.UTC,
+			from: "2025-06-06T00:00:00Z", to: "2025-06-10T00:00:00Z",
+			wantFires:  []string{"2025-06-06T09:00:00Z", "2025-06-09T09:00:00Z"},
+			wantEvents: []string{"2025-06-06", "2025-06-09"},
+		},
+		{
+			name: "event date in the schedule timezone", cronExpr: "0 30 22 * * *", location: saoPaulo,
+			from: "2025-06-01T00:00:00Z", to: "2025-06-02T12:00:00Z",
+			wantFires:  []string{"2025-06-01T01:30:00Z", "2025-06-02T01:30:00Z"},
+			wantEvents: []string{"2025-05-31", "2025-06-01"},
+		},
+		{
+			name: "empty range", cronExpr: "0 0 9 * * *", location: time.UTC,
+			from: "2025-06-01T10:00:00Z", to: "2025-06-02T09:00:00Z",
+		},
+		{
+			name: "too many runs", cronExpr: "* * * * * *", location: time.UTC,
+			from: "2025-06-01T00:00:00Z", to: "2025-06-01T01:00:00Z",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := testPlan(t, tt.cronExpr, nil, tt.rule, tt.location)
+			runs, err := backfillRuns(plan, mustTime(t, tt.from), mustTime(t, tt.to))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("backfillRuns() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(runs) != len(tt.wantFires) {
+				t.Fatalf("backfillRuns() returned %d runs, want %d", len(runs), len(tt.wantFires))
+			}
+			for i, run := range runs {
+				if !run.FireTime.Equal(mustTime(t, tt.wantFires[i])) {
+					t.Errorf("run %d fires at %s, want %s", i, run.FireTime.Format(time.RFC3339), tt.wantFires[i])
+				}
+				if run.EventDate != tt.wantEvents[i] {
+					t.Errorf("run %d eventDate = %s, want %s", i, run.EventDate, tt.wantEvents[i])
+				}
+				if run.Status != BackfillRunPending {
+					t.Errorf("run %d status = %s, want %s", i, run.Status, BackfillRunPending)
+				}
+			}
+		})
+	}
+}
+
+func TestParseBackfillBound(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		end     bool
+		want    string
+		wantErr bool
+	}{
+		{"date starts at local midnight", "2025-06-01", false, "2025-06-01T03:00:00Z", false},
+		{"end date covers the whole day", "2025-06-01", true, "2025-06-02T03:00:00Z", false},
+		{"timestamp is kept", "2025-06-01T12:00:00Z", false, "2025-06-01T12:00:00Z", false},
+		{"missing", "", false, "", true},
+		{"malformed", "06/01/2025", false, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBackfillBound(tt.value, "from", saoPaulo, tt.end)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBackfillBound(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(mustTime(t, tt.want)) {
+				t.Errorf("parseBackfillBound(%q) = %s, want %s", tt.value, got.UTC().Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+
+	// An RFC3339 end bound includes the instant it names
+	end, err := parseBackfillBound("2025-06-01T12:00:00Z", "to", time.UTC, true)
+	if err != nil || !end.After(mustTime(t, "2025-06-01T12:00:00Z")) {
+		t.Errorf("parseBackfillBound(end) = %s, %v; want just after the timestamp", end, err)
+	}
+}
+
+func TestBackfillRunKey(t *testing.T) {
+	if got, want := backfillRunKey("b-1", 0), "backfill-b-1-0"; got != want {
+		t.Errorf("backfillRunKey() = %q, want %q", got, want)
+	}
+	if backfillRunKey("b-1", 1) == backfillRunKey("b-1", 2) || backfillRunKey("b-1", 1) == backfillRunKey("b-2", 1) {
+		t.Error("backfillRunKey() repeats a key for different runs")
+	}
+}
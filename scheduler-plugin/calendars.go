@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	_ "time/tzdata" // Calendar timezones must resolve in slim images too
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+const dateLayout = "2006-01-02"
+
+var (
+	errCalendarNotFound = errors.New("calendar not found")
+	calendarNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+)
+
+// Calendar decides which days are business days: every day whose weekday is
+// not in WeekendDays and which is not excluded, plus the included dates
+// (e.g. a working Saturday). Dates are YYYY-MM-DD in the calendar timezone.
+type Calendar struct {
+	Name         string    `json:"name" dynamodbav:"name"`
+	AccountId    string    `json:"account_id" dynamodbav:"account_id"`
+	Description  string    `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	Timezone     string    `json:"timezone" dynamodbav:"timezone"`
+	WeekendDays  []int     `json:"weekend_days" dynamodbav:"weekend_days"` // 0 = Sunday ... 6 = Saturday
+	IncludeDates []string  `json:"include_dates" dynamodbav:"include_dates"`
+	ExcludeDates []string  `json:"exclude_dates" dynamodbav:"exclude_dates"`
+	CreatedAt    time.Time `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+// defaultCalendar is used by business-day rules of schedules without a calendar
+var defaultCalendar = Calendar{Name: "default", Timezone: "UTC", WeekendDays: []int{0, 6}}
+
+// IsBusinessDay reports whether the date of t (in t's location) is a business day
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	date := t.Format(dateLayout)
+	for _, included := range c.IncludeDates {
+		if included == date {
+			return true
+		}
+	}
+	for _, excluded := range c.ExcludeDates {
+		if excluded == date {
+			return false
+		}
+	}
+	for _, weekday := range c.WeekendDays {
+		if int(t.Weekday()) == weekday {
+			return false
+		}
+	}
+	return true
+}
+
+// Location is the timezone the calendar dates are expressed in
+func (c *Calendar) Location() *time.Location {
+	location, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// validate normalises the calendar and returns the first problem found
+func (c *Calendar) validate() error {
+	if !calendarNamePattern.MatchString(c.Name) {
+		return errors.New("name must be 1-64 letters, digits, '.', '_' or '-'")
+	}
+	if c.Timezone == "" {
+		c.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", c.Timezone)
+	}
+	if c.WeekendDays == nil {
+		c.WeekendDays = []int{0, 6}
+	}
+	for _, weekday := range c.WeekendDays {
+		if weekday < 0 || weekday > 6 {
+			return errors.New("weekend_days must be between 0 (Sunday) and 6 (Saturday)")
+		}
+	}
+
+	var err error
+	if c.IncludeDates, err = normaliseDates(c.IncludeDates); err != nil {
+		return fmt.Errorf("include_dates: %v", err)
+	}
+	if c.ExcludeDates, err = normaliseDates(c.ExcludeDates); err != nil {
+		return fmt.Errorf("exclude_dates: %v", err)
+	}
+	return nil
+}
+
+// normaliseDates checks YYYY-MM-DD dates and returns them sorted and unique
+func normaliseDates(dates []string) ([]string, error) {
+	unique := make(map[string]bool)
+	for _, date := range dates {
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			return nil, fmt.Errorf("%q is not a YYYY-MM-DD date", date)
+		}
+		unique[date] = true
+	}
+
+	normalised := make([]string, 0, len(unique))
+	for date := range unique {
+		normalised = append(normalised, date)
+	}
+	sort.Strings(normalised)
+	return normalised, nil
+}
+
+func (s *SchedulerPluginService) calendarTableName() string {
+	if s.calendarTable == "" {
+		return "calendars"
+	}
+	return s.calendarTable
+}
+
+func (s *SchedulerPluginService) getCalendar(accountId, name string) (*Calendar, error) {
+	result, err := s.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(s.calendarTableName()),
+		Key: map[string]types.AttributeValue{
+			"account_id": &types.AttributeValueMemberS{Value: accountId},
+			"name":       &types.AttributeValueMemberS{Value: name},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errCalendarNotFound
+	}
+
+	var calendar Calendar
+	if err := attributevalue.UnmarshalMap(result.Item, &calendar); err != nil {
+		return nil, err
+	}
+	return &calendar, nil
+}
+
+func (s *SchedulerPluginService) putCalendar(calendar *Calendar) error {
+	item, err := attributevalue.MarshalMap(calendar)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(s.calendarTableName()),
+		Item:      item,
+	})
+	return err
+}
+
+// loadCalendar answers 404/500 itself and returns nil when the handler should stop
+func (s *SchedulerPluginService) loadCalendar(ctx *gin.Context) *Calendar {
+	name := ctx.Param("name")
+	calendar, err := s.getCalendar(identityFrom(ctx).AccountId, name)
+	if err != nil {
+		if errors.Is(err, errCalendarNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Calendar not found"})
+			return nil
+		}
+		log.Printf("Error loading calendar %s: %v", name, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar"})
+		return nil
+	}
+	return calendar
+}
+
+func (s *SchedulerPluginService) GetCalendars(ctx *gin.Context) {
+	var calendars []Calendar
+	paginator := dynamodb.NewQueryPaginator(s.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(s.calendarTableName()),
+		KeyConditionExpression: aws.String("account_id = :accountId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: identityFrom(ctx).AccountId},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error querying calendars: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve calendars"})
+			return
+		}
+		var pageCalendars []Calendar
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageCalendars); err != nil {
+			log.Printf("Error unmarshaling calendars: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process calendars data"})
+			return
+		}
+		calendars = append(calendars, pageCalendars...)
+	}
+
+	if calendars == nil {
+		calendars = []Calendar{}
+	}
+	ctx.JSON(http.StatusOK, calendars)
+}
+
+func (s *SchedulerPluginService) GetCalendar(ctx *gin.Context) {
+	if calendar := s.loadCalendar(ctx); calendar != nil {
+		ctx.JSON(http.StatusOK, calendar)
+	}
+}
+
+// PutCalendar creates or replaces a named calendar of the caller's account
+func (s *SchedulerPluginService) PutCalendar(ctx *gin.Context) {
+	var calendar Calendar
+	if err := ctx.ShouldBindJSON(&calendar); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	calendar.Name = ctx.Param("name")
+	setAuditTarget(ctx, "calendar/"+calendar.Name)
+	if err := calendar.validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	calendar.AccountId = identityFrom(ctx).AccountId
+	calendar.UpdatedAt = time.Now()
+	calendar.CreatedAt = calendar.UpdatedAt
+	if existing, err := s.getCalendar(calendar.AccountId, calendar.Name); err == nil {
+		calendar.CreatedAt = existing.CreatedAt
+	}
+
+	if err := s.putCalendar(&calendar); err != nil {
+		log.Printf("Error storing calendar %s: %v", calendar.Name, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store calendar"})
+		return
+	}
+
+	log.Printf("Scheduler Plugin stored calendar %s (%d excluded, %d included dates)",
+		calendar.Name, len(calendar.ExcludeDates), len(calendar.IncludeDates))
+
+	ctx.JSON(http.StatusOK, calendar)
+}
+
+func (s *SchedulerPluginService) DeleteCalendar(ctx *gin.Context) {
+	setAuditTarget(ctx, "calendar/"+ctx.Param("name"))
+
+	calendar := s.loadCalendar(ctx)
+	if calendar == nil {
+		return
+	}
+
+	_, err := s.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.calendarTableName()),
+		Key: map[string]types.AttributeValue{
+			"account_id": &types.AttributeValueMemberS{Value: calendar.AccountId},
+			"name":       &types.AttributeValueMemberS{Value: calendar.Name},
+		},
+	})
+	if err != nil {
+		log.Printf("Error deleting calendar %s: %v", calendar.Name, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete calendar"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Calendar deleted", "name": calendar.Name})
+}
+
+// ImportCalendar merges dates from an iCal (text/calendar) or CSV (text/csv)
+// body into an existing calendar. ?format=ical|csv overrides the Content-Type;
+// ?mode=exclude (default) adds holidays, mode=include adds extra business days.
+// CSV rows are "date[,mode or description]".
+func (s *SchedulerPluginService) ImportCalendar(ctx *gin.Context) {
+	setAuditTarget(ctx, "calendar/"+ctx.Param("name"))
+
+	mode := ctx.DefaultQuery("mode", "exclude")
+	if mode != "exclude" && mode != "include" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "mode must be exclude or include"})
+		return
+	}
+
+	format := ctx.Query("format")
+	if format == "" {
+		switch ctx.ContentType() {
+		case "text/calendar":
+			format = "ical"
+		case "text/csv":
+			format = "csv"
+		}
+	}
+
+	calendar := s.loadCalendar(ctx)
+	if calendar == nil {
+		return
+	}
+
+	var dates map[string]string
+	var err error
+	switch format {
+	case "ical":
+		dates, err = parseICalDates(ctx.Request.Body, mode)
+	case "csv":
+		dates, err = parseCSVDates(ctx.Request.Body, mode)
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Send text/calendar or text/csv, or set format=ical|csv"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	imported := map[string]int{"exclude": 0, "include": 0}
+	for date, dateMode := range dates {
+		if dateMode == "include" {
+			calendar.IncludeDates = append(calendar.IncludeDates, date)
+		} else {
+			calendar.ExcludeDates = append(calendar.ExcludeDates, date)
+		}
+		imported[dateMode]++
+	}
+	if err := calendar.validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	calendar.UpdatedAt = time.Now()
+
+	if err := s.putCalendar(calendar); err != nil {
+		log.Printf("Error storing calendar %s: %v", calendar.Name, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store calendar"})
+		return
+	}
+
+	log.Printf("Scheduler Plugin imported %d dates into calendar %s", len(dates), calendar.Name)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"calendar": calendar,
+		"imported": imported,
+	})
+}
+
+// parseICalDates returns the days covered by each VEVENT. All-day events end
+// on their (exclusive) DTEND; timed events count for the day they start on.
+func parseICalDates(body io.Reader, mode string) (map[string]string, error) {
+	// Unfold continuation lines (RFC 5545 3.1) before reading properties
+	var lines []string
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	dates := make(map[string]string)
+	var start, end time.Time
+	inEvent := false
+	for _, line := range lines {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		property := strings.ToUpper(strings.SplitN(name, ";", 2)[0])
+
+		switch {
+		case property == "BEGIN" && value == "VEVENT":
+			inEvent, start, end = true, time.Time{}, time.Time{}
+		case property == "END" && value == "VEVENT":
+			if !inEvent || start.IsZero() {
+				return nil, errors.New("VEVENT without a DTSTART")
+			}
+			if end.IsZero() || !end.After(start) {
+				end = start.AddDate(0, 0, 1)
+			}
+			for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+				dates[day.Format(dateLayout)] = mode
+			}
+			inEvent = false
+		case inEvent && (property == "DTSTART" || property == "DTEND"):
+			if len(value) < 8 {
+				return nil, fmt.Errorf("invalid %s %q", property, value)
+			}
+			day, err := time.Parse("20060102", value[:8])
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q", property, value)
+			}
+			if property == "DTSTART" {
+				start = day
+			} else if strings.Contains(value, "T") {
+				end = day.AddDate(0, 0, 1) // A timed end still covers its own day
+			} else {
+				end = day
+			}
+		}
+	}
+
+	if len(dates) == 0 {
+		return nil, errors.New("no VEVENT dates found")
+	}
+	return dates, nil
+}
+
+// parseCSVDates reads "date[,mode or description]" rows, skipping a header row and blank lines
+func parseCSVDates(body io.Reader, mode string) (map[string]string, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	dates := make(map[string]string)
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		date := strings.TrimSpace(record[0])
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			if row == 1 {
+				continue // Header
+			}
+			return nil, fmt.Errorf("row %d: %q is not a YYYY-MM-DD date", row, date)
+		}
+
+		// A second column of exclude/include overrides the mode; anything else is a description
+		rowMode := mode
+		if len(record) > 1 {
+			if value := strings.ToLower(strings.TrimSpace(record[1])); value == "exclude" || value == "include" {
+				rowMode = value
+			}
+		}
+		dates[date] = rowMode
+	}
+
+	if len(dates) == 0 {
+		return nil, errors.New("no dates found")
+	}
+	return dates, nil
+}
@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -13,20 +15,36 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type Schedule struct {
-	ID        string    `json:"id" dynamodbav:"id"`
-	JobID     string    `json:"job_id" dynamodbav:"job_id"`
-	CronExpr  string    `json:"cron_expr" dynamodbav:"cron_expr"`
-	NextRun   time.Time `json:"next_run" dynamodbav:"next_run"`
-	LastRun   time.Time `json:"last_run" dynamodbav:"last_run"`
-	IsActive  bool      `json:"is_active" dynamodbav:"is_active"`
-	CreatedAt time.Time `json:"created_at" dynamodbav:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" dynamodbav:"updated_at"`
+	ID        string        `json:"id" dynamodbav:"id"`
+	JobID     string        `json:"job_id" dynamodbav:"job_id"`
+	AccountId string        `json:"account_id" dynamodbav:"account_id"`
+	CronExpr  string        `json:"cron_expr" dynamodbav:"cron_expr"`
+	Timezone  string        `json:"timezone,omitempty" dynamodbav:"timezone,omitempty"`
+	Calendar  string        `json:"calendar,omitempty" dynamodbav:"calendar,omitempty"`
+	Rule      *ScheduleRule `json:"rule,omitempty" dynamodbav:"rule,omitempty"`
+	Acronym   string        `json:"acronym,omitempty" dynamodbav:"acronym,omitempty"`
+	NextRun   time.Time     `json:"next_run" dynamodbav:"next_run"`
+	LastRun   time.Time     `json:"last_run" dynamodbav:"last_run"`
+	IsActive  bool          `json:"is_active" dynamodbav:"is_active"`
+	CreatedAt time.Time     `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at" dynamodbav:"updated_at"`
+
+	// Routine JMI runs for this schedule, e.g. on backfills
+	ExecutionName string `json:"execution_name,omitempty" dynamodbav:"execution_name,omitempty"`
+
+	// Set while IsActive is false; see pause.go
+	PauseScope  string     `json:"pause_scope,omitempty" dynamodbav:"pause_scope,omitempty"`
+	PauseReason string     `json:"pause_reason,omitempty" dynamodbav:"pause_reason,omitempty"`
+	PausedBy    string     `json:"paused_by,omitempty" dynamodbav:"paused_by,omitempty"`
+	PausedAt    *time.Time `json:"paused_at,omitempty" dynamodbav:"paused_at,omitempty"`
+	PausedUntil *time.Time `json:"paused_until,omitempty" dynamodbav:"paused_until,omitempty"`
 }
 
 type SchedulerPluginService struct {
@@ -38,6 +56,18 @@ type SchedulerPluginService struct {
 	outQueueURL   string
 	receiveCtx    context.Context
 	receiveCancel context.CancelFunc
+	auditTable    string
+	calendarTable string
+	pauseTable    string
+	backfillTable string
+
+	// JMI starts the executions of backfills
+	jmiURL    string
+	jmiAPIKey string
+	jmiClient *http.Client
+
+	backfillMu      sync.Mutex
+	backfillRunners map[string]*backfillRunner
 }
 
 func NewSchedulerPluginService() *SchedulerPluginService {
@@ -69,6 +99,12 @@ func NewSchedulerPluginService() *SchedulerPluginService {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
+	jmiURL := os.Getenv("JMI_URL")
+	if jmiURL == "" {
+		// Default to Docker internal network address
+		jmiURL = "http://jmi:8080"
+	}
+
 	service := &SchedulerPluginService{
 		schedules:     make([]Schedule, 0),
 		dynamoClient:  dynamodb.NewFromConfig(cfg),
@@ -78,11 +114,26 @@ func NewSchedulerPluginService() *SchedulerPluginService {
 		outQueueURL:   os.Getenv("SPA_QUEUE_URL"),
 		receiveCtx:    ctx,
 		receiveCancel: cancel,
+		auditTable:    os.Getenv("AUDIT_TABLE"),
+		calendarTable: os.Getenv("CALENDAR_TABLE"),
+		pauseTable:    os.Getenv("PAUSE_TABLE"),
+		backfillTable: os.Getenv("BACKFILL_TABLE"),
+		jmiURL:        jmiURL,
+		jmiAPIKey:     os.Getenv("JMI_API_KEY"),
+		jmiClient:     &http.Client{Timeout: 10 * time.Second},
+
+		backfillRunners: make(map[string]*backfillRunner),
 	}
 
 	// Start message receiver
 	go service.startMessageReceiver()
 
+	// Resume schedules and acronyms whose pause expired
+	go service.startPauseSweeper()
+
+	// Pick up backfills interrupted by a restart
+	go service.resumeBackfills()
+
 	return service
 }
 
@@ -141,12 +192,19 @@ func (s *SchedulerPluginService) processMessage(messageBody string) {
 	schedule := Schedule{
 		ID:        uuid.New().String(),
 		JobID:     jobID,
-		CronExpr:  "0 */5 * * * *", // Every 5 minutes (default)
-		NextRun:   time.Now().Add(5 * time.Minute),
+		CronExpr:  defaultCronExpr, // Every 5 minutes
 		IsActive:  true,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
+	schedule.AccountId, _ = job["account_id"].(string)
+	schedule.Acronym, _ = job["acronym"].(string)
+	schedule.ExecutionName, _ = job["job_name"].(string)
+	if err := s.applyAcronymPause(&schedule); err != nil {
+		log.Printf("Error checking pause of acronym %s: %v", schedule.Acronym, err)
+	}
+	// Same evaluator as POST /schedules, so a paused acronym leaves no next run
+	s.refreshNextRun(&schedule)
 
 	// Store schedule in DynamoDB
 	item, err := attributevalue.MarshalMap(schedule)
@@ -197,26 +255,57 @@ func (s *SchedulerPluginService) GetHealth(ctx *gin.Context) {
 }
 
 func (s *SchedulerPluginService) GetSchedules(ctx *gin.Context) {
-	// Query DynamoDB for all schedules
-	result, err := s.dynamoClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName: aws.String(s.tableName),
-	})
+	page, err := parsePageRequest(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, to, err := parseTimeRange(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Query the caller's schedules through the account_id GSI, sorted by creation time
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.tableName),
+		IndexName:              aws.String("account_id-created_at-index"),
+		KeyConditionExpression: aws.String("account_id = :accountId AND created_at BETWEEN :from AND :to"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: identityFrom(ctx).AccountId},
+			":from":      &types.AttributeValueMemberS{Value: from.UTC().Format(time.RFC3339Nano)},
+			":to":        &types.AttributeValueMemberS{Value: to.UTC().Format(time.RFC3339Nano)},
+		},
+	}
+
+	filter := newQueryFilter()
+	filter.equals("job_id", ctx.Query("job_id"))
+	filter.equalsBool("is_active", ctx.Query("is_active"))
+	filter.apply(input)
 
+	items, nextCursor, err := queryPage(s.dynamoClient, input, page)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		log.Printf("Error scanning DynamoDB: %v", err)
+		log.Printf("Error querying DynamoDB: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve schedules"})
 		return
 	}
 
-	var schedules []Schedule
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &schedules)
-	if err != nil {
+	schedules := make([]Schedule, 0, len(items))
+	if err := attributevalue.UnmarshalListOfMaps(items, &schedules); err != nil {
 		log.Printf("Error unmarshaling schedules: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process schedules data"})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, schedules)
+	ctx.JSON(http.StatusOK, gin.H{
+		"schedules":  schedules,
+		"count":      len(schedules),
+		"nextCursor": nextCursor,
+	})
 }
 
 func (s *SchedulerPluginService) CreateSchedule(ctx *gin.Context) {
@@ -229,18 +318,39 @@ func (s *SchedulerPluginService) CreateSchedule(ctx *gin.Context) {
 	if schedule.ID == "" {
 		schedule.ID = uuid.New().String()
 	}
+	identity := identityFrom(ctx)
+	schedule.AccountId = identity.AccountId
+	setAuditTarget(ctx, "schedule/"+schedule.ID)
+	if schedule.Acronym != "" && !identity.CanAccessAcronym(schedule.Acronym) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Acronym " + schedule.Acronym + " is not accessible to the caller"})
+		return
+	}
 	schedule.CreatedAt = time.Now()
-	schedule.UpdatedAt = time.Now()
-	schedule.IsActive = true
+	schedule.resume(time.Now())
 
 	// Set default cron expression if not provided
 	if schedule.CronExpr == "" {
-		schedule.CronExpr = "0 */5 * * * *" // Every 5 minutes
+		schedule.CronExpr = defaultCronExpr // Every 5 minutes
 	}
 
-	// Set next run time
-	schedule.NextRun = time.Now().Add(5 * time.Minute)
+	// Set next run time, honouring the schedule's calendar and rule
+	plan, err := s.planFor(schedule.AccountId, &schedule)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	schedule.NextRun = plan.next(time.Now())
+	if schedule.NextRun.IsZero() {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "schedule has no runs in the next five years"})
+		return
+	}
 
+	// New schedules start active unless their acronym is paused
+	if err := s.applyAcronymPause(&schedule); err != nil {
+		log.Printf("Error checking pause of acronym %s: %v", schedule.Acronym, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check acronym pause"})
+		return
+	}
 	// Store schedule in DynamoDB
 	item, err := attributevalue.MarshalMap(schedule)
 	if err != nil {
@@ -300,12 +410,19 @@ func (s *SchedulerPluginService) ProcessJob(ctx *gin.Context) {
 	schedule := Schedule{
 		ID:        uuid.New().String(),
 		JobID:     jobID,
-		CronExpr:  "0 */5 * * * *", // Every 5 minutes (default)
-		NextRun:   time.Now().Add(5 * time.Minute),
+		AccountId: identityFrom(ctx).AccountId,
+		CronExpr:  defaultCronExpr, // Every 5 minutes
 		IsActive:  true,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
+	schedule.Acronym, _ = job["acronym"].(string)
+	schedule.ExecutionName, _ = job["job_name"].(string)
+	if err := s.applyAcronymPause(&schedule); err != nil {
+		log.Printf("Error checking pause of acronym %s: %v", schedule.Acronym, err)
+	}
+	// Same evaluator as POST /schedules, so a paused acronym leaves no next run
+	s.refreshNextRun(&schedule)
 
 	// Store schedule in DynamoDB
 	item, err := attributevalue.MarshalMap(schedule)
@@ -365,10 +482,33 @@ func main() {
 	// Health check
 	r.GET("/health", service.GetHealth)
 
-	// Schedule endpoints
-	r.GET("/schedules", service.GetSchedules)
-	r.POST("/schedules", service.CreateSchedule)
-	r.POST("/process", service.ProcessJob)
+	// Schedule endpoints require an authenticated caller and are scoped to its tenant
+	tenant := r.Group("/", authMiddleware(loadAuthenticators()))
+	viewer := requireRole(RoleViewer)
+	submitter := requireRole(RoleSubmitter)
+	operator := requireRole(RoleOperator)
+	audit := newAuditor(service.dynamoClient, service.auditTableName(), "scheduler-plugin")
+	tenant.GET("/schedules", viewer, service.GetSchedules)
+	tenant.POST("/schedules", submitter, audit("schedule.create"), service.CreateSchedule)
+	tenant.POST("/schedules/preview", viewer, service.PreviewDraftSchedule)
+	tenant.GET("/schedules/:id/preview", viewer, service.PreviewSchedule)
+	tenant.POST("/schedules/:id/pause", operator, audit("schedule.pause"), service.PauseSchedule)
+	tenant.POST("/schedules/:id/resume", operator, audit("schedule.resume"), service.ResumeSchedule)
+	tenant.POST("/schedules/:id/backfill", submitter, audit("schedule.backfill"), service.CreateBackfill)
+	tenant.GET("/backfills", viewer, service.GetBackfills)
+	tenant.GET("/backfills/:id", viewer, service.GetBackfill)
+	tenant.POST("/backfills/:id/pause", operator, audit("backfill.pause"), service.PauseBackfill)
+	tenant.POST("/backfills/:id/resume", operator, audit("backfill.resume"), service.ResumeBackfill)
+	tenant.POST("/backfills/:id/cancel", operator, audit("backfill.cancel"), service.CancelBackfill)
+	tenant.GET("/acronyms/paused", viewer, service.GetAcronymPauses)
+	tenant.POST("/acronyms/:acronym/pause", operator, audit("acronym.pause"), service.PauseAcronym)
+	tenant.POST("/acronyms/:acronym/resume", operator, audit("acronym.resume"), service.ResumeAcronym)
+	tenant.GET("/calendars", viewer, service.GetCalendars)
+	tenant.GET("/calendars/:name", viewer, service.GetCalendar)
+	tenant.PUT("/calendars/:name", submitter, audit("calendar.update"), service.PutCalendar)
+	tenant.DELETE("/calendars/:name", operator, audit("calendar.delete"), service.DeleteCalendar)
+	tenant.POST("/calendars/:name/import", submitter, audit("calendar.import"), service.ImportCalendar)
+	tenant.POST("/process", submitter, service.ProcessJob)
 
 	port := os.Getenv("SERVICE_PORT")
 	if port == "" {
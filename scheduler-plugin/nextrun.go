@@ -0,0 +1,311 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+)
+
+// Business-day rules a schedule can apply on top of, or instead of, its cron
+const (
+	RuleBusinessDays      = "business_days"       // cron runs that fall on business days
+	RuleNthBusinessDay    = "nth_business_day"    // the Nth business day of each month at At (negative N counts from the end)
+	RuleLastBusinessDay   = "last_business_day"   // the last business day of each month at At
+	RuleBusinessDayOffset = "business_day_offset" // each cron run moved Offset business days (0 rolls holidays forward)
+)
+
+const (
+	defaultCronExpr     = "0 */5 * * * *"
+	defaultPreviewCount = 10
+	maxPreviewCount     = 100
+)
+
+// cronParser accepts both 5-field and 6-field (with seconds) expressions,
+// since the pipeline uses both.
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ScheduleRule is a calendar rule cron cannot express
+type ScheduleRule struct {
+	Type   string `json:"type" dynamodbav:"type"`
+	N      int    `json:"n,omitempty" dynamodbav:"n,omitempty"`
+	Offset int    `json:"offset,omitempty" dynamodbav:"offset,omitempty"`
+	At     string `json:"at,omitempty" dynamodbav:"at,omitempty"` // HH:MM, for the monthly rules
+}
+
+// validate checks the rule and fills in its defaults
+func (r *ScheduleRule) validate() error {
+	switch r.Type {
+	case RuleBusinessDays:
+	case RuleLastBusinessDay:
+		r.N = -1
+	case RuleNthBusinessDay:
+		if r.N == 0 || r.N < -23 || r.N > 23 {
+			return errors.New("rule.n must be between 1 and 23, or -1 to -23 counting from the end of the month")
+		}
+	case RuleBusinessDayOffset:
+		if r.Offset < -31 || r.Offset > 31 {
+			return errors.New("rule.offset must be between -31 and 31")
+		}
+	default:
+		return fmt.Errorf("rule.type must be one of %s, %s, %s or %s",
+			RuleBusinessDays, RuleNthBusinessDay, RuleLastBusinessDay, RuleBusinessDayOffset)
+	}
+
+	if r.Type == RuleNthBusinessDay || r.Type == RuleLastBusinessDay {
+		if r.At == "" {
+			r.At = "00:00"
+		}
+		if _, err := time.Parse("15:04", r.At); err != nil {
+			return errors.New("rule.at must be HH:MM")
+		}
+	}
+	return nil
+}
+
+// runPlan computes the run times of a schedule from its cron, calendar and rule
+type runPlan struct {
+	cron     cron.Schedule
+	calendar *Calendar
+	rule     *ScheduleRule
+	location *time.Location
+}
+
+// planFor resolves the cron, calendar and timezone of a schedule
+func (s *SchedulerPluginService) planFor(accountId string, schedule *Schedule) (*runPlan, error) {
+	plan := &runPlan{rule: schedule.Rule, location: time.UTC}
+
+	if schedule.Rule != nil {
+		if err := schedule.Rule.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	monthly := schedule.Rule != nil && (schedule.Rule.Type == RuleNthBusinessDay || schedule.Rule.Type == RuleLastBusinessDay)
+	if !monthly {
+		parsed, err := cronParser.Parse(schedule.CronExpr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron_expr: %v", err)
+		}
+		plan.cron = parsed
+	}
+
+	if schedule.Calendar != "" {
+		calendar, err := s.getCalendar(accountId, schedule.Calendar)
+		if errors.Is(err, errCalendarNotFound) {
+			return nil, fmt.Errorf("calendar %q not found", schedule.Calendar)
+		}
+		if err != nil {
+			return nil, err
+		}
+		plan.calendar = calendar
+		plan.location = calendar.Location()
+	} else if schedule.Rule != nil {
+		plan.calendar = &defaultCalendar
+	}
+
+	if schedule.Timezone != "" {
+		location, err := time.LoadLocation(schedule.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", schedule.Timezone)
+		}
+		plan.location = location
+	}
+	return plan, nil
+}
+
+// next returns the first run strictly after after, or the zero time when the
+// schedule does not run in the next five years
+func (p *runPlan) next(after time.Time) time.Time {
+	after = after.In(p.location)
+	limit := after.AddDate(5, 0, 0)
+
+	switch {
+	case p.rule != nil && (p.rule.Type == RuleNthBusinessDay || p.rule.Type == RuleLastBusinessDay):
+		clock, _ := time.Parse("15:04", p.rule.At)
+		month := time.Date(after.Year(), after.Month(), 1, 0, 0, 0, 0, p.location)
+		for ; month.Before(limit); month = month.AddDate(0, 1, 0) {
+			day, ok := p.calendar.nthBusinessDay(month, p.rule.N)
+			if !ok {
+				continue
+			}
+			run := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, p.location)
+			if run.After(after) {
+				return run
+			}
+		}
+
+	case p.rule != nil && p.rule.Type == RuleBusinessDayOffset:
+		// Anchors shortly before after can be shifted past it, so start a little earlier
+		back := p.rule.Offset
+		if back < 0 {
+			back = -back
+		}
+		anchor := after.AddDate(0, 0, -(back*2 + 14))
+		for {
+			anchor = p.cron.Next(anchor)
+			if anchor.IsZero() || anchor.After(limit) {
+				break
+			}
+			run, ok := p.calendar.shiftBusinessDays(anchor, p.rule.Offset)
+			if ok && run.After(after) {
+				return run
+			}
+		}
+
+	default:
+		run := after
+		for i := 0; i < 100000; i++ {
+			run = p.cron.Next(run)
+			if run.IsZero() || run.After(limit) {
+				break
+			}
+			if p.calendar == nil || p.calendar.IsBusinessDay(run) {
+				return run
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// nextRuns returns up to count runs after after
+func (p *runPlan) nextRuns(after time.Time, count int) []time.Time {
+	runs := make([]time.Time, 0, count)
+	for len(runs) < count {
+		run := p.next(after)
+		if run.IsZero() {
+			break
+		}
+		runs = append(runs, run)
+		after = run
+	}
+	return runs
+}
+
+// nthBusinessDay returns the nth business day of month (1-based; negative counts from the end)
+func (c *Calendar) nthBusinessDay(month time.Time, n int) (time.Time, bool) {
+	var days []time.Time
+	for day := month; day.Month() == month.Month(); day = day.AddDate(0, 0, 1) {
+		if c.IsBusinessDay(day) {
+			days = append(days, day)
+		}
+	}
+
+	switch {
+	case n > 0 && n <= len(days):
+		return days[n-1], true
+	case n < 0 && -n <= len(days):
+		return days[len(days)+n], true
+	}
+	return time.Time{}, false
+}
+
+// shiftBusinessDays moves t by offset business days, keeping its time of day.
+// Offset 0 rolls a non-business day forward to the next business day.
+func (c *Calendar) shiftBusinessDays(t time.Time, offset int) (time.Time, bool) {
+	step, remaining := 1, offset
+	if offset < 0 {
+		step, remaining = -1, -offset
+	}
+
+	// A year without business days means the calendar excludes everything
+	for guard := 0; guard < 366; guard++ {
+		if remaining == 0 && c.IsBusinessDay(t) {
+			return t, true
+		}
+		t = t.AddDate(0, 0, step)
+		if remaining > 0 && c.IsBusinessDay(t) {
+			remaining--
+			if remaining == 0 {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// parsePreviewCount reads ?count=N for the preview endpoints
+func parsePreviewCount(ctx *gin.Context) (int, error) {
+	value := ctx.Query("count")
+	if value == "" {
+		return defaultPreviewCount, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 1 || count > maxPreviewCount {
+		return 0, fmt.Errorf("count must be between 1 and %d", maxPreviewCount)
+	}
+	return count, nil
+}
+
+func (s *SchedulerPluginService) respondWithPreview(ctx *gin.Context, schedule *Schedule) {
+	count, err := parsePreviewCount(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from := time.Now()
+	if value := ctx.Query("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC3339 timestamp"})
+			return
+		}
+	}
+
+	plan, err := s.planFor(identityFrom(ctx).AccountId, schedule)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A paused schedule does not fire before its pause ends, and never while paused indefinitely
+	var runs []time.Time
+	if schedule.IsActive || schedule.PausedUntil != nil {
+		if !schedule.IsActive && schedule.PausedUntil.After(from) {
+			from = *schedule.PausedUntil
+		}
+		runs = plan.nextRuns(from, count)
+	}
+	nextRuns := make([]string, 0, len(runs))
+	for _, run := range runs {
+		nextRuns = append(nextRuns, run.Format(time.RFC3339))
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"schedule_id": schedule.ID,
+		"cron_expr":   schedule.CronExpr,
+		"calendar":    schedule.Calendar,
+		"rule":        schedule.Rule,
+		"timezone":    plan.location.String(),
+		"is_active":   schedule.IsActive,
+		"next_runs":   nextRuns,
+	})
+}
+
+// PreviewSchedule lists the next runs of a stored schedule (?count=N&from=RFC3339)
+func (s *SchedulerPluginService) PreviewSchedule(ctx *gin.Context) {
+	schedule := s.loadSchedule(ctx, ctx.Param("id"))
+	if schedule == nil {
+		return
+	}
+
+	s.respondWithPreview(ctx, schedule)
+}
+
+// PreviewDraftSchedule lists the next runs of a schedule body before creating it
+func (s *SchedulerPluginService) PreviewDraftSchedule(ctx *gin.Context) {
+	var schedule Schedule
+	if err := ctx.ShouldBindJSON(&schedule); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if schedule.CronExpr == "" {
+		schedule.CronExpr = defaultCronExpr
+	}
+	schedule.IsActive = true
+
+	s.respondWithPreview(ctx, &schedule)
+}
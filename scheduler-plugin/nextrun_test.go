@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// testPlan builds a runPlan the way planFor does, without the calendar lookup
+func testPlan(t *testing.T, cronExpr string, calendar *Calendar, rule *ScheduleRule, location *time.Location) *runPlan {
+	t.Helper()
+	plan := &runPlan{calendar: calendar, rule: rule, location: location}
+	if rule != nil {
+		if err := rule.validate(); err != nil {
+			t.Fatalf("rule.validate(): %v", err)
+		}
+		if calendar == nil {
+			plan.calendar = &defaultCalendar
+		}
+	}
+	if cronExpr != "" {
+		parsed, err := cronParser.Parse(cronExpr)
+		if err != nil {
+			t.Fatalf("cronParser.Parse(%q): %v", cronExpr, err)
+		}
+		plan.cron = parsed
+	}
+	return plan
+}
+
+func mustTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatalf("time.Parse(%q): %v", value, err)
+	}
+	return parsed
+}
+
+func TestRunPlanNext(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	holidays := &Calendar{Name: "holidays", Timezone: "UTC", WeekendDays: []int{0, 6}, ExcludeDates: []string{"2025-06-09"}}
+	saturdayIncluded := &Calendar{Name: "saturday", Timezone: "UTC", WeekendDays: []int{0, 6}, IncludeDates: []string{"2025-06-07"}}
+	neverOpen := &Calendar{Name: "closed", Timezone: "UTC", WeekendDays: []int{0, 1, 2, 3, 4, 5, 6}}
+
+	tests := []struct {
+		name     string
+		cronExpr string
+		calendar *Calendar
+		rule     *ScheduleRule
+		location *time.Location
+		after    string
+		want     string // "" when the schedule never runs
+	}{
+		{"plain cron", "0 0 9 * * *", nil, nil, time.UTC, "2025-06-02T10:00:00Z", "2025-06-03T09:00:00Z"},
+		{"five-field cron", "30 9 * * *", nil, nil, time.UTC, "2025-06-02T10:00:00Z", "2025-06-03T09:30:00Z"},
+		{"strictly after", "0 0 9 * * *", nil, nil, time.UTC, "2025-06-03T09:00:00Z", "2025-06-04T09:00:00Z"},
+		{"calendar skips weekend", "0 0 9 * * *", &defaultCalendar, nil, time.UTC, "2025-06-06T10:00:00Z", "2025-06-09T09:00:00Z"},
+		{"calendar skips holiday", "0 0 9 * * *", holidays, nil, time.UTC, "2025-06-06T10:00:00Z", "2025-06-10T09:00:00Z"},
+		{"calendar includes a weekend date", "0 0 9 * * *", saturdayIncluded, nil, time.UTC, "2025-06-06T10:00:00Z", "2025-06-07T09:00:00Z"},
+		{"business_days rule", "0 0 9 * * *", nil, &ScheduleRule{Type: RuleBusinessDays}, time.UTC, "2025-06-06T10:00:00Z", "2025-06-09T09:00:00Z"},
+		{"first business day", "", nil, &ScheduleRule{Type: RuleNthBusinessDay, N: 1, At: "08:30"}, time.UTC, "2025-05-20T00:00:00Z", "2025-06-02T08:30:00Z"},
+		{"first business day of next month", "", nil, &ScheduleRule{Type: RuleNthBusinessDay, N: 1, At: "08:30"}, time.UTC, "2025-06-02T09:00:00Z", "2025-07-01T08:30:00Z"},
+		{"second to last business day", "", nil, &ScheduleRule{Type: RuleNthBusinessDay, N: -2}, time.UTC, "2025-06-15T00:00:00Z", "2025-06-27T00:00:00Z"},
+		{"last business day", "", nil, &ScheduleRule{Type: RuleLastBusinessDay, At: "18:00"}, time.UTC, "2025-06-15T00:00:00Z", "2025-06-30T18:00:00Z"},
+		{"offset 0 rolls forward", "0 0 9 1 * *", nil, &ScheduleRule{Type: RuleBusinessDayOffset}, time.UTC, "2025-05-20T00:00:00Z", "2025-06-02T09:00:00Z"},
+		{"negative offset moves back", "0 0 9 1 * *", nil, &ScheduleRule{Type: RuleBusinessDayOffset, Offset: -1}, time.UTC, "2025-06-15T00:00:00Z", "2025-06-30T09:00:00Z"},
+		{"positive offset moves ahead", "0 0 9 1 * *", nil, &ScheduleRule{Type: RuleBusinessDayOffset, Offset: 2}, time.UTC, "2025-06-15T00:00:00Z", "2025-07-03T09:00:00Z"},
+		{"schedule timezone", "0 0 9 * * *", nil, nil, saoPaulo, "2025-06-02T13:00:00Z", "2025-06-03T12:00:00Z"},
+		{"calendar with no business days", "0 0 9 * * *", neverOpen, nil, time.UTC, "2025-06-02T10:00:00Z", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := testPlan(t, tt.cronExpr, tt.calendar, tt.rule, tt.location)
+			got := plan.next(mustTime(t, tt.after))
+			if tt.want == "" {
+				if !got.IsZero() {
+					t.Errorf("next(%s) = %s, want no run", tt.after, got)
+				}
+				return
+			}
+			if want := mustTime(t, tt.want); !got.Equal(want) {
+				t.Errorf("next(%s) = %s, want %s", tt.after, got.UTC().Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
+
+func TestRunPlanNextRuns(t *testing.T) {
+	plan := testPlan(t, "0 0 9 * * *", nil, &ScheduleRule{Type: RuleBusinessDays}, time.UTC)
+	got := plan.nextRuns(mustTime(t, "2025-06-05T10:00:00Z"), 3)
+	want := []string{"2025-06-06T09:00:00Z", "2025-06-09T09:00:00Z", "2025-06-10T09:00:00Z"}
+	if len(got) != len(want) {
+		t.Fatalf("nextRuns returned %d runs, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Equal(mustTime(t, want[i])) {
+			t.Errorf("run %d = %s, want %s", i, got[i].UTC().Format(time.RFC3339), want[i])
+		}
+	}
+}
+
+func TestScheduleRuleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    ScheduleRule
+		wantErr bool
+		wantN   int
+		wantAt  string
+	}{
+		{"business days", ScheduleRule{Type: RuleBusinessDays}, false, 0, ""},
+		{"last business day defaults", ScheduleRule{Type: RuleLastBusinessDay}, false, -1, "00:00"},
+		{"nth business day", ScheduleRule{Type: RuleNthBusinessDay, N: 5, At: "07:15"}, false, 5, "07:15"},
+		{"nth business day from the end", ScheduleRule{Type: RuleNthBusinessDay, N: -23}, false, -23, "00:00"},
+		{"nth business day zero", ScheduleRule{Type: RuleNthBusinessDay}, true, 0, ""},
+		{"nth business day too far", ScheduleRule{Type: RuleNthBusinessDay, N: 24}, true, 0, ""},
+		{"bad time of day", ScheduleRule{Type: RuleNthBusinessDay, N: 1, At: "25:00"}, true, 0, ""},
+		{"offset in range", ScheduleRule{Type: RuleBusinessDayOffset, Offset: -31}, false, 0, ""},
+		{"offset out of range", ScheduleRule{Type: RuleBusinessDayOffset, Offset: 32}, true, 0, ""},
+		{"unknown type", ScheduleRule{Type: "weekly"}, true, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			err := rule.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if rule.N != tt.wantN || rule.At != tt.wantAt {
+				t.Errorf("validate() left n=%d at=%q, want n=%d at=%q", rule.N, rule.At, tt.wantN, tt.wantAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// errInvalidCursor is returned for a cursor that is malformed or was issued
+// by another listing; handlers answer it with 400
+var errInvalidCursor = errors.New("invalid cursor")
+
+// pageRequest is the cursor pagination shared by the list endpoints:
+// ?limit=N&cursor=<nextCursor of the previous page>&order=asc|desc. Every
+// list answers {<items>, count, nextCursor}, nextCursor being "" on the last page.
+type pageRequest struct {
+	Limit     int32
+	Cursor    string
+	Ascending bool
+}
+
+func parsePageRequest(ctx *gin.Context) (pageRequest, error) {
+	page := pageRequest{Limit: defaultPageSize}
+
+	if value := ctx.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return page, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		page.Limit = int32(limit)
+	}
+
+	switch ctx.DefaultQuery("order", "desc") {
+	case "asc":
+		page.Ascending = true
+	case "desc":
+	default:
+		return page, errors.New("order must be asc or desc")
+	}
+
+	if value := ctx.Query("cursor"); value != "" {
+		if _, _, err := decodeCursor(value); err != nil {
+			return page, errInvalidCursor
+		}
+		page.Cursor = value
+	}
+
+	return page, nil
+}
+
+// parseTimeRange reads the RFC3339 from/to query parameters; missing bounds are open
+func parseTimeRange(ctx *gin.Context) (time.Time, time.Time, error) {
+	from, to := time.Unix(0, 0), time.Now().Add(24*time.Hour)
+	for param, bound := range map[string]*time.Time{"from": &from, "to": &to} {
+		value := ctx.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, fmt.Errorf("%s must be an RFC3339 timestamp", param)
+		}
+		*bound = parsed
+	}
+	return from, to, nil
+}
+
+// cursorToken is the content of a cursor: the LastEvaluatedKey and the scope
+// of the query that produced it
+type cursorToken struct {
+	Scope string                       `json:"scope"`
+	Key   map[string]map[string]string `json:"key"`
+}
+
+// cursorScope names the table, index and partition a query reads, so a cursor
+// of another listing or tenant is refused instead of reaching DynamoDB
+func cursorScope(input *dynamodb.QueryInput) string {
+	partition := ""
+	condition, _, _ := strings.Cut(aws.ToString(input.KeyConditionExpression), " AND ")
+	if _, placeholder, found := strings.Cut(condition, "="); found {
+		switch v := input.ExpressionAttributeValues[strings.TrimSpace(placeholder)].(type) {
+		case *types.AttributeValueMemberS:
+			partition = v.Value
+		case *types.AttributeValueMemberN:
+			partition = v.Value
+		}
+	}
+	return aws.ToString(input.TableName) + "|" + aws.ToString(input.IndexName) + "|" + partition
+}
+
+// encodeCursor turns a LastEvaluatedKey into an opaque URL-safe token
+func encodeCursor(scope string, key map[string]types.AttributeValue) (string, error) {
+	plain := make(map[string]map[string]string, len(key))
+	for name, value := range key {
+		switch v := value.(type) {
+		case *types.AttributeValueMemberS:
+			plain[name] = map[string]string{"S": v.Value}
+		case *types.AttributeValueMemberN:
+			plain[name] = map[string]string{"N": v.Value}
+		default:
+			return "", fmt.Errorf("unsupported key attribute %s", name)
+		}
+	}
+
+	data, err := json.Marshal(cursorToken{Scope: scope, Key: plain})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor returns the scope and the key of a cursor
+func decodeCursor(cursor string) (string, map[string]types.AttributeValue, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var token cursorToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", nil, err
+	}
+	if token.Scope == "" || len(token.Key) == 0 {
+		return "", nil, errors.New("cursor has no scope or key")
+	}
+
+	key := make(map[string]types.AttributeValue, len(token.Key))
+	for name, value := range token.Key {
+		if s, ok := value["S"]; ok {
+			key[name] = &types.AttributeValueMemberS{Value: s}
+		} else if n, ok := value["N"]; ok {
+			key[name] = &types.AttributeValueMemberN{Value: n}
+		} else {
+			return "", nil, fmt.Errorf("invalid key attribute %s", name)
+		}
+	}
+	return token.Scope, key, nil
+}
+
+// queryFilter collects optional equality filters applied after the key condition
+type queryFilter struct {
+	expressions []string
+	names       map[string]string
+	values      map[string]types.AttributeValue
+}
+
+func newQueryFilter() *queryFilter {
+	return &queryFilter{names: make(map[string]string), values: make(map[string]types.AttributeValue)}
+}
+
+// equals adds attribute = value when value is set
+func (f *queryFilter) equals(attribute, value string) {
+	if value == "" {
+		return
+	}
+	placeholder := "f" + strconv.Itoa(len(f.expressions))
+	f.names["#"+placeholder] = attribute
+	f.values[":"+placeholder] = &types.AttributeValueMemberS{Value: value}
+	f.expressions = append(f.expressions, "#"+placeholder+" = :"+placeholder)
+}
+
+// equalsBool adds attribute = value when value is "true" or "false"
+func (f *queryFilter) equalsBool(attribute, value string) {
+	parsed, err := strconv.ParseBool(value)
+	if value == "" || err != nil {
+		return
+	}
+	placeholder := "f" + strconv.Itoa(len(f.expressions))
+	f.names["#"+placeholder] = attribute
+	f.values[":"+placeholder] = &types.AttributeValueMemberBOOL{Value: parsed}
+	f.expressions = append(f.expressions, "#"+placeholder+" = :"+placeholder)
+}
+
+func (f *queryFilter) apply(input *dynamodb.QueryInput) {
+	if len(f.expressions) == 0 {
+		return
+	}
+	if input.ExpressionAttributeNames == nil {
+		input.ExpressionAttributeNames = make(map[string]string)
+	}
+	if input.ExpressionAttributeValues == nil {
+		input.ExpressionAttributeValues = make(map[string]types.AttributeValue)
+	}
+	for name, attribute := range f.names {
+		input.ExpressionAttributeNames[name] = attribute
+	}
+	for name, value := range f.values {
+		input.ExpressionAttributeValues[name] = value
+	}
+	input.FilterExpression = aws.String(strings.Join(f.expressions, " AND "))
+}
+
+// queryPage reads one page of up to page.Limit items. Filters are applied after
+// DynamoDB's Limit, so it keeps reading until the page is full or the index is
+// exhausted, and returns the cursor for the next page ("" on the last one).
+// A cursor issued for another query fails with errInvalidCursor.
+func queryPage(client *dynamodb.Client, input *dynamodb.QueryInput, page pageRequest) ([]map[string]types.AttributeValue, string, error) {
+	scope := cursorScope(input)
+	input.ScanIndexForward = aws.Bool(page.Ascending)
+	input.ExclusiveStartKey = nil
+	if page.Cursor != "" {
+		issuedFor, key, err := decodeCursor(page.Cursor)
+		if err != nil || issuedFor != scope {
+			return nil, "", errInvalidCursor
+		}
+		input.ExclusiveStartKey = key
+	}
+
+	var items []map[string]types.AttributeValue
+	for {
+		input.Limit = aws.Int32(page.Limit - int32(len(items)))
+
+		result, err := client.Query(context.TODO(), input)
+		if err != nil {
+			return nil, "", err
+		}
+		items = append(items, result.Items...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return items, "", nil
+		}
+		if int32(len(items)) >= page.Limit {
+			cursor, err := encodeCursor(scope, result.LastEvaluatedKey)
+			return items, cursor, err
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// Pause scopes record who paused a schedule, and so what may resume it
+const (
+	PauseScopeSchedule = "schedule"
+	PauseScopeAcronym  = "acronym"
+)
+
+var errScheduleNotFound = errors.New("schedule not found")
+
+// PauseRequest is the body of the pause endpoints; without Until the pause
+// lasts until it is resumed explicitly
+type PauseRequest struct {
+	Reason string     `json:"reason"`
+	Until  *time.Time `json:"until,omitempty"`
+}
+
+// AcronymPause holds every schedule of one acronym, including those created
+// while it is in place
+type AcronymPause struct {
+	AccountId string     `json:"account_id" dynamodbav:"account_id"`
+	Acronym   string     `json:"acronym" dynamodbav:"acronym"`
+	Reason    string     `json:"reason" dynamodbav:"reason"`
+	PausedBy  string     `json:"paused_by" dynamodbav:"paused_by"`
+	PausedAt  time.Time  `json:"paused_at" dynamodbav:"paused_at"`
+	Until     *time.Time `json:"until,omitempty" dynamodbav:"until,omitempty"`
+}
+
+// active reports whether the pause is still in force at t
+func (p *AcronymPause) active(t time.Time) bool {
+	return p.Until == nil || t.Before(*p.Until)
+}
+
+// pause deactivates the schedule and records why
+func (sc *Schedule) pause(scope, reason, by string, until *time.Time, now time.Time) {
+	sc.IsActive = false
+	sc.PauseScope = scope
+	sc.PauseReason = reason
+	sc.PausedBy = by
+	sc.PausedAt = &now
+	sc.PausedUntil = until
+	sc.UpdatedAt = now
+}
+
+// resume reactivates the schedule and clears its pause
+func (sc *Schedule) resume(now time.Time) {
+	sc.IsActive = true
+	sc.PauseScope = ""
+	sc.PauseReason = ""
+	sc.PausedBy = ""
+	sc.PausedAt = nil
+	sc.PausedUntil = nil
+	sc.UpdatedAt = now
+}
+
+func (s *SchedulerPluginService) pauseTableName() string {
+	if s.pauseTable == "" {
+		return "acronym_pauses"
+	}
+	return s.pauseTable
+}
+
+// bindPauseRequest reads the pause body; a reason is mandatory and until must be in the future
+func bindPauseRequest(ctx *gin.Context) (PauseRequest, bool) {
+	var req PauseRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, false
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		return req, false
+	}
+	if req.Until != nil {
+		if !req.Until.After(time.Now()) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "until must be in the future"})
+			return req, false
+		}
+		until := req.Until.UTC()
+		req.Until = &until
+	}
+	return req, true
+}
+
+// getSchedule loads one of the account's schedules
+func (s *SchedulerPluginService) getSchedule(accountId, id string) (*Schedule, error) {
+	result, err := s.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errScheduleNotFound
+	}
+
+	var schedule Schedule
+	if err := attributevalue.UnmarshalMap(result.Item, &schedule); err != nil {
+		return nil, err
+	}
+	if schedule.AccountId != accountId {
+		return nil, errScheduleNotFound
+	}
+	return &schedule, nil
+}
+
+// putSchedule stores the schedule and refreshes the local cache
+func (s *SchedulerPluginService) putSchedule(schedule *Schedule) error {
+	item, err := attributevalue.MarshalMap(schedule)
+	if err != nil {
+		return err
+	}
+	_, err = s.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range s.schedules {
+		if s.schedules[i].ID == schedule.ID {
+			s.schedules[i] = *schedule
+		}
+	}
+	return nil
+}
+
+// loadSchedule answers 404/500 itself and returns nil when the schedule is unusable
+func (s *SchedulerPluginService) loadSchedule(ctx *gin.Context, id string) *Schedule {
+	schedule, err := s.getSchedule(identityFrom(ctx).AccountId, id)
+	if errors.Is(err, errScheduleNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error loading schedule %s: %v", id, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load schedule"})
+		return nil
+	}
+	return schedule
+}
+
+// nextFire computes the next run of the schedule, skipping the pause window.
+// An open-ended pause has no next run.
+func (s *SchedulerPluginService) nextFire(schedule *Schedule, after time.Time) (time.Time, error) {
+	if !schedule.IsActive {
+		if schedule.PausedUntil == nil {
+			return time.Time{}, nil
+		}
+		if schedule.PausedUntil.After(after) {
+			after = *schedule.PausedUntil
+		}
+	}
+
+	plan, err := s.planFor(schedule.AccountId, schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return plan.next(after), nil
+}
+
+// getAcronymPause returns the acronym's pause, or nil when it is not paused
+func (s *SchedulerPluginService) getAcronymPause(accountId, acronym string) (*AcronymPause, error) {
+	result, err := s.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(s.pauseTableName()),
+		Key: map[string]types.AttributeValue{
+			"account_id": &types.AttributeValueMemberS{Value: accountId},
+			"acronym":    &types.AttributeValueMemberS{Value: acronym},
+		},
+	})
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+
+	var pause AcronymPause
+	if err := attributevalue.UnmarshalMap(result.Item, &pause); err != nil {
+		return nil, err
+	}
+	if !pause.active(time.Now()) {
+		return nil, nil
+	}
+	return &pause, nil
+}
+
+// applyAcronymPause pauses a new schedule whose acronym is on hold
+func (s *SchedulerPluginService) applyAcronymPause(schedule *Schedule) error {
+	if schedule.Acronym == "" {
+		return nil
+	}
+	pause, err := s.getAcronymPause(schedule.AccountId, schedule.Acronym)
+	if err != nil || pause == nil {
+		return err
+	}
+	schedule.pause(PauseScopeAcronym, pause.Reason, pause.PausedBy, pause.Until, time.Now())
+	s.refreshNextRun(schedule)
+	return nil
+}
+
+// acronymSchedules loads every schedule of the account that belongs to the acronym
+func (s *SchedulerPluginService) acronymSchedules(accountId, acronym string) ([]Schedule, error) {
+	var schedules []Schedule
+	paginator := dynamodb.NewQueryPaginator(s.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(s.tableName),
+		IndexName:              aws.String("account_id-created_at-index"),
+		KeyConditionExpression: aws.String("account_id = :accountId"),
+		FilterExpression:       aws.String("acronym = :acronym"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: accountId},
+			":acronym":   &types.AttributeValueMemberS{Value: acronym},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+
+		var pageSchedules []Schedule
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageSchedules); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, pageSchedules...)
+	}
+	return schedules, nil
+}
+
+// PauseSchedule stops a schedule from firing, optionally until a given time
+func (s *SchedulerPluginService) PauseSchedule(ctx *gin.Context) {
+	id := ctx.Param("id")
+	setAuditTarget(ctx, "schedule/"+id)
+	req, ok := bindPauseRequest(ctx)
+	if !ok {
+		return
+	}
+	schedule := s.loadSchedule(ctx, id)
+	if schedule == nil {
+		return
+	}
+	if !schedule.IsActive && schedule.PauseScope == PauseScopeAcronym {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Schedule is held by the pause of acronym " + schedule.Acronym})
+		return
+	}
+
+	schedule.pause(PauseScopeSchedule, req.Reason, identityFrom(ctx).Subject, req.Until, time.Now())
+	s.refreshNextRun(schedule)
+	if err := s.putSchedule(schedule); err != nil {
+		log.Printf("Error storing schedule %s: %v", id, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store schedule"})
+		return
+	}
+
+	log.Printf("Scheduler Plugin paused schedule %s: %s", id, req.Reason)
+	ctx.JSON(http.StatusOK, schedule)
+}
+
+// ResumeSchedule lets a paused schedule fire again
+func (s *SchedulerPluginService) ResumeSchedule(ctx *gin.Context) {
+	id := ctx.Param("id")
+	setAuditTarget(ctx, "schedule/"+id)
+	schedule := s.loadSchedule(ctx, id)
+	if schedule == nil {
+		return
+	}
+	if schedule.IsActive {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Schedule is not paused"})
+		return
+	}
+	if schedule.PauseScope == PauseScopeAcronym {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Schedule is held by the pause of acronym " + schedule.Acronym + "; resume the acronym instead"})
+		return
+	}
+
+	schedule.resume(time.Now())
+	s.refreshNextRun(schedule)
+	if err := s.putSchedule(schedule); err != nil {
+		log.Printf("Error storing schedule %s: %v", id, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store schedule"})
+		return
+	}
+
+	log.Printf("Scheduler Plugin resumed schedule %s", id)
+	ctx.JSON(http.StatusOK, schedule)
+}
+
+// refreshNextRun recomputes NextRun after a state change; on error the old value is kept
+func (s *SchedulerPluginService) refreshNextRun(schedule *Schedule) {
+	next, err := s.nextFire(schedule, time.Now())
+	if err != nil {
+		log.Printf("Error computing next run of schedule %s: %v", schedule.ID, err)
+		return
+	}
+	schedule.NextRun = next
+}
+
+// GetAcronymPauses lists the acronyms of the account that are on hold
+func (s *SchedulerPluginService) GetAcronymPauses(ctx *gin.Context) {
+	result, err := s.dynamoClient.Query(context.TODO(), &dynamodb.QueryInput{
+		TableName:              aws.String(s.pauseTableName()),
+		KeyConditionExpression: aws.String("account_id = :accountId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: identityFrom(ctx).AccountId},
+		},
+	})
+	if err != nil {
+		log.Printf("Error querying acronym pauses: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve acronym pauses"})
+		return
+	}
+
+	var pauses []AcronymPause
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &pauses); err != nil {
+		log.Printf("Error unmarshaling acronym pauses: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process acronym pauses"})
+		return
+	}
+
+	active := make([]AcronymPause, 0, len(pauses))
+	for _, pause := range pauses {
+		if pause.active(time.Now()) {
+			active = append(active, pause)
+		}
+	}
+	ctx.JSON(http.StatusOK, active)
+}
+
+// PauseAcronym pauses every schedule of an acronym and holds the ones created later
+func (s *SchedulerPluginService) PauseAcronym(ctx *gin.Context) {
+	acronym := ctx.Param("acronym")
+	setAuditTarget(ctx, "acronym/"+acronym)
+	identity := identityFrom(ctx)
+	if !identity.CanAccessAcronym(acronym) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Acronym " + acronym + " is not accessible to the caller"})
+		return
+	}
+	req, ok := bindPauseRequest(ctx)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	pause := AcronymPause{
+		AccountId: identity.AccountId,
+		Acronym:   acronym,
+		Reason:    req.Reason,
+		PausedBy:  identity.Subject,
+		PausedAt:  now,
+		Until:     req.Until,
+	}
+	item, err := attributevalue.MarshalMap(pause)
+	if err != nil {
+		log.Printf("Error marshaling acronym pause: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process acronym pause"})
+		return
+	}
+	_, err = s.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(s.pauseTableName()),
+		Item:      item,
+	})
+	if err != nil {
+		log.Printf("Error storing acronym pause %s: %v", acronym, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store acronym pause"})
+		return
+	}
+
+	schedules, err := s.acronymSchedules(identity.AccountId, acronym)
+	if err != nil {
+		log.Printf("Error loading schedules of acronym %s: %v", acronym, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve schedules"})
+		return
+	}
+
+	// Schedules paused on their own keep their pause; the rest move under the acronym's
+	paused := 0
+	for i := range schedules {
+		schedule := &schedules[i]
+		if !schedule.IsActive && schedule.PauseScope == PauseScopeSchedule {
+			continue
+		}
+		schedule.pause(PauseScopeAcronym, req.Reason, identity.Subject, req.Until, now)
+		s.refreshNextRun(schedule)
+		if err := s.putSchedule(schedule); err != nil {
+			log.Printf("Error pausing schedule %s: %v", schedule.ID, err)
+			continue
+		}
+		paused++
+	}
+
+	log.Printf("Scheduler Plugin paused acronym %s (%d schedules): %s", acronym, paused, req.Reason)
+	ctx.JSON(http.StatusOK, gin.H{
+		"pause":            pause,
+		"schedules_paused": paused,
+	})
+}
+
+// ResumeAcronym lifts the acronym's pause and resumes the schedules it held
+func (s *SchedulerPluginService) ResumeAcronym(ctx *gin.Context) {
+	acronym := ctx.Param("acronym")
+	setAuditTarget(ctx, "acronym/"+acronym)
+	identity := identityFrom(ctx)
+	if !identity.CanAccessAcronym(acronym) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Acronym " + acronym + " is not accessible to the caller"})
+		return
+	}
+
+	resumed, err := s.resumeAcronym(identity.AccountId, acronym)
+	if err != nil {
+		log.Printf("Error resuming acronym %s: %v", acronym, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resume acronym"})
+		return
+	}
+
+	log.Printf("Scheduler Plugin resumed acronym %s (%d schedules)", acronym, resumed)
+	ctx.JSON(http.StatusOK, gin.H{
+		"acronym":           acronym,
+		"schedules_resumed": resumed,
+	})
+}
+
+// resumeAcronym deletes the acronym's pause and resumes the schedules held by it
+func (s *SchedulerPluginService) resumeAcronym(accountId, acronym string) (int, error) {
+	_, err := s.dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.pauseTableName()),
+		Key: map[string]types.AttributeValue{
+			"account_id": &types.AttributeValueMemberS{Value: accountId},
+			"acronym":    &types.AttributeValueMemberS{Value: acronym},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	schedules, err := s.acronymSchedules(accountId, acronym)
+	if err != nil {
+		return 0, err
+	}
+
+	resumed := 0
+	for i := range schedules {
+		schedule := &schedules[i]
+		if schedule.IsActive || schedule.PauseScope != PauseScopeAcronym {
+			continue
+		}
+		schedule.resume(time.Now())
+		s.refreshNextRun(schedule)
+		if err := s.putSchedule(schedule); err != nil {
+			return resumed, fmt.Errorf("resuming schedule %s: %w", schedule.ID, err)
+		}
+		resumed++
+	}
+	return resumed, nil
+}
+
+// startPauseSweeper resumes schedules and acronyms whose pause expired,
+// every PAUSE_CHECK_INTERVAL seconds (default 60)
+func (s *SchedulerPluginService) startPauseSweeper() {
+	interval := 60 * time.Second
+	if value, err := strconv.Atoi(os.Getenv("PAUSE_CHECK_INTERVAL")); err == nil && value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.receiveCtx.Done():
+			log.Println("Pause sweeper stopped")
+			return
+		case <-ticker.C:
+			s.sweepExpiredPauses()
+		}
+	}
+}
+
+func (s *SchedulerPluginService) sweepExpiredPauses() {
+	now := time.Now()
+
+	pauses := dynamodb.NewScanPaginator(s.dynamoClient, &dynamodb.ScanInput{
+		TableName:        aws.String(s.pauseTableName()),
+		FilterExpression: aws.String("attribute_exists(#until)"),
+		ExpressionAttributeNames: map[string]string{
+			"#until": "until",
+		},
+	})
+	for pauses.HasMorePages() {
+		page, err := pauses.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error scanning acronym pauses: %v", err)
+			return
+		}
+		var pagePauses []AcronymPause
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pagePauses); err != nil {
+			log.Printf("Error unmarshaling acronym pauses: %v", err)
+			return
+		}
+		for _, pause := range pagePauses {
+			if pause.active(now) {
+				continue
+			}
+			if _, err := s.resumeAcronym(pause.AccountId, pause.Acronym); err != nil {
+				log.Printf("Error resuming expired pause of acronym %s: %v", pause.Acronym, err)
+				continue
+			}
+			log.Printf("Scheduler Plugin pause of acronym %s expired", pause.Acronym)
+		}
+	}
+
+	schedules := dynamodb.NewScanPaginator(s.dynamoClient, &dynamodb.ScanInput{
+		TableName:        aws.String(s.tableName),
+		FilterExpression: aws.String("is_active = :false AND attribute_exists(paused_until)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":false": &types.AttributeValueMemberBOOL{Value: false},
+		},
+	})
+	for schedules.HasMorePages() {
+		page, err := schedules.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error scanning paused schedules: %v", err)
+			return
+		}
+		var pageSchedules []Schedule
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageSchedules); err != nil {
+			log.Printf("Error unmarshaling paused schedules: %v", err)
+			return
+		}
+		for i := range pageSchedules {
+			schedule := &pageSchedules[i]
+			if schedule.PausedUntil == nil || now.Before(*schedule.PausedUntil) {
+				continue
+			}
+			schedule.resume(now)
+			s.refreshNextRun(schedule)
+			if err := s.putSchedule(schedule); err != nil {
+				log.Printf("Error resuming schedule %s: %v", schedule.ID, err)
+				continue
+			}
+			log.Printf("Scheduler Plugin pause of schedule %s expired", schedule.ID)
+		}
+	}
+}
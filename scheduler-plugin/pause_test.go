@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextFire(t *testing.T) {
+	now := mustTime(t, "2025-06-02T10:00:00Z")
+	until := func(value string) *time.Time {
+		parsed := mustTime(t, value)
+		return &parsed
+	}
+
+	tests := []struct {
+		name        string
+		isActive    bool
+		pausedUntil *time.Time
+		want        string // "" when the schedule has no next run
+	}{
+		{"active", true, nil, "2025-06-03T09:00:00Z"},
+		{"paused until resumed", false, nil, ""},
+		{"paused over the next runs", false, until("2025-06-05T12:00:00Z"), "2025-06-06T09:00:00Z"},
+		{"pause ending before the next run", false, until("2025-06-02T11:00:00Z"), "2025-06-03T09:00:00Z"},
+		{"pause already over", false, until("2025-06-01T00:00:00Z"), "2025-06-03T09:00:00Z"},
+	}
+
+	service := &SchedulerPluginService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := &Schedule{CronExpr: "0 0 9 * * *", IsActive: tt.isActive, PausedUntil: tt.pausedUntil}
+			got, err := service.nextFire(schedule, now)
+			if err != nil {
+				t.Fatalf("nextFire(): %v", err)
+			}
+			if tt.want == "" {
+				if !got.IsZero() {
+					t.Errorf("nextFire() = %s, want no run", got)
+				}
+				return
+			}
+			if want := mustTime(t, tt.want); !got.Equal(want) {
+				t.Errorf("nextFire() = %s, want %s", got.UTC().Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
+
+func TestAcronymPauseActive(t *testing.T) {
+	now := mustTime(t, "2025-06-02T10:00:00Z")
+	later := now.Add(time.Hour)
+	earlier := now.Add(-time.Hour)
+
+	tests := []struct {
+		name  string
+		until *time.Time
+		want  bool
+	}{
+		{"open-ended", nil, true},
+		{"until later", &later, true},
+		{"until now", &now, false},
+		{"expired", &earlier, false},
+	}
+
+	for _, tt := range tests {
+		pause := AcronymPause{Until: tt.until}
+		if got := pause.active(now); got != tt.want {
+			t.Errorf("%s: active() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSchedulePauseResume(t *testing.T) {
+	now := mustTime(t, "2025-06-02T10:00:00Z")
+	until := now.Add(24 * time.Hour)
+	schedule := &Schedule{IsActive: true}
+
+	schedule.pause(PauseScopeAcronym, "freeze", "ops", &until, now)
+	if schedule.IsActive || schedule.PauseScope != PauseScopeAcronym || schedule.PauseReason != "freeze" ||
+		schedule.PausedBy != "ops" || schedule.PausedAt == nil || !schedule.PausedUntil.Equal(until) {
+		t.Fatalf("pause() left %+v", schedule)
+	}
+
+	schedule.resume(now.Add(time.Minute))
+	if !schedule.IsActive || schedule.PauseScope != "" || schedule.PauseReason != "" ||
+		schedule.PausedBy != "" || schedule.PausedAt != nil || schedule.PausedUntil != nil {
+		t.Fatalf("resume() left %+v", schedule)
+	}
+	if !schedule.UpdatedAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("resume() UpdatedAt = %s, want %s", schedule.UpdatedAt, now.Add(time.Minute))
+	}
+}
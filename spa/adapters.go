@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// Adapter states; SPAQ holds the dispatch of disabled adapters
+const (
+	AdapterStatusConfigured = "configured"
+	AdapterStatusDisabled   = "disabled"
+)
+
+var errAdapterNotFound = errors.New("adapter not found")
+
+// DisableRequest is the body of POST /adapters/:id/disable; without Until the
+// adapter stays disabled until it is enabled explicitly
+type DisableRequest struct {
+	Reason string     `json:"reason"`
+	Until  *time.Time `json:"until,omitempty"`
+}
+
+// disable marks the adapter disabled and records why
+func (a *Adapter) disable(reason, by string, until *time.Time, now time.Time) {
+	a.Status = AdapterStatusDisabled
+	a.StatusReason = reason
+	a.DisabledBy = by
+	a.DisabledAt = &now
+	a.DisabledUntil = until
+	a.UpdatedAt = now
+}
+
+// enable puts the adapter back in service
+func (a *Adapter) enable(now time.Time) {
+	a.Status = AdapterStatusConfigured
+	a.StatusReason = ""
+	a.DisabledBy = ""
+	a.DisabledAt = nil
+	a.DisabledUntil = nil
+	a.UpdatedAt = now
+}
+
+// getAdapter loads one of the account's adapters
+func (s *SPAService) getAdapter(accountId, id string) (*Adapter, error) {
+	result, err := s.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errAdapterNotFound
+	}
+
+	var adapter Adapter
+	if err := attributevalue.UnmarshalMap(result.Item, &adapter); err != nil {
+		return nil, err
+	}
+	// Triggers and schedules share the table; only adapters have an adapter_type
+	if adapter.AccountId != accountId || adapter.AdapterType == "" {
+		return nil, errAdapterNotFound
+	}
+	return &adapter, nil
+}
+
+// putAdapter stores the adapter and refreshes the local cache
+func (s *SPAService) putAdapter(adapter *Adapter) error {
+	item, err := attributevalue.MarshalMap(adapter)
+	if err != nil {
+		return err
+	}
+	_, err = s.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range s.adapters {
+		if s.adapters[i].ID == adapter.ID {
+			s.adapters[i] = *adapter
+		}
+	}
+	return nil
+}
+
+// loadAdapter answers 404/500 itself and returns nil when the adapter is unusable
+func (s *SPAService) loadAdapter(ctx *gin.Context, id string) *Adapter {
+	adapter, err := s.getAdapter(identityFrom(ctx).AccountId, id)
+	if errors.Is(err, errAdapterNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Adapter not found"})
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error loading adapter %s: %v", id, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load adapter"})
+		return nil
+	}
+	return adapter
+}
+
+// DisableAdapter stops SPAQ from dispatching the adapter's messages, optionally until a given time
+func (s *SPAService) DisableAdapter(ctx *gin.Context) {
+	id := ctx.Param("id")
+	setAuditTarget(ctx, "adapter/"+id)
+
+	var req DisableRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		return
+	}
+	if req.Until != nil {
+		if !req.Until.After(time.Now()) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "until must be in the future"})
+			return
+		}
+		until := req.Until.UTC()
+		req.Until = &until
+	}
+
+	adapter := s.loadAdapter(ctx, id)
+	if adapter == nil {
+		return
+	}
+	identity := identityFrom(ctx)
+	if adapter.Acronym != "" && !identity.CanAccessAcronym(adapter.Acronym) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Acronym " + adapter.Acronym + " is not accessible to the caller"})
+		return
+	}
+
+	adapter.disable(req.Reason, identity.Subject, req.Until, time.Now())
+	if err := s.putAdapter(adapter); err != nil {
+		log.Printf("Error storing adapter %s: %v", id, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store adapter"})
+		return
+	}
+
+	log.Printf("SPA disabled adapter %s: %s", id, req.Reason)
+	ctx.JSON(http.StatusOK, adapter)
+}
+
+// EnableAdapter puts a disabled adapter back in service; SPAQ then releases its held messages
+func (s *SPAService) EnableAdapter(ctx *gin.Context) {
+	id := ctx.Param("id")
+	setAuditTarget(ctx, "adapter/"+id)
+
+	adapter := s.loadAdapter(ctx, id)
+	if adapter == nil {
+		return
+	}
+	if adapter.Acronym != "" && !identityFrom(ctx).CanAccessAcronym(adapter.Acronym) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Acronym " + adapter.Acronym + " is not accessible to the caller"})
+		return
+	}
+	if adapter.Status != AdapterStatusDisabled {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Adapter is not disabled"})
+		return
+	}
+
+	adapter.enable(time.Now())
+	if err := s.putAdapter(adapter); err != nil {
+		log.Printf("Error storing adapter %s: %v", id, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store adapter"})
+		return
+	}
+
+	log.Printf("SPA enabled adapter %s", id)
+	ctx.JSON(http.StatusOK, adapter)
+}
+
+// startDisableSweeper re-enables adapters whose disable window expired,
+// every PAUSE_CHECK_INTERVAL seconds (default 60)
+func (s *SPAService) startDisableSweeper() {
+	interval := 60 * time.Second
+	if value, err := strconv.Atoi(os.Getenv("PAUSE_CHECK_INTERVAL")); err == nil && value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.receiveCtx.Done():
+			log.Println("Disable sweeper stopped")
+			return
+		case <-ticker.C:
+			s.sweepExpiredDisables()
+		}
+	}
+}
+
+func (s *SPAService) sweepExpiredDisables() {
+	now := time.Now()
+	paginator := dynamodb.NewScanPaginator(s.dynamoClient, &dynamodb.ScanInput{
+		TableName:        aws.String(s.tableName),
+		FilterExpression: aws.String("#status = :disabled AND attribute_exists(disabled_until)"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":disabled": &types.AttributeValueMemberS{Value: AdapterStatusDisabled},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error scanning disabled adapters: %v", err)
+			return
+		}
+		var adapters []Adapter
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &adapters); err != nil {
+			log.Printf("Error unmarshaling disabled adapters: %v", err)
+			return
+		}
+		for i := range adapters {
+			adapter := &adapters[i]
+			if adapter.DisabledUntil == nil || now.Before(*adapter.DisabledUntil) {
+				continue
+			}
+			adapter.enable(now)
+			if err := s.putAdapter(adapter); err != nil {
+				log.Printf("Error enabling adapter %s: %v", adapter.ID, err)
+				continue
+			}
+			log.Printf("SPA disable window of adapter %s expired", adapter.ID)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Roles, from least to most privileged. Each role includes the ones below it.
+const (
+	RoleViewer    = "viewer"
+	RoleSubmitter = "submitter"
+	RoleOperator  = "operator"
+)
+
+var roleRank = map[string]int{
+	RoleViewer:    1,
+	RoleSubmitter: 2,
+	RoleOperator:  3,
+}
+
+var errUnauthenticated = errors.New("missing credentials")
+
+// serviceAccount is the account of an API key that internal services use to act
+// for any tenant
+const serviceAccount = "*"
+
+// Authenticator resolves the caller of a request. It returns errUnauthenticated
+// when the request carries no credentials it understands, so the next
+// authenticator in the chain can try.
+type Authenticator interface {
+	Authenticate(req *http.Request) (Identity, error)
+}
+
+// loadAuthenticators builds the chain from AUTH_MODE, a comma-separated list of
+// "apikey" (the default), "jwt" and "none". "none" trusts X-Account-Id for
+// read-only access and is refused unless AUTH_INSECURE_HEADERS=true, since it
+// is meant for local development only.
+func loadAuthenticators() []Authenticator {
+	mode := os.Getenv("AUTH_MODE")
+	if mode == "" {
+		mode = "apikey"
+	}
+
+	var authenticators []Authenticator
+	for _, name := range strings.Split(mode, ",") {
+		switch strings.TrimSpace(name) {
+		case "apikey":
+			authenticators = append(authenticators, newAPIKeyAuthenticator(os.Getenv("API_KEYS")))
+		case "jwt":
+			authenticators = append(authenticators, newJWTAuthenticator())
+		case "none":
+			if os.Getenv("AUTH_INSECURE_HEADERS") != "true" {
+				log.Fatalf("AUTH_MODE none trusts unauthenticated headers; set AUTH_INSECURE_HEADERS=true to use it in development")
+			}
+			log.Printf("WARN: AUTH_MODE none lets anyone read any tenant's data")
+			authenticators = append(authenticators, headerAuthenticator{})
+		default:
+			log.Fatalf("Unknown AUTH_MODE %q", name)
+		}
+	}
+
+	log.Printf("Authentication mode: %s", mode)
+	return authenticators
+}
+
+// authMiddleware authenticates the caller and stores its identity on the context.
+// Every tenant-scoped read and write relies on it.
+func authMiddleware(authenticators []Authenticator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		for _, authenticator := range authenticators {
+			identity, err := authenticator.Authenticate(ctx.Request)
+			if errors.Is(err, errUnauthenticated) {
+				continue
+			}
+			if err != nil {
+				log.Printf("Authentication failed: %v", err)
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+				return
+			}
+
+			ctx.Set(identityContextKey, identity)
+			ctx.Next()
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+	}
+}
+
+// requireRole rejects callers whose roles do not include the given one
+func requireRole(role string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !identityFrom(ctx).HasRole(role) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":        "Insufficient role",
+				"requiredRole": role,
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// headerAuthenticator trusts X-Account-Id and grants the viewer role only, so
+// an unauthenticated caller can never change anything
+type headerAuthenticator struct{}
+
+func (h headerAuthenticator) Authenticate(req *http.Request) (Identity, error) {
+	accountId := req.Header.Get("X-Account-Id")
+	if accountId == "" {
+		return Identity{}, errUnauthenticated
+	}
+
+	subject := req.Header.Get("X-Subject")
+	if subject == "" {
+		subject = "anonymous"
+	}
+
+	return Identity{
+		Subject:   subject,
+		AccountId: accountId,
+		Acronyms:  splitList(req.Header.Get("X-Acronyms"), ","),
+		Roles:     []string{RoleViewer},
+	}, nil
+}
+
+// apiKeyAuthenticator checks X-API-Key against API_KEYS, a comma-separated list of
+// key:accountId:roles[:subject] entries with roles joined by "+", e.g.
+// "dev-key:000000000000:submitter+operator:local-dev". A service key, with
+// accountId "*", acts for the account named by X-Account-Id, which it must send.
+type apiKeyAuthenticator struct {
+	keys map[string]Identity
+}
+
+func newAPIKeyAuthenticator(config string) apiKeyAuthenticator {
+	authenticator := apiKeyAuthenticator{keys: make(map[string]Identity)}
+
+	for _, entry := range splitList(config, ",") {
+		fields := strings.Split(entry, ":")
+		if len(fields) < 3 || fields[0] == "" || fields[1] == "" {
+			log.Printf("WARN: Ignoring malformed API key entry")
+			continue
+		}
+
+		identity := Identity{
+			Subject:   "apikey:" + fields[1],
+			AccountId: fields[1],
+			Roles:     splitList(fields[2], "+"),
+		}
+		if len(fields) > 3 && fields[3] != "" {
+			identity.Subject = fields[3]
+		}
+		authenticator.keys[fields[0]] = identity
+	}
+
+	if len(authenticator.keys) == 0 {
+		log.Printf("WARN: AUTH_MODE includes apikey but API_KEYS is empty")
+	}
+	return authenticator
+}
+
+func (a apiKeyAuthenticator) Authenticate(req *http.Request) (Identity, error) {
+	key := req.Header.Get("X-API-Key")
+	if key == "" {
+		return Identity{}, errUnauthenticated
+	}
+
+	identity, ok := a.keys[key]
+	if !ok {
+		return Identity{}, errors.New("unknown API key")
+	}
+	if identity.AccountId == serviceAccount {
+		identity.AccountId = req.Header.Get("X-Account-Id")
+		if identity.AccountId == "" {
+			return Identity{}, errors.New("service API key used without X-Account-Id")
+		}
+		if subject := req.Header.Get("X-Subject"); subject != "" {
+			identity.Subject = subject
+		}
+		identity.Acronyms = splitList(req.Header.Get("X-Acronyms"), ",")
+	}
+	return identity, nil
+}
+
+// jwtAuthenticator validates bearer tokens against the keys published at JWKS_URL.
+// JWT_ISSUER and JWT_AUDIENCE are enforced when set; the account, roles and
+// acronyms come from the claims named by JWT_ACCOUNT_CLAIM, JWT_ROLES_CLAIM and
+// JWT_ACRONYMS_CLAIM.
+type jwtAuthenticator struct {
+	jwks          *jwksCache
+	parser        *jwt.Parser
+	accountClaim  string
+	rolesClaim    string
+	acronymsClaim string
+}
+
+func newJWTAuthenticator() *jwtAuthenticator {
+	jwksURL := os.Getenv("JWKS_URL")
+	if jwksURL == "" {
+		log.Fatalf("AUTH_MODE includes jwt but JWKS_URL is not set")
+	}
+
+	options := []jwt.ParserOption{jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}), jwt.WithExpirationRequired()}
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		options = append(options, jwt.WithIssuer(issuer))
+	}
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		options = append(options, jwt.WithAudience(audience))
+	}
+
+	return &jwtAuthenticator{
+		jwks:          &jwksCache{url: jwksURL, client: &http.Client{Timeout: 5 * time.Second}},
+		parser:        jwt.NewParser(options...),
+		accountClaim:  envOrDefault("JWT_ACCOUNT_CLAIM", "account_id"),
+		rolesClaim:    envOrDefault("JWT_ROLES_CLAIM", "roles"),
+		acronymsClaim: envOrDefault("JWT_ACRONYMS_CLAIM", "acronyms"),
+	}
+}
+
+func (a *jwtAuthenticator) Authenticate(req *http.Request) (Identity, error) {
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return Identity{}, errUnauthenticated
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(strings.TrimPrefix(header, "Bearer "), claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return a.jwks.key(kid)
+	})
+	if err != nil {
+		return Identity{}, err
+	}
+
+	subject, _ := claims.GetSubject()
+	accountId, _ := claims[a.accountClaim].(string)
+	if accountId == "" {
+		return Identity{}, fmt.Errorf("token has no %s claim", a.accountClaim)
+	}
+
+	return Identity{
+		Subject:   subject,
+		AccountId: accountId,
+		Acronyms:  claimList(claims[a.acronymsClaim]),
+		Roles:     claimList(claims[a.rolesClaim]),
+	}, nil
+}
+
+// jwksCache keeps the RSA keys of a JWKS endpoint, refetching when an unknown
+// kid shows up (at most once a minute) or when the cache is an hour old.
+type jwksCache struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func (c *jwksCache) key(kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[kid]; ok && time.Since(c.fetchedAt) < time.Hour {
+		return key, nil
+	}
+	if time.Since(c.fetchedAt) > time.Minute {
+		if err := c.refresh(); err != nil {
+			return nil, err
+		}
+	}
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no JWKS key with kid %q", kid)
+}
+
+func (c *jwksCache) refresh() error {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS endpoint returned status %d", resp.StatusCode)
+	}
+
+	var document struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range document.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil {
+			log.Printf("WARN: Skipping malformed JWKS key %s", jwk.Kid)
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	return nil
+}
+
+// claimList accepts a claim given either as a JSON array or a space-separated string
+func claimList(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func splitList(value, separator string) []string {
+	var values []string
+	for _, item := range strings.Split(value, separator) {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
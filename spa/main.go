@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -47,11 +49,19 @@ type Routine struct {
 type Adapter struct {
 	ID          string                 `json:"id" dynamodbav:"id"`
 	ScheduleID  string                 `json:"schedule_id" dynamodbav:"schedule_id"`
+	AccountId   string                 `json:"account_id" dynamodbav:"account_id"`
 	AdapterType string                 `json:"adapter_type" dynamodbav:"adapter_type"`
 	Config      map[string]interface{} `json:"config" dynamodbav:"config"`
 	Status      string                 `json:"status" dynamodbav:"status"`
+	Acronym     string                 `json:"acronym,omitempty" dynamodbav:"acronym,omitempty"`
 	CreatedAt   time.Time              `json:"created_at" dynamodbav:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at" dynamodbav:"updated_at"`
+
+	// Set while Status is disabled; see adapters.go
+	StatusReason  string     `json:"status_reason,omitempty" dynamodbav:"status_reason,omitempty"`
+	DisabledBy    string     `json:"disabled_by,omitempty" dynamodbav:"disabled_by,omitempty"`
+	DisabledAt    *time.Time `json:"disabled_at,omitempty" dynamodbav:"disabled_at,omitempty"`
+	DisabledUntil *time.Time `json:"disabled_until,omitempty" dynamodbav:"disabled_until,omitempty"`
 }
 
 type SPAService struct {
@@ -63,6 +73,7 @@ type SPAService struct {
 	outQueueURL   string
 	receiveCtx    context.Context
 	receiveCancel context.CancelFunc
+	auditTable    string
 }
 
 func NewSPAService() *SPAService {
@@ -103,11 +114,15 @@ func NewSPAService() *SPAService {
 		outQueueURL:   os.Getenv("SPAQ_QUEUE_URL"),
 		receiveCtx:    ctx,
 		receiveCancel: cancel,
+		auditTable:    os.Getenv("AUDIT_TABLE"),
 	}
 
 	// Start message receiver
 	go service.startMessageReceiver()
 
+	// Re-enable adapters whose disable window expired
+	go service.startDisableSweeper()
+
 	return service
 }
 
@@ -173,10 +188,12 @@ func (s *SPAService) processMessage(messageBody string) {
 		ScheduleID:  scheduleID,
 		AdapterType: s.determineAdapterType(cronExpr),
 		Config:      s.createAdapterConfig(cronExpr),
-		Status:      "configured",
+		Status:      AdapterStatusConfigured,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
+	adapter.AccountId, _ = schedule["account_id"].(string)
+	adapter.Acronym, _ = schedule["acronym"].(string)
 
 	// Store adapter in DynamoDB
 	item, err := attributevalue.MarshalMap(adapter)
@@ -250,26 +267,58 @@ func (s *SPAService) GetHealth(ctx *gin.Context) {
 }
 
 func (s *SPAService) GetAdapters(ctx *gin.Context) {
-	// Query DynamoDB for all adapters
-	result, err := s.dynamoClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName: aws.String(s.tableName),
-	})
+	page, err := parsePageRequest(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, to, err := parseTimeRange(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
+	// Query the caller's adapters through the account_id GSI, sorted by creation time
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.tableName),
+		IndexName:              aws.String("account_id-created_at-index"),
+		KeyConditionExpression: aws.String("account_id = :accountId AND created_at BETWEEN :from AND :to"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: identityFrom(ctx).AccountId},
+			":from":      &types.AttributeValueMemberS{Value: from.UTC().Format(time.RFC3339Nano)},
+			":to":        &types.AttributeValueMemberS{Value: to.UTC().Format(time.RFC3339Nano)},
+		},
+	}
+
+	filter := newQueryFilter()
+	filter.equals("status", ctx.Query("status"))
+	filter.equals("adapter_type", ctx.Query("adapter_type"))
+	filter.equals("schedule_id", ctx.Query("schedule_id"))
+	filter.apply(input)
+
+	items, nextCursor, err := queryPage(s.dynamoClient, input, page)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		log.Printf("Error scanning DynamoDB: %v", err)
+		log.Printf("Error querying DynamoDB: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve adapters"})
 		return
 	}
 
-	var adapters []Adapter
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &adapters)
-	if err != nil {
+	adapters := make([]Adapter, 0, len(items))
+	if err := attributevalue.UnmarshalListOfMaps(items, &adapters); err != nil {
 		log.Printf("Error unmarshaling adapters: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process adapters data"})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, adapters)
+	ctx.JSON(http.StatusOK, gin.H{
+		"adapters":   adapters,
+		"count":      len(adapters),
+		"nextCursor": nextCursor,
+	})
 }
 
 func (s *SPAService) CreateAdapter(ctx *gin.Context) {
@@ -282,9 +331,10 @@ func (s *SPAService) CreateAdapter(ctx *gin.Context) {
 	if adapter.ID == "" {
 		adapter.ID = uuid.New().String()
 	}
+	adapter.AccountId = identityFrom(ctx).AccountId
 	adapter.CreatedAt = time.Now()
 	adapter.UpdatedAt = time.Now()
-	adapter.Status = "configured"
+	adapter.enable(time.Now())
 
 	// Store adapter in DynamoDB
 	item, err := attributevalue.MarshalMap(adapter)
@@ -347,12 +397,14 @@ func (s *SPAService) ProcessSchedule(ctx *gin.Context) {
 	adapter := Adapter{
 		ID:          uuid.New().String(),
 		ScheduleID:  scheduleID,
+		AccountId:   identityFrom(ctx).AccountId,
 		AdapterType: s.determineAdapterType(cronExpr),
 		Config:      s.createAdapterConfig(cronExpr),
-		Status:      "configured",
+		Status:      AdapterStatusConfigured,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
+	adapter.Acronym, _ = schedule["acronym"].(string)
 
 	// Store adapter in DynamoDB
 	item, err := attributevalue.MarshalMap(adapter)
@@ -406,15 +458,23 @@ func (s *SPAService) ProcessSchedule(ctx *gin.Context) {
 
 func (s *SPAService) Trigger(ctx *gin.Context) {
 	var req TriggerRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindAndValidate(ctx, "trigger-request", &req, nil) {
+		return
+	}
+
+	setAuditTarget(ctx, "execution/"+req.ExecutionName)
+	identity := identityFrom(ctx)
+	if req.AccountId != identity.AccountId {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "accountId does not match the caller's account"})
 		return
 	}
 
 	// Create trigger record
 	trigger := map[string]interface{}{
 		"id":            uuid.New().String(),
+		"account_id":    identity.AccountId,
 		"accountId":     req.AccountId,
+		"triggeredBy":   identity.Subject,
 		"executionName": req.ExecutionName,
 		"eventDate":     req.EventDate,
 		"eventType":     req.EventType,
@@ -475,20 +535,30 @@ func (s *SPAService) Trigger(ctx *gin.Context) {
 
 func (s *SPAService) Schedule(ctx *gin.Context) {
 	var req ScheduleRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindAndValidate(ctx, "schedule-request", &req, func() []Violation {
+		return validateScheduleRequest(req)
+	}) {
+		return
+	}
+
+	setAuditTarget(ctx, "schedule/"+req.Acronym+"/"+req.Repo)
+	identity := identityFrom(ctx)
+	if !identity.CanAccessAcronym(req.Acronym) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Acronym " + req.Acronym + " is not accessible to the caller"})
 		return
 	}
 
 	// Create schedule record
 	schedule := map[string]interface{}{
-		"id":        uuid.New().String(),
-		"acronym":   req.Acronym,
-		"repo":      req.Repo,
-		"routines":  req.Routines,
-		"status":    "created",
-		"createdAt": time.Now(),
-		"updatedAt": time.Now(),
+		"id":         uuid.New().String(),
+		"account_id": identity.AccountId,
+		"createdBy":  identity.Subject,
+		"acronym":    req.Acronym,
+		"repo":       req.Repo,
+		"routines":   req.Routines,
+		"status":     "created",
+		"createdAt":  time.Now(),
+		"updatedAt":  time.Now(),
 	}
 
 	// Store schedule in DynamoDB
@@ -548,14 +618,27 @@ func main() {
 	// Health check
 	r.GET("/health", service.GetHealth)
 
+	// Authenticated, tenant-scoped endpoints
+	tenant := r.Group("/", authMiddleware(loadAuthenticators()))
+	viewer := requireRole(RoleViewer)
+	submitter := requireRole(RoleSubmitter)
+	operator := requireRole(RoleOperator)
+	audit := newAuditor(service.dynamoClient, service.auditTableName(), "spa")
+
 	// New endpoints from collection.json
-	r.POST("/v1/trigger", service.Trigger)
-	r.POST("/v1/schedule", service.Schedule)
+	tenant.POST("/v1/trigger", audit("trigger.create"), submitter, service.Trigger)
+	tenant.POST("/v1/schedule", audit("schedule.create"), submitter, service.Schedule)
+
+	// Published JSON Schemas for request payloads
+	r.GET("/schemas", service.GetSchemas)
+	r.GET("/schemas/:name", service.GetSchema)
 
 	// Legacy adapter endpoints
-	r.GET("/adapters", service.GetAdapters)
-	r.POST("/adapters", service.CreateAdapter)
-	r.POST("/process", service.ProcessSchedule)
+	tenant.GET("/adapters", viewer, service.GetAdapters)
+	tenant.POST("/adapters", submitter, service.CreateAdapter)
+	tenant.POST("/adapters/:id/disable", audit("adapter.disable"), operator, service.DisableAdapter)
+	tenant.POST("/adapters/:id/enable", audit("adapter.enable"), operator, service.EnableAdapter)
+	tenant.POST("/process", submitter, service.ProcessSchedule)
 
 	port := os.Getenv("SERVICE_PORT")
 	if port == "" {
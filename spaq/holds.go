@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Queue message states
+const (
+	MessageStatusQueued    = "queued"
+	MessageStatusHeld      = "held"
+	MessageStatusProcessed = "processed"
+)
+
+// adapterState is the part of an SPA adapter that decides dispatch
+type adapterState struct {
+	Status        string     `dynamodbav:"status"`
+	Acronym       string     `dynamodbav:"acronym"`
+	ScheduleID    string     `dynamodbav:"schedule_id"`
+	StatusReason  string     `dynamodbav:"status_reason"`
+	DisabledUntil *time.Time `dynamodbav:"disabled_until"`
+}
+
+// scheduleState is the part of a Scheduler Plugin schedule that decides dispatch
+type scheduleState struct {
+	IsActive    bool       `dynamodbav:"is_active"`
+	Acronym     string     `dynamodbav:"acronym"`
+	PauseReason string     `dynamodbav:"pause_reason"`
+	PausedUntil *time.Time `dynamodbav:"paused_until"`
+}
+
+// acronymPause is a Scheduler Plugin hold on a whole acronym
+type acronymPause struct {
+	Reason string     `dynamodbav:"reason"`
+	Until  *time.Time `dynamodbav:"until"`
+}
+
+// stillPaused reports whether a pause with the optional end until is in force at now
+func stillPaused(until *time.Time, now time.Time) bool {
+	return until == nil || now.Before(*until)
+}
+
+func (s *SPAQService) adapterTableName() string {
+	if s.adapterTable == "" {
+		return "adapters"
+	}
+	return s.adapterTable
+}
+
+func (s *SPAQService) scheduleTableName() string {
+	if s.scheduleTable == "" {
+		return "schedules"
+	}
+	return s.scheduleTable
+}
+
+func (s *SPAQService) pauseTableName() string {
+	if s.pauseTable == "" {
+		return "acronym_pauses"
+	}
+	return s.pauseTable
+}
+
+// getState loads one item into out and reports whether it exists
+func (s *SPAQService) getState(table string, key map[string]types.AttributeValue, out interface{}) (bool, error) {
+	result, err := s.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(table),
+		Key:       key,
+	})
+	if err != nil || result.Item == nil {
+		return false, err
+	}
+	return true, attributevalue.UnmarshalMap(result.Item, out)
+}
+
+// holdReason explains why the message must not be dispatched yet: its adapter
+// is disabled, its schedule is paused or its acronym is paused. An empty
+// reason means it can be dispatched. When the state cannot be read the message
+// is held, and the releaser checks it again later.
+func (s *SPAQService) holdReason(queueMessage QueueMessage) string {
+	now := time.Now()
+	scheduleID, _ := queueMessage.Payload["schedule_id"].(string)
+	acronym, _ := queueMessage.Payload["acronym"].(string)
+
+	var adapter adapterState
+	found, err := s.getState(s.adapterTableName(), map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: queueMessage.AdapterID},
+	}, &adapter)
+	if err != nil {
+		log.Printf("Error loading adapter %s: %v", queueMessage.AdapterID, err)
+		return "adapter state unavailable"
+	}
+	if found {
+		if adapter.Status == "disabled" && stillPaused(adapter.DisabledUntil, now) {
+			return "adapter disabled: " + adapter.StatusReason
+		}
+		if scheduleID == "" {
+			scheduleID = adapter.ScheduleID
+		}
+		if acronym == "" {
+			acronym = adapter.Acronym
+		}
+	}
+
+	if scheduleID != "" {
+		var schedule scheduleState
+		found, err := s.getState(s.scheduleTableName(), map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: scheduleID},
+		}, &schedule)
+		if err != nil {
+			log.Printf("Error loading schedule %s: %v", scheduleID, err)
+			return "schedule state unavailable"
+		}
+		if found {
+			if !schedule.IsActive && stillPaused(schedule.PausedUntil, now) {
+				return "schedule paused: " + schedule.PauseReason
+			}
+			if acronym == "" {
+				acronym = schedule.Acronym
+			}
+		}
+	}
+
+	if acronym != "" && queueMessage.AccountId != "" {
+		var pause acronymPause
+		found, err := s.getState(s.pauseTableName(), map[string]types.AttributeValue{
+			"account_id": &types.AttributeValueMemberS{Value: queueMessage.AccountId},
+			"acronym":    &types.AttributeValueMemberS{Value: acronym},
+		}, &pause)
+		if err != nil {
+			log.Printf("Error loading pause of acronym %s: %v", acronym, err)
+			return "acronym state unavailable"
+		}
+		if found && stillPaused(pause.Until, now) {
+			return fmt.Sprintf("acronym %s paused: %s", acronym, pause.Reason)
+		}
+	}
+
+	return ""
+}
+
+// storeMessage writes the queue message to DynamoDB
+func (s *SPAQService) storeMessage(queueMessage QueueMessage) error {
+	item, err := attributevalue.MarshalMap(queueMessage)
+	if err != nil {
+		return err
+	}
+	_, err = s.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      item,
+	})
+	return err
+}
+
+// dispatch stores a new message, held or queued, and processes it when nothing holds it
+func (s *SPAQService) dispatch(queueMessage *QueueMessage) error {
+	if reason := s.holdReason(*queueMessage); reason != "" {
+		queueMessage.Status = MessageStatusHeld
+		queueMessage.HoldReason = reason
+	}
+
+	if err := s.storeMessage(*queueMessage); err != nil {
+		return err
+	}
+
+	// Add to local cache
+	s.messages = append(s.messages, *queueMessage)
+
+	if queueMessage.Status == MessageStatusHeld {
+		log.Printf("SPAQ holding queue message %s: %s", queueMessage.ID, queueMessage.HoldReason)
+		return nil
+	}
+
+	// Process the message immediately (simulate queue processing)
+	go s.processQueueMessage(*queueMessage)
+	return nil
+}
+
+// startHoldReleaser dispatches held messages once nothing holds them any more,
+// every HOLD_CHECK_INTERVAL seconds (default 30)
+func (s *SPAQService) startHoldReleaser() {
+	interval := 30 * time.Second
+	if value, err := strconv.Atoi(os.Getenv("HOLD_CHECK_INTERVAL")); err == nil && value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.receiveCtx.Done():
+			log.Println("Hold releaser stopped")
+			return
+		case <-ticker.C:
+			s.releaseHeldMessages()
+		}
+	}
+}
+
+func (s *SPAQService) releaseHeldMessages() {
+	paginator := dynamodb.NewScanPaginator(s.dynamoClient, &dynamodb.ScanInput{
+		TableName:        aws.String(s.tableName),
+		FilterExpression: aws.String("#status = :held"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":held": &types.AttributeValueMemberS{Value: MessageStatusHeld},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Error scanning held messages: %v", err)
+			return
+		}
+		var messages []QueueMessage
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &messages); err != nil {
+			log.Printf("Error unmarshaling held messages: %v", err)
+			return
+		}
+
+		for _, queueMessage := range messages {
+			if s.holdReason(queueMessage) != "" {
+				continue
+			}
+
+			queueMessage.Status = MessageStatusQueued
+			queueMessage.HoldReason = ""
+			queueMessage.UpdatedAt = time.Now()
+			if err := s.storeMessage(queueMessage); err != nil {
+				log.Printf("Error releasing queue message %s: %v", queueMessage.ID, err)
+				continue
+			}
+
+			log.Printf("SPAQ released queue message %s", queueMessage.ID)
+			go s.processQueueMessage(queueMessage)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -21,6 +23,7 @@ import (
 type QueueMessage struct {
 	ID          string                 `json:"id" dynamodbav:"id"`
 	AdapterID   string                 `json:"adapter_id" dynamodbav:"adapter_id"`
+	AccountId   string                 `json:"account_id" dynamodbav:"account_id"`
 	MessageType string                 `json:"message_type" dynamodbav:"message_type"`
 	Payload     map[string]interface{} `json:"payload" dynamodbav:"payload"`
 	Status      string                 `json:"status" dynamodbav:"status"`
@@ -29,6 +32,7 @@ type QueueMessage struct {
 	CreatedAt   time.Time              `json:"created_at" dynamodbav:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at" dynamodbav:"updated_at"`
 	ProcessedAt *time.Time             `json:"processed_at,omitempty" dynamodbav:"processed_at,omitempty"`
+	HoldReason  string                 `json:"hold_reason,omitempty" dynamodbav:"hold_reason,omitempty"`
 }
 
 type SPAQService struct {
@@ -39,6 +43,9 @@ type SPAQService struct {
 	inQueueURL    string
 	receiveCtx    context.Context
 	receiveCancel context.CancelFunc
+	adapterTable  string
+	scheduleTable string
+	pauseTable    string
 }
 
 func NewSPAQService() *SPAQService {
@@ -78,11 +85,17 @@ func NewSPAQService() *SPAQService {
 		inQueueURL:    os.Getenv("SPAQ_QUEUE_URL"),
 		receiveCtx:    ctx,
 		receiveCancel: cancel,
+		adapterTable:  os.Getenv("ADAPTER_TABLE"),
+		scheduleTable: os.Getenv("SCHEDULE_TABLE"),
+		pauseTable:    os.Getenv("PAUSE_TABLE"),
 	}
 
 	// Start message receiver
 	go service.startMessageReceiver()
 
+	// Dispatch held messages once their adapter, schedule and acronym are active again
+	go service.startHoldReleaser()
+
 	return service
 }
 
@@ -139,6 +152,7 @@ func (s *SPAQService) processMessage(messageBody string) {
 
 	adapterType, _ := adapter["adapter_type"].(string)
 	scheduleID, _ := adapter["schedule_id"].(string)
+	acronym, _ := adapter["acronym"].(string)
 
 	log.Printf("SPAQ processing adapter %s", adapterID)
 
@@ -150,37 +164,22 @@ func (s *SPAQService) processMessage(messageBody string) {
 		Payload: map[string]interface{}{
 			"adapter_type": adapterType,
 			"schedule_id":  scheduleID,
+			"acronym":      acronym,
 		},
-		Status:     "queued",
+		Status:     MessageStatusQueued,
 		Priority:   s.calculatePriority(adapterType),
 		RetryCount: 0,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	}
+	queueMessage.AccountId, _ = adapter["account_id"].(string)
 
-	// Store message in DynamoDB
-	item, err := attributevalue.MarshalMap(queueMessage)
-	if err != nil {
-		log.Printf("Error marshaling queue message: %v", err)
-		return
-	}
-
-	_, err = s.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
-		TableName: aws.String(s.tableName),
-		Item:      item,
-	})
-
-	if err != nil {
+	// Store the message and process it unless its adapter, schedule or acronym is paused
+	if err := s.dispatch(&queueMessage); err != nil {
 		log.Printf("Error storing queue message in DynamoDB: %v", err)
 		return
 	}
 
-	// Add to local cache
-	s.messages = append(s.messages, queueMessage)
-
-	// Process the message immediately (simulate queue processing)
-	go s.processQueueMessage(queueMessage)
-
 	log.Printf("SPAQ processed adapter %s and created queue message %s", adapterID, queueMessage.ID)
 }
 
@@ -203,7 +202,7 @@ func (s *SPAQService) processQueueMessage(queueMessage QueueMessage) {
 	time.Sleep(500 * time.Millisecond)
 
 	// Update message status
-	queueMessage.Status = "processed"
+	queueMessage.Status = MessageStatusProcessed
 	now := time.Now()
 	queueMessage.ProcessedAt = &now
 	queueMessage.UpdatedAt = now
@@ -244,62 +243,150 @@ func (s *SPAQService) GetHealth(ctx *gin.Context) {
 	})
 }
 
-func (s *SPAQService) GetMessages(ctx *gin.Context) {
-	// Query DynamoDB for all messages
-	result, err := s.dynamoClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName: aws.String(s.tableName),
+// maxStatsWindow bounds the interval GET /stats counts over
+const maxStatsWindow = 31 * 24 * time.Hour
+
+// countTenantMessages counts one account's messages created between from and
+// to by status, reading only the status of each
+func (s *SPAQService) countTenantMessages(accountId string, from, to time.Time) (map[string]int, error) {
+	counts := make(map[string]int)
+	paginator := dynamodb.NewQueryPaginator(s.dynamoClient, &dynamodb.QueryInput{
+		TableName:              aws.String(s.tableName),
+		IndexName:              aws.String("account_id-created_at-index"),
+		KeyConditionExpression: aws.String("account_id = :accountId AND created_at BETWEEN :from AND :to"),
+		ProjectionExpression:   aws.String("#status"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: accountId},
+			":from":      &types.AttributeValueMemberS{Value: from.UTC().Format(time.RFC3339Nano)},
+			":to":        &types.AttributeValueMemberS{Value: to.UTC().Format(time.RFC3339Nano)},
+		},
 	})
 
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+
+		var statuses []struct {
+			Status string `dynamodbav:"status"`
+		}
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &statuses); err != nil {
+			return nil, err
+		}
+		for _, item := range statuses {
+			counts[item.Status]++
+		}
+	}
+
+	return counts, nil
+}
+
+func (s *SPAQService) GetMessages(ctx *gin.Context) {
+	page, err := parsePageRequest(ctx)
 	if err != nil {
-		log.Printf("Error scanning DynamoDB: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	from, to, err := parseTimeRange(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Query the caller's messages through the account_id GSI, sorted by creation time
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.tableName),
+		IndexName:              aws.String("account_id-created_at-index"),
+		KeyConditionExpression: aws.String("account_id = :accountId AND created_at BETWEEN :from AND :to"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":accountId": &types.AttributeValueMemberS{Value: identityFrom(ctx).AccountId},
+			":from":      &types.AttributeValueMemberS{Value: from.UTC().Format(time.RFC3339Nano)},
+			":to":        &types.AttributeValueMemberS{Value: to.UTC().Format(time.RFC3339Nano)},
+		},
+	}
+
+	filter := newQueryFilter()
+	filter.equals("status", ctx.Query("status"))
+	filter.equals("message_type", ctx.Query("message_type"))
+	filter.equals("adapter_id", ctx.Query("adapter_id"))
+	filter.apply(input)
 
-	var messages []QueueMessage
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &messages)
+	items, nextCursor, err := queryPage(s.dynamoClient, input, page)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
+		log.Printf("Error querying DynamoDB: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+		return
+	}
+
+	messages := make([]QueueMessage, 0, len(items))
+	if err := attributevalue.UnmarshalListOfMaps(items, &messages); err != nil {
 		log.Printf("Error unmarshaling messages: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process messages data"})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, messages)
+	ctx.JSON(http.StatusOK, gin.H{
+		"messages":   messages,
+		"count":      len(messages),
+		"nextCursor": nextCursor,
+	})
 }
 
+// GetStats counts the caller's messages by status over from/to (RFC3339,
+// default the last 24 hours, at most 31 days)
 func (s *SPAQService) GetStats(ctx *gin.Context) {
-	// Query DynamoDB for all messages
-	result, err := s.dynamoClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName: aws.String(s.tableName),
-	})
-
-	if err != nil {
-		log.Printf("Error scanning DynamoDB: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+	for param, bound := range map[string]*time.Time{"from": &from, "to": &to} {
+		value := ctx.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC3339 timestamp"})
+			return
+		}
+		*bound = parsed
+	}
+	if to.Before(from) || to.Sub(from) > maxStatsWindow {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "from must precede to by at most 31 days"})
 		return
 	}
 
-	var messages []QueueMessage
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &messages)
+	// Query the caller's messages in the window through the account_id GSI
+	counts, err := s.countTenantMessages(identityFrom(ctx).AccountId, from, to)
 	if err != nil {
-		log.Printf("Error unmarshaling messages: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process messages data"})
+		log.Printf("Error querying DynamoDB: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
 		return
 	}
 
 	stats := map[string]int{
-		"total":     len(messages),
+		"total":     0,
 		"queued":    0,
+		"held":      0,
 		"processed": 0,
 		"failed":    0,
 	}
 
-	for _, msg := range messages {
-		stats[msg.Status]++
+	for status, count := range counts {
+		stats[status] += count
+		stats["total"] += count
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"queue_stats": stats,
+		"from":        from,
+		"to":          to,
 		"timestamp":   time.Now(),
 	})
 }
@@ -314,6 +401,7 @@ func (s *SPAQService) ProcessAdapter(ctx *gin.Context) {
 	adapterID, _ := adapter["id"].(string)
 	adapterType, _ := adapter["adapter_type"].(string)
 	scheduleID, _ := adapter["schedule_id"].(string)
+	acronym, _ := adapter["acronym"].(string)
 
 	log.Printf("SPAQ processing adapter %s", adapterID)
 
@@ -321,49 +409,35 @@ func (s *SPAQService) ProcessAdapter(ctx *gin.Context) {
 	queueMessage := QueueMessage{
 		ID:          uuid.New().String(),
 		AdapterID:   adapterID,
+		AccountId:   identityFrom(ctx).AccountId,
 		MessageType: "adapter_configuration",
 		Payload: map[string]interface{}{
 			"adapter_type": adapterType,
 			"schedule_id":  scheduleID,
+			"acronym":      acronym,
 		},
-		Status:     "queued",
+		Status:     MessageStatusQueued,
 		Priority:   s.calculatePriority(adapterType),
 		RetryCount: 0,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	}
 
-	// Store message in DynamoDB
-	item, err := attributevalue.MarshalMap(queueMessage)
-	if err != nil {
-		log.Printf("Error marshaling queue message: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process adapter"})
-		return
-	}
-
-	_, err = s.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
-		TableName: aws.String(s.tableName),
-		Item:      item,
-	})
-
-	if err != nil {
+	// Store the message and process it unless its adapter, schedule or acronym is paused
+	if err := s.dispatch(&queueMessage); err != nil {
 		log.Printf("Error storing queue message in DynamoDB: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store message"})
 		return
 	}
 
-	// Add to local cache
-	s.messages = append(s.messages, queueMessage)
-
-	// Process the message immediately (simulate queue processing)
-	go s.processQueueMessage(queueMessage)
-
 	log.Printf("SPAQ processed adapter %s and created queue message %s", adapterID, queueMessage.ID)
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"message":         "Adapter processed successfully",
 		"adapter_id":      adapterID,
 		"queue_message_id": queueMessage.ID,
+		"status":           queueMessage.Status,
+		"hold_reason":      queueMessage.HoldReason,
 	})
 }
 
@@ -375,10 +449,13 @@ func main() {
 	// Health check
 	r.GET("/health", service.GetHealth)
 
-	// Queue endpoints
-	r.GET("/messages", service.GetMessages)
-	r.GET("/stats", service.GetStats)
-	r.POST("/process", service.ProcessAdapter)
+	// Queue endpoints require an authenticated caller and are scoped to its tenant
+	tenant := r.Group("/", authMiddleware(loadAuthenticators()))
+	viewer := requireRole(RoleViewer)
+	submitter := requireRole(RoleSubmitter)
+	tenant.GET("/messages", viewer, service.GetMessages)
+	tenant.GET("/stats", viewer, service.GetStats)
+	tenant.POST("/process", submitter, service.ProcessAdapter)
 
 	port := os.Getenv("SERVICE_PORT")
 	if port == "" {
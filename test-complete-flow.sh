@@ -2,6 +2,9 @@
 
 echo "=== Testing Complete Flow ==="
 
+# Chave de API (X-API-Key) aceita pelos serviços; local-dev-key é a do docker-compose
+API_KEY="${JMI_API_KEY:-local-dev-key}"
+
 # Generate random execution names to avoid key collisions
 TIMESTAMP=$(date +%s)
 RANDOM_ID=$(openssl rand -hex 4)
@@ -18,7 +21,7 @@ echo ""
 # Test 1: Start Execution via Control-M (NEW - correct architecture)
 echo "1. Testing Start Execution via Control-M..."
 EXECUTION_UUID=$(curl -s -X POST http://localhost:8081/startExecution \
--H "Content-Type: application/json" \
+-H "Content-Type: application/json" -H "X-API-Key: $API_KEY" \
 -d "{
     \"executionName\": \"$EXECUTION_NAME_1\"
 }" | jq -r '.executionUuid // empty')
@@ -32,7 +35,7 @@ fi
 # Test 2: Start Execution via Control-M - Synthetic Test
 echo "2. Testing Start Execution via Control-M - Synthetic Test..."
 curl -s -X POST http://localhost:8081/startExecution \
--H "Content-Type: application/json" \
+-H "Content-Type: application/json" -H "X-API-Key: $API_KEY" \
 -d "{
     \"executionName\": \"$EXECUTION_NAME_2\"
 }" > /dev/null
@@ -46,7 +49,7 @@ fi
 # Test 3: JMW Start (from startRoutine.sh)
 echo "3. Testing JMW Start..."
 JMW_UUID=$(curl -s -X POST http://localhost:8080/start \
--H "Content-Type: application/json" \
+-H "Content-Type: application/json" -H "X-API-Key: $API_KEY" \
 -d "{
     \"executionName\": \"$EXECUTION_NAME_3\",
     \"accountId\": \"017820684888\",
@@ -107,7 +110,7 @@ fi
 # Test 4: SPA Trigger
 echo "4. Testing SPA Trigger..."
 curl -s -X POST http://localhost:4446/v1/trigger \
--H "Content-Type: application/json" \
+-H "Content-Type: application/json" -H "X-API-Key: $API_KEY" \
 -d "{
     \"accountId\": \"017820684888\",
     \"executionName\": \"$EXECUTION_NAME_3\",
@@ -130,7 +133,7 @@ fi
 echo "5. Testing SPA Schedule Creation..."
 SCHEDULE_NAME="DEMO_ROTINA_${RANDOM_ID}"
 curl -s -X POST http://localhost:4444/v1/schedule \
--H "Content-Type: application/json" \
+-H "Content-Type: application/json" -H "X-API-Key: $API_KEY" \
 -d "{
     \"acronym\": \"A5\",
     \"repo\": \"BOC_DEMO_FOLDER\",
@@ -155,7 +158,7 @@ fi
 if [ -n "$EXECUTION_UUID" ]; then
     echo "6. Testing Stop Execution..."
     curl -s -X POST http://localhost:4333/stopExecution \
-    -H "Content-Type: application/json" \
+    -H "Content-Type: application/json" -H "X-API-Key: $API_KEY" \
     -d "{
         \"executionName\": \"$EXECUTION_NAME_1\",
         \"executionUuid\": \"$EXECUTION_UUID\"
@@ -171,7 +174,7 @@ fi
 # Test 7: Health checks
 echo "7. Testing Health Checks..."
 for port in 4333 8080 8084 8085 4444 8087; do
-    response=$(curl -s http://localhost:$port/health)
+    response=$(curl -s -H "X-API-Key: $API_KEY" http://localhost:$port/health)
     if [ $? -eq 0 ]; then
         echo "✓ Service on port $port is healthy"
     else
@@ -185,17 +188,17 @@ echo "📊 VERIFICANDO DADOS CRIADOS (via microserviços):"
 echo "================================================="
 echo ""
 echo "1. Execuções na tabela (via JMI):"
-curl -s http://localhost:4333/executions | jq '{count: .count, sample_executions: .executions[0:3] | map({name: .executionName, stage: .stage, status: .status})}'
+curl -s -H "X-API-Key: $API_KEY" http://localhost:4333/executions | jq '{count: .count, sample_executions: .executions[0:3] | map({name: .executionName, stage: .stage, status: .status})}'
 echo ""
 echo "2. Tabelas disponíveis (via JMI):"
-curl -s http://localhost:4333/tables | jq '{count: .count, tables: .tables}'
+curl -s -H "X-API-Key: $API_KEY" http://localhost:4333/tables | jq '{count: .count, tables: .tables}'
 echo ""
 echo "3. Filas SQS (via JMI):"
-curl -s http://localhost:4333/queues | jq '{count: .count, queues: .queues | map({name: .name, visible: .visibleMessages, processing: .notVisibleMessages})}'
+curl -s -H "X-API-Key: $API_KEY" http://localhost:4333/queues | jq '{count: .count, queues: .queues | map({name: .name, visible: .visibleMessages, processing: .notVisibleMessages})}'
 echo ""
 echo "💡 COMANDOS ÚTEIS PARA MONITORAMENTO:"
 echo "===================================="
 echo "• ./dashboard.sh                      - Dashboard em tempo real"
-echo "• curl http://localhost:4333/executions - Ver todas as execuções"
-echo "• curl http://localhost:4333/tables     - Listar tabelas DynamoDB"
-echo "• curl http://localhost:4333/queues     - Ver status das filas SQS"
+echo "• curl -H \"X-API-Key: $API_KEY\" http://localhost:4333/executions - Ver todas as execuções"
+echo "• curl -H \"X-API-Key: $API_KEY\" http://localhost:4333/tables     - Listar tabelas DynamoDB"
+echo "• curl -H \"X-API-Key: $API_KEY\" http://localhost:4333/queues     - Ver status das filas SQS"
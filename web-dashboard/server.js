@@ -22,6 +22,10 @@ const PORT = process.env.PORT || 3000;
 const isDocker = process.env.NODE_ENV === 'production';
 const baseUrl = isDocker ? 'http://jmi:8080' : 'http://localhost:4333';
 
+// JMI answers /executions and /events only to authenticated callers; the
+// services share API_KEYS, so the same key goes to every call
+const jmiHeaders = { 'X-API-Key': process.env.JMI_API_KEY || 'local-dev-key' };
+
 // Security and performance middleware
 app.use(helmet({
   contentSecurityPolicy: false // Disable for development
@@ -65,6 +69,7 @@ async function checkServiceHealth(service) {
   try {
     const url = `http://${service.host}:${service.port}${service.endpoint}`;
     const response = await axios.get(url, {
+      headers: jmiHeaders,
       timeout: 5000
     });
     return {
@@ -116,7 +121,7 @@ function normalizeQueueData(queues) {
 // Utility function to fetch data from endpoints
 async function fetchEndpointData(url) {
   try {
-    const response = await axios.get(url, { timeout: 10000 });
+    const response = await axios.get(url, { headers: jmiHeaders, timeout: 10000 });
     const data = response.data;
     
     // Normalize data based on endpoint
@@ -233,6 +238,52 @@ app.get('*', (req, res) => {
   res.sendFile(path.join(__dirname, 'frontend/build/index.html'));
 });
 
+// Relay JMI's live event stream (SSE) to Socket.IO clients as
+// 'execution-event' and 'queue-event', reconnecting when it drops
+function subscribeToEventStream() {
+  axios.get(`${baseUrl}/events`, { headers: jmiHeaders, responseType: 'stream', timeout: 0 })
+    .then(response => {
+      console.log('Subscribed to JMI event stream');
+      let buffer = '';
+      response.data.on('data', chunk => {
+        buffer += chunk.toString();
+        let boundary;
+        while ((boundary = buffer.indexOf('\n\n')) !== -1) {
+          const block = buffer.slice(0, boundary);
+          buffer = buffer.slice(boundary + 2);
+
+          let event = 'message';
+          let data = '';
+          block.split('\n').forEach(line => {
+            if (line.startsWith('event:')) event = line.slice(6).trim();
+            else if (line.startsWith('data:')) data += line.slice(5).trim();
+          });
+          if (!data) continue; // keep-alive comments
+
+          try {
+            io.emit(`${event}-event`, JSON.parse(data));
+          } catch (error) {
+            console.error('Invalid event from JMI stream:', error.message);
+          }
+        }
+      });
+      let reconnecting = false;
+      const reconnect = () => {
+        if (reconnecting) return;
+        reconnecting = true;
+        setTimeout(subscribeToEventStream, 5000);
+      };
+      response.data.on('end', reconnect);
+      response.data.on('error', reconnect);
+    })
+    .catch(error => {
+      console.error('Error subscribing to JMI event stream:', error.message);
+      setTimeout(subscribeToEventStream, 5000);
+    });
+}
+
+subscribeToEventStream();
+
 // Socket.IO for real-time updates
 io.on('connection', (socket) => {
   console.log('Client connected:', socket.id);